@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxAuxBytes caps the total size of the .aux files returned for one compile
+const maxAuxBytes = 8 << 20
+
+// collectAuxFiles returns every .aux file in the workspace keyed by its
+// slash-separated path relative to the workspace root. Only regular files are
+// read (symlinks are skipped), and collection stops at maxAuxBytes.
+func (s *compileSession) collectAuxFiles() map[string]string {
+	auxFiles := map[string]string{}
+	total := 0
+
+	err := filepath.WalkDir(s.tempDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || !strings.EqualFold(filepath.Ext(path), ".aux") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if total+len(data) > maxAuxBytes {
+			log.Printf("[%s] Warning: .aux files exceed %d bytes, skipping %s", s.compiler.RequestID, maxAuxBytes, path)
+			return nil
+		}
+		total += len(data)
+
+		rel, err := filepath.Rel(s.tempDir, path)
+		if err != nil {
+			return err
+		}
+		auxFiles[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		log.Printf("[%s] Warning: failed to collect .aux files: %v", s.compiler.RequestID, err)
+	}
+
+	return auxFiles
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeLatexmkWithAux writes an .aux per included file, as \include does, and a
+// symlinked .aux that must not be followed.
+var fakeLatexmkWithAux = fakeLatexmkScript + `printf '\\newlabel{sec:main}{{1}{1}}\n' > "$job.aux"
+printf '\\newlabel{sec:intro}{{2}{3}}\n' > chapters/intro.aux
+ln -sf /etc/hostname escape.aux
+`
+
+func TestCompileReturnsAllAuxFiles(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithAux})
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: "\\documentclass{book}\n\\begin{document}\n\\include{chapters/intro}\n\\end{document}"},
+		{Path: "chapters/intro.tex", Content: "\\chapter{Intro}\\label{sec:intro}"},
+	}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnAllAux: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	if len(result.AuxFiles) != 2 {
+		t.Fatalf("expected main and chapter .aux files, got %v", result.AuxFiles)
+	}
+	if result.AuxFiles["main.aux"] != "\\newlabel{sec:main}{{1}{1}}\n" {
+		t.Fatalf("unexpected main.aux: %q", result.AuxFiles["main.aux"])
+	}
+	if result.AuxFiles["chapters/intro.aux"] != "\\newlabel{sec:intro}{{2}{3}}\n" {
+		t.Fatalf("unexpected chapters/intro.aux: %q", result.AuxFiles["chapters/intro.aux"])
+	}
+}
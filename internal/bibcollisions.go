@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Kinds of BibCollision
+const (
+	CollisionDuplicateKey = "duplicate-key"
+	CollisionLabel        = "label"
+)
+
+var (
+	// biberDuplicateKeyPattern matches biber's report of a key defined twice,
+	// e.g. "WARN - Duplicate entry key 'knuth84' in file 'refs.bib', skipping ..."
+	biberDuplicateKeyPattern = regexp.MustCompile(`Duplicate entry key '([^']+)' in file '([^']+)'`)
+	// bblEntryBlockPattern matches a biber .bbl record up to its \endentry
+	bblEntryBlockPattern = regexp.MustCompile(`(?s)\\entry\{([^}]+)\}\{[^}]*\}.*?\\endentry`)
+	bblFieldPattern      = regexp.MustCompile(`\\field\{(\w+)\}\{([^}]*)\}`)
+	bblNameHashPattern   = regexp.MustCompile(`\\strng\{namehash\}\{([^}]*)\}`)
+	bblFamilyPattern     = regexp.MustCompile(`family=\{([^}]*)\}`)
+)
+
+// bibCollisions returns the bibliography's duplicate keys and label
+// collisions when requested, from biber's .blg and .bbl
+func (s *compileSession) bibCollisions() []BibCollision {
+	if !s.options.ReturnBibCollisions {
+		return nil
+	}
+
+	base := strings.TrimSuffix(s.pdfPath, ".pdf")
+	collisions := []BibCollision{}
+	if blg, err := os.ReadFile(base + ".blg"); err == nil {
+		collisions = append(collisions, parseBiberDuplicateKeys(string(blg))...)
+	}
+	if bbl, err := os.ReadFile(base + ".bbl"); err == nil {
+		collisions = append(collisions, parseLabelCollisions(string(bbl))...)
+	}
+	log.Printf("[%s] Found %d bibliography collisions", s.compiler.RequestID, len(collisions))
+	return collisions
+}
+
+// parseBiberDuplicateKeys lists the keys biber found defined more than once;
+// it keeps the first definition and skips the rest
+func parseBiberDuplicateKeys(blg string) []BibCollision {
+	var collisions []BibCollision
+	seen := map[string]bool{}
+	for _, m := range biberDuplicateKeyPattern.FindAllStringSubmatch(blg, -1) {
+		if seen[m[1]+"\x00"+m[2]] {
+			continue
+		}
+		seen[m[1]+"\x00"+m[2]] = true
+		collisions = append(collisions, BibCollision{Kind: CollisionDuplicateKey, Label: m[1], Keys: []string{m[1]}, File: m[2]})
+	}
+	return collisions
+}
+
+// parseLabelCollisions groups the .bbl entries biber disambiguated with
+// extradate (authoryear styles: same names and year, "Smith 2020a/b") or
+// extraalpha (alphabetic styles: same label, "Smi20a/b")
+func parseLabelCollisions(bbl string) []BibCollision {
+	var order []string
+	groups := map[string]*BibCollision{}
+	seen := map[string]bool{}
+
+	for _, block := range bblEntryBlockPattern.FindAllStringSubmatch(bbl, -1) {
+		fields := map[string]string{}
+		for _, m := range bblFieldPattern.FindAllStringSubmatch(block[0], -1) {
+			fields[m[1]] = m[2]
+		}
+
+		var group, label string
+		switch {
+		case fields["extraalpha"] != "":
+			group, label = "alpha\x00"+fields["labelalpha"], fields["labelalpha"]
+		case fields["extradate"] != "":
+			var hash, family string
+			if m := bblNameHashPattern.FindStringSubmatch(block[0]); m != nil {
+				hash = m[1]
+			}
+			if m := bblFamilyPattern.FindStringSubmatch(block[0]); m != nil {
+				family = m[1]
+			}
+			group, label = "date\x00"+hash+"\x00"+fields["labelyear"], strings.TrimSpace(family+" "+fields["labelyear"])
+		default:
+			continue
+		}
+
+		// Entries repeat in every sorting list of the .bbl
+		key := block[1]
+		if seen[group+"\x00"+key] {
+			continue
+		}
+		seen[group+"\x00"+key] = true
+
+		if groups[group] == nil {
+			groups[group] = &BibCollision{Kind: CollisionLabel, Label: label}
+			order = append(order, group)
+		}
+		groups[group].Keys = append(groups[group].Keys, key)
+	}
+
+	var collisions []BibCollision
+	for _, group := range order {
+		if len(groups[group].Keys) > 1 {
+			collisions = append(collisions, *groups[group])
+		}
+	}
+	return collisions
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const collidingBlg = `[0] Config.pm:307> INFO - This is Biber 2.19
+[24] Utils.pm:411> WARN - Duplicate entry key 'smith2020a' in file 'refs.bib', skipping ...
+[30] Biber.pm:4215> INFO - Sorting list 'nyt/global//global/global' of type 'entry' with template 'nyt'
+`
+
+// collidingBbl is biber's output for two 2020 papers by the same author and
+// an unrelated one; biber disambiguates the first two with extradate
+const collidingBbl = `\refsection{0}
+  \datalist[entry]{nyt/global//global/global}
+    \entry{smith2020a}{article}{}
+      \name{author}{1}{}{%
+        {{hash=5d0ddb7c}{%
+           family={Smith},
+           given={Jane}}}%
+      }
+      \strng{namehash}{5d0ddb7c}
+      \field{extradate}{1}
+      \field{labelyear}{2020}
+      \field{title}{First paper}
+    \endentry
+    \entry{smith2020b}{article}{}
+      \name{author}{1}{}{%
+        {{hash=5d0ddb7c}{%
+           family={Smith},
+           given={Jane}}}%
+      }
+      \strng{namehash}{5d0ddb7c}
+      \field{extradate}{2}
+      \field{labelyear}{2020}
+      \field{title}{Second paper}
+    \endentry
+    \entry{knuth84}{article}{}
+      \name{author}{1}{}{%
+        {{hash=a1b2c3d4}{%
+           family={Knuth},
+           given={Donald}}}%
+      }
+      \strng{namehash}{a1b2c3d4}
+      \field{labelyear}{1984}
+    \endentry
+  \enddatalist
+\endrefsection
+`
+
+func TestParseBibCollisions(t *testing.T) {
+	want := []BibCollision{
+		{Kind: CollisionDuplicateKey, Label: "smith2020a", Keys: []string{"smith2020a"}, File: "refs.bib"},
+		{Kind: CollisionLabel, Label: "Smith 2020", Keys: []string{"smith2020a", "smith2020b"}},
+	}
+	got := append(parseBiberDuplicateKeys(collidingBlg), parseLabelCollisions(collidingBbl)...)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCompileReturnsBibCollisions(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript + "cat > \"$job.bbl\" <<'EOF'\n" + collidingBbl + "EOF\n"})
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: simpleDocument},
+		{Path: "refs.bib", Content: testBib},
+	}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnBibCollisions: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if len(result.BibCollisions) != 1 || result.BibCollisions[0].Label != "Smith 2020" {
+		t.Fatalf("expected the Smith 2020 label collision, got %+v", result.BibCollisions)
+	}
+}
@@ -0,0 +1,360 @@
+package internal
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	// bblEntryPattern matches biblatex's .bbl records, \entry{key}{type}{}
+	bblEntryPattern = regexp.MustCompile(`\\entry\{([^}]+)\}\{`)
+	// bibNameSeparatorPattern matches the "and" between names at the start
+	// of the rest of a name list
+	bibNameSeparatorPattern = regexp.MustCompile(`(?i)^\s+and\s+`)
+	bibYearPattern          = regexp.MustCompile(`\d{4}`)
+)
+
+// bibMonthMacros are the month abbreviations BibTeX styles predefine
+var bibMonthMacros = map[string]string{
+	"jan": "January", "feb": "February", "mar": "March", "apr": "April",
+	"may": "May", "jun": "June", "jul": "July", "aug": "August",
+	"sep": "September", "oct": "October", "nov": "November", "dec": "December",
+}
+
+// bibTeXReplacer turns the escapes common in .bib values into plain text
+var bibTeXReplacer = strings.NewReplacer(`\LaTeX`, "LaTeX", `\TeX`, "TeX", `\&`, "&", `\%`, "%", `\$`, "$", `\_`, "_", `\#`, "#", "~", " ", "---", "—", "--", "–")
+
+// bibliography returns the project's bibliography entries when requested:
+// those the build cited, in .bbl order, or every .bib entry when the build
+// wrote no .bbl
+func (s *compileSession) bibliography() []BibEntry {
+	if !s.options.ReturnBibliography {
+		return nil
+	}
+
+	entries := parseBibFiles(s.files)
+	if bbl, err := os.ReadFile(strings.TrimSuffix(s.pdfPath, ".pdf") + ".bbl"); err == nil {
+		entries = citedBibEntries(entries, string(bbl))
+	}
+	log.Printf("[%s] Parsed %d bibliography entries", s.compiler.RequestID, len(entries))
+	return entries
+}
+
+// citedBibEntries orders entries by the keys the .bbl lists, dropping the
+// ones it does not. Keys without a .bib entry (e.g. from \bibitem) are kept
+// with only their key.
+func citedBibEntries(entries []BibEntry, bbl string) []BibEntry {
+	byKey := map[string]BibEntry{}
+	for _, entry := range entries {
+		byKey[entry.Key] = entry
+	}
+
+	matches := bblEntryPattern.FindAllStringSubmatch(bbl, -1)
+	if len(matches) == 0 {
+		matches = bibitemPattern.FindAllStringSubmatch(bbl, -1)
+	}
+
+	cited := []BibEntry{}
+	seen := map[string]bool{}
+	for _, m := range matches {
+		key := strings.TrimSpace(m[1])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		entry, ok := byKey[key]
+		if !ok {
+			entry = BibEntry{Key: key}
+		}
+		cited = append(cited, entry)
+	}
+	return cited
+}
+
+// parseBibFiles parses every .bib file of the request, in file order
+func parseBibFiles(files []FileEntry) []BibEntry {
+	entries := []BibEntry{}
+	for _, file := range files {
+		if file.Encoding == "base64" || !isBibFile(file.Path) {
+			continue
+		}
+		entries = append(entries, parseBibTeX(file.Content)...)
+	}
+	return entries
+}
+
+// bibParser reads BibTeX entries. It skips what it cannot parse up to the
+// next "@", as BibTeX does.
+type bibParser struct {
+	src    string
+	pos    int
+	macros map[string]string // @string definitions, by lowercased name
+}
+
+// parseBibTeX parses the entries of one .bib file. @string macros are
+// expanded; @comment and @preamble blocks are skipped.
+func parseBibTeX(src string) []BibEntry {
+	p := &bibParser{src: src, macros: map[string]string{}}
+	var entries []BibEntry
+
+	for {
+		at := strings.IndexByte(p.src[p.pos:], '@')
+		if at < 0 {
+			return entries
+		}
+		p.pos += at + 1
+
+		entryType := strings.ToLower(p.identifier())
+		p.skipSpace()
+		if entryType == "" || p.pos >= len(p.src) || (p.src[p.pos] != '{' && p.src[p.pos] != '(') {
+			continue
+		}
+		if entryType == "comment" || entryType == "preamble" {
+			p.value()
+			continue
+		}
+		p.pos++
+
+		if entryType == "string" {
+			fields := p.fields()
+			for name, value := range fields {
+				p.macros[name] = value
+			}
+			continue
+		}
+
+		key := p.key()
+		if key == "" {
+			continue
+		}
+		entries = append(entries, newBibEntry(entryType, key, p.fields()))
+	}
+}
+
+// key reads an entry's citation key up to its comma
+func (p *bibParser) key() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(",}) \t\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	key := p.src[start:p.pos]
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == ',' {
+		p.pos++
+	}
+	return key
+}
+
+// fields reads "name = value" pairs until the entry's closing brace or
+// parenthesis. Names are lowercased.
+func (p *bibParser) fields() map[string]string {
+	fields := map[string]string{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return fields
+		}
+		switch p.src[p.pos] {
+		case '}', ')':
+			p.pos++
+			return fields
+		case ',':
+			p.pos++
+			continue
+		case '@':
+			// Unterminated entry; let the caller resume here
+			return fields
+		}
+
+		name := strings.ToLower(p.identifier())
+		p.skipSpace()
+		if name == "" || p.pos >= len(p.src) || p.src[p.pos] != '=' {
+			p.skipToNextField()
+			continue
+		}
+		p.pos++
+		fields[name] = p.value()
+	}
+}
+
+// value reads a field value: braced, quoted, numeric, or macro parts joined
+// with "#"
+func (p *bibParser) value() string {
+	var parts []string
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			break
+		}
+		switch c := p.src[p.pos]; {
+		case c == '{' || c == '(':
+			parts = append(parts, p.delimited(c, closingDelimiter(c)))
+		case c == '"':
+			parts = append(parts, p.delimited('"', '"'))
+		default:
+			word := p.identifier()
+			if word == "" {
+				return strings.Join(parts, "")
+			}
+			if expansion, ok := p.macros[strings.ToLower(word)]; ok {
+				word = expansion
+			} else if month, ok := bibMonthMacros[strings.ToLower(word)]; ok {
+				word = month
+			}
+			parts = append(parts, word)
+		}
+
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != '#' {
+			break
+		}
+		p.pos++
+	}
+	return strings.Join(parts, "")
+}
+
+// delimited reads a balanced group and returns its inner text. Nested braces
+// are kept so name lists can be split outside them.
+func (p *bibParser) delimited(open, close byte) string {
+	p.pos++
+	start, depth := p.pos, 0
+	for ; p.pos < len(p.src); p.pos++ {
+		switch c := p.src[p.pos]; {
+		case c == '\\':
+			p.pos++
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == close && depth == 0:
+			inner := p.src[start:p.pos]
+			p.pos++
+			return inner
+		}
+	}
+	return p.src[start:]
+}
+
+func closingDelimiter(open byte) byte {
+	if open == '(' {
+		return ')'
+	}
+	return '}'
+}
+
+func (p *bibParser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := rune(p.src[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("_-:.+/'", c) {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *bibParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *bibParser) skipToNextField() {
+	for p.pos < len(p.src) && !strings.ContainsRune(",})@", rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// newBibEntry picks the common fields out of an entry's raw fields
+func newBibEntry(entryType, key string, fields map[string]string) BibEntry {
+	entry := BibEntry{
+		Key:       key,
+		Type:      entryType,
+		Authors:   splitBibNames(fields["author"]),
+		Editors:   splitBibNames(fields["editor"]),
+		Title:     cleanBibValue(fields["title"]),
+		Journal:   cleanBibValue(firstNonEmpty(fields["journal"], fields["journaltitle"])),
+		Booktitle: cleanBibValue(fields["booktitle"]),
+		Publisher: cleanBibValue(firstNonEmpty(fields["publisher"], fields["institution"], fields["school"])),
+		Volume:    cleanBibValue(fields["volume"]),
+		Number:    cleanBibValue(fields["number"]),
+		Pages:     cleanBibValue(fields["pages"]),
+		DOI:       cleanBibValue(fields["doi"]),
+		URL:       cleanBibValue(fields["url"]),
+		Fields:    map[string]string{},
+	}
+
+	// biblatex's date field stands in for year
+	if year := cleanBibValue(fields["year"]); year != "" {
+		entry.Year = year
+	} else if m := bibYearPattern.FindString(fields["date"]); m != "" {
+		entry.Year = m
+	}
+
+	for name, value := range fields {
+		entry.Fields[name] = cleanBibValue(value)
+	}
+	return entry
+}
+
+// splitBibNames splits an author or editor list on "and" at brace depth 0
+// and writes "Last, First" names as "First Last"
+func splitBibNames(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	var names []string
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		if depth != 0 {
+			continue
+		}
+		if loc := bibNameSeparatorPattern.FindStringIndex(value[i:]); loc != nil && i > start {
+			names = append(names, value[start:i])
+			i += loc[1] - 1
+			start = i + 1
+		}
+	}
+	names = append(names, value[start:])
+
+	var cleaned []string
+	for _, name := range names {
+		name = cleanBibValue(name)
+		if last, first, ok := strings.Cut(name, ","); ok && !strings.Contains(first, ",") {
+			name = strings.TrimSpace(first) + " " + strings.TrimSpace(last)
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			cleaned = append(cleaned, name)
+		}
+	}
+	return cleaned
+}
+
+// cleanBibValue drops grouping braces and common TeX escapes and collapses
+// whitespace
+func cleanBibValue(value string) string {
+	value = bibTeXReplacer.Replace(value)
+	value = strings.NewReplacer("{", "", "}", "").Replace(value)
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testBib = `@string{tugboat = "TUGboat"}
+
+@comment{Exported from a reference manager}
+
+@article{knuth84,
+  author  = {Knuth, Donald E. and {The {\TeX} Users Group}},
+  title   = {Literate {P}rogramming},
+  journal = tugboat # " Journal",
+  year    = 1984,
+  month   = may,
+  pages   = "97--111",
+}
+
+@book(lamport94, author = "Leslie Lamport", title = {{\LaTeX}: A Document Preparation System}, date = {1994-06})
+`
+
+func TestParseBibTeXArticle(t *testing.T) {
+	entries := parseBibTeX(testBib)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+
+	article := entries[0]
+	if article.Key != "knuth84" || article.Type != "article" {
+		t.Fatalf("unexpected entry %q of type %q", article.Key, article.Type)
+	}
+	if want := []string{"Donald E. Knuth", "The TeX Users Group"}; !reflect.DeepEqual(article.Authors, want) {
+		t.Fatalf("expected authors %q, got %q", want, article.Authors)
+	}
+	if article.Title != "Literate Programming" || article.Year != "1984" {
+		t.Fatalf("expected title and year, got %q (%q)", article.Title, article.Year)
+	}
+	if article.Journal != "TUGboat Journal" || article.Pages != "97–111" || article.Fields["month"] != "May" {
+		t.Fatalf("unexpected journal %q, pages %q, month %q", article.Journal, article.Pages, article.Fields["month"])
+	}
+
+	book := entries[1]
+	if book.Key != "lamport94" || book.Year != "1994" || book.Title != "LaTeX: A Document Preparation System" {
+		t.Fatalf("unexpected book entry %+v", book)
+	}
+}
+
+func TestCitedBibEntriesFollowBbl(t *testing.T) {
+	entries := parseBibTeX(testBib)
+
+	bbl := "\\begin{thebibliography}{1}\n\\bibitem{lamport94}\nL.~Lamport.\n\\bibitem[Knu]{missing}\n\\end{thebibliography}\n"
+	cited := citedBibEntries(entries, bbl)
+	if len(cited) != 2 || cited[0].Key != "lamport94" || cited[1].Key != "missing" || cited[1].Type != "" {
+		t.Fatalf("expected the .bbl's keys in order, got %+v", cited)
+	}
+
+	bbl = "\\entry{knuth84}{article}{}\n  \\field{title}{Literate Programming}\n\\endentry\n"
+	if cited := citedBibEntries(entries, bbl); len(cited) != 1 || cited[0].Title != "Literate Programming" {
+		t.Fatalf("expected the biblatex entry, got %+v", cited)
+	}
+}
+
+func TestCompileReturnsBibliography(t *testing.T) {
+	// The fake bibtex run cites knuth84 only
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript + `printf '\\bibitem{knuth84}\n' > "$job.bbl"
+`})
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: simpleDocument},
+		{Path: "refs.bib", Content: testBib},
+	}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnBibliography: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if len(result.Bibliography) != 1 || result.Bibliography[0].Key != "knuth84" || result.Bibliography[0].Authors[0] != "Donald E. Knuth" {
+		t.Fatalf("expected only the cited entry, got %+v", result.Bibliography)
+	}
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BibValidationTimeout bounds the biber runs of one validation request
+const BibValidationTimeout = 30 * time.Second
+
+var (
+	// biberDatamodelPattern matches data-model violations, e.g. "WARN -
+	// Datamodel: article entry 'knuth84' (refs.bib): Missing mandatory field 'author'"
+	biberDatamodelPattern = regexp.MustCompile(`^(WARN|ERROR) - Datamodel: (?:\w+ )?[Ee]ntry '([^']+)' \([^)]*\): (.+)$`)
+	// biberSyntaxPattern matches btparse reports, which name biber's UTF-8
+	// copy of the file, e.g. "ERROR - BibTeX subsystem: /tmp/biber_tmp_x/refs.bib_1.utf8,
+	// line 4, syntax error: found "title", expected end of entry"
+	biberSyntaxPattern = regexp.MustCompile(`^(WARN|ERROR) - BibTeX subsystem: .*?, line (\d+), (.+)$`)
+	biberFieldPattern  = regexp.MustCompile(`[Ff]ield[^']*'([^']+)'`)
+)
+
+// validateBibFiles runs biber's data-model validation on each .bib file in
+// its own run, so every issue belongs to a known file. The runs take one
+// standalone slot and are held to the compile limits.
+func validateBibFiles(ctx context.Context, files []FileEntry) (*BibValidationResponse, error) {
+	if _, err := exec.LookPath("biber"); err != nil {
+		return nil, fmt.Errorf("%w: biber is not installed", ErrBibValidationUnavailable)
+	}
+
+	release, err := acquireStandaloneSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, BibValidationTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "bibcheck-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBibValidationFailed, err)
+	}
+	defer os.RemoveAll(dir)
+
+	resp := &BibValidationResponse{Valid: true, Issues: []BibIssue{}}
+	for i, file := range files {
+		if !isBibFile(file.Path) {
+			continue
+		}
+		resp.FileCount++
+
+		// Numbered names keep request paths out of the filesystem
+		name := fmt.Sprintf("input-%d.bib", i)
+		if err := writeFile(dir, FileEntry{Path: name, Content: file.Content, Encoding: file.Encoding}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBibValidationFailed, err)
+		}
+
+		cmd := standaloneCommand(ctx, "biber", "--tool", "--validate-datamodel", "--nolog", name)
+		cmd.Dir = dir
+		// biber exits non-zero when it reports errors, which are the point here
+		output, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: biber timed out on %s", ErrBibValidationFailed, file.Path)
+		}
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			return nil, fmt.Errorf("%w: biber: %v", ErrBibValidationFailed, err)
+		}
+
+		for _, issue := range parseBiberOutput(string(output), file) {
+			if issue.Severity == "error" {
+				resp.Valid = false
+			}
+			resp.Issues = append(resp.Issues, issue)
+		}
+	}
+	return resp, nil
+}
+
+// parseBiberOutput collects the syntax errors and data-model violations
+// biber reported for file, locating them by entry key or line
+func parseBiberOutput(output string, file FileEntry) []BibIssue {
+	entries := bibEntryLines(file.Content)
+
+	var issues []BibIssue
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if m := biberDatamodelPattern.FindStringSubmatch(line); m != nil {
+			issues = append(issues, BibIssue{
+				File:     file.Path,
+				Line:     entryLine(entries, m[2]),
+				Key:      m[2],
+				Field:    biberField(m[3]),
+				Severity: biberSeverity(m[1]),
+				Message:  m[3],
+			})
+			continue
+		}
+
+		if m := biberSyntaxPattern.FindStringSubmatch(line); m != nil {
+			lineNo, _ := strconv.Atoi(m[2])
+			issues = append(issues, BibIssue{
+				File:     file.Path,
+				Line:     lineNo,
+				Key:      entryAtLine(entries, lineNo),
+				Field:    biberField(m[3]),
+				Severity: biberSeverity(m[1]),
+				Message:  m[3],
+			})
+		}
+	}
+	return issues
+}
+
+// bibEntry is the key and starting line of a .bib entry
+type bibEntry struct {
+	Key  string
+	Line int
+}
+
+func bibEntryLines(content string) []bibEntry {
+	var entries []bibEntry
+	for _, loc := range bibEntryPattern.FindAllStringSubmatchIndex(content, -1) {
+		if bibNonEntryTypes[strings.ToLower(content[loc[2]:loc[3]])] {
+			continue
+		}
+		entries = append(entries, bibEntry{Key: content[loc[4]:loc[5]], Line: lineNumberAt(content, loc[0])})
+	}
+	return entries
+}
+
+func entryLine(entries []bibEntry, key string) int {
+	for _, entry := range entries {
+		if entry.Key == key {
+			return entry.Line
+		}
+	}
+	return 0
+}
+
+// entryAtLine returns the key of the last entry starting at or before line
+func entryAtLine(entries []bibEntry, line int) string {
+	key := ""
+	for _, entry := range entries {
+		if entry.Line > line {
+			break
+		}
+		key = entry.Key
+	}
+	return key
+}
+
+func isBibFile(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".bib")
+}
+
+func hasBibFile(files []FileEntry) bool {
+	for _, file := range files {
+		if isBibFile(file.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func biberField(message string) string {
+	if m := biberFieldPattern.FindStringSubmatch(message); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func biberSeverity(level string) string {
+	if level == "ERROR" {
+		return "error"
+	}
+	return "warning"
+}
+
+// BibValidationHandler checks the request's .bib files for syntax errors and
+// entries violating biblatex's data model, without compiling
+func BibValidationHandler(c *gin.Context) {
+	files, ok := bindRequestFiles(c)
+	if !ok {
+		return
+	}
+
+	if !hasBibFile(files) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: "Provide at least one .bib file",
+		})
+		return
+	}
+
+	resp, err := validateBibFiles(c.Request.Context(), files)
+	if err != nil {
+		log.Printf("Bibliography validation failed: %v", err)
+		c.JSON(errorStatus(errorCode(err)), ErrorResponse{
+			Error:   "Bibliography validation failed",
+			Code:    errorCode(err),
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const brokenBib = `@article{knuth84,
+  title = {Literate Programming},
+  year = {1984}
+}
+
+@book{lamport94,
+  author = {Leslie Lamport}
+  title = {LaTeX}
+}`
+
+const biberOutput = `INFO - This is Biber 2.19
+INFO - Globbing data source 'input-0.bib'
+WARN - Datamodel: article entry 'knuth84' (input-0.bib): Missing mandatory field 'author'
+ERROR - BibTeX subsystem: /tmp/biber_tmp_Xy/input-0.bib_123.utf8, line 8, syntax error: found "title", expected end of entry ("}" or ")") (skipping to next "@")
+INFO - WARNINGS: 1
+`
+
+func TestParseBiberOutput(t *testing.T) {
+	issues := parseBiberOutput(biberOutput, FileEntry{Path: "refs/main.bib", Content: brokenBib})
+	want := []BibIssue{
+		{File: "refs/main.bib", Line: 1, Key: "knuth84", Field: "author", Severity: "warning", Message: "Missing mandatory field 'author'"},
+		{File: "refs/main.bib", Line: 8, Key: "lamport94", Severity: "error", Message: `syntax error: found "title", expected end of entry ("}" or ")") (skipping to next "@")`},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %+v", len(want), issues)
+	}
+	for i := range want {
+		if issues[i] != want[i] {
+			t.Fatalf("issue %d: expected %+v, got %+v", i, want[i], issues[i])
+		}
+	}
+}
+
+func TestBibValidationHandler(t *testing.T) {
+	installFakeTools(t, map[string]string{"biber": "cat <<'EOF'\n" + biberOutput + "EOF\nexit 2\n"})
+
+	recorder := performJSON(t, http.MethodPost, "/validate-bib", BibValidationHandler, SourceRequest{
+		Files: []FileEntry{
+			{Path: "main.tex", Content: simpleDocument},
+			{Path: "refs.bib", Content: brokenBib},
+		},
+	})
+	assertStatus(t, recorder, http.StatusOK)
+
+	var resp BibValidationResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Valid || resp.FileCount != 1 || len(resp.Issues) != 2 || resp.Issues[1].Key != "lamport94" {
+		t.Fatalf("expected an invalid file with 2 issues, got %+v", resp)
+	}
+}
+
+func TestBibValidationHandlerRequiresBibFile(t *testing.T) {
+	recorder := performJSON(t, http.MethodPost, "/validate-bib", BibValidationHandler, SourceRequest{
+		Content: simpleDocument,
+	})
+	assertStatus(t, recorder, http.StatusBadRequest)
+}
@@ -4,7 +4,9 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"log"
+	"net/url"
 	"os"
+	"sort"
 	"sync"
 	"time"
 )
@@ -15,23 +17,44 @@ const (
 	CleanupInterval     = 5 * time.Minute   // Run cleanup every 5 minutes
 )
 
+// maxCachedProjectsPerClient caps how many cache slots one client may hold;
+// 0 disables the per-client cap
+var maxCachedProjectsPerClient int
+
+// SetMaxCachedProjectsPerClient sets the per-client share of the cache (0 = no cap)
+func SetMaxCachedProjectsPerClient(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	maxCachedProjectsPerClient = limit
+}
+
 // CacheEntry represents a cached compilation for a project
 type CacheEntry struct {
 	ProjectID      string
+	ClientID       string // Client (IP) that created the entry, for per-client caps
 	TempDir        string
 	FileHashes     map[string]string // path -> hash
 	ContentHash    string            // Hash of all file content
+	BibHash        string            // Hash of bibliography inputs (.bib files + cited keys)
 	LastPDFData    []byte
 	LastSHA256     string
+	LastVisualHash string
+	LastUndefined  UndefinedReferences // Unresolved refs of the cached PDF
+	LastText       *PDFText            // Text layer of the cached PDF, when a build extracted it
+	LastWarnings   []LatexWarning      // Log warnings of the build that produced the cached PDF
+	LastSummary    *WarningSummary     // Warning categories of that build's log
 	LastAccessTime time.Time
 	mutex          sync.Mutex // Lock for this cache entry
 }
 
 // CompilationCache manages cached compilation directories
 type CompilationCache struct {
-	entries      map[string]*CacheEntry // projectID -> CacheEntry
-	projectLocks map[string]*sync.Mutex // projectID -> lock for serializing requests
-	globalMutex  sync.RWMutex           // Protects the maps
+	entries      map[string]*CacheEntry      // projectID -> CacheEntry
+	projectLocks map[string]*sync.Mutex      // projectID -> lock for serializing requests
+	globalMutex  sync.RWMutex                // Protects the maps
+	inflight     map[string]*inflightCompile // project + content hash -> the compile building it, see coalesce.go
+	inflightMu   sync.Mutex                  // Protects inflight
 }
 
 var globalCache *CompilationCache
@@ -43,6 +66,7 @@ func GetCache() *CompilationCache {
 		globalCache = &CompilationCache{
 			entries:      make(map[string]*CacheEntry),
 			projectLocks: make(map[string]*sync.Mutex),
+			inflight:     make(map[string]*inflightCompile),
 		}
 		// Start cleanup goroutine
 		go globalCache.cleanupLoop()
@@ -108,6 +132,14 @@ func (c *CompilationCache) Set(projectID string, entry *CacheEntry) {
 	c.globalMutex.Lock()
 	defer c.globalMutex.Unlock()
 
+	// A client over its share evicts its own oldest entry rather than another
+	// tenant's warm directory
+	if _, exists := c.entries[projectID]; !exists && maxCachedProjectsPerClient > 0 && entry.ClientID != "" {
+		if c.countClientEntriesLocked(entry.ClientID) >= maxCachedProjectsPerClient {
+			c.evictOldestForClientLocked(entry.ClientID)
+		}
+	}
+
 	// Check if we need to evict (LRU)
 	if len(c.entries) >= MaxCachedProjects {
 		// Don't evict if we're updating an existing entry
@@ -132,6 +164,45 @@ func (c *CompilationCache) CheckContentHash(projectID, contentHash string) bool
 	return entry.ContentHash == contentHash
 }
 
+// CachedPDF is a consistent copy of an entry's last PDF and its metadata.
+// Entries replace LastPDFData rather than writing into it, so Data can be
+// shared without copying.
+type CachedPDF struct {
+	Data       []byte
+	SHA256     string
+	VisualHash string
+	Undefined  UndefinedReferences
+	Text       *PDFText
+	Warnings   []LatexWarning
+	Summary    *WarningSummary
+}
+
+// LookupPDF returns the project's cached PDF when it was built from
+// contentHash. The hash check and the read happen under the entry's lock, so
+// a concurrent clean or compile cannot hand out a mismatched PDF and hash.
+func (c *CompilationCache) LookupPDF(projectID, contentHash string) (CachedPDF, bool) {
+	entry, exists := c.Get(projectID)
+	if !exists {
+		return CachedPDF{}, false
+	}
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	if entry.ContentHash != contentHash || len(entry.LastPDFData) == 0 {
+		return CachedPDF{}, false
+	}
+	return CachedPDF{
+		Data:       entry.LastPDFData,
+		SHA256:     entry.LastSHA256,
+		VisualHash: entry.LastVisualHash,
+		Undefined:  entry.LastUndefined,
+		Text:       entry.LastText,
+		Warnings:   entry.LastWarnings,
+		Summary:    entry.LastSummary,
+	}, true
+}
+
 // evictOldestLocked evicts the oldest cache entry (must be called with globalMutex held)
 func (c *CompilationCache) evictOldestLocked() {
 	var oldestID string
@@ -154,6 +225,43 @@ func (c *CompilationCache) evictOldestLocked() {
 	}
 }
 
+// countClientEntriesLocked counts the entries owned by a client (must be called with globalMutex held)
+func (c *CompilationCache) countClientEntriesLocked(clientID string) int {
+	count := 0
+	for _, entry := range c.entries {
+		if entry.ClientID == clientID {
+			count++
+		}
+	}
+	return count
+}
+
+// evictOldestForClientLocked evicts a client's least recently used entry (must be called with globalMutex held)
+func (c *CompilationCache) evictOldestForClientLocked(clientID string) {
+	var oldestID string
+	var oldestTime time.Time
+
+	for id, entry := range c.entries {
+		if entry.ClientID != clientID {
+			continue
+		}
+
+		entry.mutex.Lock()
+		accessTime := entry.LastAccessTime
+		entry.mutex.Unlock()
+
+		if oldestID == "" || accessTime.Before(oldestTime) {
+			oldestID = id
+			oldestTime = accessTime
+		}
+	}
+
+	if oldestID != "" {
+		c.removeEntryLocked(oldestID)
+		log.Printf("[CACHE] Evicted oldest entry for client %s: %s (per-client limit)", clientID, oldestID)
+	}
+}
+
 // removeEntryLocked removes a cache entry and cleans up resources (must be called with globalMutex held)
 func (c *CompilationCache) removeEntryLocked(projectID string) {
 	if entry, exists := c.entries[projectID]; exists {
@@ -227,6 +335,67 @@ func (c *CompilationCache) Stats() map[string]interface{} {
 	}
 }
 
+// CacheProjectStats describes one cached project, as listed by GET /cache/stats
+type CacheProjectStats struct {
+	ProjectID      string    `json:"projectId"`
+	ClientID       string    `json:"clientId,omitempty"`
+	LastAccessTime time.Time `json:"lastAccessTime"`
+	IdleSeconds    int64     `json:"idleSeconds"`
+	PDFSize        int       `json:"pdfSize"`    // 0 when only the workspace is cached
+	HasTempDir     bool      `json:"hasTempDir"` // Whether the workspace is still on disk
+}
+
+// ProjectStats returns the cached projects, least recently used first
+func (c *CompilationCache) ProjectStats() []CacheProjectStats {
+	var tempDirs []string
+	projects := []CacheProjectStats{}
+
+	c.globalMutex.RLock()
+	for id, entry := range c.entries {
+		entry.mutex.Lock()
+		projects = append(projects, CacheProjectStats{
+			ProjectID:      id,
+			ClientID:       entry.ClientID,
+			LastAccessTime: entry.LastAccessTime,
+			PDFSize:        len(entry.LastPDFData),
+		})
+		tempDirs = append(tempDirs, entry.TempDir)
+		entry.mutex.Unlock()
+	}
+	c.globalMutex.RUnlock()
+
+	// Stat the workspaces without holding the locks
+	now := time.Now()
+	for i := range projects {
+		projects[i].IdleSeconds = int64(now.Sub(projects[i].LastAccessTime).Seconds())
+		if tempDirs[i] != "" {
+			if info, err := os.Stat(tempDirs[i]); err == nil && info.IsDir() {
+				projects[i].HasTempDir = true
+			}
+		}
+	}
+
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].LastAccessTime.Before(projects[j].LastAccessTime)
+	})
+	return projects
+}
+
+// CacheKey scopes a project ID to a cache namespace so tenants reusing the
+// same project ID never share entries or locks. The namespace is escaped so
+// the first "/" always separates it from the project ID. Without a namespace
+// the project ID itself is escaped, so the key has no "/" and cannot name
+// another namespace's project.
+func CacheKey(namespace, projectID string) string {
+	if projectID == "" {
+		return ""
+	}
+	if namespace == "" {
+		return url.QueryEscape(projectID)
+	}
+	return url.QueryEscape(namespace) + "/" + projectID
+}
+
 // HashFileContent generates a SHA256 hash of file content
 func HashFileContent(content string) string {
 	hash := sha256.Sum256([]byte(content))
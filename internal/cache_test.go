@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCache() *CompilationCache {
+	return &CompilationCache{
+		entries:      make(map[string]*CacheEntry),
+		projectLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+func TestCacheEvictsOnlyOwnEntriesOverClientShare(t *testing.T) {
+	SetMaxCachedProjectsPerClient(3)
+	t.Cleanup(func() { SetMaxCachedProjectsPerClient(0) })
+
+	cache := newTestCache()
+	cache.Set("other-1", &CacheEntry{ProjectID: "other-1", ClientID: "10.0.0.2"})
+	time.Sleep(time.Millisecond)
+
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("churn-%d", i)
+		cache.Set(id, &CacheEntry{ProjectID: id, ClientID: "10.0.0.1"})
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, ok := cache.Get("other-1"); !ok {
+		t.Fatalf("another client's entry must not be evicted by churn")
+	}
+	if n := cache.countClientEntriesLocked("10.0.0.1"); n != 3 {
+		t.Fatalf("expected churning client to hold 3 entries, got %d", n)
+	}
+	for _, id := range []string{"churn-0", "churn-1", "churn-2"} {
+		if _, ok := cache.Get(id); ok {
+			t.Fatalf("expected oldest entry %s to be evicted", id)
+		}
+	}
+}
+
+func TestCacheNamespacesIsolateSameProjectID(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	forgetProject(t, CacheKey("tenant-a", "shared-project"))
+	forgetProject(t, CacheKey("tenant-b", "shared-project"))
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	compile := func(namespace string) *CompileResult {
+		result := New().Compile(files, time.Now(), "shared-project", CompileOptions{CacheNamespace: namespace})
+		if !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+		return result
+	}
+
+	compile("tenant-a")
+	if result := compile("tenant-b"); result.CacheHit {
+		t.Fatalf("tenant-b must not be served tenant-a's cached PDF")
+	}
+	if result := compile("tenant-a"); !result.CacheHit {
+		t.Fatalf("expected tenant-a's own entry to be a cache hit")
+	}
+
+	entryA, okA := GetCache().Get(CacheKey("tenant-a", "shared-project"))
+	entryB, okB := GetCache().Get(CacheKey("tenant-b", "shared-project"))
+	if !okA || !okB {
+		t.Fatalf("expected separate cache entries per namespace")
+	}
+	if entryA.TempDir == entryB.TempDir {
+		t.Fatalf("expected namespaces to use separate workspaces")
+	}
+}
+
+func TestCacheKeyEscapesNamespace(t *testing.T) {
+	if CacheKey("a/b", "c") == CacheKey("a", "b/c") {
+		t.Fatalf("namespace and project ID must not be ambiguous")
+	}
+	if CacheKey("", "project") != "project" {
+		t.Fatalf("empty namespace must leave a plain project ID unchanged")
+	}
+	if CacheKey("", "a/b") == CacheKey("a", "b") {
+		t.Fatalf("a project ID without a namespace must not reach another namespace")
+	}
+}
+
+func TestCacheStatsHandlerListsProjects(t *testing.T) {
+	forgetProject(t, "stats-warm")
+	forgetProject(t, "stats-gone")
+	workspace := t.TempDir()
+	GetCache().Set("stats-gone", &CacheEntry{ProjectID: "stats-gone", TempDir: workspace + "/removed"})
+	GetCache().Set("stats-warm", &CacheEntry{ProjectID: "stats-warm", TempDir: workspace, LastPDFData: []byte("%PDF-1.4")})
+
+	// Compiles update entries while the stats are read
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			GetCache().Get("stats-warm")
+		}
+	}()
+	recorder := performJSON(t, "GET", "/cache/stats", CacheStatsHandler, nil)
+	<-done
+	assertStatus(t, recorder, http.StatusOK)
+
+	var stats struct {
+		Entries    int                 `json:"entries"`
+		MaxEntries int                 `json:"maxEntries"`
+		Projects   []CacheProjectStats `json:"projects"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if stats.MaxEntries != MaxCachedProjects || stats.Entries != len(stats.Projects) {
+		t.Fatalf("unexpected totals: %+v", stats)
+	}
+
+	byID := map[string]CacheProjectStats{}
+	for _, project := range stats.Projects {
+		byID[project.ProjectID] = project
+	}
+	if warm := byID["stats-warm"]; !warm.HasTempDir || warm.PDFSize != 8 || warm.LastAccessTime.IsZero() {
+		t.Fatalf("unexpected stats for the warm project: %+v", warm)
+	}
+	if gone, ok := byID["stats-gone"]; !ok || gone.HasTempDir {
+		t.Fatalf("expected the project with a removed workspace to report no temp dir: %+v", gone)
+	}
+}
+
+// Run with -race: serving the cached PDF must not race with compiles
+// replacing the entry or a clean clearing it
+func TestCacheLookupPDFConcurrentWithSetAndClean(t *testing.T) {
+	cache := newTestCache()
+	tempDir := t.TempDir()
+	const projectID = "concurrent-pdf"
+
+	set := func(i int) {
+		pdf := []byte(fmt.Sprintf("%%PDF-1.5 build %d", i))
+		cache.Set(projectID, &CacheEntry{
+			ProjectID:   projectID,
+			TempDir:     tempDir,
+			ContentHash: "hash",
+			LastPDFData: pdf,
+			LastSHA256:  fmt.Sprintf("%x", sha256.Sum256(pdf)),
+		})
+	}
+	set(0)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				set(i)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				cache.cleanWorkspace(projectID)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				cached, ok := cache.LookupPDF(projectID, "hash")
+				if ok && cached.SHA256 != fmt.Sprintf("%x", sha256.Sum256(cached.Data)) {
+					t.Errorf("cached PDF does not match its hash %s", cached.SHA256)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	set(1)
+	if _, ok := cache.LookupPDF(projectID, "other"); ok {
+		t.Fatalf("a PDF built from other content must not be served")
+	}
+	if cached, ok := cache.LookupPDF(projectID, "hash"); !ok || string(cached.Data) != "%PDF-1.5 build 1" {
+		t.Fatalf("expected the latest cached PDF, got %q", cached.Data)
+	}
+}
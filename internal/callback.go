@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	CallbackTimeout     = 10 * time.Second
+	CallbackMaxAttempts = 3
+	CallbackRetryDelay  = 2 * time.Second
+)
+
+// callbackAllowedHosts lists the hosts that may receive compile callbacks;
+// callbacks are rejected when it is empty
+var callbackAllowedHosts map[string]bool
+
+// callbackIPAllowed decides whether a callback may connect to ip. Tests swap it
+// to reach a local receiver.
+var callbackIPAllowed = isPublicIP
+
+// SetCallbackAllowedHosts sets the hosts allowed as callback URL targets
+func SetCallbackAllowedHosts(hosts []string) {
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			allowed[host] = true
+		}
+	}
+	callbackAllowedHosts = allowed
+}
+
+// validateCallbackURL checks the scheme, allowlist and resolved addresses of a
+// callback URL before a job is accepted
+func validateCallbackURL(raw string) (*url.URL, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid callback URL: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("callback URL must use http or https")
+	}
+	if parsed.User != nil {
+		return nil, fmt.Errorf("callback URL must not contain credentials")
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if len(callbackAllowedHosts) == 0 {
+		return nil, fmt.Errorf("callbacks are not enabled on this server")
+	}
+	if !callbackAllowedHosts[host] {
+		return nil, fmt.Errorf("callback host %q is not allowed", host)
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve callback host %q: %v", host, err)
+	}
+	for _, ip := range ips {
+		if !callbackIPAllowed(ip) {
+			return nil, fmt.Errorf("callback host %q resolves to a disallowed address", host)
+		}
+	}
+
+	return parsed, nil
+}
+
+// isPublicIP rejects loopback, private, link-local and other internal ranges
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// callbackClient re-checks the address actually dialed so a DNS change after
+// validation cannot redirect the callback to an internal host
+var callbackClient = &http.Client{
+	Timeout: CallbackTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: CallbackTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !callbackIPAllowed(ip) {
+					return fmt.Errorf("callback address %s is not allowed", address)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// startAsyncCompile queues the job, answers 202 immediately and delivers the
+// result to the callback URL once the worker finishes. A failed compile's
+// partial PDF is delivered only when partialPDF is set.
+func startAsyncCompile(c *gin.Context, job *CompileJob, rawURL string, partialPDF bool) {
+	callbackURL, err := validateCallbackURL(rawURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	job.RequestID = uuid.New().String()
+	job.Context = nil // The handler returns before the job runs
+	job.Options.Progress = asyncProgress.update
+	asyncProgress.update(ProgressEvent{RequestID: job.RequestID, Stage: StageQueued})
+
+	if err := enqueueJob(job); err != nil {
+		asyncProgress.remove(job.RequestID)
+		c.JSON(errorStatus(errorCode(err)), ErrorResponse{
+			Error:   "Server busy",
+			Code:    errorCode(err),
+			Message: err.Error(),
+		})
+		return
+	}
+
+	go func() {
+		result := <-job.ResultChan
+		asyncProgress.expire(job.RequestID)
+		deliverCallback(callbackURL.String(), buildCallbackPayload(job.RequestID, result, partialPDF))
+	}()
+
+	c.JSON(http.StatusAccepted, AsyncCompileResponse{
+		RequestID: job.RequestID,
+		Status:    "queued",
+	})
+}
+
+func buildCallbackPayload(requestID string, result *CompileResult, partialPDF bool) CallbackPayload {
+	payload := CallbackPayload{
+		RequestID:  requestID,
+		Status:     "success",
+		SHA256:     result.SHA256,
+		PDFSize:    result.PDFSize,
+		Memory:     result.Memory,
+		QueueMs:    result.QueueMs,
+		DurationMs: result.DurationMs,
+	}
+
+	if !result.Success {
+		payload.Status = "error"
+		payload.Error = result.ErrorMessage
+		payload.Code = result.ErrorCode
+		payload.Log = result.LogTail
+	}
+	if len(result.PDFData) > 0 && (result.Success || partialPDF) {
+		payload.PdfBuffer = base64.StdEncoding.EncodeToString(result.PDFData)
+	}
+
+	return payload
+}
+
+// deliverCallback POSTs the payload, retrying on transport errors and 5xx
+func deliverCallback(callbackURL string, payload CallbackPayload) bool {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[%s] Failed to marshal callback payload: %v", payload.RequestID, err)
+		return false
+	}
+
+	for attempt := 1; attempt <= CallbackMaxAttempts; attempt++ {
+		status, err := postCallback(callbackURL, body)
+		switch {
+		case err == nil && status < 300:
+			log.Printf("[%s] Callback delivered (HTTP %d, attempt %d)", payload.RequestID, status, attempt)
+			return true
+		case err == nil && status < 500:
+			log.Printf("[%s] Callback rejected with HTTP %d; not retrying", payload.RequestID, status)
+			return false
+		case err != nil:
+			log.Printf("[%s] Callback attempt %d failed: %v", payload.RequestID, attempt, err)
+		default:
+			log.Printf("[%s] Callback attempt %d got HTTP %d", payload.RequestID, attempt, status)
+		}
+
+		if attempt < CallbackMaxAttempts {
+			time.Sleep(CallbackRetryDelay * time.Duration(attempt))
+		}
+	}
+
+	log.Printf("[%s] Giving up on callback after %d attempts", payload.RequestID, CallbackMaxAttempts)
+	return false
+}
+
+func postCallback(callbackURL string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), CallbackTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAsyncCompileDeliversCallback(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	received := make(chan CallbackPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload CallbackPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode callback payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	SetCallbackAllowedHosts([]string{"127.0.0.1"})
+	callbackIPAllowed = func(net.IP) bool { return true }
+	t.Cleanup(func() {
+		SetCallbackAllowedHosts(nil)
+		callbackIPAllowed = isPublicIP
+	})
+
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:       []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		CallbackURL: receiver.URL + "/done",
+	})
+	assertStatus(t, recorder, http.StatusAccepted)
+
+	var ack AsyncCompileResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &ack); err != nil || ack.RequestID == "" {
+		t.Fatalf("expected requestId in 202 response, got %s", recorder.Body.String())
+	}
+
+	select {
+	case payload := <-received:
+		if payload.RequestID != ack.RequestID || payload.Status != "success" || payload.SHA256 == "" || payload.PdfBuffer == "" {
+			t.Fatalf("unexpected callback payload: %+v", payload)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("callback was not delivered")
+	}
+
+	progress := performProgress(t, ack.RequestID)
+	assertStatus(t, progress, http.StatusOK)
+	var event ProgressEvent
+	if err := json.Unmarshal(progress.Body.Bytes(), &event); err != nil || event.Stage != StageDone || event.Percent != 100 {
+		t.Fatalf("expected finished progress, got %s", progress.Body.String())
+	}
+}
+
+func TestValidateCallbackURLRejectsInternalAddresses(t *testing.T) {
+	SetCallbackAllowedHosts([]string{"127.0.0.1", "localhost"})
+	t.Cleanup(func() { SetCallbackAllowedHosts(nil) })
+
+	for _, raw := range []string{"http://127.0.0.1/hook", "http://localhost:8080/hook", "ftp://127.0.0.1/", "http://example.com/hook"} {
+		if _, err := validateCallbackURL(raw); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+
+	if isPublicIP(net.ParseIP("10.1.2.3")) || isPublicIP(net.ParseIP("169.254.169.254")) {
+		t.Fatalf("expected private and link-local addresses to be rejected")
+	}
+}
+
+func TestCallbackPayloadHonoursPartialPdfOnError(t *testing.T) {
+	failed := &CompileResult{ErrorMessage: "LaTeX Error", PDFData: []byte("%PDF-partial")}
+	if payload := buildCallbackPayload("req", failed, false); payload.Status != "error" || payload.PdfBuffer != "" {
+		t.Fatalf("expected no partial PDF when partialPdfOnError is false, got %+v", payload)
+	}
+	if payload := buildCallbackPayload("req", failed, true); payload.PdfBuffer == "" {
+		t.Fatalf("expected the partial PDF by default")
+	}
+
+	succeeded := &CompileResult{Success: true, PDFData: []byte("%PDF-1.5")}
+	if payload := buildCallbackPayload("req", succeeded, false); payload.PdfBuffer == "" {
+		t.Fatalf("expected a successful compile's PDF regardless of partialPdfOnError")
+	}
+}
+
+func TestAsyncCompileCallbackIncludesMemoryUsage(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(memoryLog)})
+	startTestWorker(t)
+
+	received := make(chan CallbackPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload CallbackPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode callback payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	SetCallbackAllowedHosts([]string{"127.0.0.1"})
+	callbackIPAllowed = func(net.IP) bool { return true }
+	t.Cleanup(func() {
+		SetCallbackAllowedHosts(nil)
+		callbackIPAllowed = isPublicIP
+	})
+
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:             []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		CallbackURL:       receiver.URL + "/done",
+		ReturnMemoryUsage: true,
+	})
+	assertStatus(t, recorder, http.StatusAccepted)
+
+	select {
+	case payload := <-received:
+		if payload.Status != "success" || payload.Memory == nil || len(payload.Memory.Stats) == 0 {
+			t.Fatalf("expected memory usage in the callback payload, got %+v", payload)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("callback was not delivered")
+	}
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// chapterLogPrefix tags the physical start pages typed out by chapterPageHook
+const chapterLogPrefix = "[octree-chapter]"
+
+// chapterPageHook logs the physical page each numbered chapter starts on.
+// \@chapter runs after \chapter's page break, so the chapter's first page is
+// the next one shipped out.
+const chapterPageHook = `\ifdefined\AddToHook` +
+	`\AddToHook{cmd/@chapter/before}{\typeout{` + chapterLogPrefix + ` \the\numexpr\ReadonlyShipoutCounter+1\relax}}` +
+	`\fi`
+
+var (
+	chapterStartPattern = regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(chapterLogPrefix) + ` (\d+)$`)
+	// chapterTocPattern matches the chapter lines \chapter writes to the .aux,
+	// \@writefile{toc}{\contentsline {chapter}{\numberline {1}Title}{3}{chapter.1}%
+	chapterTocPattern = regexp.MustCompile(`\\@writefile\{toc\}\{\\contentsline \{chapter\}`)
+	pageCountPattern  = regexp.MustCompile(`Output written on .*? \((\d+) pages?`)
+	numberlinePattern = regexp.MustCompile(`^\\numberline\s*\{([^}]*)\}`)
+)
+
+// chapterBoundaries pairs the chapter titles from the .aux with the start
+// pages logged by chapterPageHook, and ends each chapter where the next one
+// starts. Pages before the first chapter (front matter) are not included.
+func chapterBoundaries(auxContent, logContent string) []ChapterPDF {
+	titles := chapterTitles(auxContent)
+	starts := chapterStartPattern.FindAllStringSubmatch(unwrapLogLines(logContent), -1)
+	pages := pageCountPattern.FindStringSubmatch(logContent)
+	if len(titles) == 0 || len(titles) != len(starts) || pages == nil {
+		return nil
+	}
+	total, _ := strconv.Atoi(pages[1])
+
+	chapters := make([]ChapterPDF, len(titles))
+	for i := range titles {
+		first, _ := strconv.Atoi(starts[i][1])
+		chapters[i] = ChapterPDF{Title: titles[i], FirstPage: first, LastPage: total}
+		if i > 0 {
+			chapters[i-1].LastPage = first - 1
+		}
+	}
+
+	for _, chapter := range chapters {
+		if chapter.FirstPage < 1 || chapter.LastPage < chapter.FirstPage {
+			return nil
+		}
+	}
+	return chapters
+}
+
+// chapterTitles returns the plain-text titles of the chapter toc entries in
+// an .aux file, prefixed with their number ("1 Introduction")
+func chapterTitles(auxContent string) []string {
+	var titles []string
+	for _, entry := range auxContentsEntries(auxContent, chapterTocPattern) {
+		title := entry.Title
+		if entry.Number != "" {
+			title = entry.Number + " " + title
+		}
+		titles = append(titles, strings.TrimSpace(title))
+	}
+	return titles
+}
+
+// contentsEntry is one \contentsline an .aux writes for the toc, lof, or lot
+type contentsEntry struct {
+	Number string
+	Title  string // Plain text
+}
+
+// auxContentsEntries parses the entries following each match of pattern, which
+// must end just before the entry's {\numberline {n}Title} argument
+func auxContentsEntries(auxContent string, pattern *regexp.Regexp) []contentsEntry {
+	var entries []contentsEntry
+	for _, loc := range pattern.FindAllStringIndex(auxContent, -1) {
+		pos := skipSpaces(auxContent, loc[1])
+		if pos >= len(auxContent) || auxContent[pos] != '{' {
+			continue
+		}
+		text, _ := readDelimited(auxContent, pos, '{', '}')
+		text = strings.TrimSpace(text)
+
+		var entry contentsEntry
+		if m := numberlinePattern.FindStringSubmatch(text); m != nil {
+			entry.Number = m[1]
+			text = text[len(m[0]):]
+		}
+		entry.Title = latexToText(text)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// splitByChapter cuts the compiled PDF into one PDF per chapter with qpdf.
+// It returns nil when the chapter boundaries cannot be determined.
+func (s *compileSession) splitByChapter(logContent string) []ChapterPDF {
+	auxPath := strings.TrimSuffix(s.pdfPath, ".pdf") + ".aux"
+	auxData, err := os.ReadFile(auxPath)
+	if err != nil {
+		log.Printf("[%s] Warning: cannot split by chapter, .aux unavailable: %v", s.compiler.RequestID, err)
+		return nil
+	}
+
+	chapters := chapterBoundaries(string(auxData), logContent)
+	if chapters == nil {
+		log.Printf("[%s] Warning: no chapter boundaries found, PDF not split", s.compiler.RequestID)
+		return nil
+	}
+
+	for i := range chapters {
+		data, err := s.extractPages(chapters[i].FirstPage, chapters[i].LastPage, i+1)
+		if err != nil {
+			log.Printf("[%s] Warning: failed to split chapter %q: %v", s.compiler.RequestID, chapters[i].Title, err)
+			return nil
+		}
+		chapters[i].PDFData = data
+	}
+
+	log.Printf("[%s] Split PDF into %d chapters", s.compiler.RequestID, len(chapters))
+	return chapters
+}
+
+// extractPages writes pages first..last of the compiled PDF to a new PDF and
+// returns its bytes
+func (s *compileSession) extractPages(first, last, index int) ([]byte, error) {
+	outPath := filepath.Join(filepath.Dir(s.pdfPath), fmt.Sprintf("%s-chapter-%d.pdf", s.jobName, index))
+	defer os.Remove(outPath)
+
+	cmd := s.command("qpdf", "--empty", "--pages", filepath.Base(s.pdfPath), fmt.Sprintf("%d-%d", first, last), "--", filepath.Base(outPath))
+	cmd.Dir = filepath.Dir(s.pdfPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("qpdf: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return os.ReadFile(outPath)
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const chapteredLog = `This is pdfTeX, Version 3.141592653-2.6-1.40.25
+[octree-chapter] 3
+[octree-chapter] 6
+Output written on main.pdf (8 pages, 45678 bytes).
+`
+
+const chapteredAux = `\relax
+\@writefile{toc}{\contentsline {chapter}{\numberline {1}Getting \emph {Started}}{1}{chapter.1}}%
+\@writefile{toc}{\contentsline {section}{\numberline {1.1}Setup}{1}{section.1.1}}%
+\@writefile{toc}{\contentsline {chapter}{\numberline {2}Results}{4}{chapter.2}}%
+`
+
+// fakeLatexmkWithChapterLog logs two chapter start pages and writes their toc
+// entries to the .aux.
+var fakeLatexmkWithChapterLog = fakeLatexmkWithLog(chapteredLog) + `cat > "$job.aux" <<'FAKEAUX'
+` + chapteredAux + `FAKEAUX
+`
+
+// fakeQpdf writes the requested page range as the output PDF's content:
+// qpdf --empty --pages in.pdf A-B -- out.pdf
+const fakeQpdf = `printf '%%PDF-1.4 pages %s' "$4" > "$6"
+`
+
+func TestCompileSplitsPDFByChapter(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithChapterLog, "qpdf": fakeQpdf})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: "\\documentclass{book}\n\\begin{document}\n\\chapter{Getting Started}\n\\chapter{Results}\n\\end{document}"}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{SplitByChapter: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	hooked := false
+	for _, arg := range readArgs() {
+		hooked = hooked || strings.HasPrefix(arg, "-pretex=") && strings.Contains(arg, `cmd/@chapter/before`)
+	}
+	if !hooked {
+		t.Fatalf("expected the chapter page hook in -pretex")
+	}
+
+	want := []ChapterPDF{
+		{Title: "1 Getting Started", FirstPage: 3, LastPage: 5, PDFData: []byte("%PDF-1.4 pages 3-5")},
+		{Title: "2 Results", FirstPage: 6, LastPage: 8, PDFData: []byte("%PDF-1.4 pages 6-8")},
+	}
+	if len(result.Chapters) != len(want) {
+		t.Fatalf("expected %d chapters, got %+v", len(want), result.Chapters)
+	}
+	for i, chapter := range result.Chapters {
+		if chapter.Title != want[i].Title || chapter.FirstPage != want[i].FirstPage || chapter.LastPage != want[i].LastPage || string(chapter.PDFData) != string(want[i].PDFData) {
+			t.Fatalf("chapter %d: expected %+v, got %+v", i, want[i], chapter)
+		}
+	}
+}
+
+func TestChapterBoundariesRequireMatchingStarts(t *testing.T) {
+	if chapters := chapterBoundaries(chapteredAux, "Output written on main.pdf (8 pages)."); chapters != nil {
+		t.Fatalf("expected no chapters without logged start pages, got %+v", chapters)
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// bibEntryPattern matches the start of a BibTeX entry, "@article{key,"
+	bibEntryPattern = regexp.MustCompile(`@\s*([A-Za-z]+)\s*[{(]\s*([^,\s{}()]+)\s*,`)
+	// bibitemPattern matches thebibliography entries, \bibitem[label]{key}
+	bibitemPattern = regexp.MustCompile(`\\bibitem\s*(?:\[[^\]]*\])?\s*\{([^}]+)\}`)
+)
+
+// bibNonEntryTypes are @-blocks that do not define a citable key
+var bibNonEntryTypes = map[string]bool{
+	"comment":  true,
+	"string":   true,
+	"preamble": true,
+}
+
+// checkCitations compares every \cite key in the LaTeX sources against the
+// keys defined in .bib files and \bibitem entries, without running the engine
+func checkCitations(files []FileEntry) CitationCheckResponse {
+	defined := map[string]bool{}
+	for _, file := range files {
+		if file.Encoding == "base64" {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(file.Path), ".bib") {
+			for _, m := range bibEntryPattern.FindAllStringSubmatch(file.Content, -1) {
+				if !bibNonEntryTypes[strings.ToLower(m[1])] {
+					defined[m[2]] = true
+				}
+			}
+			continue
+		}
+		if shouldInspectForEngine(file.Path) {
+			for _, m := range bibitemPattern.FindAllStringSubmatch(stripTeXComments(file.Content), -1) {
+				defined[strings.TrimSpace(m[1])] = true
+			}
+		}
+	}
+
+	resp := CitationCheckResponse{EntryCount: len(defined), Missing: []MissingCitation{}}
+	cited := map[string]bool{}
+	for _, file := range files {
+		if file.Encoding == "base64" || !shouldInspectForEngine(file.Path) {
+			continue
+		}
+		content := stripTeXComments(file.Content)
+		for _, loc := range citationPattern.FindAllStringSubmatchIndex(content, -1) {
+			for _, key := range strings.Split(content[loc[2]:loc[3]], ",") {
+				// \nocite{*} pulls in the whole database
+				if key = strings.TrimSpace(key); key == "" || key == "*" {
+					continue
+				}
+				cited[key] = true
+				if !defined[key] {
+					resp.Missing = append(resp.Missing, MissingCitation{
+						Key:  key,
+						File: file.Path,
+						Line: lineNumberAt(content, loc[0]),
+					})
+				}
+			}
+		}
+	}
+	resp.CitedCount = len(cited)
+
+	sort.SliceStable(resp.Missing, func(i, j int) bool {
+		return resp.Missing[i].Key < resp.Missing[j].Key
+	})
+	return resp
+}
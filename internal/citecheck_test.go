@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestCheckCitationsFlagsMissingKeys(t *testing.T) {
+	files := []FileEntry{
+		{Path: "main.tex", Content: "\\documentclass{article}\n\\begin{document}\nSee \\cite{knuth1984, knuht1984}.\n% \\cite{commented}\n\\nocite{*}\n\\input{related}\n\\end{document}"},
+		{Path: "related.tex", Content: "As in \\citep[p.~2]{lamport1994} and \\citet{missing2020}."},
+		{Path: "refs.bib", Content: refsBib + "\n@string{tug = {TeX Users Group}}\n@comment{ignored,}"},
+	}
+
+	resp := checkCitations(files)
+	if resp.CitedCount != 4 || resp.EntryCount != 2 {
+		t.Fatalf("expected 4 cited and 2 defined keys, got %+v", resp)
+	}
+
+	want := []MissingCitation{
+		{Key: "knuht1984", File: "main.tex", Line: 3},
+		{Key: "missing2020", File: "related.tex", Line: 1},
+	}
+	if len(resp.Missing) != len(want) || resp.Missing[0] != want[0] || resp.Missing[1] != want[1] {
+		t.Fatalf("expected missing %+v, got %+v", want, resp.Missing)
+	}
+}
+
+func TestCheckCitationsAcceptsBibitems(t *testing.T) {
+	content := "\\cite{a}\n\\begin{thebibliography}{9}\n\\bibitem[A]{a} Author.\n\\end{thebibliography}"
+	if resp := checkCitations([]FileEntry{{Path: "main.tex", Content: content}}); len(resp.Missing) != 0 {
+		t.Fatalf("expected \\bibitem keys to count as defined, got %+v", resp.Missing)
+	}
+}
+
+func TestCitationCheckHandler(t *testing.T) {
+	recorder := performJSON(t, http.MethodPost, "/citations/check", CitationCheckHandler, SourceRequest{
+		Files: []FileEntry{
+			{Path: "main.tex", Content: `\cite{knuth1984,nobody}`},
+			{Path: "refs.bib", Content: refsBib},
+		},
+	})
+	assertStatus(t, recorder, http.StatusOK)
+
+	var resp CitationCheckResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Missing) != 1 || resp.Missing[0].Key != "nobody" {
+		t.Fatalf("expected nobody to be flagged, got %+v", resp.Missing)
+	}
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auxiliaryExtensions are the build byproducts POST /clean removes, like
+// latexmk -c: the PDF stays until the next build replaces it
+var auxiliaryExtensions = []string{
+	".aux", ".toc", ".lof", ".lot", ".out", ".bbl", ".blg", ".bcf", ".run.xml",
+	".fls", ".fdb_latexmk", ".log", ".idx", ".ind", ".ilg", ".glo", ".gls", ".glg",
+	".nav", ".snm", ".vrb", ".synctex.gz", ".xdv",
+}
+
+// CleanResponse lists the files removed from a project's cached workspace
+type CleanResponse struct {
+	ProjectID string   `json:"projectId"`
+	Removed   []string `json:"removed"` // Workspace-relative paths
+}
+
+func isAuxiliaryFile(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range auxiliaryExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanWorkspace removes the auxiliary files of a cached workspace, sparing
+// any the project uploaded itself (e.g. a hand-made .bbl), and drops the
+// cached PDF and bibliography hash so the next compile runs every pass. It
+// reports false when the project has no cached workspace.
+func (c *CompilationCache) cleanWorkspace(projectID string) ([]string, bool) {
+	c.LockProject(projectID)
+	defer c.UnlockProject(projectID)
+
+	entry, exists := c.Get(projectID)
+	if !exists || entry.TempDir == "" {
+		return nil, false
+	}
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	removed := []string{}
+	filepath.WalkDir(entry.TempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isAuxiliaryFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(entry.TempDir, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if _, uploaded := entry.FileHashes[rel]; uploaded {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove %s from the workspace of %s: %v", rel, projectID, err)
+			return nil
+		}
+		removed = append(removed, rel)
+		return nil
+	})
+	sort.Strings(removed)
+
+	entry.ContentHash = ""
+	entry.BibHash = ""
+	entry.LastPDFData = nil
+	return removed, true
+}
+
+// CleanHandler removes auxiliary files from a project's cached workspace, a
+// lighter recovery from stale cross-references than discarding the cache. The
+// namespace query parameter selects the project's cache namespace, so any
+// tenant's workspace can be named; mount it behind RequireAdmin.
+func CleanHandler(c *gin.Context) {
+	projectID := c.Param("projectId")
+	removed, ok := GetCache().cleanWorkspace(CacheKey(c.Query("namespace"), projectID))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Not found",
+			Message: "No cached workspace for this project",
+		})
+		return
+	}
+
+	log.Printf("Cleaned %d auxiliary file(s) from the workspace of project %s", len(removed), projectID)
+	c.JSON(http.StatusOK, CleanResponse{ProjectID: projectID, Removed: removed})
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCleanHandlerRemovesAuxiliaryFiles(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	projectID := "clean-test"
+	forgetProject(t, projectID)
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: simpleDocument},
+		{Path: "legacy.bbl", Content: "\\begin{thebibliography}{1}\\end{thebibliography}"},
+	}
+	if result := New().Compile(files, time.Now(), projectID, CompileOptions{}); !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	entry, _ := GetCache().Get(projectID)
+	for _, name := range []string{"main.aux", "chapters/intro.aux", "main.toc"} {
+		path := filepath.Join(entry.TempDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("stale"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/clean/:projectId", CleanHandler)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/clean/"+projectID, nil))
+	assertStatus(t, recorder, http.StatusOK)
+
+	var resp CleanResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := []string{"chapters/intro.aux", "main.aux", "main.log", "main.toc"}
+	if len(resp.Removed) != len(want) {
+		t.Fatalf("expected %v removed, got %v", want, resp.Removed)
+	}
+	for i := range want {
+		if resp.Removed[i] != want[i] {
+			t.Fatalf("expected %v removed, got %v", want, resp.Removed)
+		}
+	}
+	for _, kept := range []string{"main.tex", "legacy.bbl", "main.pdf"} {
+		if _, err := os.Stat(filepath.Join(entry.TempDir, kept)); err != nil {
+			t.Fatalf("expected %s to be kept: %v", kept, err)
+		}
+	}
+
+	// The cached PDF no longer answers the unchanged sources
+	if result := New().Compile(files, time.Now(), projectID, CompileOptions{}); result.CacheHit {
+		t.Fatalf("expected a fresh build after cleaning")
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/clean/unknown-project", nil))
+	assertStatus(t, recorder, http.StatusNotFound)
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// inflightCompile is a queued or running compile that identical requests
+// wait on instead of compiling again
+type inflightCompile struct {
+	key     string
+	job     *CompileJob
+	waiters []*CompileJob
+}
+
+// sharedCompiles counts the requests answered with another request's
+// in-flight compile
+var sharedCompiles atomic.Int64
+
+// inflightKey identifies what a project-scoped job builds: its project and
+// a hash of its files and options, so only requests expecting the same
+// result share one. One-off compiles get "" and are never shared.
+func inflightKey(job *CompileJob) string {
+	key := supersedeKey(job)
+	if key == "" {
+		return ""
+	}
+
+	// The context, progress callback, and client do not change the result
+	options := job.Options
+	options.Context, options.Progress, options.ClientID = nil, nil, ""
+	var forward SourcePosition
+	if options.SyncForward != nil {
+		forward = *options.SyncForward
+		options.SyncForward = nil
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%+v\x00%+v", HashFileSet(job.Files), options, forward))
+	return key + "\x00" + hex.EncodeToString(sum[:])
+}
+
+// joinInFlight makes job wait on an identical compile of its project that is
+// already queued or running, and reports whether it did. Otherwise job is
+// registered as the compile later identical requests wait on, and must be
+// answered with finishInFlight.
+func (c *CompilationCache) joinInFlight(job *CompileJob) bool {
+	key := inflightKey(job)
+	if key == "" {
+		return false
+	}
+
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+
+	// A superseded compile will not produce the result job expects
+	if running := c.inflight[key]; running != nil && (running.job.Options.Context == nil || running.job.Options.Context.Err() == nil) {
+		running.waiters = append(running.waiters, job)
+		count := sharedCompiles.Add(1)
+		log.Printf("[%s] Waiting on the identical in-flight compile %s of project %q (%d shared so far)", job.RequestID, running.job.RequestID, job.ProjectID, count)
+		return true
+	}
+
+	job.inflight = &inflightCompile{key: key, job: job}
+	c.inflight[key] = job.inflight
+	return false
+}
+
+// finishInFlight forgets job as an in-flight compile and hands its result to
+// the requests waiting on it, flagged as a cache hit since they did not
+// compile. Each copy carries the waiter's own request ID, with its time
+// waiting as queue time, and is recorded in the project's history. Their
+// progress listeners see the compile done, as their own compile would have
+// reported.
+func (c *CompilationCache) finishInFlight(job *CompileJob, result *CompileResult) {
+	if job.inflight == nil {
+		return
+	}
+
+	c.inflightMu.Lock()
+	// A newer identical request may have taken the key over after job was
+	// superseded
+	if c.inflight[job.inflight.key] == job.inflight {
+		delete(c.inflight, job.inflight.key)
+	}
+	waiters := job.inflight.waiters
+	job.inflight = nil
+	c.inflightMu.Unlock()
+
+	for _, waiter := range waiters {
+		if waiter.Options.Progress != nil {
+			waiter.Options.Progress(ProgressEvent{RequestID: waiter.RequestID, Stage: StageDone, Percent: 100})
+		}
+		shared := *result
+		shared.RequestID = waiter.RequestID
+		shared.CacheHit = result.Success
+		shared.QueueMs = time.Since(waiter.EnqueuedAt).Milliseconds()
+		shared.DurationMs = 0
+		compilesSharedTotal.Inc()
+		recordBuild(supersedeKey(waiter), "", &shared)
+		waiter.ResultChan <- &shared
+	}
+}
+
+// sendResult answers job, and the identical requests waiting on it, with
+// result
+func sendResult(job *CompileJob, result *CompileResult) {
+	GetCache().finishInFlight(job, result)
+	job.ResultChan <- result
+}
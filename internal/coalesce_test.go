@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdenticalInFlightCompilesShareOneBuild(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	t.Setenv("FAKE_LATEXMK_RUNS", runs)
+	installFakeTools(t, map[string]string{"latexmk": "echo run >> \"$FAKE_LATEXMK_RUNS\"\n" + fakeLatexmkScript})
+	projectID := "inflight-test"
+	forgetProject(t, projectID)
+
+	// No worker drains this queue until both jobs are submitted
+	previous := requestQueue
+	SetRequestQueue(make(chan *CompileJob, 2))
+	t.Cleanup(func() { SetRequestQueue(previous) })
+
+	shared := sharedCompiles.Load()
+	var jobs []*CompileJob
+	for i := 0; i < 2; i++ {
+		job := &CompileJob{
+			Files:      []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+			ProjectID:  projectID,
+			EnqueuedAt: time.Now(),
+			ResultChan: make(chan *CompileResult, 1),
+		}
+		if enqueueJob(job) != nil {
+			t.Fatalf("failed to enqueue job %d", i+1)
+		}
+		jobs = append(jobs, job)
+	}
+	if len(requestQueue) != 1 {
+		t.Fatalf("expected the identical job to wait instead of queueing, got %d queued", len(requestQueue))
+	}
+
+	HandleCompilation(<-requestQueue)
+
+	first, second := <-jobs[0].ResultChan, <-jobs[1].ResultChan
+	if !first.Success || first.CacheHit {
+		t.Fatalf("expected the first job to compile, got success=%v cacheHit=%v", first.Success, first.CacheHit)
+	}
+	if !second.Success || !second.CacheHit || second.SHA256 != first.SHA256 {
+		t.Fatalf("expected the second job to share the first one's PDF as a cache hit, got success=%v cacheHit=%v", second.Success, second.CacheHit)
+	}
+	if first.RequestID != jobs[0].RequestID || second.RequestID != jobs[1].RequestID {
+		t.Fatalf("expected each job's own request ID, got %q and %q", first.RequestID, second.RequestID)
+	}
+	history := buildHistory.builds(projectID)
+	if len(history) < 2 || history[0].RequestID != jobs[1].RequestID || !history[0].CacheHit {
+		t.Fatalf("expected the shared result in the project's history, got %+v", history)
+	}
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "run") != 1 {
+		t.Fatalf("expected latexmk to run once, got %q", data)
+	}
+	if got := sharedCompiles.Load() - shared; got != 1 {
+		t.Fatalf("expected 1 shared compile, got %d", got)
+	}
+}
+
+func TestInFlightKeyCoversFilesAndOptions(t *testing.T) {
+	job := func(content string, options CompileOptions) *CompileJob {
+		return &CompileJob{Files: []FileEntry{{Path: "main.tex", Content: content}}, ProjectID: "p", Options: options}
+	}
+	base := inflightKey(job(simpleDocument, CompileOptions{ClientID: "10.0.0.1"}))
+
+	if got := inflightKey(job(simpleDocument, CompileOptions{ClientID: "10.0.0.2", Progress: func(ProgressEvent) {}})); got != base {
+		t.Fatalf("expected the client and progress callback not to matter")
+	}
+	if inflightKey(job(simpleDocument+"%", CompileOptions{})) == base {
+		t.Fatalf("expected different files to get different keys")
+	}
+	if inflightKey(job(simpleDocument, CompileOptions{OutputFormat: OutputFormatPNG})) == base {
+		t.Fatalf("expected different options to get different keys")
+	}
+	if inflightKey(&CompileJob{Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}}}) != "" {
+		t.Fatalf("expected one-off compiles never to be shared")
+	}
+}
+
+func TestAsyncWaiterOnInFlightCompileReachesDone(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	projectID := "inflight-async"
+	forgetProject(t, projectID)
+
+	received := make(chan CallbackPayload, 2)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload CallbackPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode callback payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	SetCallbackAllowedHosts([]string{"127.0.0.1"})
+	callbackIPAllowed = func(net.IP) bool { return true }
+	t.Cleanup(func() {
+		SetCallbackAllowedHosts(nil)
+		callbackIPAllowed = isPublicIP
+	})
+
+	// No worker drains this queue until both requests are accepted
+	previous := requestQueue
+	SetRequestQueue(make(chan *CompileJob, 2))
+	t.Cleanup(func() { SetRequestQueue(previous) })
+
+	var acks []AsyncCompileResponse
+	for i := 0; i < 2; i++ {
+		recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+			Files:       []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+			ProjectID:   projectID,
+			CallbackURL: receiver.URL + "/done",
+		})
+		assertStatus(t, recorder, http.StatusAccepted)
+		var ack AsyncCompileResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &ack); err != nil {
+			t.Fatalf("failed to decode the 202 response: %v", err)
+		}
+		acks = append(acks, ack)
+	}
+	if len(requestQueue) != 1 {
+		t.Fatalf("expected the second request to wait on the first, got %d queued", len(requestQueue))
+	}
+	HandleCompilation(<-requestQueue)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case payload := <-received:
+			if payload.Status != "success" {
+				t.Fatalf("unexpected callback payload: %+v", payload)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("callback %d was not delivered", i+1)
+		}
+	}
+	for _, ack := range acks {
+		var event ProgressEvent
+		progress := performProgress(t, ack.RequestID)
+		if err := json.Unmarshal(progress.Body.Bytes(), &event); err != nil || event.Stage != StageDone || event.Percent != 100 {
+			t.Fatalf("expected %s to reach done, got %s", ack.RequestID, progress.Body.String())
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: compile.proto
+
+package compilepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CompileService_Compile_FullMethodName = "/octree.compile.v1.CompileService/Compile"
+)
+
+// CompileServiceClient is the client API for CompileService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CompileServiceClient interface {
+	Compile(ctx context.Context, in *CompileRequest, opts ...grpc.CallOption) (*CompileResponse, error)
+}
+
+type compileServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCompileServiceClient(cc grpc.ClientConnInterface) CompileServiceClient {
+	return &compileServiceClient{cc}
+}
+
+func (c *compileServiceClient) Compile(ctx context.Context, in *CompileRequest, opts ...grpc.CallOption) (*CompileResponse, error) {
+	out := new(CompileResponse)
+	err := c.cc.Invoke(ctx, CompileService_Compile_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CompileServiceServer is the server API for CompileService service.
+// All implementations must embed UnimplementedCompileServiceServer
+// for forward compatibility
+type CompileServiceServer interface {
+	Compile(context.Context, *CompileRequest) (*CompileResponse, error)
+	mustEmbedUnimplementedCompileServiceServer()
+}
+
+// UnimplementedCompileServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCompileServiceServer struct {
+}
+
+func (UnimplementedCompileServiceServer) Compile(context.Context, *CompileRequest) (*CompileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Compile not implemented")
+}
+func (UnimplementedCompileServiceServer) mustEmbedUnimplementedCompileServiceServer() {}
+
+// UnsafeCompileServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CompileServiceServer will
+// result in compilation errors.
+type UnsafeCompileServiceServer interface {
+	mustEmbedUnimplementedCompileServiceServer()
+}
+
+func RegisterCompileServiceServer(s grpc.ServiceRegistrar, srv CompileServiceServer) {
+	s.RegisterService(&CompileService_ServiceDesc, srv)
+}
+
+func _CompileService_Compile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompileServiceServer).Compile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CompileService_Compile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompileServiceServer).Compile(ctx, req.(*CompileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CompileService_ServiceDesc is the grpc.ServiceDesc for CompileService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CompileService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "octree.compile.v1.CompileService",
+	HandlerType: (*CompileServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Compile",
+			Handler:    _CompileService_Compile_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "compile.proto",
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -9,11 +10,11 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,7 +26,11 @@ const (
 )
 
 var historyDir string
-var usepackagePatternCache sync.Map
+
+// usepackagePatterns holds the precompiled patterns for the fixed set of
+// packages the compiler checks for. It is built once and never written to
+// afterwards, so concurrent reads are safe and it cannot grow.
+var usepackagePatterns = compileUsepackagePatterns("fontspec")
 
 type latexEngine string
 
@@ -35,6 +40,24 @@ const (
 	engineLuaLaTeX latexEngine = "lualatex"
 )
 
+// preferredUnicodeEngine compiles documents that need a Unicode engine
+// (fontspec, unicode-math, ...) without anything specific to one
+var preferredUnicodeEngine = engineXeLaTeX
+
+// SetPreferredUnicodeEngine sets the engine for fontspec-only documents:
+// "xelatex" (default) or "lualatex"
+func SetPreferredUnicodeEngine(name string) error {
+	switch engine := latexEngine(strings.ToLower(strings.TrimSpace(name))); engine {
+	case "":
+		preferredUnicodeEngine = engineXeLaTeX
+	case engineXeLaTeX, engineLuaLaTeX:
+		preferredUnicodeEngine = engine
+	default:
+		return fmt.Errorf("unsupported Unicode engine %q (want xelatex or lualatex)", name)
+	}
+	return nil
+}
+
 // SetHistoryDir sets the directory for compilation history logs
 func SetHistoryDir(dir string) {
 	historyDir = dir
@@ -54,6 +77,7 @@ type compileSession struct {
 	compiler            *Compiler
 	files               []FileEntry
 	projectID           string
+	options             CompileOptions
 	enqueuedAt          time.Time
 	receivedAt          time.Time
 	queueMs             int64
@@ -66,6 +90,9 @@ type compileSession struct {
 	logPath             string
 	fileChanges         *FileChanges
 	isIncremental       bool
+	bibHash             string
+	cachedBibHash       string
+	skipBibliography    bool
 	shouldCleanup       bool
 	metadata            *compileMetadata
 	requiresShellEscape bool
@@ -73,18 +100,28 @@ type compileSession struct {
 	stdout              bytes.Buffer
 	stderr              bytes.Buffer
 	exitCode            int
+	compiled            bool // The toolchain ran, rather than a cache hit or an early failure
 	bibTool             bibliographyTool
 	engine              latexEngine
+	peakRssKb           int64
+	cpuTime             time.Duration // CPU time of the toolchain processes so far
+	cpuLimitExceeded    bool
+	toolchainCtx        context.Context // Cancelled when superseded or at the compilation timeout
+	progress            *progressTracker
+	includeOnly         []string // \include files of a partial build, see resolveIncludeOnly
+	sandboxedFrom       string   // Cached workspace while the toolchain runs in a sandbox, see enterSandbox
+	passes              []PassLog
 }
 
-func newCompileSession(compiler *Compiler, files []FileEntry, enqueuedAt time.Time, projectID string) *compileSession {
+func newCompileSession(compiler *Compiler, files []FileEntry, enqueuedAt time.Time, projectID string, options CompileOptions) *compileSession {
 	receivedAt := time.Now()
 	queueMs := receivedAt.Sub(enqueuedAt).Milliseconds()
 
 	session := &compileSession{
 		compiler:      compiler,
 		files:         files,
-		projectID:     projectID,
+		projectID:     CacheKey(options.CacheNamespace, projectID),
+		options:       options,
 		enqueuedAt:    enqueuedAt,
 		receivedAt:    receivedAt,
 		queueMs:       queueMs,
@@ -96,8 +133,9 @@ func newCompileSession(compiler *Compiler, files []FileEntry, enqueuedAt time.Ti
 			QueueMs:    queueMs,
 			Status:     "processing",
 		},
-		bibTool: bibliographyToolNone,
-		engine:  enginePdfLaTeX,
+		bibTool:  bibliographyToolNone,
+		engine:   enginePdfLaTeX,
+		progress: newProgressTracker(compiler.RequestID, options.Progress),
 	}
 
 	session.logInitialDetails()
@@ -105,8 +143,18 @@ func newCompileSession(compiler *Compiler, files []FileEntry, enqueuedAt time.Ti
 	return session
 }
 
-func (c *Compiler) Compile(files []FileEntry, enqueuedAt time.Time, projectID string) *CompileResult {
-	session := newCompileSession(c, files, enqueuedAt, projectID)
+func (c *Compiler) Compile(files []FileEntry, enqueuedAt time.Time, projectID string, options CompileOptions) (result *CompileResult) {
+	files = dropDisallowedFiles(files, c.RequestID)
+	session := newCompileSession(c, files, enqueuedAt, projectID, options)
+	defer session.progress.enter(StageDone)
+	defer func() {
+		session.recordHistory(result)
+		session.recordMetrics(result)
+	}()
+
+	if errResult := session.enforceLimits(); errResult != nil {
+		return errResult
+	}
 
 	cache := GetCache()
 	if session.projectID != "" {
@@ -114,19 +162,34 @@ func (c *Compiler) Compile(files []FileEntry, enqueuedAt time.Time, projectID st
 		defer cache.UnlockProject(session.projectID)
 	}
 
-	if result := session.tryServeCachedPDF(cache); result != nil {
-		return result
+	if session.superseded() {
+		return session.abandonSuperseded(cache)
+	}
+
+	if cached := session.tryServeCachedPDF(cache); cached != nil {
+		return session.render(cached)
 	}
 
+	session.progress.enter(StageWorkspace)
 	if errResult := session.prepareWorkspace(cache); errResult != nil {
 		return errResult
 	}
 	defer session.cleanup()
 
+	if session.sandboxesShellEscape() {
+		if errResult := session.enterSandbox(); errResult != nil {
+			return errResult
+		}
+		defer session.leaveSandbox()
+	}
+
+	stopTimeout := session.startTimeout()
+	defer stopTimeout()
+
 	needsBib, needsMultiPass := session.determineStrategy()
 	session.runCompilation(needsBib, needsMultiPass)
 
-	return session.finalize(cache)
+	return session.render(session.finalize(cache))
 }
 
 func (s *compileSession) logInitialDetails() {
@@ -194,6 +257,9 @@ func (s *compileSession) detectEngine() (latexEngine, string) {
 	if reason := detectXeEngineTrigger(content); reason != "" {
 		return engineXeLaTeX, reason
 	}
+	if reason := detectUnicodeEngineTrigger(content); reason != "" {
+		return preferredUnicodeEngine, reason
+	}
 	return enginePdfLaTeX, ""
 }
 
@@ -209,8 +275,78 @@ func shouldInspectForEngine(path string) bool {
 	case strings.HasSuffix(lower, ".ltx"):
 		return true
 	default:
-		return false
+		return isMainFileCandidate(path)
+	}
+}
+
+// texRootPattern matches the "% !TEX root = main.tex" magic comment editors
+// write into subfiles
+var texRootPattern = regexp.MustCompile(`(?i)^\s*%\s*!\s*TEX\s+root\s*=\s*(.+?)\s*$`)
+
+// texRootSearchLines is how far into a file editors look for the directive
+const texRootSearchLines = 20
+
+// findDeclaredRoot returns the file named by the first "% !TEX root" directive,
+// resolved relative to the file declaring it
+func findDeclaredRoot(files []FileEntry) (FileEntry, bool) {
+	byPath := make(map[string]FileEntry, len(files))
+	for _, file := range files {
+		byPath[path.Clean(file.Path)] = file
+	}
+
+	for _, file := range files {
+		if file.Encoding == "base64" || !shouldInspectForEngine(file.Path) {
+			continue
+		}
+
+		lines := strings.SplitN(file.Content, "\n", texRootSearchLines+1)
+		for _, line := range lines[:min(len(lines), texRootSearchLines)] {
+			m := texRootPattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+			if m == nil {
+				continue
+			}
+
+			target := path.Clean(path.Join(path.Dir(file.Path), m[1]))
+			if root, ok := byPath[target]; ok && root.Encoding != "base64" {
+				return root, true
+			}
+			break
+		}
+	}
+
+	return FileEntry{}, false
+}
+
+// defaultMainFileExtensions are the extensions a root document may have
+var defaultMainFileExtensions = []string{".tex", ".ltx", ".latex"}
+
+var mainFileExtensions = defaultMainFileExtensions
+
+// SetExtraMainFileExtensions adds extensions (e.g. ".ltx2") accepted for the
+// root document on top of .tex, .ltx and .latex
+func SetExtraMainFileExtensions(extensions []string) {
+	exts := append([]string{}, defaultMainFileExtensions...)
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	mainFileExtensions = exts
+}
+
+func isMainFileCandidate(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, candidate := range mainFileExtensions {
+		if ext == candidate {
+			return true
+		}
 	}
+	return false
 }
 
 func detectLuaEngineTrigger(content string) string {
@@ -236,7 +372,29 @@ func detectLuaEngineTrigger(content string) string {
 	return ""
 }
 
+// detectXeEngineTrigger returns the first construct only XeTeX supports
 func detectXeEngineTrigger(content string) string {
+	triggers := []string{
+		"\\usepackage{xecjk",
+		"\\setcjkmainfont",
+		"\\setcjkfamilyfont",
+		"\\usepackage{mathspec",
+		"\\xeprintrule",
+		"\\xetex",
+	}
+
+	for _, trigger := range triggers {
+		if strings.Contains(content, trigger) {
+			return trigger
+		}
+	}
+
+	return ""
+}
+
+// detectUnicodeEngineTrigger returns the first construct that needs a Unicode
+// engine but works under both xelatex and lualatex
+func detectUnicodeEngineTrigger(content string) string {
 	if containsUsepackage(content, "fontspec") {
 		return "\\usepackage{fontspec}"
 	}
@@ -246,14 +404,8 @@ func detectXeEngineTrigger(content string) string {
 		"\\setsansfont",
 		"\\setmonofont",
 		"\\newfontfamily",
-		"\\usepackage{xecjk",
-		"\\setcjkmainfont",
-		"\\setcjkfamilyfont",
 		"\\usepackage{polyglossia",
-		"\\usepackage{mathspec",
 		"\\usepackage{unicode-math",
-		"\\xeprintrule",
-		"\\xetex",
 		"\\defaultfontfeatures",
 	}
 
@@ -266,20 +418,30 @@ func detectXeEngineTrigger(content string) string {
 	return ""
 }
 
+func compileUsepackagePatterns(pkgs ...string) map[string]*regexp.Regexp {
+	patterns := make(map[string]*regexp.Regexp, len(pkgs))
+	for _, pkg := range pkgs {
+		patterns[pkg] = usepackagePattern(pkg)
+	}
+	return patterns
+}
+
+func usepackagePattern(pkg string) *regexp.Regexp {
+	pattern := fmt.Sprintf(`\\(?:use|require)package(?:\[[^\]]*\])?\{\s*%s\s*\}`, regexp.QuoteMeta(pkg))
+	return regexp.MustCompile(pattern)
+}
+
 func containsUsepackage(content, pkg string) bool {
 	if pkg == "" {
 		return false
 	}
 
-	if cached, ok := usepackagePatternCache.Load(pkg); ok {
-		return cached.(*regexp.Regexp).MatchString(content)
+	if re, ok := usepackagePatterns[pkg]; ok {
+		return re.MatchString(content)
 	}
 
-	pattern := fmt.Sprintf(`\\(?:use|require)package(?:\[[^\]]*\])?\{\s*%s\s*\}`, regexp.QuoteMeta(pkg))
-	re := regexp.MustCompile(pattern)
-	usepackagePatternCache.Store(pkg, re)
-
-	return re.MatchString(content)
+	// Packages outside the fixed set are compiled on demand and not cached.
+	return usepackagePattern(pkg).MatchString(content)
 }
 
 func (s *compileSession) extractMainContent() string {
@@ -294,6 +456,17 @@ func (s *compileSession) extractMainContent() string {
 	}
 	log.Printf("[%s] Project files received: %d total (%d text, %d binary)", s.compiler.RequestID, len(s.files), textFiles, binaryFiles)
 
+	if s.options.MainFile != "" {
+		mainFile, ok := findRequestedMainFile(s.files, s.options.MainFile)
+		if !ok {
+			// enforceMainFile rejects the request
+			return ""
+		}
+		s.mainFilePath = mainFile.Path
+		log.Printf("[%s] Using requested main file: %s", s.compiler.RequestID, mainFile.Path)
+		return mainFile.Content
+	}
+
 	mainFile, hasDocclass, found := findMainFile(s.files)
 	if !found {
 		log.Printf("[%s] Warning: No LaTeX source file detected in request", s.compiler.RequestID)
@@ -306,34 +479,86 @@ func (s *compileSession) extractMainContent() string {
 	if hasDocclass {
 		log.Printf("[%s] Detected main file by \\documentclass: %s", s.compiler.RequestID, mainFile.Path)
 	} else {
-		log.Printf("[%s] Warning: No \\documentclass found; using first .tex file: %s", s.compiler.RequestID, mainFile.Path)
+		log.Printf("[%s] Warning: No \\documentclass found; using first LaTeX source file: %s", s.compiler.RequestID, mainFile.Path)
 	}
 
 	return mainFile.Content
 }
 
+// findRequestedMainFile looks up the main file a request names explicitly
+func findRequestedMainFile(files []FileEntry, name string) (FileEntry, bool) {
+	name = path.Clean(name)
+	for _, file := range files {
+		if file.Encoding != "base64" && path.Clean(file.Path) == name {
+			return file, true
+		}
+	}
+	return FileEntry{}, false
+}
+
+// enforceMainFile rejects requests naming a main file they do not contain
+func (s *compileSession) enforceMainFile() *CompileResult {
+	if s.options.MainFile == "" || s.mainFilePath != "" {
+		return nil
+	}
+	err := fmt.Errorf("%w: %s", ErrMainFileNotFound, s.options.MainFile)
+	log.Printf("[%s] Rejecting request: %v", s.compiler.RequestID, err)
+	return s.compiler.failWith(s.metadata, err, s.queueMs, s.receivedAt)
+}
+
+// documentClassPattern matches \documentclass[options]{class}
+var documentClassPattern = regexp.MustCompile(`\\documentclass\s*(?:\[[^\]]*\])?\s*\{\s*([^}\s]+)\s*\}`)
+
+// Main file candidates in order of preference
+const (
+	mainRankDocument   = iota // A class and \begin{document}
+	mainRankPreamble          // A class, with the body \input from elsewhere
+	mainRankStandalone        // A standalone figure or table
+	mainRankSubfile           // A part of a subfiles project
+	mainRankNoClass           // No \documentclass at all
+)
+
+// mainFileRank ranks a LaTeX source as the project's root document
+func mainFileRank(content string) int {
+	content = stripTeXComments(content)
+	m := documentClassPattern.FindStringSubmatch(content)
+	switch {
+	case m == nil:
+		return mainRankNoClass
+	case m[1] == "subfiles":
+		return mainRankSubfile
+	case m[1] == "standalone":
+		return mainRankStandalone
+	case strings.Contains(content, "\\begin{document}"):
+		return mainRankDocument
+	default:
+		return mainRankPreamble
+	}
+}
+
+// findMainFile returns the file a "% !TEX root" directive names or else the
+// best-ranked LaTeX source, the first of equals, and whether it has a class.
+// Subfiles and standalone parts also declare a class, so they only win when
+// nothing else does.
 func findMainFile(files []FileEntry) (FileEntry, bool, bool) {
-	var fallback *FileEntry
+	if root, ok := findDeclaredRoot(files); ok {
+		return root, mainFileRank(root.Content) != mainRankNoClass, true
+	}
 
-	for i := range files {
-		file := files[i]
-		switch {
-		case file.Encoding == "base64":
-			continue
-		case !strings.HasSuffix(file.Path, ".tex"):
+	best, bestRank := -1, mainRankNoClass+1
+	for i, file := range files {
+		if file.Encoding == "base64" || !isMainFileCandidate(file.Path) {
 			continue
-		case strings.Contains(file.Content, "\\documentclass"):
-			return file, true, true
-		case fallback == nil:
-			fallback = &files[i]
+		}
+		if rank := mainFileRank(file.Content); rank < bestRank {
+			best, bestRank = i, rank
 		}
 	}
 
-	if fallback != nil {
-		return *fallback, false, true
+	if best < 0 {
+		return FileEntry{}, false, false
 	}
-
-	return FileEntry{}, false, false
+	return files[best], bestRank != mainRankNoClass, true
 }
 
 func (s *compileSession) attachCachedTempDir(cache *CompilationCache) {
@@ -346,6 +571,11 @@ func (s *compileSession) attachCachedTempDir(cache *CompilationCache) {
 		return
 	}
 
+	if s.options.ForceRebuild {
+		s.discardCachedWorkspace(cache, entry.TempDir)
+		return
+	}
+
 	if _, err := os.Stat(entry.TempDir); err != nil {
 		log.Printf("[%s] Cached temp dir %s unavailable: %v", s.compiler.RequestID, entry.TempDir, err)
 		return
@@ -355,6 +585,7 @@ func (s *compileSession) attachCachedTempDir(cache *CompilationCache) {
 	s.tempDir = entry.TempDir
 	s.isIncremental = true
 	s.shouldCleanup = false
+	s.cachedBibHash = entry.BibHash
 
 	s.fileChanges = diffFiles(s.files, entry.FileHashes)
 	changeCount := len(s.fileChanges.Added) + len(s.fileChanges.Modified) + len(s.fileChanges.Deleted)
@@ -364,14 +595,28 @@ func (s *compileSession) attachCachedTempDir(cache *CompilationCache) {
 		s.compiler.RequestID, s.fileChanges.HasTexChanges, s.fileChanges.HasBibChanges, s.fileChanges.HasAssetChanges)
 }
 
+// discardCachedWorkspace removes the project's cached workspace for a forced
+// rebuild. The entry stays, emptied, so the fresh build's entry replaces it.
+func (s *compileSession) discardCachedWorkspace(cache *CompilationCache, tempDir string) {
+	log.Printf("[%s] Forced rebuild: discarding cached temp directory %s", s.compiler.RequestID, tempDir)
+	cache.Set(s.projectID, &CacheEntry{ProjectID: s.projectID, ClientID: s.options.ClientID})
+	if err := os.RemoveAll(tempDir); err != nil {
+		log.Printf("[%s] Failed to remove cached temp dir %s: %v", s.compiler.RequestID, tempDir, err)
+	}
+}
+
 func (s *compileSession) ensureTempDir() *CompileResult {
 	if s.tempDir != "" {
 		return nil
 	}
 
-	dir, err := os.MkdirTemp("", "latex-*")
+	dir, err := s.newTempDir()
 	if err != nil {
-		return s.compiler.errorResult(s.metadata, fmt.Sprintf("Failed to create temp directory: %v", err), s.queueMs, s.receivedAt)
+		return s.failWrite("Failed to create temp directory", err)
+	}
+	if err := applyTempDirMode(dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return s.compiler.errorResult(s.metadata, fmt.Sprintf("Failed to set temp directory mode: %v", err), s.queueMs, s.receivedAt)
 	}
 
 	s.tempDir = dir
@@ -393,25 +638,44 @@ func (s *compileSession) resolveMainFilePaths() *CompileResult {
 	texPath := filepath.Join(s.tempDir, filepath.FromSlash(s.mainFilePath))
 	s.texFilePath = texPath
 	jobName := strings.TrimSuffix(filepath.Base(texPath), filepath.Ext(texPath))
-	s.pdfPath = filepath.Join(s.tempDir, fmt.Sprintf("%s.pdf", jobName))
-	s.logPath = filepath.Join(s.tempDir, fmt.Sprintf("%s.log", jobName))
+	if override := sanitizeJobName(s.options.JobName); override != "" {
+		log.Printf("[%s] Using job name override: %s", s.compiler.RequestID, override)
+		jobName = override
+	}
+	// The toolchain runs in the main file's directory and writes its output there
+	outputDir := filepath.Dir(texPath)
+	s.pdfPath = filepath.Join(outputDir, fmt.Sprintf("%s.pdf", jobName))
+	s.logPath = filepath.Join(outputDir, fmt.Sprintf("%s.log", jobName))
 	s.jobName = jobName
 
 	return nil
 }
 
+var jobNameUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sanitizeJobName reduces a requested job name to characters that are safe
+// both as a file name and as a latexmk argument
+func sanitizeJobName(name string) string {
+	name = jobNameUnsafeChars.ReplaceAllString(strings.TrimSpace(name), "_")
+	name = strings.TrimLeft(name, "._-")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
 func (s *compileSession) syncFilesToWorkspace() *CompileResult {
 	switch {
 	case s.isIncremental && s.fileChanges != nil:
 		if err := updateCachedFiles(s.tempDir, s.fileChanges); err != nil {
-			return s.compiler.errorResult(s.metadata, fmt.Sprintf("Failed to update files: %v", err), s.queueMs, s.receivedAt)
+			return s.failWrite("Failed to update files", err)
 		}
 		log.Printf("[%s] Incremental update: wrote %d changed files", s.compiler.RequestID,
 			len(s.fileChanges.Added)+len(s.fileChanges.Modified)+len(s.fileChanges.Deleted))
 		return nil
 	default:
 		if err := createFileStructure(s.tempDir, s.files); err != nil {
-			return s.compiler.errorResult(s.metadata, fmt.Sprintf("Failed to write files: %v", err), s.queueMs, s.receivedAt)
+			return s.failWrite("Failed to write files", err)
 		}
 		log.Printf("[%s] Project structure written to: %s", s.compiler.RequestID, s.tempDir)
 		return nil
@@ -423,13 +687,28 @@ func (s *compileSession) tryServeCachedPDF(cache *CompilationCache) *CompileResu
 		return nil
 	}
 
-	contentHash := HashFileSet(s.files)
-	if !cache.CheckContentHash(s.projectID, contentHash) {
+	if s.options.wantsBuildOutputs() {
+		// The cached entry only holds the PDF; anything else the build
+		// produces needs a fresh run.
 		return nil
 	}
 
-	entry, _ := cache.Get(s.projectID)
-	if entry == nil || len(entry.LastPDFData) == 0 {
+	if len(s.options.IncludeOnly) > 0 || len(s.options.Env) > 0 || s.options.Provenance {
+		// The cached PDF may hold other chapters, come from a build with
+		// different parameters, or lack a current provenance record
+		return nil
+	}
+
+	if s.options.ForceRebuild {
+		return nil
+	}
+
+	cached, ok := cache.LookupPDF(s.projectID, s.contentHash())
+	if !ok {
+		return nil
+	}
+	if s.options.ReturnText && cached.Text == nil {
+		// The cached PDF was built without extracting its text
 		return nil
 	}
 
@@ -438,15 +717,31 @@ func (s *compileSession) tryServeCachedPDF(cache *CompilationCache) *CompileResu
 	durationMs := completedAt.Sub(s.receivedAt).Milliseconds()
 
 	return &CompileResult{
-		RequestID:  s.compiler.RequestID,
-		Success:    true,
-		PDFData:    entry.LastPDFData,
-		SHA256:     entry.LastSHA256,
-		QueueMs:    s.queueMs,
-		DurationMs: durationMs,
-		PDFSize:    len(entry.LastPDFData),
-		CacheHit:   true,
+		RequestID:      s.compiler.RequestID,
+		Success:        true,
+		PDFData:        cached.Data,
+		SHA256:         cached.SHA256,
+		VisualHash:     cached.VisualHash,
+		QueueMs:        s.queueMs,
+		DurationMs:     durationMs,
+		PDFSize:        len(cached.Data),
+		CacheHit:       true,
+		Undefined:      cached.Undefined,
+		Text:           s.textResult(cached.Text),
+		Warnings:       cached.Warnings,
+		WarningSummary: cached.Summary,
+	}
+}
+
+// contentHash identifies what a cached PDF was built from: the sources and,
+// when the request chose them, the main file and the kernel release
+func (s *compileSession) contentHash() string {
+	hash := HashFileSet(s.files)
+	if s.options.MainFile == "" && s.options.LatexRelease == "" {
+		return hash
 	}
+	sum := sha256.Sum256([]byte(hash + "\x00" + s.mainFilePath + "\x00" + s.options.LatexRelease))
+	return hex.EncodeToString(sum[:])
 }
 
 func (s *compileSession) prepareWorkspace(cache *CompilationCache) *CompileResult {
@@ -465,6 +760,8 @@ func (s *compileSession) prepareWorkspace(cache *CompilationCache) *CompileResul
 	}
 
 	s.removeStaleOutputs()
+	s.removeStaleGeneratedFiles()
+	s.resolveIncludeOnly()
 
 	s.metadata.Status = "written"
 	s.compiler.persistMetadata(s.metadata)
@@ -485,9 +782,19 @@ func (s *compileSession) removeStaleOutputs() {
 			log.Printf("[%s] Warning: failed to remove stale log %s: %v", s.compiler.RequestID, s.logPath, err)
 		}
 	}
+
+	if s.pdfPath != "" {
+		if err := os.Remove(s.synctexPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[%s] Warning: failed to remove stale synctex %s: %v", s.compiler.RequestID, s.synctexPath(), err)
+		}
+		if err := os.Remove(s.xdvPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[%s] Warning: failed to remove stale xdv %s: %v", s.compiler.RequestID, s.xdvPath(), err)
+		}
+	}
 }
 
 func (s *compileSession) determineStrategy() (bool, bool) {
+	s.bibHash = bibliographyInputHash(s.files)
 	needsBib := needsBibliography(s.mainContent, s.files)
 	needsMultiPass := needsMultiplePasses(s.mainContent)
 
@@ -535,6 +842,12 @@ func (s *compileSession) adjustStrategyForIncremental(needsBib bool, needsMultiP
 				return false, needsMultiPass
 			}
 
+			if s.bibliographyUnchanged() {
+				log.Printf("[%s] INCREMENTAL: .tex changed but bibliography inputs and citations unchanged; reusing .bbl", s.compiler.RequestID)
+				s.skipBibliography = true
+				return false, needsMultiPass
+			}
+
 			// .tex changed (with/without assets); still run bibliography to refresh citations.
 			log.Printf("[%s] INCREMENTAL: .tex changed with existing bibliography; rerunning bibliography processor", s.compiler.RequestID)
 			return true, needsMultiPass
@@ -554,18 +867,40 @@ func (s *compileSession) adjustStrategyForIncremental(needsBib bool, needsMultiP
 	return needsBib, needsMultiPass
 }
 
+// bibliographyUnchanged reports whether the cached workspace already holds a
+// .bbl built from the same bibliography inputs and citation keys
+func (s *compileSession) bibliographyUnchanged() bool {
+	if s.cachedBibHash == "" || s.cachedBibHash != s.bibHash {
+		return false
+	}
+
+	bblPath := filepath.Join(filepath.Dir(s.texFilePath), s.jobName+".bbl")
+	if _, err := os.Stat(bblPath); err != nil {
+		return false
+	}
+	return true
+}
+
 func (s *compileSession) runCompilation(needsBib, needsMultiPass bool) {
 	s.exitCode = 0
+	s.compiled = true
 
 	log.Printf("[%s] Delegating compilation to latexmk (bib=%v, multi-pass=%v, pythontex=%v)",
 		s.compiler.RequestID, needsBib, needsMultiPass, s.requiresPythonTex)
 
-	s.recordExitCode(s.runLatexmk("initial"))
+	if s.requiresPythonTex {
+		s.progress.plan(StageWorkspace, StageLatexmk, StagePythonTex, StageFinalPass)
+	}
+
+	s.progress.enter(StageLatexmk)
+	s.runPass("initial", true, func() error { return s.runToolchain("initial", needsBib, needsMultiPass) })
 
 	if s.exitCode == 0 && s.requiresPythonTex {
-		s.recordExitCode(s.runPythonTex())
+		s.progress.enter(StagePythonTex)
+		s.runPass("pythontex", false, s.runPythonTex)
 		if s.exitCode == 0 {
-			s.recordExitCode(s.runLatexmk("post-pythontex"))
+			s.progress.enter(StageFinalPass)
+			s.runPass("post-pythontex", true, func() error { return s.runToolchain("post-pythontex", needsBib, needsMultiPass) })
 		}
 	}
 }
@@ -580,7 +915,15 @@ func (s *compileSession) runLatexmk(stage string) error {
 	if s.requiresShellEscape {
 		engineOpts = append(engineOpts, "-shell-escape")
 	}
-	latexCommand := fmt.Sprintf("%s %s %%O %%S", s.engine.command(), strings.Join(engineOpts, " "))
+	if s.options.writesSynctex() {
+		engineOpts = append(engineOpts, "-synctex=1")
+	}
+	source := "%S"
+	preTex := s.preTexCode()
+	if preTex != "" {
+		source = "%P"
+	}
+	latexCommand := fmt.Sprintf("%s %s %%O %s", s.engine.command(), strings.Join(engineOpts, " "), source)
 
 	args := []string{
 		"-silent",
@@ -588,13 +931,38 @@ func (s *compileSession) runLatexmk(stage string) error {
 		"-pdf",
 		"-pdflatex=" + latexCommand,
 	}
+	if s.keepsXdv() {
+		// Run xelatex -no-pdf and xdvipdfmx as separate steps so the .xdv
+		// survives in the temp dir.
+		xdvCommand := fmt.Sprintf("%s -no-pdf %s %%O %s", s.engine.command(), strings.Join(engineOpts, " "), source)
+		args = []string{
+			"-silent",
+			"-f",
+			"-pdfxe",
+			"-xelatex=" + xdvCommand,
+		}
+	}
+	if preTex != "" {
+		args = append(args, "-pretex="+preTex)
+	}
+	if s.options.ReturnTimings {
+		args = append(args, "-time")
+	}
+	if sanitizeJobName(s.options.JobName) != "" {
+		args = append(args, "-jobname="+s.jobName)
+	}
+	if s.skipBibliography {
+		// Keep the existing .bbl; the bibliography inputs have not changed.
+		args = append(args, "-bibtex-")
+	}
 
-	cmd := exec.Command("latexmk", append(args, filepath.Base(s.texFilePath))...)
+	cmd := s.command("latexmk", append(args, filepath.Base(s.texFilePath))...)
 	cmd.Dir = filepath.Dir(s.texFilePath)
+	cmd.Env = s.toolchainEnv()
 	cmd.Stdout = &s.stdout
 	cmd.Stderr = &s.stderr
 
-	err := cmd.Run()
+	err := s.runToolchainCommand(cmd)
 	if err != nil {
 		log.Printf("[%s] latexmk (%s) exited with error: %v", s.compiler.RequestID, stage, err)
 	} else {
@@ -603,14 +971,88 @@ func (s *compileSession) runLatexmk(stage string) error {
 	return err
 }
 
+// toolchainEnv returns the environment for this session's tool processes
+func (s *compileSession) toolchainEnv() []string {
+	var extra []string
+	if s.options.SourceDateEpoch > 0 {
+		// Fixed timestamps (and a stable /ID) make the PDF reproducible
+		extra = append(extra, fmt.Sprintf("SOURCE_DATE_EPOCH=%d", s.options.SourceDateEpoch), "FORCE_SOURCE_DATE=1")
+	}
+	if texInputs := texInputsEnv(); texInputs != "" {
+		extra = append(extra, texInputs)
+	}
+	extra = append(extra, requestEnv(s.options.Env)...)
+	if safeMode {
+		// Last, so that request variables cannot loosen it
+		extra = append(extra, safeModeEnv...)
+	}
+	return toolchainEnv(extra...)
+}
+
+// preTexCode returns TeX code that latexmk runs before inputting the main file
+// (substituted for %P in the engine command), or "" when none is needed.
+func (s *compileSession) preTexCode() string {
+	var code strings.Builder
+
+	// First, so that no other pre-TeX code can load a denied package
+	code.WriteString(deniedPackageHooks())
+
+	if s.options.LatexRelease != "" {
+		code.WriteString(latexReleaseDirective(s.options.LatexRelease))
+	}
+
+	if (s.options.ReturnManifest || s.options.Provenance) && !s.documentUsesListfiles() {
+		code.WriteString(`\listfiles`)
+	}
+
+	if s.options.ReturnTimings {
+		code.WriteString(packageTimingHooks)
+	}
+
+	if s.options.SplitByChapter {
+		code.WriteString(chapterPageHook)
+	}
+
+	if len(s.includeOnly) > 0 {
+		code.WriteString(`\includeonly{` + strings.Join(s.includeOnly, ",") + `}`)
+	}
+
+	return code.String()
+}
+
+func (s *compileSession) documentUsesListfiles() bool {
+	for _, file := range s.files {
+		if file.Encoding == "base64" {
+			continue
+		}
+		if strings.Contains(file.Content, `\listfiles`) {
+			return true
+		}
+	}
+	return false
+}
+
+// pythontexCacheDir is where pythontex keeps the output of each code session
+// along with its hash; it lives in the cached workspace, so incremental
+// compiles only rerun sessions whose code changed
+func (s *compileSession) pythontexCacheDir() string {
+	return filepath.Join(filepath.Dir(s.texFilePath), "pythontex-files-"+s.jobName)
+}
+
 func (s *compileSession) runPythonTex() error {
 	log.Printf("[%s] Running pythontex helper...", s.compiler.RequestID)
-	cmd := exec.Command("pythontex", filepath.Base(s.texFilePath))
-	cmd.Dir = s.tempDir
+	if _, err := os.Stat(s.pythontexCacheDir()); err == nil {
+		log.Printf("[%s] Reusing pythontex output cache %s", s.compiler.RequestID, filepath.Base(s.pythontexCacheDir()))
+	}
+
+	// pythontex reads <jobname>.pytxcode, written next to the PDF by the engine
+	cmd := s.command("pythontex", s.jobName)
+	cmd.Dir = filepath.Dir(s.texFilePath)
+	cmd.Env = s.toolchainEnv()
 	cmd.Stdout = &s.stdout
 	cmd.Stderr = &s.stderr
 
-	err := cmd.Run()
+	err := s.runToolchainCommand(cmd)
 	if err != nil {
 		log.Printf("[%s] pythontex exited with error: %v", s.compiler.RequestID, err)
 	} else {
@@ -623,15 +1065,41 @@ func (s *compileSession) recordExitCode(err error) {
 	if err == nil {
 		return
 	}
+	s.exitCode = exitCodeOf(err)
+}
 
-	if exitError, ok := err.(*exec.ExitError); ok {
-		s.exitCode = exitError.ExitCode()
-	} else {
-		s.exitCode = -1
+// recordPeakRss keeps the largest resident set size reported for any toolchain
+// process run in this session. On Linux, wait4 folds reaped descendants into
+// Maxrss (in kilobytes), so engine runs spawned by latexmk are included.
+func (s *compileSession) recordPeakRss(state *os.ProcessState) {
+	if state == nil {
+		return
+	}
+
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || usage == nil {
+		return
+	}
+
+	if kb := int64(usage.Maxrss); kb > s.peakRssKb {
+		s.peakRssKb = kb
 	}
 }
 
 func (s *compileSession) finalize(cache *CompilationCache) *CompileResult {
+	if s.superseded() {
+		return s.abandonSuperseded(cache)
+	}
+
+	if s.timedOut() {
+		return s.abandonTimedOut(cache)
+	}
+
+	if s.cpuLimitExceeded {
+		log.Printf("[%s] CPU-time limit exceeded after %s", s.compiler.RequestID, s.cpuTime)
+		return s.failToolchain(s.cpuLimitError())
+	}
+
 	completedAt := time.Now()
 	durationMs := completedAt.Sub(s.receivedAt).Milliseconds()
 
@@ -640,8 +1108,10 @@ func (s *compileSession) finalize(cache *CompilationCache) *CompileResult {
 	s.metadata.ExitCode = s.exitCode
 	s.metadata.StdoutBytes = s.stdout.Len()
 	s.metadata.StderrBytes = s.stderr.Len()
+	s.metadata.PeakRssKb = s.peakRssKb
 
 	log.Printf("[%s] Compilation completed with exit code: %d", s.compiler.RequestID, s.exitCode)
+	log.Printf("[%s] Peak RSS: %d KB", s.compiler.RequestID, s.peakRssKb)
 	log.Printf("[%s] Total stdout length: %d bytes", s.compiler.RequestID, s.stdout.Len())
 	log.Printf("[%s] Total stderr length: %d bytes", s.compiler.RequestID, s.stderr.Len())
 
@@ -652,24 +1122,93 @@ func (s *compileSession) finalize(cache *CompilationCache) *CompileResult {
 			return s.compiler.errorResult(s.metadata, "Invalid PDF format", s.queueMs, s.receivedAt)
 		}
 
-		hash := sha256.Sum256(pdfData)
-		sha256Hex := hex.EncodeToString(hash[:])
-
 		logContent := ""
 		if logData, err := os.ReadFile(s.logPath); err == nil {
 			logContent = string(logData)
 		}
 
+		provenanceError := ""
+		if s.options.Provenance {
+			if embedded, err := s.embedProvenance(logContent); err != nil {
+				log.Printf("[%s] Warning: failed to attach provenance record: %v", s.compiler.RequestID, err)
+				provenanceError = err.Error()
+			} else {
+				pdfData = embedded
+				log.Printf("[%s] Attached provenance record", s.compiler.RequestID)
+			}
+		}
+
+		hash := sha256.Sum256(pdfData)
+		sha256Hex := hex.EncodeToString(hash[:])
+		visual := visualHash(pdfData)
+
 		s.metadata.LogTail = tailLines(truncateText(logContent, MaxLogChars), LogTailLines)
 
+		var manifest []PackageInfo
+		if s.options.ReturnManifest {
+			manifest = parseFileList(logContent)
+			log.Printf("[%s] Package manifest: %d entries", s.compiler.RequestID, len(manifest))
+		}
+
+		memory := s.memoryUsage(logContent)
+
+		var synctex []byte
+		if s.options.ReturnSynctex {
+			if synctex, err = s.readSynctex(); err != nil {
+				log.Printf("[%s] Warning: SyncTeX data unavailable: %v", s.compiler.RequestID, err)
+			}
+		}
+
+		var timings *CompileTimings
+		if s.options.ReturnTimings {
+			timings = parseTimings(s.stdout.String()+s.stderr.String(), logContent)
+		}
+
+		var auxFiles map[string]string
+		if s.options.ReturnAllAux {
+			auxFiles = s.collectAuxFiles()
+			log.Printf("[%s] Collected %d .aux files", s.compiler.RequestID, len(auxFiles))
+		}
+
+		var chapters []ChapterPDF
+		if s.options.SplitByChapter {
+			chapters = s.splitByChapter(logContent)
+		}
+
+		var floats *FloatInventory
+		if s.options.ReturnFloats {
+			floats = s.floatInventory()
+		}
+
+		var xdv []byte
+		if s.options.ReturnXdv {
+			if xdv, err = s.readXdv(); err != nil {
+				log.Printf("[%s] Warning: XDV data unavailable: %v", s.compiler.RequestID, err)
+			}
+		}
+
+		undefined := parseUndefinedReferences(logContent)
+		if undefined.ReferenceCount > 0 || undefined.CitationCount > 0 {
+			log.Printf("[%s] Unresolved references: %d, citations: %d", s.compiler.RequestID, undefined.ReferenceCount, undefined.CitationCount)
+		}
+
 		// LaTeX exit codes:
 		// 0 = success with no warnings
 		// 1 = fatal error (no PDF)
 		// 2 = success with warnings (e.g., missing citations, undefined references)
 		// Since we have a valid PDF, treat exit codes 0-2 as success
 		if s.exitCode > 2 {
-			errMsg := fmt.Sprintf("LaTeX toolchain exited with code %d", s.exitCode)
+			errMsg, errCode := fmt.Sprintf("LaTeX toolchain exited with code %d", s.exitCode), ""
 			log.Printf("[%s] Compilation produced PDF but exited with code %d", s.compiler.RequestID, s.exitCode)
+			// An overflow, or a denied package loaded late, can stop the
+			// engine after it shipped some pages
+			if err := detectDeniedPackageLoad(logContent); err != nil {
+				log.Printf("[%s] %v", s.compiler.RequestID, err)
+				errMsg, errCode = err.Error(), errorCode(err)
+			} else if err := detectMemoryOverflow(logContent); err != nil {
+				log.Printf("[%s] %v", s.compiler.RequestID, err)
+				errMsg, errCode = err.Error(), errorCode(err)
+			}
 			s.metadata.Status = "error"
 			s.metadata.Error = errMsg
 			s.compiler.persistMetadata(s.metadata)
@@ -679,11 +1218,18 @@ func (s *compileSession) finalize(cache *CompilationCache) *CompileResult {
 				Success:      false,
 				PDFData:      pdfData, // Include partial PDF even on error
 				ErrorMessage: errMsg,
+				ErrorCode:    errCode,
 				Stdout:       truncateText(s.stdout.String(), MaxLogChars),
 				Stderr:       truncateText(s.stderr.String(), MaxLogChars),
 				LogTail:      s.metadata.LogTail,
 				QueueMs:      s.queueMs,
 				DurationMs:   durationMs,
+				PeakRssKb:    s.peakRssKb,
+				Memory:       memory,
+				Passes:       s.passes,
+				Sarif:        s.sarif(logContent),
+				FullLog:      s.fullLog(logContent),
+				Errors:       s.latexErrors(logContent),
 			}
 		}
 
@@ -691,22 +1237,38 @@ func (s *compileSession) finalize(cache *CompilationCache) *CompileResult {
 			log.Printf("[%s] LaTeX completed with warnings (exit code 2), but PDF was generated successfully", s.compiler.RequestID)
 		}
 
+		text := s.extractText()
+		warnings, summary := ParseLatexWarnings(logContent), SummarizeLatexWarnings(logContent)
+
 		s.metadata.Status = "success"
 		s.metadata.PDFSize = len(pdfData)
 		s.metadata.SHA256 = sha256Hex
 		s.compiler.persistMetadata(s.metadata)
 
 		if s.projectID != "" {
-			contentHash := HashFileSet(s.files)
+			contentHash := s.contentHash()
 			fileHashes := buildFileHashMap(s.files)
+			cachedPDF, cachedText := pdfData, text
+			if len(s.includeOnly) > 0 || len(s.options.Env) > 0 || s.options.Provenance {
+				// A partial, parameterized, or stamped PDF must not answer
+				// a later build of the same sources; keep only the workspace.
+				contentHash, cachedPDF, cachedText = "", nil, nil
+			}
 
 			cacheEntry := &CacheEntry{
 				ProjectID:      s.projectID,
-				TempDir:        s.tempDir,
+				ClientID:       s.options.ClientID,
+				TempDir:        s.workspaceDir(),
 				FileHashes:     fileHashes,
 				ContentHash:    contentHash,
-				LastPDFData:    pdfData,
+				BibHash:        s.bibHash,
+				LastPDFData:    cachedPDF,
 				LastSHA256:     sha256Hex,
+				LastVisualHash: visual,
+				LastUndefined:  undefined,
+				LastText:       cachedText,
+				LastWarnings:   warnings,
+				LastSummary:    summary,
 				LastAccessTime: time.Now(),
 			}
 
@@ -717,14 +1279,36 @@ func (s *compileSession) finalize(cache *CompilationCache) *CompileResult {
 		log.Printf("[%s] Compilation successful", s.compiler.RequestID)
 
 		return &CompileResult{
-			RequestID:  s.compiler.RequestID,
-			Success:    true,
-			PDFData:    pdfData,
-			SHA256:     sha256Hex,
-			QueueMs:    s.queueMs,
-			DurationMs: durationMs,
-			PDFSize:    len(pdfData),
-			CacheHit:   false,
+			RequestID:       s.compiler.RequestID,
+			Success:         true,
+			PDFData:         pdfData,
+			SHA256:          sha256Hex,
+			VisualHash:      visual,
+			QueueMs:         s.queueMs,
+			DurationMs:      durationMs,
+			PDFSize:         len(pdfData),
+			PeakRssKb:       s.peakRssKb,
+			CacheHit:        false,
+			Manifest:        manifest,
+			Undefined:       undefined,
+			Memory:          memory,
+			Synctex:         synctex,
+			Text:            s.textResult(text),
+			Xdv:             xdv,
+			Timings:         timings,
+			AuxFiles:        auxFiles,
+			Chapters:        chapters,
+			Passes:          s.passes,
+			Floats:          floats,
+			Macros:          s.macroList(),
+			Bibliography:    s.bibliography(),
+			BibCollisions:   s.bibCollisions(),
+			SyncTarget:      s.forwardSync(),
+			Warnings:        warnings,
+			WarningSummary:  summary,
+			Sarif:           s.sarif(logContent),
+			FullLog:         s.fullLog(logContent),
+			ProvenanceError: provenanceError,
 		}
 	}
 
@@ -734,20 +1318,63 @@ func (s *compileSession) finalize(cache *CompilationCache) *CompileResult {
 		log.Printf("[%s] LaTeX log excerpt: %s", s.compiler.RequestID, logContent[:min(500, len(logContent))])
 	}
 
+	errMsg, errCode := "PDF file not generated", ""
+	if err := detectDeniedPackageLoad(logContent); err != nil {
+		log.Printf("[%s] %v", s.compiler.RequestID, err)
+		errMsg, errCode = err.Error(), errorCode(err)
+	} else if err := detectMemoryOverflow(logContent); err != nil {
+		log.Printf("[%s] %v", s.compiler.RequestID, err)
+		errMsg, errCode = err.Error(), errorCode(err)
+	} else if err := detectDiskFull(logContent, s.stdout.String(), s.stderr.String()); err != nil {
+		log.Printf("[%s] %v", s.compiler.RequestID, err)
+		errMsg, errCode = err.Error(), errorCode(err)
+	}
+
 	s.metadata.Status = "error"
+	s.metadata.Error = errMsg
 	s.metadata.LogTail = tailLines(logContent, LogTailLines)
 	s.compiler.persistMetadata(s.metadata)
 
 	return &CompileResult{
 		RequestID:    s.compiler.RequestID,
 		Success:      false,
-		ErrorMessage: "PDF file not generated",
+		ErrorMessage: errMsg,
+		ErrorCode:    errCode,
 		Stdout:       truncateText(s.stdout.String(), MaxLogChars),
 		Stderr:       truncateText(s.stderr.String(), MaxLogChars),
 		LogTail:      s.metadata.LogTail,
 		QueueMs:      s.queueMs,
 		DurationMs:   durationMs,
+		PeakRssKb:    s.peakRssKb,
+		Memory:       s.memoryUsage(logContent),
+		Passes:       s.passes,
+		Sarif:        s.sarif(logContent),
+		FullLog:      s.fullLog(logContent),
+		Errors:       s.latexErrors(logContent),
+	}
+}
+
+// memoryUsage parses the engine's memory report when the request asked for it
+func (s *compileSession) memoryUsage(logContent string) *MemoryUsage {
+	if !s.options.ReturnMemoryUsage {
+		return nil
+	}
+
+	memory := parseMemoryUsage(logContent)
+	if memory != nil {
+		for _, warning := range memory.Warnings {
+			log.Printf("[%s] TeX memory near limit: %s", s.compiler.RequestID, warning)
+		}
+	}
+	return memory
+}
+
+// fullLog returns the complete log when the request asked for it
+func (s *compileSession) fullLog(logContent string) string {
+	if !s.options.FullLog {
+		return ""
 	}
+	return logContent
 }
 
 func (s *compileSession) cleanup() {
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const citingDocument = `\documentclass{article}
+\begin{document}
+%s \cite{knuth1984}.
+\bibliographystyle{plain}
+\bibliography{refs}
+\end{document}`
+
+const refsBib = `@book{knuth1984, author = {Donald Knuth}, title = {The TeXbook}, year = {1984}}
+@book{lamport1994, author = {Leslie Lamport}, title = {LaTeX}, year = {1994}}`
+
+func TestIncrementalCompileSkipsBibliographyForProseEdits(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	projectID := "bib-skip-test"
+	forgetProject(t, projectID)
+
+	compile := func(body string) []string {
+		argsFile := t.TempDir() + "/args"
+		t.Setenv("FAKE_LATEXMK_ARGS", argsFile)
+
+		files := []FileEntry{
+			{Path: "main.tex", Content: strings.Replace(citingDocument, "%s", body, 1)},
+			{Path: "refs.bib", Content: refsBib},
+		}
+		result := New().Compile(files, time.Now(), projectID, CompileOptions{})
+		if !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+
+		data, err := os.ReadFile(argsFile)
+		if err != nil {
+			t.Fatalf("failed to read latexmk args: %v", err)
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	if args := compile("As shown in"); containsString(args, "-bibtex-") {
+		t.Fatalf("initial compile must run the bibliography tool, got %v", args)
+	}
+	if args := compile("As famously shown in"); !containsString(args, "-bibtex-") {
+		t.Fatalf("prose-only edit should skip the bibliography tool, got %v", args)
+	}
+	if args := compile(`See \cite{lamport1994} and`); containsString(args, "-bibtex-") {
+		t.Fatalf("new citation should rerun the bibliography tool, got %v", args)
+	}
+}
+
+func TestExtractCitationKeys(t *testing.T) {
+	keys := extractCitationKeys(`\citestyle{authoryear} \citep[p.~4]{b, a} \citesetup{x} \textcite{c} \nocite{a} % \cite{ignored}`)
+	if strings.Join(keys, ",") != "b,a,c" {
+		t.Fatalf("unexpected citation keys: %v", keys)
+	}
+}
+
+func TestDetectBibliographyToolReadsClassBackend(t *testing.T) {
+	mainContent := "\\documentclass{thesis}\n\\begin{document}\n\\cite{knuth1984}\n\\end{document}"
+	files := []FileEntry{
+		{Path: "main.tex", Content: mainContent},
+		{Path: "thesis.cls", Content: "\\RequirePackage{biblatex}\n\\ExecuteBibliographyOptions{sorting=nyt, backend =\n  biber}"},
+	}
+	if tool := detectBibliographyTool(mainContent, files); tool != bibliographyToolBiber {
+		t.Fatalf("expected the class's biber backend to be detected, got %s", tool)
+	}
+
+	files[1].Content = "\\RequirePackage[backend = bibtex]{biblatex}"
+	if tool := detectBibliographyTool(mainContent, files); tool != bibliographyToolBibtex {
+		t.Fatalf("expected the class's bibtex backend to be detected, got %s", tool)
+	}
+}
+
+func TestBibliographyHashCoversStyleOptionsAndCitationOrder(t *testing.T) {
+	hash := func(body string) string {
+		return bibliographyInputHash([]FileEntry{
+			{Path: "main.tex", Content: body},
+			{Path: "refs.bib", Content: refsBib},
+		})
+	}
+	base := hash(`\bibliographystyle{plain} Prose \cite{knuth1984} and \cite{lamport1994}.`)
+
+	if hash(`\bibliographystyle{plain} Other prose \cite{knuth1984} and \cite{lamport1994}.`) != base {
+		t.Fatalf("expected prose edits to keep the bibliography hash")
+	}
+	for name, body := range map[string]string{
+		"style":            `\bibliographystyle{alpha} Prose \cite{knuth1984} and \cite{lamport1994}.`,
+		"citation order":   `\bibliographystyle{plain} Prose \cite{lamport1994} and \cite{knuth1984}.`,
+		"biblatex options": `\usepackage[style=numeric]{biblatex}\bibliographystyle{plain} Prose \cite{knuth1984} and \cite{lamport1994}.`,
+	} {
+		if hash(body) == base {
+			t.Errorf("expected a change of %s to change the bibliography hash", name)
+		}
+	}
+}
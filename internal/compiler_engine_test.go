@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreferredUnicodeEngineHandlesFontspecDocuments(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	t.Cleanup(func() { _ = SetPreferredUnicodeEngine("") })
+
+	engineFor := func(document string) string {
+		readArgs := recordLatexmkArgs(t)
+		result := New().Compile([]FileEntry{{Path: "main.tex", Content: document}}, time.Now(), "", CompileOptions{})
+		if !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+		for _, arg := range readArgs() {
+			if command, ok := strings.CutPrefix(arg, "-pdflatex="); ok {
+				return strings.Fields(command)[0]
+			}
+		}
+		t.Fatalf("latexmk received no engine command")
+		return ""
+	}
+
+	if engine := engineFor(xelatexDocument); engine != "xelatex" {
+		t.Fatalf("expected xelatex by default, got %s", engine)
+	}
+
+	if err := SetPreferredUnicodeEngine("lualatex"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if engine := engineFor(xelatexDocument); engine != "lualatex" {
+		t.Fatalf("expected the preferred lualatex for a fontspec-only document, got %s", engine)
+	}
+
+	xeCJK := "\\documentclass{article}\n\\usepackage{xeCJK}\n\\begin{document}\n\\end{document}"
+	if engine := engineFor(xeCJK); engine != "xelatex" {
+		t.Fatalf("expected xeCJK to keep xelatex, got %s", engine)
+	}
+
+	if err := SetPreferredUnicodeEngine("pdflatex"); err == nil {
+		t.Fatalf("expected pdflatex to be rejected as a Unicode engine")
+	}
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const simpleDocument = `\documentclass{article}
+\begin{document}
+Hello from Octree!
+\end{document}`
+
+// fakeLatexmkScript stands in for latexmk in tests: it writes a minimal PDF
+// and log for the job named by -jobname or the last argument, plus a .bbl when
+// the project has a .bib file. When FAKE_LATEXMK_ARGS is
+// set, each invocation's arguments are appended to that file.
+var fakeLatexmkScript = fakeLatexmkWithLog("This is a fake log\n")
+
+// fakeLatexmkWithLog is fakeLatexmkScript with a custom log body.
+func fakeLatexmkWithLog(logContent string) string {
+	return `[ -n "$FAKE_LATEXMK_ARGS" ] && printf '%s\n' "$@" >> "$FAKE_LATEXMK_ARGS"
+job=""
+for arg; do
+	case "$arg" in
+	-jobname=*) job="${arg#-jobname=}" ;;
+	esac
+	last="$arg"
+done
+[ -n "$job" ] || job="${last%.*}"
+printf '%%PDF-1.4\n%%fake\n' > "$job.pdf"
+for bib in *.bib; do [ -e "$bib" ] && : > "$job.bbl"; break; done
+cat > "$job.log" <<'FAKELOG'
+` + logContent + `FAKELOG
+`
+}
+
+// installFakeTools writes each script as an executable in a temporary
+// directory and prepends it to PATH for the duration of the test.
+func installFakeTools(t *testing.T, tools map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, body := range tools {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+			t.Fatalf("failed to write fake %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+// forgetProject drops a project's cache entry (and its temp dir) when the
+// test finishes.
+func forgetProject(t *testing.T, projectID string) {
+	t.Helper()
+	t.Cleanup(func() {
+		cache := GetCache()
+		cache.globalMutex.Lock()
+		cache.removeEntryLocked(projectID)
+		cache.globalMutex.Unlock()
+	})
+}
+
+// recordLatexmkArgs makes the fake latexmk log its arguments and returns a
+// function reading them back.
+func recordLatexmkArgs(t *testing.T) func() []string {
+	t.Helper()
+
+	argsFile := filepath.Join(t.TempDir(), "latexmk.args")
+	t.Setenv("FAKE_LATEXMK_ARGS", argsFile)
+
+	return func() []string {
+		data, err := os.ReadFile(argsFile)
+		if err != nil {
+			t.Fatalf("failed to read recorded latexmk args: %v", err)
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+}
@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestForceRebuildReplacesCachedWorkspace(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	projectID := "force-rebuild"
+	forgetProject(t, projectID)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	if result := New().Compile(files, time.Now(), projectID, CompileOptions{}); !result.Success {
+		t.Fatalf("first compile failed: %s", result.ErrorMessage)
+	}
+	entry, _ := GetCache().Get(projectID)
+	oldDir := entry.TempDir
+	// Stand-in for corrupted auxiliary state left by an earlier build
+	if err := os.WriteFile(filepath.Join(oldDir, "main.aux"), []byte("\\corrupt{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := New().Compile(files, time.Now(), projectID, CompileOptions{}); !result.CacheHit {
+		t.Fatalf("expected an unchanged project to be served from the cache")
+	}
+
+	result := New().Compile(files, time.Now(), projectID, CompileOptions{ForceRebuild: true})
+	if !result.Success || result.CacheHit {
+		t.Fatalf("expected a fresh successful build, got success=%v cacheHit=%v", result.Success, result.CacheHit)
+	}
+	if _, err := os.Stat(oldDir); !os.IsNotExist(err) {
+		t.Fatalf("expected the old workspace to be removed, stat: %v", err)
+	}
+
+	entry, _ = GetCache().Get(projectID)
+	if entry.TempDir == "" || entry.TempDir == oldDir || len(entry.LastPDFData) == 0 {
+		t.Fatalf("expected the cache entry to hold the fresh workspace and PDF, got dir %q", entry.TempDir)
+	}
+	if _, err := os.Stat(filepath.Join(entry.TempDir, "main.aux")); !os.IsNotExist(err) {
+		t.Fatalf("expected the fresh workspace not to inherit the old .aux")
+	}
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileReturnsFullLogOnRequest(t *testing.T) {
+	var logContent strings.Builder
+	for i := 1; i <= 3*LogTailLines; i++ {
+		fmt.Fprintf(&logContent, "(/usr/share/texmf/tex/latex/pkg%d.sty) line %d\n", i, i)
+	}
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(logContent.String())})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{FullLog: true})
+	if !result.Success {
+		t.Fatalf("expected success: %s", result.ErrorMessage)
+	}
+	if result.FullLog != logContent.String() {
+		t.Fatalf("expected the complete log (%d bytes), got %d bytes", logContent.Len(), len(result.FullLog))
+	}
+	if strings.Contains(result.LogTail, "pkg1.sty") {
+		t.Fatalf("expected the log tail to stay truncated")
+	}
+
+	result = New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.FullLog != "" {
+		t.Fatalf("expected no full log unless requested")
+	}
+}
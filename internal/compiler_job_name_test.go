@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSanitizeJobName(t *testing.T) {
+	cases := map[string]string{
+		"output":          "output",
+		" my report ":     "my_report",
+		"../etc/passwd":   "etc_passwd",
+		"-shell-escape":   "shell-escape",
+		"thesis.v2-final": "thesis.v2-final",
+	}
+
+	for input, want := range cases {
+		if got := sanitizeJobName(input); got != want {
+			t.Errorf("sanitizeJobName(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestCompileUsesJobNameOverride(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	readArgs := recordLatexmkArgs(t)
+
+	session := newCompileSession(New(), []FileEntry{{Path: "paper.tex", Content: simpleDocument}}, time.Now(), "", CompileOptions{JobName: "output"})
+	session.tempDir = t.TempDir()
+	if result := session.resolveMainFilePaths(); result != nil {
+		t.Fatalf("unexpected error resolving paths: %s", result.ErrorMessage)
+	}
+	if filepath.Base(session.pdfPath) != "output.pdf" || filepath.Base(session.logPath) != "output.log" {
+		t.Fatalf("expected output.pdf/output.log, got %s and %s", session.pdfPath, session.logPath)
+	}
+
+	files := []FileEntry{{Path: "paper.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{JobName: "output"})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	args := readArgs()
+	if !containsString(args, "-jobname=output") {
+		t.Fatalf("expected -jobname=output in latexmk args, got %v", args)
+	}
+	if args[len(args)-1] != "paper.tex" {
+		t.Fatalf("expected latexmk to still compile paper.tex, got %v", args)
+	}
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompileSelectsLtxMainFile(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{
+		{Path: "macros.sty", Content: `\ProvidesPackage{macros}`},
+		{Path: "paper.ltx", Content: simpleDocument},
+	}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	args := readArgs()
+	if len(args) == 0 || args[len(args)-1] != "paper.ltx" {
+		t.Fatalf("expected latexmk to compile paper.ltx, got %v", args)
+	}
+}
+
+func TestFindMainFileHonorsExtraExtensions(t *testing.T) {
+	files := []FileEntry{
+		{Path: "notes.txt", Content: `\documentclass{article}`},
+		{Path: "thesis.latex", Content: `\documentclass{book}`},
+	}
+	if main, hasDocclass, found := findMainFile(files); !found || !hasDocclass || main.Path != "thesis.latex" {
+		t.Fatalf("expected thesis.latex to be selected, got %q", main.Path)
+	}
+
+	SetExtraMainFileExtensions([]string{"txt"})
+	t.Cleanup(func() { SetExtraMainFileExtensions(nil) })
+
+	if main, _, _ := findMainFile(files); main.Path != "notes.txt" {
+		t.Fatalf("expected configured .txt extension to be accepted, got %q", main.Path)
+	}
+}
+
+func TestFindMainFileHonorsTexRootDirective(t *testing.T) {
+	files := []FileEntry{
+		{Path: "figures/plot.tex", Content: "\\documentclass{standalone}\n\\begin{document}x\\end{document}"},
+		{Path: "chapters/intro.tex", Content: "% !TEX root = ../thesis.tex\n\\chapter{Intro}"},
+		{Path: "thesis.tex", Content: simpleDocument},
+	}
+
+	main, hasDocclass, found := findMainFile(files)
+	if !found || !hasDocclass || main.Path != "thesis.tex" {
+		t.Fatalf("expected thesis.tex from the %%!TEX root directive, got %q", main.Path)
+	}
+
+	// A directive pointing at a missing file is ignored
+	files[1].Content = "%!TEX root=missing.tex\n"
+	files[2].Content = "\\documentclass{book}\n\\input{body}"
+	if main, _, _ := findMainFile(files); main.Path != "thesis.tex" {
+		t.Fatalf("expected fallback to \\documentclass detection, got %q", main.Path)
+	}
+}
+
+func TestCompileUsesRequestedMainFile(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	readArgs := recordLatexmkArgs(t)
+	projectID := "requested-main-file-test"
+	forgetProject(t, projectID)
+
+	// Both files are complete documents
+	files := []FileEntry{
+		{Path: "figures/plot.tex", Content: "\\documentclass{standalone}\n\\begin{document}x\\end{document}"},
+		{Path: "thesis.tex", Content: simpleDocument},
+	}
+	compile := func(mainFile string) string {
+		result := New().Compile(files, time.Now(), projectID, CompileOptions{MainFile: mainFile})
+		if !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+		args := readArgs()
+		if result.CacheHit || len(args) == 0 {
+			return ""
+		}
+		return args[len(args)-1]
+	}
+
+	if got := compile("./thesis.tex"); got != "thesis.tex" {
+		t.Fatalf("expected latexmk to compile thesis.tex, got %q", got)
+	}
+	// The PDF cached for thesis.tex must not answer a build of another root
+	if got := compile("figures/plot.tex"); got != "plot.tex" {
+		t.Fatalf("expected latexmk to compile plot.tex, got %q", got)
+	}
+}
+
+func TestCompileRejectsMissingMainFile(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{MainFile: "thesis.tex"})
+	if result.Success || result.ErrorCode != "MAIN_FILE_NOT_FOUND" {
+		t.Fatalf("expected MAIN_FILE_NOT_FOUND, got success=%v code=%q", result.Success, result.ErrorCode)
+	}
+}
+
+func TestFindMainFilePrefersFullDocument(t *testing.T) {
+	// A modular thesis: chapters are subfiles of main.tex, figures are
+	// standalone, and the preamble lives in its own file
+	files := []FileEntry{
+		{Path: "chapters/intro.tex", Content: "\\documentclass[../main.tex]{subfiles}\n\\begin{document}\n\\chapter{Introduction}\n\\end{document}"},
+		{Path: "figures/pipeline.tex", Content: "\\documentclass[tikz, border=2pt]{standalone}\n\\begin{document}\n\\begin{tikzpicture}\\end{tikzpicture}\n\\end{document}"},
+		{Path: "preamble.tex", Content: "\\usepackage{subfiles}\n\\usepackage{tikz}"},
+		{Path: "main.tex", Content: "% \\documentclass{article}\n\\documentclass[12pt]{report}\n\\input{preamble}\n\\begin{document}\n\\subfile{chapters/intro}\n\\end{document}"},
+	}
+	if main, hasDocclass, _ := findMainFile(files); main.Path != "main.tex" || !hasDocclass {
+		t.Fatalf("expected main.tex, got %q", main.Path)
+	}
+
+	// Without the root, a standalone part is still preferred over a subfile
+	if main, _, _ := findMainFile(files[:3]); main.Path != "figures/pipeline.tex" {
+		t.Fatalf("expected the standalone figure, got %q", main.Path)
+	}
+	if main, _, _ := findMainFile(files[:1]); main.Path != "chapters/intro.tex" {
+		t.Fatalf("expected the lone subfile, got %q", main.Path)
+	}
+}
+
+func TestMainFileRank(t *testing.T) {
+	cases := []struct {
+		content string
+		want    int
+	}{
+		{"\\documentclass{article}\n\\begin{document}\\end{document}", mainRankDocument},
+		{"\\documentclass [a4paper]{ article }\n\\input{body}", mainRankPreamble},
+		{"\\documentclass[class=article]{standalone}\n\\begin{document}\\end{document}", mainRankStandalone},
+		{"\\documentclass[main]{subfiles}\n\\begin{document}\\end{document}", mainRankSubfile},
+		{"% \\documentclass{article}\n\\section{Notes}", mainRankNoClass},
+	}
+	for _, tc := range cases {
+		if got := mainFileRank(tc.content); got != tc.want {
+			t.Errorf("mainFileRank(%q) = %d, want %d", tc.content, got, tc.want)
+		}
+	}
+}
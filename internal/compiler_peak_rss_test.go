@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestCompileReportsPeakRss(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if result.PeakRssKb <= 0 {
+		t.Fatalf("expected positive peak RSS, got %d", result.PeakRssKb)
+	}
+}
+
+func TestCompileReportsPeakRssWithRealToolchain(t *testing.T) {
+	if _, err := exec.LookPath("latexmk"); err != nil {
+		t.Skip("latexmk is not installed")
+	}
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if result.PeakRssKb <= 0 {
+		t.Fatalf("expected positive peak RSS, got %d", result.PeakRssKb)
+	}
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePythontex executes the code sessions only when the job's output cache
+// is missing, like pythontex skipping sessions whose hash is unchanged. It
+// must be given the job name, as pythontex reads <jobname>.pytxcode.
+const fakePythontex = `[ -e "$1.pdf" ] || exit 1
+if [ -e "pythontex-files-$1/py_default_default.stdout" ]; then
+	echo reused >> "$FAKE_PYTHONTEX_RUNS"
+else
+	echo executed >> "$FAKE_PYTHONTEX_RUNS"
+	mkdir -p "pythontex-files-$1"
+	echo 2 > "pythontex-files-$1/py_default_default.stdout"
+fi
+`
+
+func TestPythontexCacheSurvivesIncrementalCompile(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript, "pythontex": fakePythontex})
+	runsFile := filepath.Join(t.TempDir(), "runs")
+	t.Setenv("FAKE_PYTHONTEX_RUNS", runsFile)
+	projectID := "pythontex-cache-test"
+	forgetProject(t, projectID)
+
+	compile := func(prose string) {
+		document := "\\documentclass{article}\n\\usepackage{pythontex}\n\\begin{document}\n" + prose + " \\py{1+1}\n\\end{document}"
+		files := []FileEntry{{Path: "main.tex", Content: document}}
+		result := New().Compile(files, time.Now(), projectID, CompileOptions{JobName: "paper"})
+		if !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+	}
+
+	compile("One plus one is")
+	compile("Famously, one plus one is")
+
+	data, err := os.ReadFile(runsFile)
+	if err != nil {
+		t.Fatalf("failed to read pythontex runs: %v", err)
+	}
+	if got := strings.Fields(string(data)); strings.Join(got, ",") != "executed,reused" {
+		t.Fatalf("expected the second compile to reuse pythontex-files-paper, got %v", got)
+	}
+}
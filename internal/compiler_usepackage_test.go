@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestContainsUsepackageDoesNotGrowPatternCache(t *testing.T) {
+	before := len(usepackagePatterns)
+
+	for i := 0; i < 100; i++ {
+		pkg := fmt.Sprintf("userpkg%d", i)
+		content := fmt.Sprintf(`\usepackage{%s}`, pkg)
+		if !containsUsepackage(content, pkg) {
+			t.Fatalf("expected %s to be detected", pkg)
+		}
+	}
+
+	if after := len(usepackagePatterns); after != before {
+		t.Fatalf("expected pattern cache to stay at %d entries, got %d", before, after)
+	}
+}
+
+func TestContainsUsepackageMatchesPrecompiledPackage(t *testing.T) {
+	if !containsUsepackage(`\usepackage[no-math]{ fontspec }`, "fontspec") {
+		t.Fatalf("expected fontspec with options to be detected")
+	}
+	if containsUsepackage(`\usepackage{fontspecx}`, "fontspec") {
+		t.Fatalf("did not expect fontspecx to match fontspec")
+	}
+}
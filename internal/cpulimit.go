@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cpuPollInterval is how often a running toolchain's process group is
+// checked against the compile's CPU-time budget
+const cpuPollInterval = 200 * time.Millisecond
+
+// clockTicks is the unit of the CPU times in /proc/<pid>/stat (USER_HZ)
+const clockTicks = 100
+
+// maxCpuSeconds is the server's CPU-time budget per compile; 0 disables it
+var maxCpuSeconds int
+
+// SetMaxCpuSeconds sets the CPU-time budget of each compile (0 = unlimited).
+// Requests may ask for a lower budget, never a higher one.
+func SetMaxCpuSeconds(seconds int) {
+	if seconds < 0 {
+		seconds = 0
+	}
+	maxCpuSeconds = seconds
+}
+
+// cpuLimit returns the compile's CPU-time budget: the request's, capped by
+// the server's, or 0 when neither sets one
+func (s *compileSession) cpuLimit() time.Duration {
+	seconds := maxCpuSeconds
+	if requested := s.options.CpuLimitSeconds; requested > 0 && (seconds == 0 || requested < seconds) {
+		seconds = requested
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// cpuLimitedCommand wraps a toolchain command in a shell that sets
+// RLIMIT_CPU to the budget left and then execs it. Go's SysProcAttr cannot set
+// rlimits, and setting them on the server process would limit it too. Every
+// process inherits the limit, so the engine runs latexmk spawns are each
+// killed (SIGXCPU) once they alone use up the remaining budget; what they use
+// together is enforced by runToolchainCommand.
+func (s *compileSession) cpuLimitedCommand(name string, args []string) (string, []string) {
+	limit := s.cpuLimit()
+	if limit <= 0 {
+		return name, args
+	}
+
+	remaining := limit - s.cpuTime
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	return ulimitCommand(seconds, name, args)
+}
+
+// ulimitCommand wraps a command in a shell that sets RLIMIT_CPU to seconds
+// (at least 1) and then execs it
+func ulimitCommand(seconds int, name string, args []string) (string, []string) {
+	if seconds < 1 {
+		seconds = 1
+	}
+	script := fmt.Sprintf(`ulimit -t %d && exec "$0" "$@"`, seconds)
+	return "sh", append([]string{"-c", script, name}, args...)
+}
+
+// runToolchainCommand runs cmd and records its peak RSS and CPU time. Under a
+// CPU-time budget, the CPU time of cmd's process group is polled while it
+// runs, and the group is killed once that, added to the compile's earlier
+// commands, uses up the budget, however it is spread over latexmk's children.
+func (s *compileSession) runToolchainCommand(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	if limit := s.cpuLimit(); limit > 0 {
+		go killGroupOverCpuBudget(cmd.Process.Pid, limit-s.cpuTime, done)
+	}
+	err := cmd.Wait()
+	close(done)
+
+	s.recordPeakRss(cmd.ProcessState)
+	s.recordCpuTime(cmd.ProcessState)
+	return err
+}
+
+// killGroupOverCpuBudget kills process group pgid once its CPU time reaches
+// budget, checking until done is closed
+func killGroupOverCpuBudget(pgid int, budget time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(cpuPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if processGroupCpuTime(pgid) >= budget {
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+			return
+		}
+	}
+}
+
+// processGroupCpuTime sums the CPU time of the running members of process
+// group pgid, including the children each has already reaped. It returns 0
+// where /proc is unavailable, leaving only the per-process RLIMIT_CPU.
+func processGroupCpuTime(pgid int) time.Duration {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+
+	group := strconv.Itoa(pgid)
+	var ticks int64
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		data, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces; the fields after it start with
+		// the state (field 3), so pgrp is [2] and utime, stime, cutime,
+		// cstime are [11] to [14]
+		fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+		if len(fields) < 15 || fields[2] != group {
+			continue
+		}
+		for _, field := range fields[11:15] {
+			n, _ := strconv.ParseInt(field, 10, 64)
+			ticks += n
+		}
+	}
+	return time.Duration(ticks) * time.Second / clockTicks
+}
+
+// recordCpuTime adds a finished toolchain process's CPU time (including the
+// descendants it reaped) to the compile's total and notes whether the budget
+// was exceeded, either by that total or by a process killed for exceeding it
+func (s *compileSession) recordCpuTime(state *os.ProcessState) {
+	limit := s.cpuLimit()
+	if state == nil || limit <= 0 {
+		return
+	}
+
+	s.cpuTime += state.UserTime() + state.SystemTime()
+
+	killed := false
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		killed = status.Signal() == syscall.SIGXCPU || status.Signal() == syscall.SIGKILL
+	}
+	if s.cpuTime >= limit || killed && !s.superseded() {
+		s.cpuLimitExceeded = true
+	}
+}
+
+// cpuLimitError describes an exceeded CPU-time budget
+func (s *compileSession) cpuLimitError() error {
+	return fmt.Errorf("%w: used %.1fs, limit is %s", ErrCpuLimitExceeded, s.cpuTime.Seconds(), s.cpuLimit())
+}
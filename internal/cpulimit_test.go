@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCpuLimitTerminatesBusyEngine(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": "while :; do :; done\n"})
+
+	started := time.Now()
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{CpuLimitSeconds: 1})
+	if result.Success || result.ErrorCode != "CPU_LIMIT_EXCEEDED" {
+		t.Fatalf("expected CPU_LIMIT_EXCEEDED, got success=%v code=%q: %s", result.Success, result.ErrorCode, result.ErrorMessage)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected the engine to be killed near its 1s budget, took %s", elapsed)
+	}
+}
+
+func TestRequestCannotRaiseServerCpuLimit(t *testing.T) {
+	SetMaxCpuSeconds(5)
+	t.Cleanup(func() { SetMaxCpuSeconds(0) })
+
+	for requested, want := range map[int]time.Duration{0: 5 * time.Second, 2: 2 * time.Second, 60: 5 * time.Second} {
+		s := &compileSession{options: CompileOptions{CpuLimitSeconds: requested}}
+		if got := s.cpuLimit(); got != want {
+			t.Fatalf("request for %ds: expected a %s budget, got %s", requested, want, got)
+		}
+	}
+}
+
+// fakeLatexmkSpreadsCpu runs five busy children one after another, each
+// using about a second of CPU time, under the per-process limit
+var fakeLatexmkSpreadsCpu = `for i in 1 2 3 4 5; do
+	sh -c 'while :; do :; done' &
+	busy=$!
+	sleep 1
+	kill $busy
+	wait $busy
+done
+` + fakeLatexmkScript
+
+func TestCpuLimitCoversAllToolchainChildren(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkSpreadsCpu})
+
+	started := time.Now()
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{CpuLimitSeconds: 2})
+	if result.Success || result.ErrorCode != "CPU_LIMIT_EXCEEDED" {
+		t.Fatalf("expected CPU_LIMIT_EXCEEDED, got success=%v code=%q: %s", result.Success, result.ErrorCode, result.ErrorMessage)
+	}
+	// Killed once the children together used 2s, not after all five ran
+	if elapsed := time.Since(started); elapsed > 4*time.Second {
+		t.Fatalf("expected latexmk to be killed near its 2s budget, took %s", elapsed)
+	}
+}
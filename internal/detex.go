@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DetexTimeout bounds the detex run of one request
+const DetexTimeout = 30 * time.Second
+
+// detexTools are the plain-text extractors tried in order
+var detexTools = []string{"detex", "opendetex"}
+
+var (
+	// mathPattern matches display and inline math: $$..$$, \[..\], \(..\),
+	// $..$ and the usual display environments, starred or not
+	mathPattern = regexp.MustCompile(`(?s)\$\$.+?\$\$|\\\[.+?\\\]|\\\(.+?\\\)|\$[^$]+\$|` +
+		`\\begin\{(?:equation|align|alignat|gather|multline|flalign|eqnarray|displaymath|math)\*?\}.*?` +
+		`\\end\{(?:equation|align|alignat|gather|multline|flalign|eqnarray|displaymath|math)\*?\}`)
+	// mathPlaceholderPattern matches the words protectMath leaves for detex
+	mathPlaceholderPattern = regexp.MustCompile(`octreemath(\d+)x`)
+	blankLinesPattern      = regexp.MustCompile(`\n(?:[ \t]*\n){2,}`)
+)
+
+// escapedDollar stands in for \$ while math is matched, so an escaped dollar
+// never opens or closes inline math
+const escapedDollar = "\x00"
+
+// detexFiles writes files to a temporary directory and runs detex on the
+// main file, following its \input and \include. With keepMath the math is
+// kept as LaTeX source instead of being dropped. detex takes a standalone
+// slot and is held to the compile limits.
+func detexFiles(ctx context.Context, files []FileEntry, keepMath bool) (*DetexResponse, error) {
+	tool := ""
+	for _, candidate := range detexTools {
+		if _, err := exec.LookPath(candidate); err == nil {
+			tool = candidate
+			break
+		}
+	}
+	if tool == "" {
+		return nil, fmt.Errorf("%w: neither detex nor opendetex is installed", ErrDetexUnavailable)
+	}
+
+	mainFile, _, found := findMainFile(files)
+	if !found {
+		return nil, fmt.Errorf("%w: no LaTeX source file found", ErrMainFileNotFound)
+	}
+
+	release, err := acquireStandaloneSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, DetexTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "detex-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDetexFailed, err)
+	}
+	defer os.RemoveAll(dir)
+
+	var math []string
+	for _, file := range files {
+		if !filepath.IsLocal(filepath.FromSlash(file.Path)) {
+			continue
+		}
+		if keepMath && file.Encoding != "base64" && isMainFileCandidate(file.Path) {
+			file.Content = protectMath(file.Content, &math)
+		}
+		if err := writeFile(dir, file); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDetexFailed, err)
+		}
+	}
+
+	// detex resolves \input relative to its working directory
+	mainPath := filepath.Join(dir, filepath.FromSlash(mainFile.Path))
+	cmd := standaloneCommand(ctx, tool, "-l", filepath.Base(mainPath))
+	cmd.Dir = filepath.Dir(mainPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: %s timed out", ErrDetexFailed, tool)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v: %s", ErrDetexFailed, tool, err, strings.TrimSpace(stderr.String()))
+	}
+
+	text := restoreMath(string(output), math)
+	text = blankLinesPattern.ReplaceAllString(text, "\n\n")
+	return &DetexResponse{MainFile: mainFile.Path, Text: strings.TrimSpace(text) + "\n"}, nil
+}
+
+// protectMath swaps every math span of content for a placeholder word detex
+// passes through, appending the spans to math
+func protectMath(content string, math *[]string) string {
+	content = strings.ReplaceAll(content, `\$`, escapedDollar)
+	content = mathPattern.ReplaceAllStringFunc(content, func(span string) string {
+		*math = append(*math, strings.ReplaceAll(span, escapedDollar, `\$`))
+		return fmt.Sprintf("octreemath%dx", len(*math)-1)
+	})
+	return strings.ReplaceAll(content, escapedDollar, `\$`)
+}
+
+// restoreMath puts the spans protectMath took back in place of their
+// placeholders
+func restoreMath(text string, math []string) string {
+	if len(math) == 0 {
+		return text
+	}
+	return mathPlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		var i int
+		if _, err := fmt.Sscanf(placeholder, "octreemath%dx", &i); err != nil || i >= len(math) {
+			return placeholder
+		}
+		return math[i]
+	})
+}
+
+// DetexHandler returns the plain text of a document, its markup stripped by
+// detex. Math is dropped unless keepMath is set.
+func DetexHandler(c *gin.Context) {
+	var req DetexRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	files, ok := requestFiles(c, req.SourceRequest)
+	if !ok {
+		return
+	}
+
+	resp, err := detexFiles(c.Request.Context(), files, req.KeepMath)
+	if err != nil {
+		log.Printf("Plain-text extraction failed: %v", err)
+		c.JSON(errorStatus(errorCode(err)), ErrorResponse{
+			Error:   "Plain-text extraction failed",
+			Code:    errorCode(err),
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeDetex drops lines starting with a command and inline $..$ math, roughly
+// like detex -l
+const fakeDetex = `sed -e '/^\\/d' -e 's/\$[^$]*\$//g' "$2"
+`
+
+func TestProtectMathKeepsEscapedDollars(t *testing.T) {
+	var math []string
+	got := protectMath(`costs \$5 when $x^2$ and \[ y \] or \begin{align*} a &= b \end{align*}`, &math)
+	if got != `costs \$5 when octreemath0x and octreemath1x or octreemath2x` {
+		t.Fatalf("unexpected protected content: %q", got)
+	}
+	if restored := restoreMath(got, math); restored != `costs \$5 when $x^2$ and \[ y \] or \begin{align*} a &= b \end{align*}` {
+		t.Fatalf("unexpected restored content: %q", restored)
+	}
+}
+
+func TestDetexHandler(t *testing.T) {
+	installFakeTools(t, map[string]string{"detex": fakeDetex})
+
+	content := "\\documentclass{article}\n\\begin{document}\nEnergy is $E = mc^2$ here.\n\n\n\nThe end.\n\\end{document}\n"
+	for _, tc := range []struct {
+		keepMath bool
+		want     string
+	}{
+		{false, "Energy is  here.\n\nThe end.\n"},
+		{true, "Energy is $E = mc^2$ here.\n\nThe end.\n"},
+	} {
+		recorder := performJSON(t, http.MethodPost, "/detex", DetexHandler, DetexRequest{
+			SourceRequest: SourceRequest{Files: []FileEntry{
+				{Path: "notes.bib", Content: "@misc{a, title={$x$}}"},
+				{Path: "paper/main.tex", Content: content},
+			}},
+			KeepMath: tc.keepMath,
+		})
+		assertStatus(t, recorder, http.StatusOK)
+
+		var resp DetexResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.MainFile != "paper/main.tex" || resp.Text != tc.want {
+			t.Fatalf("keepMath=%v: unexpected response %+v", tc.keepMath, resp)
+		}
+	}
+}
+
+func TestDetexHandlerWithoutDetex(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	recorder := performJSON(t, http.MethodPost, "/detex", DetexHandler, SourceRequest{Content: simpleDocument})
+	assertStatus(t, recorder, http.StatusNotImplemented)
+	if !strings.Contains(recorder.Body.String(), "DETEX_UNAVAILABLE") {
+		t.Fatalf("expected DETEX_UNAVAILABLE, got %s", recorder.Body.String())
+	}
+}
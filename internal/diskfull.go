@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"syscall"
+)
+
+// diskFullPattern matches the ENOSPC reports of the toolchain and the shell,
+// e.g. "write error: No space left on device"
+var diskFullPattern = regexp.MustCompile(`(?i)no space left on device|\bENOSPC\b`)
+
+// detectDiskFull returns an ErrDiskFull when the toolchain's log or output
+// reports that the volume filled up, or nil. TeX itself only says it cannot
+// write a file; the cause shows up in what its write calls or tools printed.
+func detectDiskFull(outputs ...string) error {
+	for _, output := range outputs {
+		if m := diskFullPattern.FindString(output); m != "" {
+			return fmt.Errorf("%w: the toolchain reported %q; free or add space for the temp directory", ErrDiskFull, m)
+		}
+	}
+	return nil
+}
+
+// failWrite fails a compile whose workspace could not be written, with
+// ErrDiskFull when the volume is full
+func (s *compileSession) failWrite(message string, err error) *CompileResult {
+	if errors.Is(err, syscall.ENOSPC) {
+		return s.compiler.failWith(s.metadata, fmt.Errorf("%w: %s: %v", ErrDiskFull, message, err), s.queueMs, s.receivedAt)
+	}
+	return s.compiler.errorResult(s.metadata, fmt.Sprintf("%s: %v", message, err), s.queueMs, s.receivedAt)
+}
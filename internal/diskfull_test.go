@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWorkspaceWriteOnFullDiskFailsWithDiskFull(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+
+	// Writes to /dev/full fail with ENOSPC
+	dir := t.TempDir()
+	if err := os.Symlink("/dev/full", filepath.Join(dir, "main.tex")); err != nil {
+		t.Fatal(err)
+	}
+	err := writeFile(dir, FileEntry{Path: "main.tex", Content: simpleDocument})
+	if err == nil {
+		t.Fatalf("expected the write to fail")
+	}
+
+	session := newCompileSession(New(), nil, time.Now(), "", CompileOptions{})
+	result := session.failWrite("Failed to write files", err)
+	if result.ErrorCode != "DISK_FULL" || errorStatus(result.ErrorCode) != 507 {
+		t.Fatalf("expected DISK_FULL (507), got %q: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestCompileReportsToolchainDiskFull(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": "echo 'Latexmk: write error: No space left on device' >&2\nexit 12\n"})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success || result.ErrorCode != "DISK_FULL" {
+		t.Fatalf("expected DISK_FULL, got success=%v code=%q: %s", result.Success, result.ErrorCode, result.ErrorMessage)
+	}
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// allowedEnvVars are the variables a request may set for its compile
+// subprocesses; empty rejects every request Env
+var allowedEnvVars map[string]bool
+
+// SetAllowedEnvVars sets the variable names requests may pass in Env
+func SetAllowedEnvVars(names []string) {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			allowed[name] = true
+		}
+	}
+	allowedEnvVars = allowed
+}
+
+// checkRequestEnv returns an ErrEnvNotAllowed for the first variable outside
+// the allowlist, or a value TeX tools cannot receive
+func checkRequestEnv(env map[string]string) error {
+	for _, name := range sortedEnvNames(env) {
+		if !allowedEnvVars[name] {
+			return fmt.Errorf("%w: %s", ErrEnvNotAllowed, name)
+		}
+		if strings.ContainsRune(env[name], 0) {
+			return fmt.Errorf("%w: %s contains a NUL byte", ErrEnvNotAllowed, name)
+		}
+	}
+	return nil
+}
+
+// requestEnv returns the request's variables as NAME=value, sorted by name
+func requestEnv(env map[string]string) []string {
+	var pairs []string
+	for _, name := range sortedEnvNames(env) {
+		pairs = append(pairs, name+"="+env[name])
+	}
+	return pairs
+}
+
+func sortedEnvNames(env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enforceRequestEnv rejects requests setting variables outside the allowlist
+func (s *compileSession) enforceRequestEnv() *CompileResult {
+	if err := checkRequestEnv(s.options.Env); err != nil {
+		log.Printf("[%s] Rejecting request: %v", s.compiler.RequestID, err)
+		return s.compiler.failWith(s.metadata, err, s.queueMs, s.receivedAt)
+	}
+	return nil
+}
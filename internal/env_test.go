@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestEnvReachesToolchain(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": `echo "BUILD_VARIANT=$BUILD_VARIANT" >> "$FAKE_LATEXMK_ARGS"
+` + fakeLatexmkScript})
+	readArgs := recordLatexmkArgs(t)
+
+	SetAllowedEnvVars([]string{"BUILD_VARIANT", "BIBINPUTS"})
+	t.Cleanup(func() { SetAllowedEnvVars(nil) })
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{Env: map[string]string{"BUILD_VARIANT": "print"}})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if !containsString(readArgs(), "BUILD_VARIANT=print") {
+		t.Fatalf("expected BUILD_VARIANT to reach latexmk")
+	}
+}
+
+func TestRequestEnvRejectsUnlistedVariables(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+
+	SetAllowedEnvVars([]string{"BUILD_VARIANT"})
+	t.Cleanup(func() { SetAllowedEnvVars(nil) })
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{Env: map[string]string{"BUILD_VARIANT": "print", "LD_PRELOAD": "/tmp/x.so"}})
+	if result.Success || result.ErrorCode != "ENV_NOT_ALLOWED" {
+		t.Fatalf("expected ENV_NOT_ALLOWED, got success=%v code=%q", result.Success, result.ErrorCode)
+	}
+	if result.ErrorMessage != "environment variable is not allowed: LD_PRELOAD" {
+		t.Fatalf("unexpected message: %q", result.ErrorMessage)
+	}
+}
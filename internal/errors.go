@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Sentinel errors for compilations rejected by policy or failing in a way
+// clients can act on. Wrap them with fmt.Errorf("%w: ...") to add detail.
+var (
+	ErrTooManyGraphics          = errors.New("too many graphics inclusions")
+	ErrDeniedPackage            = errors.New("package is not allowed on this server")
+	ErrFileTypeNotAllowed       = errors.New("file type is not allowed on this server")
+	ErrPipedInput               = errors.New("piped input (shell command execution) is not allowed")
+	ErrAbsolutePath             = errors.New("absolute input paths are not allowed")
+	ErrEnvNotAllowed            = errors.New("environment variable is not allowed")
+	ErrMainFileNotFound         = errors.New("main file is not among the request's text files")
+	ErrInvalidLatexRelease      = errors.New("latexRelease must be a date in YYYY-MM-DD format")
+	ErrMemoryOverflow           = errors.New("TeX memory capacity exceeded")
+	ErrDiskFull                 = errors.New("no space left on the compile volume")
+	ErrUnmatchedEnvironment     = errors.New("unmatched environment")
+	ErrEnqueueTimeout           = errors.New("could not enqueue request, timeout")
+	ErrQueueWaitExceeded        = errors.New("compile did not finish within the maximum queue wait")
+	ErrSuperseded               = errors.New("compile superseded by a newer request for the same project")
+	ErrRateLimited              = errors.New("global compile rate limit exceeded")
+	ErrCpuLimitExceeded         = errors.New("CPU-time limit exceeded")
+	ErrCompileTimeout           = errors.New("compilation timed out")
+	ErrRenderUnavailable        = errors.New("page rendering is not available")
+	ErrRenderFailed             = errors.New("page rendering failed")
+	ErrImpositionUnavailable    = errors.New("page imposition is not available")
+	ErrImpositionFailed         = errors.New("page imposition failed")
+	ErrInvalidPageRange         = errors.New("invalid page range")
+	ErrBibValidationUnavailable = errors.New("bibliography validation is not available")
+	ErrBibValidationFailed      = errors.New("bibliography validation failed")
+	ErrDetexUnavailable         = errors.New("plain-text extraction is not available")
+	ErrDetexFailed              = errors.New("plain-text extraction failed")
+)
+
+type compileErrorKind struct {
+	err    error
+	code   string
+	status int
+}
+
+// compileErrorKinds maps each sentinel to the code and HTTP status returned
+// to clients
+var compileErrorKinds = []compileErrorKind{
+	{ErrTooManyGraphics, "TOO_MANY_GRAPHICS", http.StatusUnprocessableEntity},
+	{ErrDeniedPackage, "DENIED_PACKAGE", http.StatusUnprocessableEntity},
+	{ErrFileTypeNotAllowed, "FILE_TYPE_NOT_ALLOWED", http.StatusUnprocessableEntity},
+	{ErrPipedInput, "PIPED_INPUT", http.StatusUnprocessableEntity},
+	{ErrAbsolutePath, "ABSOLUTE_PATH", http.StatusUnprocessableEntity},
+	{ErrEnvNotAllowed, "ENV_NOT_ALLOWED", http.StatusUnprocessableEntity},
+	{ErrMainFileNotFound, "MAIN_FILE_NOT_FOUND", http.StatusUnprocessableEntity},
+	{ErrInvalidLatexRelease, "INVALID_LATEX_RELEASE", http.StatusBadRequest},
+	{ErrMemoryOverflow, "MEMORY_OVERFLOW", http.StatusUnprocessableEntity},
+	{ErrDiskFull, "DISK_FULL", http.StatusInsufficientStorage},
+	{ErrCpuLimitExceeded, "CPU_LIMIT_EXCEEDED", http.StatusUnprocessableEntity},
+	{ErrCompileTimeout, "COMPILE_TIMEOUT", http.StatusUnprocessableEntity},
+	{ErrUnmatchedEnvironment, "UNMATCHED_ENVIRONMENT", http.StatusUnprocessableEntity},
+	{ErrEnqueueTimeout, "ENQUEUE_TIMEOUT", http.StatusServiceUnavailable},
+	{ErrQueueWaitExceeded, "QUEUE_WAIT_EXCEEDED", http.StatusServiceUnavailable},
+	{ErrSuperseded, "SUPERSEDED", http.StatusConflict},
+	{ErrRateLimited, "RATE_LIMITED", http.StatusTooManyRequests},
+	{ErrRenderUnavailable, "RENDER_UNAVAILABLE", http.StatusNotImplemented},
+	{ErrRenderFailed, "RENDER_FAILED", http.StatusInternalServerError},
+	{ErrImpositionUnavailable, "IMPOSITION_UNAVAILABLE", http.StatusNotImplemented},
+	{ErrImpositionFailed, "IMPOSITION_FAILED", http.StatusInternalServerError},
+	{ErrInvalidPageRange, "INVALID_PAGE_RANGE", http.StatusBadRequest},
+	{ErrBibValidationUnavailable, "BIB_VALIDATION_UNAVAILABLE", http.StatusNotImplemented},
+	{ErrBibValidationFailed, "BIB_VALIDATION_FAILED", http.StatusInternalServerError},
+	{ErrDetexUnavailable, "DETEX_UNAVAILABLE", http.StatusNotImplemented},
+	{ErrDetexFailed, "DETEX_FAILED", http.StatusInternalServerError},
+}
+
+// errorCode returns the client-facing code for err, or "" if it has none
+func errorCode(err error) string {
+	for _, kind := range compileErrorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.code
+		}
+	}
+	return ""
+}
+
+// errorStatus returns the HTTP status for a failed result's error code
+func errorStatus(code string) int {
+	for _, kind := range compileErrorKinds {
+		if kind.code == code {
+			return kind.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// failWith records err as the failure of this compilation and tags the result
+// with its structured error code
+func (c *Compiler) failWith(metadata *compileMetadata, err error, queueMs int64, receivedAt time.Time) *CompileResult {
+	result := c.errorResult(metadata, err.Error(), queueMs, receivedAt)
+	result.ErrorCode = errorCode(err)
+	return result
+}
+
+// newLimitError wraps a sentinel with the observed and allowed values
+func newLimitError(sentinel error, observed, limit int) error {
+	return fmt.Errorf("%w: found %d, limit is %d", sentinel, observed, limit)
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// allowedFileExtensions is the server policy of file types requests may
+// carry, as lowercased ".ext"; empty allows every type
+var allowedFileExtensions map[string]bool
+
+// skipDisallowedFiles drops files of other types instead of rejecting the
+// request
+var skipDisallowedFiles bool
+
+// SetAllowedFileExtensions sets the file types requests may carry (empty =
+// any) and whether other files are skipped rather than rejected
+func SetAllowedFileExtensions(extensions []string, skip bool) {
+	allowed := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		allowed[ext] = true
+	}
+	allowedFileExtensions = allowed
+	skipDisallowedFiles = skip
+}
+
+// fileExtensionAllowed reports whether path's type passes the policy. Files
+// without an extension never do once an allowlist is set.
+func fileExtensionAllowed(path string) bool {
+	if len(allowedFileExtensions) == 0 {
+		return true
+	}
+	return allowedFileExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// findDisallowedFile returns the path of the first file whose type the
+// policy does not allow
+func findDisallowedFile(files []FileEntry) string {
+	for _, file := range files {
+		if !fileExtensionAllowed(file.Path) {
+			return file.Path
+		}
+	}
+	return ""
+}
+
+// dropDisallowedFiles removes the files the policy does not allow when it
+// skips them; otherwise files are returned as is, for enforceFileExtensions
+// to reject
+func dropDisallowedFiles(files []FileEntry, requestID string) []FileEntry {
+	if !skipDisallowedFiles || findDisallowedFile(files) == "" {
+		return files
+	}
+
+	kept := make([]FileEntry, 0, len(files))
+	for _, file := range files {
+		if !fileExtensionAllowed(file.Path) {
+			log.Printf("[%s] Skipping %s: file type not allowed", requestID, file.Path)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
+
+// fileTypeError describes the disallowed file at path, listing the allowed
+// types
+func fileTypeError(path string) error {
+	allowed := make([]string, 0, len(allowedFileExtensions))
+	for ext := range allowedFileExtensions {
+		allowed = append(allowed, ext)
+	}
+	sort.Strings(allowed)
+	return fmt.Errorf("%w: %s (allowed: %s)", ErrFileTypeNotAllowed, path, strings.Join(allowed, ", "))
+}
+
+// enforceFileExtensions rejects requests carrying a file type outside the
+// allowlist
+func (s *compileSession) enforceFileExtensions() *CompileResult {
+	path := findDisallowedFile(s.files)
+	if path == "" {
+		return nil
+	}
+
+	log.Printf("[%s] Rejecting request: file type of %s not allowed", s.compiler.RequestID, path)
+	return s.compiler.failWith(s.metadata, fileTypeError(path), s.queueMs, s.receivedAt)
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileRejectsDisallowedFileType(t *testing.T) {
+	SetAllowedFileExtensions([]string{".tex", "bib"}, false)
+	t.Cleanup(func() { SetAllowedFileExtensions(nil, false) })
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: simpleDocument},
+		{Path: "scripts/build.sh", Content: "#!/bin/sh\nrm -rf /\n"},
+	}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success || result.ErrorCode != "FILE_TYPE_NOT_ALLOWED" {
+		t.Fatalf("expected FILE_TYPE_NOT_ALLOWED rejection, got success=%v code=%q", result.Success, result.ErrorCode)
+	}
+	if !strings.Contains(result.ErrorMessage, "scripts/build.sh") || !strings.Contains(result.ErrorMessage, ".bib, .tex") {
+		t.Fatalf("expected error to name the file and the allowed types, got %q", result.ErrorMessage)
+	}
+}
+
+func TestCompileSkipsDisallowedFileType(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": "[ ! -e build.sh ] || exit 1\n" + fakeLatexmkScript})
+	SetAllowedFileExtensions([]string{".TEX"}, true)
+	t.Cleanup(func() { SetAllowedFileExtensions(nil, false) })
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: simpleDocument},
+		{Path: "build.sh", Content: "#!/bin/sh\n"},
+	}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed without build.sh, got: %s", result.ErrorMessage)
+	}
+}
+
+func TestCreateFileStructureRefusesDisallowedFileType(t *testing.T) {
+	SetAllowedFileExtensions([]string{".tex"}, false)
+	t.Cleanup(func() { SetAllowedFileExtensions(nil, false) })
+
+	dir := t.TempDir()
+	err := createFileStructure(dir, []FileEntry{{Path: "main.tex", Content: simpleDocument}, {Path: "run.sh", Content: "#!/bin/sh\n"}})
+	if !errors.Is(err, ErrFileTypeNotAllowed) {
+		t.Fatalf("expected ErrFileTypeNotAllowed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "run.sh")); !os.IsNotExist(err) {
+		t.Fatalf("expected run.sh not to be written")
+	}
+}
+
+func TestSourceEndpointsApplyFileTypePolicy(t *testing.T) {
+	SetAllowedFileExtensions([]string{".tex"}, false)
+	t.Cleanup(func() { SetAllowedFileExtensions(nil, false) })
+
+	request := DetexRequest{SourceRequest: SourceRequest{Files: []FileEntry{
+		{Path: "main.tex", Content: simpleDocument},
+		{Path: "run.sh", Content: "#!/bin/sh\n"},
+	}}}
+	recorder := performJSON(t, http.MethodPost, "/detex", DetexHandler, request)
+	assertStatus(t, recorder, http.StatusUnprocessableEntity)
+	if !strings.Contains(recorder.Body.String(), "FILE_TYPE_NOT_ALLOWED") {
+		t.Fatalf("expected FILE_TYPE_NOT_ALLOWED, got %s", recorder.Body.String())
+	}
+
+	SetAllowedFileExtensions([]string{".tex", ".bib"}, true)
+	recorder = performJSON(t, http.MethodPost, "/validate-bib", BibValidationHandler, SourceRequest{Files: []FileEntry{
+		{Path: "run.sh", Content: "#!/bin/sh\n"},
+	}})
+	assertStatus(t, recorder, http.StatusBadRequest)
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// filecontentsPattern matches a filecontents block, whose body LaTeX writes
+// to the named file when the document is compiled
+var filecontentsPattern = regexp.MustCompile(`(?s)\\begin\{filecontents\*?\}\s*(?:\[[^\]]*\])?\s*\{([^}]+)\}(.*?)\\end\{filecontents\*?\}`)
+
+// filecontentsBlock is one file a document generates for itself
+type filecontentsBlock struct {
+	Target string // As written, possibly using \jobname
+	Body   string
+}
+
+// findFilecontents returns every filecontents block in content, so a document
+// generating several files has each of them regenerated
+func findFilecontents(content string) []filecontentsBlock {
+	var blocks []filecontentsBlock
+	for _, m := range filecontentsPattern.FindAllStringSubmatch(content, -1) {
+		blocks = append(blocks, filecontentsBlock{Target: strings.TrimSpace(m[1]), Body: m[2]})
+	}
+	return blocks
+}
+
+// generatedFilePath resolves a filecontents target the way \openout does:
+// \jobname expanded and .tex added when it has no extension. It returns ""
+// for targets outside the workspace.
+func generatedFilePath(target, jobName string) string {
+	name := strings.ReplaceAll(target, "\\jobname", jobName)
+	if path.Ext(name) == "" {
+		name += ".tex"
+	}
+	name = path.Clean(name)
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return ""
+	}
+	return name
+}
+
+// removeStaleGeneratedFiles deletes the files filecontents blocks wrote on a
+// previous build of the cached workspace. LaTeX does not overwrite existing
+// files by default, so an edited block would otherwise keep its old output.
+// Files the project uploads under the same name are left alone.
+func (s *compileSession) removeStaleGeneratedFiles() {
+	if !s.isIncremental {
+		return
+	}
+
+	uploaded := make(map[string]bool, len(s.files))
+	for _, file := range s.files {
+		uploaded[path.Clean(file.Path)] = true
+	}
+	mainDir := path.Dir(s.mainFilePath)
+
+	for _, file := range s.files {
+		if file.Encoding == "base64" || !shouldInspectForEngine(file.Path) {
+			continue
+		}
+		for _, block := range findFilecontents(file.Content) {
+			name := generatedFilePath(block.Target, s.jobName)
+			// The engine runs in the main file's directory
+			if name == "" || uploaded[path.Join(mainDir, name)] {
+				continue
+			}
+			generated := filepath.Join(filepath.Dir(s.texFilePath), filepath.FromSlash(name))
+			if err := os.Remove(generated); err == nil {
+				log.Printf("[%s] Removed %s for its filecontents block to regenerate it", s.compiler.RequestID, name)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("[%s] Warning: failed to remove generated file %s: %v", s.compiler.RequestID, name, err)
+			}
+		}
+	}
+}
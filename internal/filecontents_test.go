@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeLatexmkFilecontents writes data.csv from main.tex's filecontents block
+// unless it exists, as LaTeX does, before the usual fake build.
+var fakeLatexmkFilecontents = `[ -e data.csv ] || sed -n '/begin{filecontents}{data.csv}/,/end{filecontents}/p' main.tex | sed '1d;$d' > data.csv
+` + fakeLatexmkScript
+
+func filecontentsDocument(rows string) string {
+	return "\\documentclass{article}\n\\begin{filecontents}{data.csv}\n" + rows + "\\end{filecontents}\n" +
+		"\\begin{document}\n\\input{data.csv}\n\\end{document}\n"
+}
+
+func TestCompileRegeneratesFilecontentsOutputs(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkFilecontents})
+	projectID := "filecontents-test"
+	forgetProject(t, projectID)
+
+	compile := func(rows string) string {
+		files := []FileEntry{{Path: "main.tex", Content: filecontentsDocument(rows)}}
+		if result := New().Compile(files, time.Now(), projectID, CompileOptions{}); !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+		entry, _ := GetCache().Get(projectID)
+		data, err := os.ReadFile(filepath.Join(entry.TempDir, "data.csv"))
+		if err != nil {
+			t.Fatalf("expected the filecontents block to generate data.csv: %v", err)
+		}
+		return string(data)
+	}
+
+	if got := compile("a,1\n"); got != "a,1\n" {
+		t.Fatalf("unexpected data.csv %q", got)
+	}
+	// The incremental build must not keep the first build's output
+	if got := compile("a,1\nb,2\n"); got != "a,1\nb,2\n" {
+		t.Fatalf("expected data.csv to follow the edited block, got %q", got)
+	}
+}
+
+func TestGeneratedFilePath(t *testing.T) {
+	cases := map[string]string{
+		"data.csv":       "data.csv",
+		"\\jobname.bib":  "thesis.bib",
+		"appendix":       "appendix.tex",
+		"./out/refs.bib": "out/refs.bib",
+		"../escape.tex":  "",
+		"/etc/passwd.x":  "",
+	}
+	for target, want := range cases {
+		if got := generatedFilePath(target, "thesis"); got != want {
+			t.Errorf("generatedFilePath(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestBibliographyHashCoversFilecontentsBib(t *testing.T) {
+	document := func(entry string) []FileEntry {
+		content := "\\begin{filecontents*}{\\jobname.bib}\n" + entry + "\n\\end{filecontents*}\n\\cite{knuth1984}"
+		return []FileEntry{{Path: "main.tex", Content: content}}
+	}
+	before := bibliographyInputHash(document("@book{knuth1984, title = {The TeXbook}}"))
+	after := bibliographyInputHash(document("@book{knuth1984, title = {The METAFONTbook}}"))
+	if before == after {
+		t.Fatalf("expected an edited filecontents .bib to change the bibliography hash")
+	}
+}
+
+func TestRemoveStaleGeneratedFilesCoversEveryJobnameOutput(t *testing.T) {
+	dir := t.TempDir()
+	content := "\\begin{filecontents*}{\\jobname-data.tex}\nold\n\\end{filecontents*}\n" +
+		"\\begin{filecontents*}{\\jobname.bib}\n@misc{a}\n\\end{filecontents*}\n" +
+		"\\begin{filecontents}{notes}\nkept\n\\end{filecontents}\n\\input{\\jobname-data}\n"
+	s := &compileSession{
+		compiler:      New(),
+		files:         []FileEntry{{Path: "main.tex", Content: content}, {Path: "notes.tex", Content: "uploaded"}},
+		mainFilePath:  "main.tex",
+		texFilePath:   filepath.Join(dir, "main.tex"),
+		jobName:       "thesis",
+		isIncremental: true,
+	}
+	for _, name := range []string{"thesis-data.tex", "thesis.bib", "notes.tex", "thesis.pdf"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("stale"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.removeStaleGeneratedFiles()
+
+	for name, kept := range map[string]bool{"thesis-data.tex": false, "thesis.bib": false, "notes.tex": true, "thesis.pdf": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("%s: expected kept=%v, got err %v", name, kept, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	floatBeginPattern = regexp.MustCompile(`\\begin\{(figure\*?|table\*?)\}`)
+	// \caption writes one list-of entry per float to the .aux,
+	// \@writefile{lof}{\contentsline {figure}{\numberline {1}{\ignorespaces Caption}}{2}{figure.1}}%
+	figureLofPattern = regexp.MustCompile(`\\@writefile\{lof\}\{\\contentsline \{figure\}`)
+	tableLotPattern  = regexp.MustCompile(`\\@writefile\{lot\}\{\\contentsline \{table\}`)
+	// \newlabel{fig:plot}{{1}{2}...} records the number a \label resolved to
+	newlabelPattern = regexp.MustCompile(`\\newlabel\{([^}]*)\}\{\{([^}]*)\}`)
+)
+
+// extractFloats finds every figure and table environment (starred included)
+// in the project sources, main file first, with its caption and label
+func extractFloats(files []FileEntry) []FloatInfo {
+	var floats []FloatInfo
+	for _, file := range mainFileFirst(files) {
+		if file.Encoding == "base64" || !strings.HasSuffix(file.Path, ".tex") {
+			continue
+		}
+		content := stripTeXComments(file.Content)
+
+		for offset := 0; ; {
+			loc := floatBeginPattern.FindStringSubmatchIndex(content[offset:])
+			if loc == nil {
+				break
+			}
+			env := content[offset+loc[2] : offset+loc[3]]
+			start := offset + loc[0]
+			body, end := tableBody(content, offset+loc[1], env)
+
+			float := FloatInfo{
+				Environment: env,
+				File:        file.Path,
+				Line:        lineNumberAt(content, start),
+			}
+			float.ShortCaption, float.Caption, float.Label = floatCaption(body)
+			floats = append(floats, float)
+			offset = end
+		}
+	}
+	return floats
+}
+
+// floatCaption returns the optional short form and the text of the last
+// \caption in a float body (the float's own caption follows any subfigure
+// captions), and the first \label after it
+func floatCaption(body string) (short, caption, label string) {
+	captionEnd := 0
+	for pos := 0; ; {
+		i := strings.Index(body[pos:], `\caption`)
+		if i == -1 {
+			break
+		}
+		name, end := readCommandName(body, pos+i)
+		pos = end
+		if name != "caption" {
+			continue // \captionsetup, \captionof, ...
+		}
+
+		end = skipSpaces(body, end)
+		var shortArg string
+		if end < len(body) && body[end] == '[' {
+			shortArg, end = readDelimited(body, end, '[', ']')
+			end = skipSpaces(body, end)
+		}
+		if end < len(body) && body[end] == '{' {
+			var arg string
+			arg, pos = readDelimited(body, end, '{', '}')
+			short, caption, captionEnd = latexToText(shortArg), latexToText(arg), pos
+		}
+	}
+
+	labels := commandArguments(body[captionEnd:], "label")
+	if len(labels) > 0 {
+		label = strings.TrimSpace(labels[0])
+	}
+	return short, caption, label
+}
+
+// numberFloats fills in the numbers LaTeX assigned, from the .aux files of
+// the last run: by \label when the float has one, otherwise by matching its
+// caption against the list of figures/tables entries
+func numberFloats(floats []FloatInfo, auxContent string) {
+	labels := map[string]string{}
+	for _, m := range newlabelPattern.FindAllStringSubmatch(auxContent, -1) {
+		labels[m[1]] = m[2]
+	}
+	entries := map[string][]contentsEntry{
+		"figure": auxContentsEntries(auxContent, figureLofPattern),
+		"table":  auxContentsEntries(auxContent, tableLotPattern),
+	}
+	used := map[string][]bool{
+		"figure": make([]bool, len(entries["figure"])),
+		"table":  make([]bool, len(entries["table"])),
+	}
+
+	for i := range floats {
+		float := &floats[i]
+		kind := strings.TrimSuffix(float.Environment, "*")
+		if number, ok := labels[float.Label]; ok && float.Label != "" {
+			float.Number = number
+			for j, entry := range entries[kind] {
+				if !used[kind][j] && entry.Number == number {
+					used[kind][j] = true
+					break
+				}
+			}
+			continue
+		}
+		if float.Caption == "" {
+			continue // Uncaptioned floats are not numbered
+		}
+
+		listed := float.Caption
+		if float.ShortCaption != "" {
+			listed = float.ShortCaption
+		}
+		for j, entry := range entries[kind] {
+			if !used[kind][j] && entry.Title == listed {
+				float.Number = entry.Number
+				used[kind][j] = true
+				break
+			}
+		}
+	}
+}
+
+// floatInventory lists the document's floats, numbered from the .aux files
+// when the compile produced them
+func (s *compileSession) floatInventory() *FloatInventory {
+	inventory := &FloatInventory{Floats: extractFloats(s.files)}
+	for _, float := range inventory.Floats {
+		if strings.HasPrefix(float.Environment, "figure") {
+			inventory.FigureCount++
+		} else {
+			inventory.TableCount++
+		}
+	}
+
+	// \include'd files write their floats to their own .aux
+	auxFiles := s.collectAuxFiles()
+	paths := make([]string, 0, len(auxFiles))
+	for path := range auxFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var aux strings.Builder
+	for _, path := range paths {
+		aux.WriteString(auxFiles[path])
+	}
+	numberFloats(inventory.Floats, aux.String())
+
+	log.Printf("[%s] Found %d figures and %d tables", s.compiler.RequestID, inventory.FigureCount, inventory.TableCount)
+	return inventory
+}
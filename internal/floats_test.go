@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+const floatsDocument = `\documentclass{article}
+\begin{document}
+\begin{figure}
+  \centering
+  \caption{Growth of \emph{the} sample}\label{fig:growth}
+\end{figure}
+% \begin{figure}\caption{Commented out}\end{figure}
+\begin{figure*}
+  \caption[Survey map]{A map of every survey site}
+\end{figure*}
+\begin{table}
+  \begin{tabular}{l}x\end{tabular}
+\end{table}
+\end{document}`
+
+// fakeLatexmkWithFloats writes the list-of-figures entries and the label the
+// two captions produce.
+var fakeLatexmkWithFloats = fakeLatexmkScript + `cat > "$job.aux" <<'FAKEAUX'
+\newlabel{fig:growth}{{1}{1}{Growth of \emph {the} sample}{figure.caption.1}{}}
+\@writefile{lof}{\contentsline {figure}{\numberline {1}{\ignorespaces Growth of \emph {the} sample}}{1}{figure.caption.1}}%
+\@writefile{lof}{\contentsline {figure}{\numberline {2}{\ignorespaces Survey map}}{2}{figure.caption.2}}%
+FAKEAUX
+`
+
+func TestCompileReturnsFloatCaptions(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithFloats})
+
+	files := []FileEntry{{Path: "main.tex", Content: floatsDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnFloats: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	inventory := result.Floats
+	if inventory == nil || inventory.FigureCount != 2 || inventory.TableCount != 1 {
+		t.Fatalf("expected 2 figures and 1 table, got %+v", inventory)
+	}
+
+	want := []FloatInfo{
+		{Environment: "figure", Number: "1", Caption: "Growth of the sample", Label: "fig:growth", File: "main.tex", Line: 3},
+		{Environment: "figure*", Number: "2", Caption: "A map of every survey site", ShortCaption: "Survey map", File: "main.tex", Line: 8},
+		{Environment: "table", File: "main.tex", Line: 11},
+	}
+	for i, float := range inventory.Floats {
+		if float != want[i] {
+			t.Fatalf("float %d: expected %+v, got %+v", i, want[i], float)
+		}
+	}
+}
+
+func TestNumberFloatsWithoutAux(t *testing.T) {
+	floats := extractFloats([]FileEntry{{Path: "main.tex", Content: floatsDocument}})
+	numberFloats(floats, "")
+	for _, float := range floats {
+		if float.Number != "" {
+			t.Fatalf("expected no numbers without an .aux, got %+v", float)
+		}
+	}
+}
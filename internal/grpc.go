@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/octree/latex-compile/internal/compilepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// MaxGRPCRequestBytes bounds the size of a gRPC compile request (file set)
+const MaxGRPCRequestBytes = 64 << 20
+
+// grpcCompileServer exposes compilation over gRPC, sharing the HTTP queue,
+// workers and cache
+type grpcCompileServer struct {
+	compilepb.UnimplementedCompileServiceServer
+}
+
+// NewGRPCServer returns a gRPC server with the compile service registered
+func NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(MaxGRPCRequestBytes))
+	compilepb.RegisterCompileServiceServer(server, &grpcCompileServer{})
+	return server
+}
+
+// Compile queues the file set like CompileHandler and returns the result.
+// Compilation failures are reported in the response, not as RPC errors.
+func (s *grpcCompileServer) Compile(ctx context.Context, req *compilepb.CompileRequest) (*compilepb.CompileResponse, error) {
+	if len(req.GetFiles()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "the files array must contain at least one file")
+	}
+
+	if req.GetProjectId() != "" {
+		log.Printf("gRPC compilation request for project: %s", req.GetProjectId())
+	}
+
+	if queueFull() {
+		return nil, status.Error(codes.ResourceExhausted, "too many compilation requests, please try again in a moment")
+	}
+
+	files := make([]FileEntry, 0, len(req.GetFiles()))
+	for _, file := range req.GetFiles() {
+		files = append(files, FileEntry{
+			Path:     file.GetPath(),
+			Content:  file.GetContent(),
+			Encoding: file.GetEncoding(),
+		})
+	}
+
+	job := &CompileJob{
+		Context:          ctx,
+		Files:            files,
+		ProjectID:        req.GetProjectId(),
+		LastModifiedFile: req.GetLastModifiedFile(),
+		Options: CompileOptions{
+			ReturnManifest: req.GetReturnManifest(),
+			JobName:        sanitizeJobName(req.GetJobName()),
+			ClientID:       grpcClientID(ctx),
+			CacheNamespace: grpcMetadataValue(ctx, "cache-namespace"),
+		},
+		EnqueuedAt: time.Now(),
+		ResultChan: make(chan *CompileResult, 1),
+	}
+
+	result, err := submitJob(job)
+	if err != nil {
+		return nil, status.Error(grpcQueueErrorCode(err), err.Error())
+	}
+
+	return toCompileResponse(result), nil
+}
+
+// grpcQueueErrorCode maps a submitJob failure to its gRPC status code, as
+// errorStatus does for HTTP. Unavailable is left to the server shutting down.
+func grpcQueueErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrEnqueueTimeout):
+		return codes.ResourceExhausted
+	case errors.Is(err, ErrQueueWaitExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, ErrSuperseded):
+		return codes.Aborted
+	default:
+		return codes.Internal
+	}
+}
+
+// grpcMetadataValue returns the first value of an incoming metadata key
+func grpcMetadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcClientID identifies the caller by its peer IP, like c.ClientIP() for HTTP
+func grpcClientID(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+func toCompileResponse(result *CompileResult) *compilepb.CompileResponse {
+	resp := &compilepb.CompileResponse{
+		RequestId:    result.RequestID,
+		Success:      result.Success,
+		Pdf:          result.PDFData,
+		Sha256:       result.SHA256,
+		ErrorMessage: result.ErrorMessage,
+		ErrorCode:    result.ErrorCode,
+		Stdout:       result.Stdout,
+		Stderr:       result.Stderr,
+		LogTail:      result.LogTail,
+		QueueMs:      result.QueueMs,
+		DurationMs:   result.DurationMs,
+		PdfSize:      int64(result.PDFSize),
+		CacheHit:     result.CacheHit,
+		PeakRssKb:    result.PeakRssKb,
+	}
+
+	for _, pkg := range result.Manifest {
+		resp.Manifest = append(resp.Manifest, &compilepb.PackageInfo{
+			Name:    pkg.Name,
+			Date:    pkg.Date,
+			Version: pkg.Version,
+			Info:    pkg.Info,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/octree/latex-compile/internal/compilepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCCompileEndToEnd(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	listener := bufconn.Listen(1 << 20)
+	server := NewGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	defer conn.Close()
+
+	client := compilepb.NewCompileServiceClient(conn)
+	resp, err := client.Compile(ctx, &compilepb.CompileRequest{
+		Files: []*compilepb.FileEntry{{Path: "main.tex", Content: simpleDocument}},
+	})
+	if err != nil {
+		t.Fatalf("Compile RPC failed: %v", err)
+	}
+
+	if !resp.GetSuccess() {
+		t.Fatalf("expected success, got error: %s", resp.GetErrorMessage())
+	}
+	if string(resp.GetPdf()[:4]) != "%PDF" || resp.GetSha256() == "" || resp.GetRequestId() == "" {
+		t.Fatalf("unexpected response: pdf=%q sha=%q id=%q", resp.GetPdf(), resp.GetSha256(), resp.GetRequestId())
+	}
+}
+
+func TestGRPCQueueErrorCodes(t *testing.T) {
+	for err, want := range map[error]codes.Code{
+		ErrRateLimited:       codes.ResourceExhausted,
+		ErrEnqueueTimeout:    codes.ResourceExhausted,
+		ErrQueueWaitExceeded: codes.DeadlineExceeded,
+		ErrSuperseded:        codes.Aborted,
+	} {
+		if got := grpcQueueErrorCode(err); got != want {
+			t.Errorf("%v: expected %s, got %s", err, want, got)
+		}
+	}
+}
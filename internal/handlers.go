@@ -1,14 +1,39 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// EnqueueTimeout bounds how long a request waits for a free queue slot
+const EnqueueTimeout = 10 * time.Second
+
+// immutableCacheControl marks content-addressed PDFs as cacheable forever;
+// the name changes whenever the bytes do
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// maxQueueWait bounds how long a request waits for its result once queued;
+// 0 waits indefinitely
+var maxQueueWait time.Duration
+
+// SetMaxQueueWait sets the overall wait for a compile result (0 = unlimited)
+func SetMaxQueueWait(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	maxQueueWait = d
+}
+
 var requestQueue chan *CompileJob
 
 // SetRequestQueue sets the queue for compilation jobs
@@ -26,112 +51,602 @@ func HealthHandler(c *gin.Context) {
 	})
 }
 
+// CacheStatsHandler reports the cache's size and limits and each cached
+// project's last access, PDF size, and workspace presence. It lists every
+// tenant's projects and clients; mount it behind RequireAdmin.
+func CacheStatsHandler(c *gin.Context) {
+	cache := GetCache()
+	stats := cache.Stats()
+	stats["projects"] = cache.ProjectStats()
+	c.JSON(http.StatusOK, stats)
+}
+
 // CompileHandler handles LaTeX compilation requests
 func CompileHandler(c *gin.Context) {
 	// Parse request
 	var req CompileRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "Invalid request",
-			Message: "Could not parse JSON payload",
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	outputFormat, ok := validateCompileRequest(c, &req)
+	if !ok {
+		return
+	}
+
+	// Check queue capacity
+	if rejectWhenBusy(c) {
+		return
+	}
+
+	job := newCompileJob(c, &req, outputFormat)
+
+	if req.CallbackURL != "" {
+		startAsyncCompile(c, job, req.CallbackURL, req.wantsPartialPDF())
+		return
+	}
+
+	// Add to queue (non-blocking with timeout) and wait for the worker's result
+	result, err := submitJob(job)
+	if err != nil {
+		c.JSON(errorStatus(errorCode(err)), ErrorResponse{
+			Error:   "Server busy",
+			Code:    errorCode(err),
+			Message: err.Error(),
 		})
 		return
 	}
 
+	// Set custom headers
+	c.Header("X-Compile-Request-Id", result.RequestID)
+	c.Header("X-Compile-Duration-Ms", fmt.Sprintf("%d", result.DurationMs))
+	c.Header("X-Compile-Queue-Ms", fmt.Sprintf("%d", result.QueueMs))
+	if result.PeakRssKb > 0 {
+		c.Header("X-Compile-Peak-Rss-Kb", fmt.Sprintf("%d", result.PeakRssKb))
+	}
+
+	if result.Success {
+		c.Header("X-Compile-Undefined-References", fmt.Sprintf("%d", result.Undefined.ReferenceCount))
+		c.Header("X-Compile-Undefined-Citations", fmt.Sprintf("%d", result.Undefined.CitationCount))
+		c.Header("X-Compile-Warnings", fmt.Sprintf("%d", len(result.Warnings)))
+		if result.ProvenanceError != "" {
+			c.Header("X-Compile-Provenance-Error", result.ProvenanceError)
+		}
+	}
+
+	// Send response based on result
+	if result.Success && wantsJSONResponse(c, job.Options) {
+		c.Header("X-Compile-Sha256", result.SHA256)
+		c.Header("X-Compile-Visual-Hash", result.VisualHash)
+		c.JSON(http.StatusOK, newCompileResponse(result, job.Options))
+	} else if result.Success && len(result.Artifacts) > 0 {
+		// The rendered first page replaces the PDF
+		c.Header("X-Compile-Sha256", result.SHA256)
+		c.Header("X-Compile-Visual-Hash", result.VisualHash)
+		filename := "compiled-1." + job.Options.OutputFormat
+		if job.Options.JobName != "" {
+			filename = job.Options.JobName + "-1." + job.Options.OutputFormat
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, result.ArtifactMimeType, result.Artifacts[0])
+	} else if result.Success {
+		c.Header("X-Compile-Sha256", result.SHA256)
+		c.Header("X-Compile-Visual-Hash", result.VisualHash)
+		c.Header("Content-Type", "application/pdf")
+		c.Header("Content-Length", fmt.Sprintf("%d", len(result.PDFData)))
+		filename := "compiled.pdf"
+		if job.Options.JobName != "" {
+			filename = job.Options.JobName + ".pdf"
+		}
+		if req.ContentAddressed {
+			filename = result.SHA256 + ".pdf"
+			c.Header("Cache-Control", immutableCacheControl)
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, "application/pdf", result.PDFData)
+	} else {
+		c.JSON(errorStatus(result.ErrorCode), newCompileErrorResponse(result, req.wantsPartialPDF()))
+	}
+}
+
+// validateCompileRequest checks a compile request's files and output format,
+// answering 400 itself when they are invalid
+func validateCompileRequest(c *gin.Context, req *CompileRequest) (string, bool) {
 	if len(req.Files) == 0 {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error:   "Invalid request",
 			Message: "The files array must contain at least one file",
 		})
-		return
+		return "", false
 	}
 
-	files := req.Files
+	outputFormat, ok := normalizeOutputFormat(req.OutputFormat)
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: "outputFormat must be pdf, png, or svg",
+		})
+		return "", false
+	}
+
+	impose, ok := normalizeImposition(req.Impose)
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: "impose must be 2up or booklet",
+		})
+		return "", false
+	}
+	req.Impose = impose
 
 	// Log project ID if provided
 	if req.ProjectID != "" {
 		fmt.Printf("Compilation request for project: %s\n", req.ProjectID)
 	}
+	return outputFormat, true
+}
 
-	// Check queue capacity
-	if len(requestQueue) >= cap(requestQueue) {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":         "Server busy",
-			"message":       "Too many compilation requests. Please try again in a moment.",
-			"queuePosition": len(requestQueue) + 1,
+// newCompileJob creates the job of a validated compile request, with its
+// result channel
+func newCompileJob(c *gin.Context, req *CompileRequest, outputFormat string) *CompileJob {
+	return &CompileJob{
+		Context:          c,
+		Files:            req.Files,
+		ProjectID:        req.ProjectID,
+		LastModifiedFile: req.LastModifiedFile,
+		Options: CompileOptions{
+			ReturnManifest:      req.ReturnManifest,
+			JobName:             sanitizeJobName(req.JobName),
+			MainFile:            req.MainFile,
+			LatexRelease:        req.LatexRelease,
+			ReturnMemoryUsage:   req.ReturnMemoryUsage,
+			ClientID:            c.ClientIP(),
+			CacheNamespace:      req.CacheNamespace,
+			ReturnSynctex:       req.ReturnSynctex || req.SynctexUncompressed,
+			SynctexUncompressed: req.SynctexUncompressed,
+			ReturnXdv:           req.ReturnXdv,
+			ReturnTimings:       req.ReturnTimings,
+			ReturnAllAux:        req.ReturnAllAux,
+			SplitByChapter:      req.SplitByChapter,
+			Env:                 req.Env,
+			ReturnPassLogs:      req.ReturnPassLogs,
+			ReturnFloats:        req.ReturnFloats,
+			ReturnMacros:        req.ReturnMacros,
+			ReturnBibliography:  req.ReturnBibliography,
+			ReturnBibCollisions: req.ReturnBibCollisions,
+			ForceRebuild:        req.ForceRebuild,
+			OutputFormat:        outputFormat,
+			Impose:              req.Impose,
+			RenderAllPages:      req.RenderAllPages,
+			SpriteSheet:         req.SpriteSheet,
+			ReturnText:          req.ReturnText,
+			TextPerPage:         req.TextPerPage,
+			SyncForward:         req.SyncForward,
+			Provenance:          req.Provenance,
+			CpuLimitSeconds:     req.CpuLimitSeconds,
+			ReturnSarif:         req.ReturnSarif,
+			FullLog:             req.FullLog,
+			IncludeOnly:         sanitizeIncludeOnly(req.IncludeOnly),
+		},
+		EnqueuedAt: time.Now(),
+		ResultChan: make(chan *CompileResult, 1),
+	}
+}
+
+// newCompileResponse builds the JSON envelope of a successful compile
+func newCompileResponse(result *CompileResult, options CompileOptions) CompileResponse {
+	resp := CompileResponse{
+		RequestID:      result.RequestID,
+		SHA256:         result.SHA256,
+		VisualHash:     result.VisualHash,
+		QueueMs:        result.QueueMs,
+		DurationMs:     result.DurationMs,
+		PDFSize:        result.PDFSize,
+		CacheHit:       result.CacheHit,
+		PdfBuffer:      base64.StdEncoding.EncodeToString(result.PDFData),
+		Manifest:       result.Manifest,
+		Undefined:      result.Undefined,
+		Memory:         result.Memory,
+		Timings:        result.Timings,
+		AuxFiles:       result.AuxFiles,
+		Passes:         result.Passes,
+		Floats:         result.Floats,
+		Macros:         result.Macros,
+		Bibliography:   result.Bibliography,
+		BibCollisions:  result.BibCollisions,
+		Sarif:          result.Sarif,
+		FullLog:        result.FullLog,
+		Warnings:       result.Warnings,
+		WarningSummary: result.WarningSummary,
+		SpriteSheet:    result.SpriteSheet,
+		Text:           result.Text,
+		SyncTarget:     result.SyncTarget,
+	}
+	resp.ProvenanceError = result.ProvenanceError
+	for _, page := range result.Artifacts {
+		resp.Artifacts = append(resp.Artifacts, base64.StdEncoding.EncodeToString(page))
+	}
+	resp.ArtifactMimeType = result.ArtifactMimeType
+	if len(result.Synctex) > 0 {
+		resp.Synctex = base64.StdEncoding.EncodeToString(result.Synctex)
+		resp.SynctexGzip = !options.SynctexUncompressed
+	}
+	if len(result.Xdv) > 0 {
+		resp.Xdv = base64.StdEncoding.EncodeToString(result.Xdv)
+	}
+	for _, chapter := range result.Chapters {
+		resp.Chapters = append(resp.Chapters, ChapterResponse{
+			Title:     chapter.Title,
+			FirstPage: chapter.FirstPage,
+			LastPage:  chapter.LastPage,
+			PdfBuffer: base64.StdEncoding.EncodeToString(chapter.PDFData),
+		})
+	}
+	return resp
+}
+
+// newCompileErrorResponse builds the response of a failed compile, with the
+// partial PDF when there is one and partialPDF is set
+func newCompileErrorResponse(result *CompileResult, partialPDF bool) ErrorResponse {
+	errResp := ErrorResponse{
+		Error:      "LaTeX compilation failed",
+		Code:       result.ErrorCode,
+		Message:    result.ErrorMessage,
+		RequestID:  result.RequestID,
+		QueueMs:    result.QueueMs,
+		DurationMs: result.DurationMs,
+		Stdout:     result.Stdout,
+		Stderr:     result.Stderr,
+		Log:        result.LogTail,
+		Memory:     result.Memory,
+		Passes:     result.Passes,
+		Sarif:      result.Sarif,
+		FullLog:    result.FullLog,
+		Errors:     result.Errors,
+	}
+	// Include partial PDF if available (some errors produce partial output)
+	if len(result.PDFData) > 0 && partialPDF {
+		errResp.PdfBuffer = base64.StdEncoding.EncodeToString(result.PDFData)
+	}
+	return errResp
+}
+
+// CompileProgressHandler returns the estimated progress of an async compile
+func CompileProgressHandler(c *gin.Context) {
+	event, ok := asyncProgress.get(c.Param("requestId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Not found",
+			Message: "No async compile with this request ID",
 		})
 		return
 	}
+	c.JSON(http.StatusOK, event)
+}
 
-	// Create job with result channel
-	job := &CompileJob{
-		Context:          c,
-		Files:            files,
-		ProjectID:        req.ProjectID,
-		LastModifiedFile: req.LastModifiedFile,
-		EnqueuedAt:       time.Now(),
-		ResultChan:       make(chan *CompileResult, 1),
+// TableExtractHandler parses tabular environments out of LaTeX source and
+// returns their cells as structured rows. It does not compile anything.
+func TableExtractHandler(c *gin.Context) {
+	files, ok := bindSourceFiles(c)
+	if !ok {
+		return
+	}
+
+	tables := []ExtractedTable{}
+	for _, file := range files {
+		tables = append(tables, extractTables(file.Path, file.Content)...)
+	}
+
+	c.JSON(http.StatusOK, TableExtractResponse{Tables: tables})
+}
+
+// MetadataExtractHandler returns the title, authors, date and abstract of a
+// document without compiling it
+func MetadataExtractHandler(c *gin.Context) {
+	files, ok := bindSourceFiles(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, extractMetadata(files))
+}
+
+// CitationCheckHandler reports citations whose keys are missing from the
+// project's .bib files, as a fast pre-flight before compiling
+func CitationCheckHandler(c *gin.Context) {
+	files, ok := bindRequestFiles(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, checkCitations(files))
+}
+
+// bindSourceFiles parses a SourceRequest for the parsing endpoints and returns
+// its LaTeX text files, answering 400 itself when the request is unusable
+func bindSourceFiles(c *gin.Context) ([]FileEntry, bool) {
+	files, ok := bindRequestFiles(c)
+	if !ok {
+		return nil, false
+	}
+
+	var sources []FileEntry
+	for _, file := range files {
+		if file.Encoding == "base64" || !shouldInspectForEngine(file.Path) {
+			continue
+		}
+		sources = append(sources, file)
+	}
+	return sources, true
+}
+
+// bindJSON decodes the request body into dst whatever its Content-Type, since
+// clients often omit the header, and answers 400 with the reason when the body
+// is empty or not valid JSON
+func bindJSON(c *gin.Context, dst interface{}) bool {
+	var body []byte
+	var err error
+	if c.Request.Body != nil {
+		body, err = io.ReadAll(c.Request.Body)
+	}
+
+	message := ""
+	switch {
+	case err != nil:
+		message = "Could not read request body"
+	case len(bytes.TrimSpace(body)) == 0:
+		message = "Request body is empty; send a JSON object"
+	default:
+		if err := json.Unmarshal(body, dst); err != nil {
+			message = jsonErrorMessage(err)
+		}
+	}
+
+	if message != "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: message,
+		})
+		return false
+	}
+	return true
+}
+
+// jsonErrorMessage describes why a body could not be decoded
+func jsonErrorMessage(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("Could not parse JSON payload: %v (at byte %d)", syntaxErr, syntaxErr.Offset)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return fmt.Sprintf("Could not parse JSON payload: field %q must be %s, not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	default:
+		return "Could not parse JSON payload: " + err.Error()
+	}
+}
+
+// bindRequestFiles parses a SourceRequest and returns all of its files
+func bindRequestFiles(c *gin.Context) ([]FileEntry, bool) {
+	var req SourceRequest
+	if !bindJSON(c, &req) {
+		return nil, false
+	}
+	return requestFiles(c, req)
+}
+
+// requestFiles returns a SourceRequest's files, with content as main.tex in
+// front, answering 400 itself when there are none. File types outside
+// ALLOWED_FILE_EXTENSIONS are dropped or answered with 422, as for a compile.
+func requestFiles(c *gin.Context, req SourceRequest) ([]FileEntry, bool) {
+	files := req.Files
+	if req.Content != "" {
+		files = append([]FileEntry{{Path: "main.tex", Content: req.Content}}, files...)
+	}
+	files = dropDisallowedFiles(files, "")
+	if path := findDisallowedFile(files); path != "" {
+		err := fileTypeError(path)
+		c.JSON(errorStatus(errorCode(err)), ErrorResponse{
+			Error:   "Invalid request",
+			Code:    errorCode(err),
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: "Provide content or at least one file",
+		})
+		return nil, false
+	}
+	return files, true
+}
+
+// queueFull reports whether the compile queue has no free slots
+func queueFull() bool {
+	return len(requestQueue) >= cap(requestQueue)
+}
+
+// rejectWhenBusy answers 503 with the queue position and estimated wait when
+// the compile queue has no free slots. Otherwise the response will carry the
+// estimate in X-Compile-Estimated-Wait-Ms.
+func rejectWhenBusy(c *gin.Context) bool {
+	waitMs := estimatedWaitMs(len(requestQueue))
+	if !queueFull() {
+		c.Header("X-Compile-Estimated-Wait-Ms", fmt.Sprintf("%d", waitMs))
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":           "Server busy",
+		"message":         "Too many compilation requests. Please try again in a moment.",
+		"queuePosition":   len(requestQueue) + 1,
+		"estimatedWaitMs": waitMs,
+	})
+	return true
+}
+
+// enqueueJob adds a job to the queue once the global rate allows, giving up
+// after EnqueueTimeout. Once queued, a project-scoped job supersedes that
+// project's previous compile. A job identical to one of its project's queued
+// or running compiles is not queued but answered with that compile's result.
+// The job's request ID is assigned here so that GET /queue can show it.
+func enqueueJob(job *CompileJob) error {
+	if job.RequestID == "" {
+		job.RequestID = uuid.New().String()
+	}
+	projectCompiles.attach(job)
+	if GetCache().joinInFlight(job) {
+		projectCompiles.finish(job)
+		return nil
+	}
+
+	if err := awaitDispatchSlot(job); err != nil {
+		abandonEnqueue(job, err)
+		return err
+	}
+
+	// Tracked before sending, since a worker may pick the job up at once
+	queuedJobs.add(job)
+
+	// A project holds one place in the queue, so superseded jobs never crowd
+	// out other projects
+	if replaced, ok := projectCompiles.claimSlot(job); ok {
+		projectCompiles.supersede(job)
+		queuedJobs.remove(replaced)
+		dropSuperseded(replaced)
+		return nil
 	}
 
-	// Add to queue (non-blocking with timeout)
 	select {
 	case requestQueue <- job:
-		// Wait for worker to send result back
-		result := <-job.ResultChan
-
-		// Set custom headers
-		c.Header("X-Compile-Request-Id", result.RequestID)
-		c.Header("X-Compile-Duration-Ms", fmt.Sprintf("%d", result.DurationMs))
-		c.Header("X-Compile-Queue-Ms", fmt.Sprintf("%d", result.QueueMs))
-
-		// Send response based on result
-		if result.Success {
-			c.Header("X-Compile-Sha256", result.SHA256)
-			c.Header("Content-Type", "application/pdf")
-			c.Header("Content-Length", fmt.Sprintf("%d", len(result.PDFData)))
-			c.Header("Content-Disposition", "attachment; filename=\"compiled.pdf\"")
-			c.Data(http.StatusOK, "application/pdf", result.PDFData)
-		} else {
-			errResp := ErrorResponse{
-				Error:      "LaTeX compilation failed",
-				Message:    result.ErrorMessage,
-				RequestID:  result.RequestID,
-				QueueMs:    result.QueueMs,
-				DurationMs: result.DurationMs,
-				Stdout:     result.Stdout,
-				Stderr:     result.Stderr,
-				Log:        result.LogTail,
-			}
-			// Include partial PDF if available (some errors produce partial output)
-			if len(result.PDFData) > 0 {
-				errResp.PdfBuffer = base64.StdEncoding.EncodeToString(result.PDFData)
-			}
-			c.JSON(http.StatusInternalServerError, errResp)
+		projectCompiles.supersede(job)
+		return nil
+	case <-time.After(EnqueueTimeout):
+		queuedJobs.remove(job)
+		if holder := projectCompiles.takeSlot(job); holder != job {
+			// A newer request took over the place that never came free
+			queuedJobs.remove(holder)
+			projectCompiles.finish(holder)
+			failJob(jobCompiler(holder), holder, ErrEnqueueTimeout)
 		}
-	case <-time.After(10 * time.Second):
-		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
-			Error:   "Server busy",
-			Message: "Could not enqueue request, timeout",
-		})
+		abandonEnqueue(job, ErrEnqueueTimeout)
+		return ErrEnqueueTimeout
+	}
+}
+
+// abandonEnqueue releases a job that was not queued, failing the identical
+// requests that joined it with err
+func abandonEnqueue(job *CompileJob, err error) {
+	projectCompiles.finish(job)
+	GetCache().finishInFlight(job, &CompileResult{
+		RequestID:    job.RequestID,
+		ErrorMessage: err.Error(),
+		ErrorCode:    errorCode(err),
+	})
+}
+
+// submitJob enqueues a job and waits for the worker's result. It fails with
+// ErrRateLimited when the global rate would hold it past maxQueueWait, with
+// ErrEnqueueTimeout when no queue slot frees up within EnqueueTimeout, and
+// with ErrQueueWaitExceeded when the result takes longer than maxQueueWait.
+// An abandoned job still runs to completion (and is cached) since ResultChan
+// is buffered.
+func submitJob(job *CompileJob) (*CompileResult, error) {
+	if err := enqueueJob(job); err != nil {
+		return nil, err
+	}
+
+	if maxQueueWait <= 0 {
+		return <-job.ResultChan, nil
+	}
+
+	wait := maxQueueWait - time.Since(job.EnqueuedAt)
+	select {
+	case result := <-job.ResultChan:
+		return result, nil
+	case <-time.After(wait):
+		log.Printf("Abandoning wait for project %q after %s (MAX_QUEUE_WAIT)", job.ProjectID, maxQueueWait)
+		return nil, ErrQueueWaitExceeded
 	}
 }
 
-// HandleCompilation processes a compilation job
+// wantsJSONResponse reports whether a successful compile should be returned as
+// a JSON envelope rather than raw PDF bytes. Every rendered page, the sprite
+// sheet, and the extracted text only fit in the envelope.
+func wantsJSONResponse(c *gin.Context, options CompileOptions) bool {
+	if options.wantsBuildOutputs() || options.SpriteSheet || options.ReturnText {
+		return true
+	}
+	if options.RenderAllPages && options.OutputFormat != OutputFormatPDF {
+		return true
+	}
+	return c.NegotiateFormat("application/pdf", gin.MIMEJSON) == gin.MIMEJSON
+}
+
+// HandleCompilation processes a compilation job. A project compiles one job
+// at a time: a job whose project is busy is parked, and the worker finishing
+// that project's compile runs the newest parked job next.
 func HandleCompilation(job *CompileJob) {
+	job = projectCompiles.takeSlot(job)
+	queuedJobs.remove(job)
+
+	run, replaced := projectCompiles.begin(job)
+	if replaced != nil {
+		dropSuperseded(replaced)
+	}
+	for run {
+		runJob(job)
+		job = projectCompiles.next(job)
+		run = job != nil
+	}
+}
+
+// runJob compiles job and sends its result. A job superseded while it was
+// queued or parked is dropped without compiling.
+func runJob(job *CompileJob) {
+	if job.Options.Context != nil && job.Options.Context.Err() != nil {
+		dropSuperseded(job)
+		return
+	}
+
+	defer projectCompiles.finish(job)
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Printf("Recovered from panic in compilation: %v\n", r)
 			// Send error result back through channel
-			job.ResultChan <- &CompileResult{
+			sendResult(job, &CompileResult{
 				Success:      false,
 				ErrorMessage: fmt.Sprintf("Internal server error: %v", r),
-			}
+			})
 		}
 	}()
 
-	comp := New()
-	result := comp.Compile(job.Files, job.EnqueuedAt, job.ProjectID)
+	comp := jobCompiler(job)
+	result := comp.Compile(job.Files, job.EnqueuedAt, job.ProjectID, job.Options)
 
 	// Send result back to handler through channel
-	job.ResultChan <- result
+	sendResult(job, result)
+}
+
+// jobCompiler returns a compiler using the job's request ID, if it has one
+func jobCompiler(job *CompileJob) *Compiler {
+	comp := New()
+	if job.RequestID != "" {
+		comp.RequestID = job.RequestID
+	}
+	return comp
+}
+
+// failJob answers a job that never reached the compiler with err, reporting
+// it done to its progress listener as Compile would have
+func failJob(comp *Compiler, job *CompileJob, err error) {
+	if job.Options.Progress != nil {
+		job.Options.Progress(ProgressEvent{RequestID: job.RequestID, Stage: StageDone, Percent: 100})
+	}
+
+	receivedAt := time.Now()
+	queueMs := receivedAt.Sub(job.EnqueuedAt).Milliseconds()
+	metadata := &compileMetadata{RequestID: comp.RequestID, EnqueuedAt: job.EnqueuedAt, ReceivedAt: receivedAt, QueueMs: queueMs}
+	sendResult(job, comp.failWith(metadata, err, queueMs, receivedAt))
 }
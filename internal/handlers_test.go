@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startTestWorker installs a fresh request queue served by one worker for the
+// duration of the test.
+func startTestWorker(t *testing.T) {
+	t.Helper()
+
+	previous := requestQueue
+	queue := make(chan *CompileJob, 4)
+	SetRequestQueue(queue)
+
+	go func() {
+		for job := range queue {
+			HandleCompilation(job)
+		}
+	}()
+
+	t.Cleanup(func() {
+		close(queue)
+		SetRequestQueue(previous)
+	})
+}
+
+// performJSON sends body as JSON to handler mounted at method/path and
+// returns the recorded response.
+func performJSON(t *testing.T, method, path string, handler gin.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal request body: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, path, handler)
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func assertStatus(t *testing.T, recorder *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if recorder.Code != want {
+		t.Fatalf("expected HTTP %d, got %d: %s", want, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestCompileHandlerGivesUpAfterMaxQueueWait(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": "sleep 1\n" + fakeLatexmkScript})
+	startTestWorker(t)
+	forgetProject(t, "slow-project")
+
+	SetMaxQueueWait(200 * time.Millisecond)
+	t.Cleanup(func() { SetMaxQueueWait(0) })
+
+	started := time.Now()
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:     []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		ProjectID: "slow-project",
+	})
+	assertStatus(t, recorder, http.StatusServiceUnavailable)
+	if elapsed := time.Since(started); elapsed > 900*time.Millisecond {
+		t.Fatalf("expected the handler to give up near the wait cap, took %s", elapsed)
+	}
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil || resp.Code != "QUEUE_WAIT_EXCEEDED" {
+		t.Fatalf("expected QUEUE_WAIT_EXCEEDED, got %s", recorder.Body.String())
+	}
+
+	// The worker still finishes and caches the result for a retry
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry, ok := GetCache().Get("slow-project"); ok && len(entry.LastPDFData) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the abandoned compile to be cached")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestCompileHandlerPartialPdfOnError(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript + "exit 12\n"})
+	startTestWorker(t)
+
+	compile := func(partial *bool) ErrorResponse {
+		recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+			Files:             []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+			PartialPdfOnError: partial,
+		})
+		var resp ErrorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode error response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := compile(nil); resp.PdfBuffer == "" {
+		t.Fatalf("expected the partial PDF by default")
+	}
+
+	omit := false
+	if resp := compile(&omit); resp.PdfBuffer != "" || resp.Error == "" {
+		t.Fatalf("expected the partial PDF to be omitted, got %+v", resp)
+	}
+}
+
+func TestCompileHandlerContentAddressedFilename(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	compile := func(contentAddressed bool) *httptest.ResponseRecorder {
+		recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+			Files:            []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+			ContentAddressed: contentAddressed,
+		})
+		assertStatus(t, recorder, http.StatusOK)
+		return recorder
+	}
+
+	recorder := compile(true)
+	sha := recorder.Header().Get("X-Compile-Sha256")
+	if want := `attachment; filename="` + sha + `.pdf"`; sha == "" || recorder.Header().Get("Content-Disposition") != want {
+		t.Fatalf("expected %s, got %q", want, recorder.Header().Get("Content-Disposition"))
+	}
+	if recorder.Header().Get("Cache-Control") != immutableCacheControl {
+		t.Fatalf("expected an immutable Cache-Control, got %q", recorder.Header().Get("Cache-Control"))
+	}
+
+	recorder = compile(false)
+	if recorder.Header().Get("Content-Disposition") != `attachment; filename="compiled.pdf"` || recorder.Header().Get("Cache-Control") != "" {
+		t.Fatalf("expected the default filename without caching headers")
+	}
+}
+
+// performRaw posts body to handler with the given Content-Type ("" omits the
+// header) and returns the recorded response.
+func performRaw(t *testing.T, path string, handler gin.HandlerFunc, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST(path, handler)
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestHandlersAcceptJSONWithoutContentType(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	body, _ := json.Marshal(CompileRequest{Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}}})
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		recorder := performRaw(t, "/compile", CompileHandler, contentType, string(body))
+		assertStatus(t, recorder, http.StatusOK)
+
+		recorder = performRaw(t, "/table/extract", TableExtractHandler, contentType, `{"content": "\\begin{tabular}{c} a \\end{tabular}"}`)
+		assertStatus(t, recorder, http.StatusOK)
+	}
+}
+
+func TestHandlersExplainUnparseableBodies(t *testing.T) {
+	for body, want := range map[string]string{
+		"":                   "Request body is empty; send a JSON object",
+		`{"files": [`:        "Could not parse JSON payload: unexpected end of JSON input (at byte 11)",
+		`{"projectId": 42}`:  `Could not parse JSON payload: field "projectId" must be string, not number`,
+		`files=main.tex&x=1`: "Could not parse JSON payload: invalid character 'i' in literal false (expecting 'a') (at byte 2)",
+	} {
+		recorder := performRaw(t, "/compile", CompileHandler, "application/json", body)
+		assertStatus(t, recorder, http.StatusBadRequest)
+
+		var resp ErrorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode error response: %v", err)
+		}
+		if resp.Message != want {
+			t.Fatalf("body %q: expected %q, got %q", body, want, resp.Message)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package internal
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -28,6 +32,34 @@ func tailLines(text string, maxLines int) string {
 	return strings.Join(lines[len(lines)-maxLines:], "\n")
 }
 
+// stripTeXComments removes %-comments (but not escaped \%) from TeX source,
+// keeping line structure intact
+func stripTeXComments(content string) string {
+	if !strings.Contains(content, "%") {
+		return content
+	}
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if line[j] == '%' {
+				lines[i] = line[:j]
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lineNumberAt returns the 1-based line number of byte offset in content
+func lineNumberAt(content string, offset int) int {
+	return strings.Count(content[:offset], "\n") + 1
+}
+
 // min returns the minimum of two integers
 func min(a, b int) int {
 	if a < b {
@@ -83,6 +115,114 @@ func needsBibliography(content string, files []FileEntry) bool {
 	return false
 }
 
+var packageLoadPattern = regexp.MustCompile(`\\(?:usepackage|RequirePackage|RequirePackageWithOptions)\s*(?:\[[^\]]*\])?\s*\{([^}]*)\}`)
+
+// extractPackages returns the packages loaded via \usepackage/\RequirePackage
+// in content, in order of first appearance
+func extractPackages(content string) []string {
+	var packages []string
+	seen := make(map[string]bool)
+
+	for _, match := range packageLoadPattern.FindAllStringSubmatch(stripTeXComments(content), -1) {
+		for _, pkg := range strings.Split(match[1], ",") {
+			pkg = strings.TrimSpace(pkg)
+			if pkg != "" && !seen[pkg] {
+				seen[pkg] = true
+				packages = append(packages, pkg)
+			}
+		}
+	}
+
+	return packages
+}
+
+// citeCommands are the commands that take citation keys: LaTeX's own, natbib's,
+// and biblatex's. Configuration commands such as \citestyle and \citesetup
+// are left out.
+var citeCommands = []string{
+	"cite", "Cite", "nocite", "citet", "Citet", "citep", "Citep", "citealt", "Citealt",
+	"citealp", "Citealp", "citeauthor", "Citeauthor", "citeyear", "citeyearpar", "citenum",
+	"parencite", "Parencite", "footcite", "Footcite", "footcitetext", "textcite", "Textcite",
+	"smartcite", "Smartcite", "autocite", "Autocite", "supercite", "fullcite", "footfullcite",
+	"citetitle", "Citetitle", "citedate", "citeurl", "volcite", "Volcite",
+	"cites", "Cites", "parencites", "Parencites", "textcites", "Textcites", "autocites", "Autocites",
+}
+
+var citationPattern = regexp.MustCompile(`\\(?:` + strings.Join(citeCommands, "|") + `)\*?(?:\[[^\]]*\]){0,2}\{([^}]*)\}`)
+
+// extractCitationKeys returns the unique citation keys used in content, in
+// order of first citation
+func extractCitationKeys(content string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(stripTeXComments(content), -1) {
+		for _, key := range strings.Split(match[1], ",") {
+			if key = strings.TrimSpace(key); key != "" && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// bibSettingsPattern matches the commands that choose the bibliography's
+// style, options, and data sources: \bibliographystyle, \bibliography, biblatex
+// loaded with options, \ExecuteBibliographyOptions, and \addbibresource
+var bibSettingsPattern = regexp.MustCompile(`\\(?:bibliographystyle|bibliography|ExecuteBibliographyOptions|addbibresource)(?:\[[^\]]*\])?\{[^}]*\}|` +
+	`\\(?:usepackage|RequirePackage)\[[^\]]*\]\{biblatex\}`)
+
+// bibliographyInputHash fingerprints everything the bibliography tool reads:
+// the .bib/.bst files (including those filecontents blocks generate), the
+// style and biblatex options, and the cited keys in order of first citation,
+// which unsorted styles number by. Prose edits that keep the same citations
+// leave it unchanged.
+func bibliographyInputHash(files []FileEntry) string {
+	var bibFiles []FileEntry
+	var keys, settings []string
+	cited := make(map[string]bool)
+
+	for _, file := range files {
+		switch {
+		case strings.HasSuffix(file.Path, ".bib") || strings.HasSuffix(file.Path, ".bst"):
+			bibFiles = append(bibFiles, file)
+		case file.Encoding != "base64" && strings.HasSuffix(file.Path, ".tex"):
+			for _, key := range extractCitationKeys(file.Content) {
+				if !cited[key] {
+					cited[key] = true
+					keys = append(keys, key)
+				}
+			}
+			settings = append(settings, bibSettingsPattern.FindAllString(stripTeXComments(file.Content), -1)...)
+			for _, block := range findFilecontents(file.Content) {
+				if strings.HasSuffix(block.Target, ".bib") || strings.HasSuffix(block.Target, ".bst") {
+					bibFiles = append(bibFiles, FileEntry{Path: file.Path + ":" + block.Target, Content: block.Body})
+				}
+			}
+		}
+	}
+
+	sort.Slice(bibFiles, func(i, j int) bool { return bibFiles[i].Path < bibFiles[j].Path })
+
+	hasher := sha256.New()
+	for _, file := range bibFiles {
+		hasher.Write([]byte(file.Path))
+		hasher.Write([]byte{0})
+		hasher.Write([]byte(file.Content))
+		hasher.Write([]byte{0})
+	}
+	hasher.Write([]byte(strings.Join(keys, ",")))
+	hasher.Write([]byte{0})
+	hasher.Write([]byte(strings.Join(settings, "\n")))
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// biblatexBackendPattern matches a biblatex backend option however it is
+// spaced, in \usepackage[backend=biber]{biblatex} or a class's
+// \ExecuteBibliographyOptions{backend = biber} (content is lowercased)
+var biblatexBackendPattern = regexp.MustCompile(`backend\s*=\s*(biber|bibtex)`)
+
 func detectBibliographyTool(mainContent string, files []FileEntry) bibliographyTool {
 	contentsToScan := []string{mainContent}
 
@@ -101,10 +241,12 @@ func detectBibliographyTool(mainContent string, files []FileEntry) bibliographyT
 	for _, content := range contentsToScan {
 		lower := strings.ToLower(content)
 
+		backend := biblatexBackendPattern.FindStringSubmatch(lower)
+
 		switch {
-		case strings.Contains(lower, "backend=bibtex") || strings.Contains(lower, "backend = bibtex"):
+		case backend != nil && backend[1] == "bibtex":
 			return bibliographyToolBibtex
-		case strings.Contains(lower, "backend=biber") || strings.Contains(lower, "backend = biber"):
+		case backend != nil:
 			seenBiblatex = true
 		case strings.Contains(lower, "\\usepackage{biblatex}") ||
 			(strings.Contains(lower, "\\usepackage[") && strings.Contains(lower, "{biblatex}")) ||
@@ -148,31 +290,12 @@ func needsMultiplePasses(content string) bool {
 }
 
 // createFileStructure writes all files to the temp directory, preserving directory structure
-// Handles both text files and binary files (encoded as base64)
+// Handles both text files and binary files (encoded as base64), refusing file
+// types outside ALLOWED_FILE_EXTENSIONS
 func createFileStructure(tempDir string, files []FileEntry) error {
 	for _, file := range files {
-		fullPath := filepath.Join(tempDir, file.Path)
-
-		// Create directory if needed
-		dir := filepath.Dir(fullPath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %v", dir, err)
-		}
-
-		// Handle binary files encoded as base64
-		if file.Encoding == "base64" {
-			decoded, err := base64.StdEncoding.DecodeString(file.Content)
-			if err != nil {
-				return fmt.Errorf("failed to decode base64 file %s: %v", file.Path, err)
-			}
-			if err := os.WriteFile(fullPath, decoded, 0644); err != nil {
-				return fmt.Errorf("failed to write binary file %s: %v", file.Path, err)
-			}
-		} else {
-			// Text file
-			if err := os.WriteFile(fullPath, []byte(file.Content), 0644); err != nil {
-				return fmt.Errorf("failed to write text file %s: %v", file.Path, err)
-			}
+		if err := writeFile(tempDir, file); err != nil {
+			return err
 		}
 	}
 
@@ -359,29 +482,39 @@ func updateCachedFiles(tempDir string, changes *FileChanges) error {
 	return nil
 }
 
-// writeFile writes a single file to the temp directory
+// writeFile writes a single file to the temp directory, refusing types the
+// file extension policy does not allow
 func writeFile(tempDir string, file FileEntry) error {
+	if !fileExtensionAllowed(file.Path) {
+		return fileTypeError(file.Path)
+	}
 	fullPath := filepath.Join(tempDir, file.Path)
 
 	// Create directory if needed
 	dir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	if err := makeWorkspaceDir(tempDir, dir); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
 
 	// Handle binary files encoded as base64
+	data := []byte(file.Content)
+	kind := "text"
 	if file.Encoding == "base64" {
 		decoded, err := base64.StdEncoding.DecodeString(file.Content)
 		if err != nil {
 			return fmt.Errorf("failed to decode base64 file %s: %v", file.Path, err)
 		}
-		if err := os.WriteFile(fullPath, decoded, 0644); err != nil {
-			return fmt.Errorf("failed to write binary file %s: %v", file.Path, err)
-		}
-	} else {
-		// Text file
-		if err := os.WriteFile(fullPath, []byte(file.Content), 0644); err != nil {
-			return fmt.Errorf("failed to write text file %s: %v", file.Path, err)
+		data = decoded
+		kind = "binary"
+	}
+
+	if err := os.WriteFile(fullPath, data, fileMode); err != nil {
+		return fmt.Errorf("failed to write %s file %s: %w", kind, file.Path, err)
+	}
+	if fileModeSet {
+		// WriteFile's mode is masked by the umask and ignored for existing files
+		if err := os.Chmod(fullPath, fileMode); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %v", file.Path, err)
 		}
 	}
 
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ProjectHistoryLength is how many recent builds are kept per project
+	ProjectHistoryLength = 20
+	// MaxHistoryProjects bounds the projects with an in-memory history; the
+	// least recently built is dropped first
+	MaxHistoryProjects = 1000
+)
+
+// BuildSummary is one compile of a project, as listed by
+// GET /history/project/:projectId
+type BuildSummary struct {
+	RequestID   string    `json:"requestId"`
+	Status      string    `json:"status"` // "success" or "error"
+	Code        string    `json:"code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	CompletedAt time.Time `json:"completedAt"`
+	QueueMs     int64     `json:"queueMs"`
+	DurationMs  int64     `json:"durationMs"`
+	Engine      string    `json:"engine,omitempty"`
+	PDFSize     int       `json:"pdfSize,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+	CacheHit    bool      `json:"cacheHit,omitempty"`
+}
+
+// ProjectHistoryResponse lists a project's recent builds, newest first
+type ProjectHistoryResponse struct {
+	ProjectID string         `json:"projectId"`
+	Builds    []BuildSummary `json:"builds"`
+}
+
+// buildRing holds a project's last ProjectHistoryLength builds
+type buildRing struct {
+	builds    [ProjectHistoryLength]BuildSummary
+	next      int // Slot the next build is written to
+	count     int
+	updatedAt time.Time
+}
+
+// projectHistory keeps each project's recent builds in memory, so editors can
+// list them without scanning HISTORY_DIR
+type projectHistory struct {
+	mu       sync.Mutex
+	projects map[string]*buildRing
+}
+
+var buildHistory = &projectHistory{projects: make(map[string]*buildRing)}
+
+func (h *projectHistory) record(projectID string, build BuildSummary) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.projects[projectID]
+	if !ok {
+		if len(h.projects) >= MaxHistoryProjects {
+			h.evictOldest()
+		}
+		ring = &buildRing{}
+		h.projects[projectID] = ring
+	}
+
+	ring.builds[ring.next] = build
+	ring.next = (ring.next + 1) % ProjectHistoryLength
+	if ring.count < ProjectHistoryLength {
+		ring.count++
+	}
+	ring.updatedAt = time.Now()
+}
+
+// evictOldest drops the least recently built project; callers hold h.mu
+func (h *projectHistory) evictOldest() {
+	oldestID := ""
+	var oldest time.Time
+	for id, ring := range h.projects {
+		if oldestID == "" || ring.updatedAt.Before(oldest) {
+			oldestID, oldest = id, ring.updatedAt
+		}
+	}
+	delete(h.projects, oldestID)
+}
+
+// builds returns the project's recent builds, newest first
+func (h *projectHistory) builds(projectID string) []BuildSummary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	builds := []BuildSummary{}
+	ring, ok := h.projects[projectID]
+	if !ok {
+		return builds
+	}
+	for i := 1; i <= ring.count; i++ {
+		builds = append(builds, ring.builds[(ring.next-i+ProjectHistoryLength)%ProjectHistoryLength])
+	}
+	return builds
+}
+
+// recordHistory adds the finished compile to its project's history
+func (s *compileSession) recordHistory(result *CompileResult) {
+	recordBuild(s.projectID, string(s.engine), result)
+}
+
+// recordBuild adds a result to the history of projectID, a namespaced
+// project key; engine is "" for results that ran none
+func recordBuild(projectID, engine string, result *CompileResult) {
+	if projectID == "" || result == nil {
+		return
+	}
+
+	build := BuildSummary{
+		RequestID:   result.RequestID,
+		Status:      "success",
+		CompletedAt: time.Now(),
+		QueueMs:     result.QueueMs,
+		DurationMs:  result.DurationMs,
+		Engine:      engine,
+		PDFSize:     result.PDFSize,
+		SHA256:      result.SHA256,
+		CacheHit:    result.CacheHit,
+	}
+	if !result.Success {
+		build.Status = "error"
+		build.Code = result.ErrorCode
+		build.Error = result.ErrorMessage
+	}
+	buildHistory.record(projectID, build)
+}
+
+// ProjectHistoryHandler lists a project's recent builds, newest first. The
+// namespace query parameter selects the project's cache namespace, so any
+// tenant's history can be named; mount it behind RequireAdmin.
+func ProjectHistoryHandler(c *gin.Context) {
+	projectID := c.Param("projectId")
+	c.JSON(http.StatusOK, ProjectHistoryResponse{
+		ProjectID: projectID,
+		Builds:    buildHistory.builds(CacheKey(c.Query("namespace"), projectID)),
+	})
+}
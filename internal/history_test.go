@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProjectHistoryListsBuildsNewestFirst(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	projectID := "history-project"
+	forgetProject(t, projectID)
+
+	var requestIDs []string
+	for i := 1; i <= 3; i++ {
+		document := strings.Replace(simpleDocument, "Hello", fmt.Sprintf("Draft %d", i), 1)
+		result := New().Compile([]FileEntry{{Path: "main.tex", Content: document}}, time.Now(), projectID, CompileOptions{})
+		if !result.Success {
+			t.Fatalf("compile %d failed: %s", i, result.ErrorMessage)
+		}
+		requestIDs = append(requestIDs, result.RequestID)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/history/project/:projectId", ProjectHistoryHandler)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/history/project/"+projectID, nil))
+	assertStatus(t, recorder, http.StatusOK)
+
+	var resp ProjectHistoryResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Builds) != 3 {
+		t.Fatalf("expected 3 builds, got %+v", resp.Builds)
+	}
+	for i, build := range resp.Builds {
+		if want := requestIDs[2-i]; build.RequestID != want || build.Status != "success" {
+			t.Fatalf("build %d: expected successful %s, got %+v", i, want, build)
+		}
+	}
+}
+
+func TestProjectHistoryKeepsLastBuilds(t *testing.T) {
+	history := &projectHistory{projects: make(map[string]*buildRing)}
+	for i := 0; i < ProjectHistoryLength+5; i++ {
+		history.record("p", BuildSummary{RequestID: fmt.Sprint(i)})
+	}
+
+	builds := history.builds("p")
+	if len(builds) != ProjectHistoryLength {
+		t.Fatalf("expected %d builds, got %d", ProjectHistoryLength, len(builds))
+	}
+	if builds[0].RequestID != fmt.Sprint(ProjectHistoryLength+4) || builds[len(builds)-1].RequestID != "5" {
+		t.Fatalf("expected builds 24 down to 5, got %s .. %s", builds[0].RequestID, builds[len(builds)-1].RequestID)
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Page impositions a compile can return
+const (
+	Impose2Up     = "2up"
+	ImposeBooklet = "booklet"
+)
+
+// blankPage stands for an empty page in a pdfjam page list
+const blankPage = "{}"
+
+// normalizeImposition returns the requested imposition in lower case, ""
+// for none, and false when it is not supported
+func normalizeImposition(impose string) (string, bool) {
+	impose = strings.ToLower(strings.TrimSpace(impose))
+	switch impose {
+	case "", Impose2Up, ImposeBooklet:
+		return impose, true
+	}
+	return impose, false
+}
+
+// imposedPageOrder lists the pages of a pageCount-page PDF in the order they
+// are placed two to a sheet side, with blank pages padding the end. 2up keeps
+// reading order; booklet pads to a multiple of 4 and orders the pages so the
+// duplex-printed sheets, folded in half and stacked, read 1, 2, 3, ...
+func imposedPageOrder(impose string, pageCount int) []string {
+	page := func(n int) string {
+		if n > pageCount {
+			return blankPage
+		}
+		return strconv.Itoa(n)
+	}
+
+	var order []string
+	if impose == ImposeBooklet {
+		padded := (pageCount + 3) / 4 * 4
+		for i := 0; i < padded/4; i++ {
+			// Front: last and first remaining pages; back: the two inner ones
+			order = append(order, page(padded-2*i), page(2*i+1), page(2*i+2), page(padded-2*i-1))
+		}
+		return order
+	}
+
+	for n := 1; n <= (pageCount+1)/2*2; n++ {
+		order = append(order, page(n))
+	}
+	return order
+}
+
+// impose replaces a successful result's PDF with its 2-up or booklet
+// imposition. The project's cache keeps the original, and the page numbers
+// reported with the result (SyncTeX, text layer, chapters) still refer to it.
+func (s *compileSession) impose(result *CompileResult) error {
+	for _, tool := range []string{"pdfinfo", "pdfjam"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("%w: %s is not installed", ErrImpositionUnavailable, tool)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "impose-*")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrImpositionFailed, err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "input.pdf"), result.PDFData, 0600); err != nil {
+		return fmt.Errorf("%w: %v", ErrImpositionFailed, err)
+	}
+
+	pageCount, err := s.pdfPageCount(dir)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrImpositionFailed, err)
+	}
+
+	order := imposedPageOrder(s.options.Impose, pageCount)
+	cmd := s.command("pdfjam", "input.pdf", strings.Join(order, ","), "--nup", "2x1", "--landscape", "--outfile", "imposed.pdf")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: pdfjam: %v: %s", ErrImpositionFailed, err, strings.TrimSpace(string(output)))
+	}
+
+	imposed, err := os.ReadFile(filepath.Join(dir, "imposed.pdf"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrImpositionFailed, err)
+	}
+
+	log.Printf("[%s] Imposed %d page(s) as %s on %d sheet side(s)", s.compiler.RequestID, pageCount, s.options.Impose, len(order)/2)
+	hash := sha256.Sum256(imposed)
+	result.PDFData = imposed
+	result.PDFSize = len(imposed)
+	result.SHA256 = hex.EncodeToString(hash[:])
+	result.VisualHash = visualHash(imposed)
+	return nil
+}
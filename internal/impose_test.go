@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePdfinfo4 reports a 4-page PDF, and fakePdfjam writes its arguments as
+// the imposed PDF.
+const (
+	fakePdfinfo4 = "echo 'Pages:          4'\n"
+	fakePdfjam   = `printf 'imposed %s' "$*" > imposed.pdf
+`
+)
+
+func TestImposedPageOrder(t *testing.T) {
+	cases := []struct {
+		impose string
+		pages  int
+		want   string
+	}{
+		{ImposeBooklet, 4, "4,1,2,3"},
+		{ImposeBooklet, 8, "8,1,2,7,6,3,4,5"},
+		{ImposeBooklet, 5, "{},1,2,{},{},3,4,5"},
+		{ImposeBooklet, 1, "{},1,{},{}"},
+		{Impose2Up, 4, "1,2,3,4"},
+		{Impose2Up, 3, "1,2,3,{}"},
+	}
+	for _, tc := range cases {
+		if got := strings.Join(imposedPageOrder(tc.impose, tc.pages), ","); got != tc.want {
+			t.Errorf("%s of %d pages: expected %s, got %s", tc.impose, tc.pages, tc.want, got)
+		}
+	}
+}
+
+func TestCompileImposesBookletAndCachesOriginal(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript, "pdfinfo": fakePdfinfo4, "pdfjam": fakePdfjam})
+	startTestWorker(t)
+	forgetProject(t, "impose-booklet")
+
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:     []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		ProjectID: "impose-booklet",
+		Impose:    "Booklet",
+	})
+	assertStatus(t, recorder, http.StatusOK)
+	want := "imposed input.pdf 4,1,2,3 --nup 2x1 --landscape --outfile imposed.pdf"
+	if body := recorder.Body.String(); body != want {
+		t.Fatalf("expected %q, got %q", want, body)
+	}
+
+	recorder = performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:     []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		ProjectID: "impose-booklet",
+	})
+	assertStatus(t, recorder, http.StatusOK)
+	if body := recorder.Body.String(); !strings.HasPrefix(body, "%PDF-1.4") {
+		t.Fatalf("expected the cached original PDF, got %q", body)
+	}
+}
+
+func TestImposeWithoutPdfjamKeepsPDF(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript, "pdfinfo": fakePdfinfo4})
+	if _, err := exec.LookPath("pdfjam"); err == nil {
+		t.Skip("pdfjam is installed")
+	}
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{Impose: Impose2Up})
+	if result.Success || result.ErrorCode != "IMPOSITION_UNAVAILABLE" {
+		t.Fatalf("expected IMPOSITION_UNAVAILABLE, got success=%v code=%q", result.Success, result.ErrorCode)
+	}
+	if len(result.PDFData) == 0 {
+		t.Fatalf("expected the PDF to be kept as a partial result")
+	}
+}
+
+func TestCompileRejectsUnknownImposition(t *testing.T) {
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:  []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		Impose: "4up",
+	})
+	assertStatus(t, recorder, http.StatusBadRequest)
+}
+
+// minimalPDF returns a valid PDF of pageCount blank pages that pdfinfo can
+// read
+func minimalPDF(pageCount int) []byte {
+	var kids []string
+	for i := 0; i < pageCount; i++ {
+		kids = append(kids, fmt.Sprintf("%d 0 R", i+3))
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount),
+	}
+	for i := 0; i < pageCount; i++ {
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes()
+}
+
+func TestCompilePadsFivePageBooklet(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "five.pdf")
+	if err := os.WriteFile(source, minimalPDF(5), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// latexmk produces the 5-page PDF, which pdfinfo counts when installed
+	tools := map[string]string{
+		"latexmk": fakeLatexmkScript + "cp '" + source + "' \"$job.pdf\"\n",
+		"pdfjam":  fakePdfjam,
+	}
+	if _, err := exec.LookPath("pdfinfo"); err != nil {
+		tools["pdfinfo"] = "echo 'Pages:          5'\n"
+	}
+	installFakeTools(t, tools)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{Impose: ImposeBooklet})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	want := "imposed input.pdf {},1,2,{},{},3,4,5 --nup 2x1 --landscape --outfile imposed.pdf"
+	if got := string(result.PDFData); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"log"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	includeOnlyPattern = regexp.MustCompile(`\\includeonly\s*\{([^}]*)\}`)
+	includeOnlyName    = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+)
+
+// sanitizeIncludeOnly normalizes the requested \include names (chapters/intro
+// or chapters/intro.tex), dropping any that could escape the TeX argument
+func sanitizeIncludeOnly(names []string) []string {
+	var clean []string
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.TrimSpace(name), ".tex")
+		if !includeOnlyName.MatchString(name) || strings.Contains(name, "..") {
+			continue
+		}
+		clean = append(clean, path.Clean(name))
+	}
+	return clean
+}
+
+// documentIncludeOnly returns the files named by an \includeonly in the main
+// document, or nil when it has none
+func documentIncludeOnly(mainContent string) []string {
+	m := includeOnlyPattern.FindStringSubmatch(stripTeXComments(mainContent))
+	if m == nil {
+		return nil
+	}
+
+	var names []string
+	for _, name := range strings.Split(m[1], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// resolveIncludeOnly decides whether this compile is a partial build. The
+// .aux files of the excluded chapters keep their page and reference numbers,
+// so the requested \includeonly is only injected into a cached workspace that
+// already has them; a fresh workspace gets a full build first.
+func (s *compileSession) resolveIncludeOnly() {
+	if names := documentIncludeOnly(s.mainContent); names != nil {
+		log.Printf("[%s] Document selects \\includeonly{%s}; other chapters keep their cached .aux (incremental: %v)",
+			s.compiler.RequestID, strings.Join(names, ","), s.isIncremental)
+	}
+
+	if len(s.options.IncludeOnly) == 0 {
+		return
+	}
+	if !s.isIncremental {
+		log.Printf("[%s] includeOnly ignored: no cached .aux files yet, running a full build", s.compiler.RequestID)
+		return
+	}
+
+	s.includeOnly = s.options.IncludeOnly
+	log.Printf("[%s] Partial build of %s", s.compiler.RequestID, strings.Join(s.includeOnly, ", "))
+}
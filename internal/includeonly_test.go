@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const chapteredDocument = `\documentclass{book}
+\begin{document}
+\include{intro}
+\include{chap2}
+\end{document}`
+
+// fakeLatexmkWithChapters writes an .aux per compiled chapter and, on partial
+// builds, records whether the excluded chapter's .aux was still there.
+var fakeLatexmkWithChapters = `partial=""
+for arg; do
+	case "$arg" in
+	-pretex=*includeonly*) partial=1 ;;
+	esac
+done
+if [ -n "$partial" ]; then
+	[ -e intro.aux ] && echo "kept intro.aux" >> "$FAKE_LATEXMK_ARGS"
+else
+	: > intro.aux
+fi
+: > chap2.aux
+` + fakeLatexmkScript
+
+func TestIncludeOnlyReusesCachedAux(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithChapters})
+	projectID := "include-only-test"
+	forgetProject(t, projectID)
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: chapteredDocument},
+		{Path: "intro.tex", Content: "Intro."},
+		{Path: "chap2.tex", Content: "Chapter two."},
+	}
+	options := CompileOptions{IncludeOnly: sanitizeIncludeOnly([]string{"chap2.tex"})}
+
+	readArgs := recordLatexmkArgs(t)
+	result := New().Compile(files, time.Now(), projectID, options)
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	for _, arg := range readArgs() {
+		if strings.HasPrefix(arg, "-pretex=") {
+			t.Fatalf("first build must compile every chapter, got %s", arg)
+		}
+	}
+
+	files[2].Content = "Chapter two, revised."
+	readArgs = recordLatexmkArgs(t)
+	result = New().Compile(files, time.Now(), projectID, options)
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	args := readArgs()
+	if !containsString(args, `-pretex=\includeonly{chap2}`) {
+		t.Fatalf("expected a partial build of chap2, got %v", args)
+	}
+	if !containsString(args, "kept intro.aux") {
+		t.Fatalf("expected the cached intro.aux to be reused, got %v", args)
+	}
+
+	entry, _ := GetCache().Get(projectID)
+	if entry == nil || entry.LastPDFData != nil || entry.ContentHash != "" {
+		t.Fatalf("partial PDF must not be cached for content-hash hits")
+	}
+}
+
+func TestSanitizeIncludeOnly(t *testing.T) {
+	got := sanitizeIncludeOnly([]string{" chapters/intro.tex ", "a}b", "../secret", "appendix"})
+	if strings.Join(got, ",") != "chapters/intro,appendix" {
+		t.Fatalf("unexpected sanitized names: %v", got)
+	}
+}
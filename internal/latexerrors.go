@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// errorContextPattern matches TeX's "l.<line> <text>" line showing where
+	// in the source it stopped
+	errorContextPattern = regexp.MustCompile(`^l\.\d+ `)
+	// runawayPattern matches the line TeX prints before an error about an
+	// unclosed argument; the next line shows how the argument starts
+	runawayPattern = regexp.MustCompile(`^Runaway (argument|definition|text|preamble)\?$`)
+	// fileEndedPattern matches "File ended while scanning use of \textbf."
+	fileEndedPattern = regexp.MustCompile(`^File ended while scanning (use|definition|text|preamble) of (\\[^\s.]+|\\.)\s*\.?`)
+	// paragraphEndedPattern matches "Paragraph ended before \textbf was complete."
+	paragraphEndedPattern = regexp.MustCompile(`^Paragraph ended before (\\\S+) was complete`)
+)
+
+// maxErrorContextLines bounds the context kept after an error message
+const maxErrorContextLines = 6
+
+// ParseLatexErrors extracts the errors of a log written under
+// -file-line-error, in log order. Context holds what TeX printed after the
+// message, up to and including the source excerpt following "l.<line>".
+func ParseLatexErrors(logContent string) []LatexError {
+	var errs []LatexError
+	lines := strings.Split(unwrapLogLines(logContent), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		m := fileLineErrorPattern.FindStringSubmatch(strings.TrimRight(lines[i], "\r"))
+		if m == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(m[2])
+		latexErr := LatexError{
+			File:    strings.TrimPrefix(m[1], "./"),
+			Line:    line,
+			Message: m[3],
+		}
+
+		var context []string
+		for j := i + 1; j < len(lines) && len(context) < maxErrorContextLines; j++ {
+			next := strings.TrimRight(lines[j], "\r")
+			if fileLineErrorPattern.MatchString(next) {
+				break
+			}
+			context = append(context, next)
+			if errorContextPattern.MatchString(next) {
+				// The line after l.<n> holds the rest of the source line
+				if j+1 < len(lines) && strings.TrimSpace(lines[j+1]) != "" {
+					context = append(context, strings.TrimRight(lines[j+1], "\r"))
+				}
+				break
+			}
+		}
+		latexErr.Context = strings.TrimSpace(strings.Join(context, "\n"))
+		latexErr.Hint = errorHint(latexErr.Message, runawayText(lines, i))
+		errs = append(errs, latexErr)
+	}
+	return errs
+}
+
+// runawayText returns how the unclosed argument starts when the error on line
+// i follows "Runaway argument?", or ""
+func runawayText(lines []string, i int) string {
+	if i < 2 || !runawayPattern.MatchString(strings.TrimSpace(lines[i-2])) {
+		return ""
+	}
+	return strings.TrimSpace(lines[i-1])
+}
+
+// errorHint explains the errors TeX reports for a group or argument left
+// open, which rarely point at the missing brace itself
+func errorHint(message, runaway string) string {
+	var hint string
+	if m := fileEndedPattern.FindStringSubmatch(message); m != nil {
+		what := "argument"
+		if m[1] == "definition" || m[1] == "text" {
+			what = "definition"
+		} else if m[1] == "preamble" {
+			what = "alignment preamble"
+		}
+		hint = fmt.Sprintf("The %s of %s is never closed: a { has no matching }, so TeX read to the end of the file looking for it.", what, m[2])
+	} else if m := paragraphEndedPattern.FindStringSubmatch(message); m != nil {
+		hint = fmt.Sprintf("A blank line or \\par ended the paragraph inside the argument of %s, which cannot span paragraphs. Most likely its closing } is missing.", m[1])
+	} else if strings.HasPrefix(message, "Missing $ inserted") {
+		hint = "A math-only character or command (_, ^, \\alpha, ...) is used outside math mode, or math was left open. Wrap it in $...$, or escape a literal underscore as \\_."
+	} else {
+		return ""
+	}
+
+	if runaway != "" {
+		hint += " The unclosed text starts with \"" + runaway + "\"."
+	}
+	return hint
+}
+
+// attachErrorSources sets each error's Source to the line of the request's
+// files it names, and Column to where TeX's "l.<line>" excerpt stops in it.
+// Error files are relative to the main file's directory, mainDir.
+func attachErrorSources(errs []LatexError, files []FileEntry, mainDir string) {
+	contents := make(map[string]string, len(files))
+	for _, file := range files {
+		if file.Encoding != "base64" {
+			contents[path.Clean(file.Path)] = file.Content
+		}
+	}
+
+	for i := range errs {
+		content, ok := contents[path.Join(mainDir, filepath.ToSlash(errs[i].File))]
+		if !ok || errs[i].Line < 1 {
+			continue
+		}
+		sourceLines := strings.Split(content, "\n")
+		if errs[i].Line > len(sourceLines) {
+			continue
+		}
+		source := strings.TrimRight(sourceLines[errs[i].Line-1], "\r")
+		errs[i].Source = source
+
+		if read := excerptRead(errs[i].Context); read != "" {
+			if at := strings.Index(source, read); at >= 0 {
+				errs[i].Column = at + len(read)
+			}
+		}
+	}
+}
+
+// excerptRead returns the source text TeX shows as read before it stopped,
+// from the "l.<line> <text>" line of an error's context
+func excerptRead(context string) string {
+	for _, line := range strings.Split(context, "\n") {
+		if loc := errorContextPattern.FindStringIndex(line); loc != nil {
+			// TeX elides the start of long lines with "..."
+			return strings.TrimPrefix(line[loc[1]:], "...")
+		}
+	}
+	return ""
+}
+
+// latexErrors parses the log's errors and locates them in the sources
+func (s *compileSession) latexErrors(logContent string) []LatexError {
+	errs := ParseLatexErrors(logContent)
+	mainFile, err := filepath.Rel(s.tempDir, s.texFilePath)
+	if err != nil {
+		return errs
+	}
+	attachErrorSources(errs, s.files, path.Dir(filepath.ToSlash(mainFile)))
+	return errs
+}
+
+// Kinds of LatexWarning
+const (
+	WarningUndefinedReference = "undefined-reference"
+	WarningUndefinedCitation  = "undefined-citation"
+	WarningOverfullBox        = "overfull-box"
+	WarningUnderfullBox       = "underfull-box"
+)
+
+// warningKinds maps the diagnostic rules surfaced as warnings to their kind
+var warningKinds = map[string]string{
+	"latex/undefined-reference": WarningUndefinedReference,
+	"latex/undefined-citation":  WarningUndefinedCitation,
+	"latex/overfull-hbox":       WarningOverfullBox,
+	"latex/overfull-vbox":       WarningOverfullBox,
+	"latex/underfull-hbox":      WarningUnderfullBox,
+	"latex/underfull-vbox":      WarningUnderfullBox,
+}
+
+// undefinedKeyPattern reads the label or citation key of an undefined
+// reference warning's message
+var undefinedKeyPattern = regexp.MustCompile("^(?:Reference|Citation) `([^']+)'")
+
+// ParseLatexWarnings extracts undefined reference and citation warnings
+// (LaTeX's and natbib's) and overfull/underfull box reports, in log order.
+// Messages TeX wrapped at max_print_line are joined first.
+func ParseLatexWarnings(logContent string) []LatexWarning {
+	var warnings []LatexWarning
+	for _, d := range parseLogDiagnostics(logContent) {
+		kind, ok := warningKinds[d.Rule]
+		if !ok {
+			continue
+		}
+		warning := LatexWarning{Kind: kind, Message: d.Message, Line: d.Line}
+		if m := undefinedKeyPattern.FindStringSubmatch(d.Message); m != nil {
+			warning.Key = m[1]
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// SummarizeLatexWarnings reports which categories of warning the log has, for
+// clients that only need to know whether a build is clean
+func SummarizeLatexWarnings(logContent string) *WarningSummary {
+	summary := &WarningSummary{}
+	for _, d := range parseLogDiagnostics(logContent) {
+		switch d.Rule {
+		case "latex/undefined-reference":
+			summary.UndefinedRefs = true
+		case "latex/undefined-citation":
+			summary.UndefinedCitations = true
+		case "latex/overfull-hbox", "latex/overfull-vbox":
+			summary.Overfull = true
+		case "latex/underfull-hbox", "latex/underfull-vbox":
+			summary.Underfull = true
+		case "latex/font":
+			summary.FontWarnings = true
+		}
+	}
+	return summary
+}
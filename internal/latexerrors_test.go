@@ -0,0 +1,246 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const erroringLog = `This is pdfTeX, Version 3.141592653-2.6-1.40.25
+(./main.tex
+./chapters/intro.tex:7: Undefined control sequence.
+l.7 Some text \foo
+                  and more
+The control sequence at the end of the top line
+./main.tex:12: LaTeX Error: Environment itemise undefined.
+
+See the LaTeX manual or LaTeX Companion for explanation.
+Type  H <return>  for immediate help.
+ ...
+
+l.12 \begin{itemise}
+
+)
+! Emergency stop.
+`
+
+func TestParseLatexErrors(t *testing.T) {
+	errs := ParseLatexErrors(erroringLog)
+	want := []LatexError{
+		{File: "chapters/intro.tex", Line: 7, Message: "Undefined control sequence.", Context: "l.7 Some text \\foo\n                  and more"},
+		{File: "main.tex", Line: 12, Message: "LaTeX Error: Environment itemise undefined.", Context: "See the LaTeX manual or LaTeX Companion for explanation.\nType  H <return>  for immediate help.\n ...\n\nl.12 \\begin{itemise}"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), errs)
+	}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Fatalf("error %d: expected %+v, got %+v", i, want[i], errs[i])
+		}
+	}
+}
+
+// runawayLog is pdflatex's log for an unclosed \textbf{ in main.tex, first
+// running into the end of the file and then, in chapter.tex, a blank line
+const runawayLog = `(./main.tex
+Runaway argument?
+{Hello world \end {document}
+./main.tex:6: File ended while scanning use of \textbf .
+<inserted text> 
+                \par 
+<*> main.tex
+            
+I suspect you have forgotten a ` + "`" + `}', causing me
+to read past where you wanted me to stop.
+Runaway argument?
+{Some bold 
+./chapter.tex:3: Paragraph ended before \textbf was complete.
+<to be read again> 
+                   \par 
+l.3 
+    
+)
+`
+
+func TestParseLatexErrorsExplainsRunawayArguments(t *testing.T) {
+	errs := ParseLatexErrors(runawayLog)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %+v", errs)
+	}
+
+	fileEnded := errs[0]
+	if fileEnded.File != "main.tex" || fileEnded.Line != 6 || fileEnded.Message != "File ended while scanning use of \\textbf ." {
+		t.Fatalf("unexpected runaway error %+v", fileEnded)
+	}
+	want := "The argument of \\textbf is never closed: a { has no matching }, so TeX read to the end of the file looking for it. " +
+		"The unclosed text starts with \"{Hello world \\end {document}\"."
+	if fileEnded.Hint != want {
+		t.Fatalf("expected hint %q, got %q", want, fileEnded.Hint)
+	}
+
+	paragraphEnded := errs[1]
+	if paragraphEnded.File != "chapter.tex" || paragraphEnded.Line != 3 ||
+		!strings.HasPrefix(paragraphEnded.Hint, "A blank line or \\par ended the paragraph inside the argument of \\textbf") ||
+		!strings.HasSuffix(paragraphEnded.Hint, "The unclosed text starts with \"{Some bold\".") {
+		t.Fatalf("unexpected paragraph error %+v", paragraphEnded)
+	}
+
+	if errs := ParseLatexErrors(erroringLog); errs[0].Hint != "" {
+		t.Fatalf("expected no hint for an undefined control sequence, got %q", errs[0].Hint)
+	}
+}
+
+func TestFailedCompileReturnsParsedErrors(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(erroringLog) + "rm -f \"$job.pdf\"\nexit 12\n"})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success {
+		t.Fatalf("expected the compile to fail")
+	}
+	if len(result.Errors) != 2 || result.Errors[1].Line != 12 {
+		t.Fatalf("expected the log's 2 errors, got %+v", result.Errors)
+	}
+}
+
+// missingDollarLog is pdflatex's log for the stray underscore of
+// missingDollarDocument
+const missingDollarLog = `(./main.tex
+./main.tex:4: Missing $ inserted.
+<inserted text> 
+                $
+l.4 The variable max_
+                     size is too small.
+I've inserted a begin-math/end-math symbol since I think
+you left one out. Proceed, with fingers crossed.
+)
+`
+
+const missingDollarDocument = "\\documentclass{article}\n\\begin{document}\n\n" +
+	"The variable max_size is too small.\n\\end{document}\n"
+
+func TestFailedCompileLocatesMissingDollar(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(missingDollarLog) + "rm -f \"$job.pdf\"\nexit 12\n"})
+
+	files := []FileEntry{{Path: "paper/main.tex", Content: missingDollarDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success || len(result.Errors) != 1 {
+		t.Fatalf("expected the compile to fail with 1 error, got %+v", result.Errors)
+	}
+
+	missing := result.Errors[0]
+	if missing.Line != 4 || missing.Source != "The variable max_size is too small." || missing.Column != 17 {
+		t.Fatalf("expected the stray _ at 4:17 with its source line, got %+v", missing)
+	}
+	if !strings.HasPrefix(missing.Hint, "A math-only character or command") {
+		t.Fatalf("expected a math-mode hint, got %q", missing.Hint)
+	}
+}
+
+func TestParseLatexWarnings(t *testing.T) {
+	// TeX breaks log lines at max_print_line (79) columns
+	wrapped := "LaTeX Warning: Reference `sec:a-rather-long-label-name-that-wraps' on page 3 un"
+	if len(wrapped) != maxPrintLine {
+		t.Fatalf("fixture line is %d columns, want %d", len(wrapped), maxPrintLine)
+	}
+	logContent := wrapped + "\ndefined on input line 42.\n\n" +
+		"Package natbib Warning: Citation `knuth84' on page 3 undefined on input line 50.\n\n" +
+		"Package hyperref Warning: Token not allowed in a PDF string (Unicode):\n" +
+		"(hyperref)                removing `math shift' on input line 9.\n\n" +
+		"Overfull \\hbox (12.3pt too wide) in paragraph at lines 7--9\n" +
+		"Underfull \\vbox (badness 10000) has occurred while \\output is active []\n"
+
+	got := ParseLatexWarnings(logContent)
+	want := []LatexWarning{
+		{Kind: WarningUndefinedReference, Key: "sec:a-rather-long-label-name-that-wraps", Message: "Reference `sec:a-rather-long-label-name-that-wraps' on page 3 undefined on input line 42.", Line: 42},
+		{Kind: WarningUndefinedCitation, Key: "knuth84", Message: "Citation `knuth84' on page 3 undefined on input line 50.", Line: 50},
+		{Kind: WarningOverfullBox, Message: "Overfull \\hbox (12.3pt too wide) in paragraph at lines 7--9", Line: 7},
+		{Kind: WarningUnderfullBox, Message: "Underfull \\vbox (badness 10000) has occurred while \\output is active []"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d warnings, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("warning %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestSuccessfulCompileReturnsWarnings(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog("Overfull \\hbox (3.0pt too wide) in paragraph at lines 4--5\n")})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if !result.Success {
+		t.Fatalf("expected success, got %s", result.ErrorMessage)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Kind != WarningOverfullBox || result.Warnings[0].Line != 4 {
+		t.Fatalf("expected the overfull box warning, got %+v", result.Warnings)
+	}
+}
+
+func TestCacheHitReturnsWarnings(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog("Overfull \\hbox (3.0pt too wide) in paragraph at lines 4--5\n")})
+	forgetProject(t, "cached-warnings")
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	New().Compile(files, time.Now(), "cached-warnings", CompileOptions{})
+	result := New().Compile(files, time.Now(), "cached-warnings", CompileOptions{})
+	if !result.Success || !result.CacheHit {
+		t.Fatalf("expected a cache hit, got success=%v cacheHit=%v", result.Success, result.CacheHit)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Kind != WarningOverfullBox {
+		t.Fatalf("expected the cached build's warning, got %+v", result.Warnings)
+	}
+}
+
+func TestCacheHitReturnsWarningSummary(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog("Overfull \\hbox (3.0pt too wide) in paragraph at lines 4--5\n")})
+	forgetProject(t, "cached-summary")
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	New().Compile(files, time.Now(), "cached-summary", CompileOptions{})
+	result := New().Compile(files, time.Now(), "cached-summary", CompileOptions{})
+	if !result.CacheHit {
+		t.Fatalf("expected a cache hit")
+	}
+	if want := (WarningSummary{Overfull: true}); result.WarningSummary == nil || *result.WarningSummary != want {
+		t.Fatalf("expected the cached build's summary, got %+v", result.WarningSummary)
+	}
+}
+
+func TestSummarizeLatexWarningsOnlyOverfull(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(
+		"Overfull \\hbox (3.0pt too wide) in paragraph at lines 4--5\n" +
+			"Overfull \\vbox (1.5pt too high) has occurred while \\output is active\n")})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if !result.Success {
+		t.Fatalf("expected success, got %s", result.ErrorMessage)
+	}
+	want := WarningSummary{Overfull: true}
+	if result.WarningSummary == nil || *result.WarningSummary != want {
+		t.Fatalf("expected only overfull to be flagged, got %+v", result.WarningSummary)
+	}
+	for _, warning := range result.Warnings {
+		if warning.Kind != WarningOverfullBox {
+			t.Fatalf("summary disagrees with diagnostic %+v", warning)
+		}
+	}
+}
+
+func TestSummarizeLatexWarnings(t *testing.T) {
+	logContent := "LaTeX Warning: Citation `knuth84' on page 1 undefined on input line 9.\n" +
+		"LaTeX Font Warning: Font shape `OT1/cmr/m/scit' undefined\n" +
+		"(Font)              using `OT1/cmr/m/it' instead on input line 3.\n"
+
+	want := WarningSummary{UndefinedCitations: true, FontWarnings: true}
+	if got := SummarizeLatexWarnings(logContent); *got != want {
+		t.Fatalf("expected %+v, got %+v", want, *got)
+	}
+	if got := SummarizeLatexWarnings(""); *got != (WarningSummary{}) {
+		t.Fatalf("expected a clean summary for an empty log, got %+v", *got)
+	}
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+)
+
+// latexReleasePattern matches the YYYY-MM-DD dates latexrelease accepts
+var latexReleasePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// validLatexRelease reports whether release is a real calendar date in
+// YYYY-MM-DD form
+func validLatexRelease(release string) bool {
+	if !latexReleasePattern.MatchString(release) {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", release)
+	return err == nil
+}
+
+// latexReleaseDirective loads latexrelease ahead of \documentclass so the
+// kernel behaves as it did on the given date
+func latexReleaseDirective(release string) string {
+	return `\RequirePackage[` + release + `]{latexrelease}`
+}
+
+// enforceLatexRelease rejects a latexRelease that is not a date; anything
+// else would be injected verbatim into the engine command
+func (s *compileSession) enforceLatexRelease() *CompileResult {
+	if s.options.LatexRelease == "" || validLatexRelease(s.options.LatexRelease) {
+		return nil
+	}
+	err := fmt.Errorf("%w: %q", ErrInvalidLatexRelease, s.options.LatexRelease)
+	log.Printf("[%s] Rejecting request: %v", s.compiler.RequestID, err)
+	return s.compiler.failWith(s.metadata, err, s.queueMs, s.receivedAt)
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompileInjectsLatexRelease(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{LatexRelease: "2022-06-01"})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if args := readArgs(); !containsString(args, `-pretex=\RequirePackage[2022-06-01]{latexrelease}`) {
+		t.Fatalf("expected the latexrelease directive before the document, got %v", args)
+	}
+
+	hash := func(release string) string {
+		s := &compileSession{files: files, options: CompileOptions{LatexRelease: release}}
+		return s.contentHash()
+	}
+	if hash("") == hash("2022-06-01") || hash("2022-06-01") == hash("2020-10-01") {
+		t.Fatalf("expected the kernel release to change the content hash")
+	}
+}
+
+func TestCompileRejectsInvalidLatexRelease(t *testing.T) {
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	for _, release := range []string{"2022/06/01", "2022-13-01", "2022-06-01]{x}"} {
+		result := New().Compile(files, time.Now(), "", CompileOptions{LatexRelease: release})
+		if result.Success || result.ErrorCode != "INVALID_LATEX_RELEASE" {
+			t.Fatalf("expected %q to be rejected, got success=%v code=%q", release, result.Success, result.ErrorCode)
+		}
+	}
+}
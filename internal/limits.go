@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxGraphicsInclusions caps the number of \includegraphics calls found in a
+// project's sources; 0 disables the check. It counts calls written out in the
+// source, not inclusions made at run time.
+var maxGraphicsInclusions int
+
+// deniedPackages is the server policy of packages documents may not load
+var deniedPackages map[string]bool
+
+var (
+	includegraphicsPattern = regexp.MustCompile(`\\includegraphics\b`)
+	// Package names safe to splice into a hook name
+	packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	// The error deniedPackageHooks raises when a denied package is loaded
+	deniedPackageLoadPattern = regexp.MustCompile(`(?m)^! Package (\S+) is not allowed on this server`)
+)
+
+// SetMaxGraphicsInclusions sets the per-request \includegraphics cap (0 = unlimited)
+func SetMaxGraphicsInclusions(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	maxGraphicsInclusions = limit
+}
+
+// SetDeniedPackages sets the packages that cause a request to be rejected
+func SetDeniedPackages(packages []string) {
+	denied := make(map[string]bool, len(packages))
+	for _, pkg := range packages {
+		if pkg = strings.TrimSpace(pkg); pkg != "" {
+			denied[pkg] = true
+		}
+	}
+	deniedPackages = denied
+}
+
+// findDeniedPackage returns the first denied package loaded by the project and
+// the file loading it. It reads the \usepackage and \RequirePackage calls in
+// the inspected text sources, so it misses package names built by macros and
+// packages loaded from files the extension filter skips; deniedPackageHooks
+// stops those at run time.
+func findDeniedPackage(files []FileEntry) (string, string) {
+	if len(deniedPackages) == 0 {
+		return "", ""
+	}
+
+	for _, file := range files {
+		if file.Encoding == "base64" || !shouldInspectForEngine(file.Path) {
+			continue
+		}
+		for _, pkg := range extractPackages(file.Content) {
+			if deniedPackages[pkg] {
+				return pkg, file.Path
+			}
+		}
+	}
+	return "", ""
+}
+
+// deniedPackageHooks returns pre-TeX code that aborts the run as soon as a
+// denied package is loaded, however its name was spelled in the source. It
+// needs the LaTeX hook system (2020-10 or later); older kernels rely on
+// findDeniedPackage alone. A package read with \input rather than loaded as
+// a package is not caught.
+func deniedPackageHooks() string {
+	packages := make([]string, 0, len(deniedPackages))
+	for pkg := range deniedPackages {
+		if packageNamePattern.MatchString(pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+	if len(packages) == 0 {
+		return ""
+	}
+	// Sorted, so the engine command stays the same between compiles
+	sort.Strings(packages)
+
+	var code strings.Builder
+	for _, pkg := range packages {
+		code.WriteString(`\AddToHook{package/` + pkg + `/before}{\errmessage{Package ` + pkg +
+			` is not allowed on this server}\csname @@end\endcsname}`)
+	}
+	return `\ifdefined\AddToHook` + code.String() + `\fi`
+}
+
+// detectDeniedPackageLoad returns an ErrDeniedPackage naming the package when
+// deniedPackageHooks stopped the run, or nil
+func detectDeniedPackageLoad(logContent string) error {
+	m := deniedPackageLoadPattern.FindStringSubmatch(logContent)
+	if m == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s (loaded at run time)", ErrDeniedPackage, m[1])
+}
+
+// countGraphicsInclusions counts \includegraphics calls outside comments in
+// the project's text sources. A loop (\foreach) or macro that issues many
+// inclusions from one call counts once, and files the extension filter does
+// not inspect are not counted; COMPILE_TIMEOUT and MAX_CPU_SECONDS bound
+// those documents at run time instead.
+func countGraphicsInclusions(files []FileEntry) int {
+	count := 0
+	for _, file := range files {
+		if file.Encoding == "base64" || !shouldInspectForEngine(file.Path) {
+			continue
+		}
+		count += len(includegraphicsPattern.FindAllStringIndex(stripTeXComments(file.Content), -1))
+	}
+	return count
+}
+
+// enforceLimits runs the cheap pre-compile guards and returns an error result
+// if the request exceeds any configured cap or violates the package policy
+func (s *compileSession) enforceLimits() *CompileResult {
+	if result := s.enforceFileExtensions(); result != nil {
+		return result
+	}
+
+	if result := s.enforceSafeMode(); result != nil {
+		return result
+	}
+
+	if result := s.enforceRequestEnv(); result != nil {
+		return result
+	}
+
+	if result := s.enforceMainFile(); result != nil {
+		return result
+	}
+
+	if result := s.enforceLatexRelease(); result != nil {
+		return result
+	}
+
+	if pkg, path := findDeniedPackage(s.files); pkg != "" {
+		log.Printf("[%s] Rejecting request: denied package %s loaded in %s", s.compiler.RequestID, pkg, path)
+		return s.compiler.failWith(s.metadata, fmt.Errorf("%w: %s (loaded in %s)", ErrDeniedPackage, pkg, path), s.queueMs, s.receivedAt)
+	}
+
+	if maxGraphicsInclusions > 0 {
+		if count := countGraphicsInclusions(s.files); count > maxGraphicsInclusions {
+			log.Printf("[%s] Rejecting request: %d \\includegraphics exceeds limit of %d", s.compiler.RequestID, count, maxGraphicsInclusions)
+			return s.compiler.failWith(s.metadata, newLimitError(ErrTooManyGraphics, count, maxGraphicsInclusions), s.queueMs, s.receivedAt)
+		}
+	}
+
+	return s.enforceSyntax()
+}
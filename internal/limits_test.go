@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileRejectsTooManyGraphics(t *testing.T) {
+	SetMaxGraphicsInclusions(10)
+	t.Cleanup(func() { SetMaxGraphicsInclusions(0) })
+
+	var body strings.Builder
+	body.WriteString("\\documentclass{article}\n\\usepackage{graphicx}\n\\begin{document}\n")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&body, "\\includegraphics{img%d.png}\n", i)
+	}
+	body.WriteString("% \\includegraphics{commented.png}\n\\end{document}\n")
+
+	files := []FileEntry{{Path: "main.tex", Content: body.String()}}
+	if got := countGraphicsInclusions(files); got != 50 {
+		t.Fatalf("expected 50 inclusions (ignoring comments), got %d", got)
+	}
+
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success {
+		t.Fatalf("expected compile to be rejected")
+	}
+	if result.ErrorCode != "TOO_MANY_GRAPHICS" {
+		t.Fatalf("expected TOO_MANY_GRAPHICS, got %q (%s)", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestCompileRejectsDeniedPackage(t *testing.T) {
+	SetDeniedPackages([]string{"shellesc"})
+	t.Cleanup(func() { SetDeniedPackages(nil) })
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: "\\documentclass{article}\n\\input{preamble}\n\\begin{document}Hi\\end{document}"},
+		{Path: "preamble.tex", Content: "\\usepackage[utf8]{inputenc}\n\\usepackage{amsmath, shellesc}\n"},
+	}
+
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success || result.ErrorCode != "DENIED_PACKAGE" {
+		t.Fatalf("expected DENIED_PACKAGE rejection, got success=%v code=%q", result.Success, result.ErrorCode)
+	}
+	if !strings.Contains(result.ErrorMessage, "shellesc") || !strings.Contains(result.ErrorMessage, "preamble.tex") {
+		t.Fatalf("expected error to name the package and file, got %q", result.ErrorMessage)
+	}
+}
+
+func TestCompileStopsDeniedPackageLoadedAtRunTime(t *testing.T) {
+	SetDeniedPackages([]string{"shellesc", "bad name}"})
+	t.Cleanup(func() { SetDeniedPackages(nil) })
+
+	// The engine's hook fires on the package actually loaded
+	installFakeTools(t, map[string]string{"latexmk": `printf '%s\n' "$@" >> "$FAKE_LATEXMK_ARGS"
+cat > main.log <<'FAKELOG'
+! Package shellesc is not allowed on this server.
+FAKELOG
+exit 12
+`})
+	readArgs := recordLatexmkArgs(t)
+
+	// A macro-built name the source scan cannot see
+	files := []FileEntry{{Path: "main.tex", Content: "\\documentclass{article}\n\\def\\pkg{shell}\n\\usepackage{\\pkg esc}\n\\begin{document}Hi\\end{document}"}}
+	if pkg, _ := findDeniedPackage(files); pkg != "" {
+		t.Fatalf("expected the source scan to miss the macro-built name, got %q", pkg)
+	}
+
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success || result.ErrorCode != "DENIED_PACKAGE" || !strings.Contains(result.ErrorMessage, "shellesc") {
+		t.Fatalf("expected DENIED_PACKAGE naming shellesc, got success=%v code=%q message=%q", result.Success, result.ErrorCode, result.ErrorMessage)
+	}
+
+	args := strings.Join(readArgs(), "\n")
+	if !strings.Contains(args, `\AddToHook{package/shellesc/before}`) {
+		t.Fatalf("expected a load hook for the denied package, got %q", args)
+	}
+	if strings.Contains(args, "bad name") {
+		t.Fatalf("expected names unsafe to splice into TeX to be left out, got %q", args)
+	}
+}
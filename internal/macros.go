@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// macroDefiners are the commands whose definitions are listed, without their
+// star
+var macroDefiners = map[string]bool{
+	"newcommand":           true,
+	"renewcommand":         true,
+	"providecommand":       true,
+	"DeclareRobustCommand": true,
+	"DeclareMathOperator":  true,
+	"def":                  true,
+	"gdef":                 true,
+	"edef":                 true,
+	"xdef":                 true,
+}
+
+// macroSourceExtensions are the project files scanned for definitions
+var macroSourceExtensions = map[string]bool{".tex": true, ".sty": true, ".cls": true}
+
+// extractMacros finds the user-defined commands in the project sources, main
+// file first, in definition order. A command redefined later is listed again.
+func extractMacros(files []FileEntry) []MacroDefinition {
+	var macros []MacroDefinition
+	for _, file := range mainFileFirst(files) {
+		if file.Encoding == "base64" || !macroSourceExtensions[filepath.Ext(file.Path)] {
+			continue
+		}
+		content := stripTeXComments(file.Content)
+
+		for pos := 0; ; {
+			i := strings.IndexByte(content[pos:], '\\')
+			if i == -1 {
+				break
+			}
+			start := pos + i
+			definer, end := readCommandName(content, start)
+			pos = end
+			if end == start+1 {
+				pos++ // A control symbol such as \\ or \%
+				continue
+			}
+			if !macroDefiners[strings.TrimSuffix(definer, "*")] {
+				continue
+			}
+
+			macro, ok := parseMacroDefinition(content, end, strings.TrimSuffix(definer, "*"))
+			if !ok {
+				continue
+			}
+			macro.Definer = definer
+			macro.File = file.Path
+			macro.Line = lineNumberAt(content, start)
+			macros = append(macros, macro)
+		}
+	}
+	return macros
+}
+
+// parseMacroDefinition reads the defined command and its arity after a
+// definer: \newcommand{\foo}[2][x], \newcommand\foo[1], \def\foo#1#2,
+// \DeclareMathOperator{\Tr}
+func parseMacroDefinition(content string, pos int, definer string) (MacroDefinition, bool) {
+	var macro MacroDefinition
+
+	pos = skipSpaces(content, pos)
+	if pos < len(content) && content[pos] == '{' {
+		var braced string
+		braced, pos = readDelimited(content, pos, '{', '}')
+		name, end := readMacroName(strings.TrimSpace(braced), 0)
+		if name == "" || end != len(strings.TrimSpace(braced)) {
+			return macro, false
+		}
+		macro.Name = name
+	} else {
+		macro.Name, pos = readMacroName(content, pos)
+		if macro.Name == "" {
+			return macro, false
+		}
+	}
+
+	switch definer {
+	case "DeclareMathOperator":
+	case "def", "gdef", "edef", "xdef":
+		// The parameter text runs up to the body's opening brace
+		for ; pos < len(content) && content[pos] != '{'; pos++ {
+			if content[pos] == '#' && pos+1 < len(content) && content[pos+1] >= '1' && content[pos+1] <= '9' {
+				macro.Arity = int(content[pos+1] - '0')
+			}
+		}
+	default:
+		pos = skipSpaces(content, pos)
+		if pos < len(content) && content[pos] == '[' {
+			var count string
+			count, pos = readDelimited(content, pos, '[', ']')
+			count = strings.TrimSpace(count)
+			if len(count) != 1 || count[0] < '0' || count[0] > '9' {
+				return macro, false
+			}
+			macro.Arity = int(count[0] - '0')
+
+			pos = skipSpaces(content, pos)
+			macro.OptionalFirst = pos < len(content) && content[pos] == '[' && macro.Arity > 0
+		}
+	}
+	return macro, true
+}
+
+// readMacroName reads the control sequence at pos, returning it with its
+// backslash. Letters and @ form a name (as under \makeatletter); anything
+// else is a single-character control symbol.
+func readMacroName(s string, pos int) (string, int) {
+	if pos >= len(s) || s[pos] != '\\' {
+		return "", pos
+	}
+	end := pos + 1
+	for end < len(s) && (s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z' || s[end] == '@') {
+		end++
+	}
+	if end == pos+1 && end < len(s) {
+		end++
+	}
+	if end == pos+1 {
+		return "", pos
+	}
+	return s[pos:end], end
+}
+
+// macroList returns the project's user-defined commands when requested
+func (s *compileSession) macroList() []MacroDefinition {
+	if !s.options.ReturnMacros {
+		return nil
+	}
+	macros := extractMacros(s.files)
+	log.Printf("[%s] Found %d macro definitions", s.compiler.RequestID, len(macros))
+	return macros
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+const macrosDocument = `\documentclass{article}
+\newcommand{\vect}[1]{\mathbf{#1}}
+\newcommand*\pair[2][0]{(#1, #2)}
+\renewcommand{\emph}[1]{\textit{#1}}
+\DeclareMathOperator{\Tr}{Tr}
+\def\inner#1#2{\langle #1, #2 \rangle}
+% \newcommand{\unused}{}
+\makeatletter
+\def\@title@sep{:}
+\makeatother
+\begin{document}
+\newcommand{\R}{\mathbb{R}}
+\end{document}`
+
+func TestExtractMacros(t *testing.T) {
+	files := []FileEntry{
+		{Path: "main.tex", Content: macrosDocument},
+		{Path: "defs.sty", Content: "\\providecommand{\\norm}[1]{\\lVert #1\\rVert}\n"},
+		{Path: "notes.txt", Content: "\\newcommand{\\ignored}{}"},
+	}
+
+	want := []MacroDefinition{
+		{Name: `\vect`, Definer: "newcommand", Arity: 1, File: "main.tex", Line: 2},
+		{Name: `\pair`, Definer: "newcommand*", Arity: 2, OptionalFirst: true, File: "main.tex", Line: 3},
+		{Name: `\emph`, Definer: "renewcommand", Arity: 1, File: "main.tex", Line: 4},
+		{Name: `\Tr`, Definer: "DeclareMathOperator", File: "main.tex", Line: 5},
+		{Name: `\inner`, Definer: "def", Arity: 2, File: "main.tex", Line: 6},
+		{Name: `\@title@sep`, Definer: "def", File: "main.tex", Line: 9},
+		{Name: `\R`, Definer: "newcommand", File: "main.tex", Line: 12},
+		{Name: `\norm`, Definer: "providecommand", Arity: 1, File: "defs.sty", Line: 1},
+	}
+	macros := extractMacros(files)
+	if len(macros) != len(want) {
+		t.Fatalf("expected %d macros, got %+v", len(want), macros)
+	}
+	for i, macro := range macros {
+		if macro != want[i] {
+			t.Fatalf("macro %d: expected %+v, got %+v", i, want[i], macro)
+		}
+	}
+}
+
+func TestCompileReturnsMacros(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+
+	files := []FileEntry{{Path: "main.tex", Content: macrosDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnMacros: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if len(result.Macros) != 7 || result.Macros[0].Name != `\vect` {
+		t.Fatalf("expected the document's 7 macros, got %+v", result.Macros)
+	}
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxPrintLine is TeX's default log line width; longer lines are wrapped.
+const maxPrintLine = 79
+
+var manifestDatePattern = regexp.MustCompile(`^\d{4}[/-]\d{2}[/-]\d{2}$`)
+var manifestVersionPattern = regexp.MustCompile(`^v?\d[\w.-]*$`)
+
+// parseFileList extracts the package manifest printed by \listfiles at the
+// end of a LaTeX log
+func parseFileList(logContent string) []PackageInfo {
+	start := strings.LastIndex(logContent, " *File List*")
+	if start == -1 {
+		return nil
+	}
+
+	var entries []PackageInfo
+	var previous string
+
+	lines := strings.Split(logContent[start:], "\n")
+	for _, raw := range lines[1:] {
+		raw = strings.TrimRight(raw, "\r")
+		line := strings.TrimSpace(raw)
+		if strings.HasPrefix(line, "***") {
+			break
+		}
+		if line == "" {
+			previous = raw
+			continue
+		}
+
+		// Lines wrapped at max_print_line continue the previous entry's info.
+		if len(previous) >= maxPrintLine && len(entries) > 0 {
+			last := &entries[len(entries)-1]
+			last.Info = strings.TrimSpace(last.Info + line)
+			previous = raw
+			continue
+		}
+
+		entries = append(entries, parseFileListLine(line))
+		previous = raw
+	}
+
+	return entries
+}
+
+func parseFileListLine(line string) PackageInfo {
+	fields := strings.Fields(line)
+	entry := PackageInfo{Name: fields[0]}
+	rest := fields[1:]
+
+	if len(rest) > 0 && manifestDatePattern.MatchString(rest[0]) {
+		entry.Date = rest[0]
+		rest = rest[1:]
+
+		if len(rest) > 0 && manifestVersionPattern.MatchString(rest[0]) {
+			entry.Version = rest[0]
+			rest = rest[1:]
+		}
+	}
+
+	entry.Info = strings.Join(rest, " ")
+	return entry
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+const listfilesLog = `Output written on main.pdf (1 page, 12345 bytes).
+ *File List*
+ article.cls    2023/05/17 v1.4n Standard LaTeX document class
+  size10.clo    2023/05/17 v1.4n Standard LaTeX file (size option)
+graphicx.sty    2021/09/16 v1.2d Enhanced LaTeX Graphics (DPC,SPQR)
+l3backend-pdftex.def    2023-04-19 L3 backend support: PDF output (pdfTeX)
+    main.tex
+ ***********
+`
+
+func TestParseFileListReadsPackagesAndVersions(t *testing.T) {
+	manifest := parseFileList(listfilesLog)
+	if len(manifest) != 5 {
+		t.Fatalf("expected 5 manifest entries, got %d: %+v", len(manifest), manifest)
+	}
+
+	graphicx := manifest[2]
+	if graphicx.Name != "graphicx.sty" || graphicx.Date != "2021/09/16" || graphicx.Version != "v1.2d" {
+		t.Fatalf("unexpected graphicx entry: %+v", graphicx)
+	}
+
+	backend := manifest[3]
+	if backend.Date != "2023-04-19" || backend.Version != "" || backend.Info != "L3 backend support: PDF output (pdfTeX)" {
+		t.Fatalf("unexpected backend entry: %+v", backend)
+	}
+
+	if manifest[4].Name != "main.tex" || manifest[4].Date != "" {
+		t.Fatalf("unexpected main.tex entry: %+v", manifest[4])
+	}
+}
+
+func TestCompileReturnsManifestWhenRequested(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(listfilesLog)})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnManifest: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if len(result.Manifest) == 0 || result.Manifest[0].Name != "article.cls" || result.Manifest[0].Version != "v1.4n" {
+		t.Fatalf("expected manifest with article.cls v1.4n, got %+v", result.Manifest)
+	}
+
+	if !containsString(readArgs(), `-pretex=\listfiles`) {
+		t.Fatalf("expected latexmk to receive -pretex=\\listfiles")
+	}
+}
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+)
+
+// maxManualPasses bounds the engine runs of a manual compile, as latexmk's
+// max_repeat does
+const maxManualPasses = 5
+
+// rerunPattern matches the log messages asking for another engine pass, e.g.
+// "LaTeX Warning: Label(s) may have changed. Rerun to get cross-references right."
+var rerunPattern = regexp.MustCompile(`Rerun to get|Please rerun LaTeX|\(rerunfilecheck\).*Rerun`)
+
+// latexmkInstalled reports whether latexmk is on PATH; minimal images may
+// ship the engines without it
+func latexmkInstalled() bool {
+	_, err := exec.LookPath("latexmk")
+	return err == nil
+}
+
+// runToolchain builds the document with latexmk, or with manually sequenced
+// engine and bibliography passes when latexmk is not installed
+func (s *compileSession) runToolchain(stage string, needsBib, needsMultiPass bool) error {
+	if latexmkInstalled() {
+		return s.runLatexmk(stage)
+	}
+	return s.runManual(stage, needsBib, needsMultiPass)
+}
+
+// runManual runs engine, bibliography, engine, ... the way latexmk -f would:
+// passes continue after engine errors, and the first error is returned once
+// the sequence ends. The engine reruns while the log asks for it.
+func (s *compileSession) runManual(stage string, needsBib, needsMultiPass bool) error {
+	log.Printf("[%s] latexmk not found; compiling manually (%s, bib=%v, multi-pass=%v)",
+		s.compiler.RequestID, stage, needsBib, needsMultiPass)
+
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	keep(s.runEngine())
+	passes := 1
+
+	if needsBib && !s.skipBibliography && s.bibTool != bibliographyToolNone {
+		keep(s.runBibliography())
+	}
+
+	if needsBib || needsMultiPass {
+		keep(s.runEngine())
+		passes++
+	}
+	for passes < maxManualPasses && s.logAsksForRerun() {
+		keep(s.runEngine())
+		passes++
+	}
+
+	if s.keepsXdv() {
+		keep(s.runXdvipdfmx())
+	}
+
+	log.Printf("[%s] Manual compile (%s) finished after %d engine passes", s.compiler.RequestID, stage, passes)
+	return firstErr
+}
+
+// runEngine runs one engine pass with the options latexmk would pass
+func (s *compileSession) runEngine() error {
+	args := []string{"-interaction=nonstopmode", "-file-line-error", "-jobname=" + s.jobName}
+	if s.requiresShellEscape {
+		args = append(args, "-shell-escape")
+	}
+	if s.options.writesSynctex() {
+		args = append(args, "-synctex=1")
+	}
+	if s.keepsXdv() {
+		args = append(args, "-no-pdf")
+	}
+
+	source := filepath.Base(s.texFilePath)
+	if preTex := s.preTexCode(); preTex != "" {
+		// What latexmk substitutes for %P
+		source = preTex + `\input{` + source + `}`
+	}
+
+	return s.runTool(s.engine.command(), append(args, source)...)
+}
+
+// runBibliography runs the detected bibliography processor on the job
+func (s *compileSession) runBibliography() error {
+	return s.runTool(s.bibTool.String(), s.jobName)
+}
+
+// runXdvipdfmx converts the .xdv of a -no-pdf xelatex run to the PDF
+func (s *compileSession) runXdvipdfmx() error {
+	return s.runTool("xdvipdfmx", "-o", s.jobName+".pdf", s.jobName+".xdv")
+}
+
+func (s *compileSession) runTool(name string, args ...string) error {
+	log.Printf("[%s] Running %s", s.compiler.RequestID, name)
+
+	cmd := s.command(name, args...)
+	cmd.Dir = filepath.Dir(s.texFilePath)
+	cmd.Env = s.toolchainEnv()
+	cmd.Stdout = &s.stdout
+	cmd.Stderr = &s.stderr
+
+	err := s.runToolchainCommand(cmd)
+	if err != nil {
+		log.Printf("[%s] %s exited with error: %v", s.compiler.RequestID, name, err)
+	}
+	return err
+}
+
+// logAsksForRerun reports whether the last engine pass's log requests another
+func (s *compileSession) logAsksForRerun() bool {
+	data, err := os.ReadFile(s.logPath)
+	if err != nil {
+		return false
+	}
+	return rerunPattern.MatchString(unwrapLogLines(string(data)))
+}
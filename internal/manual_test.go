@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeManualPdflatex uses only shell builtins, since PATH holds nothing but
+// the fake tools. After the bibliography run it asks for one more pass.
+const fakeManualPdflatex = `job=""
+for arg; do
+	case "$arg" in
+	-jobname=*) job="${arg#-jobname=}" ;;
+	esac
+done
+printf 'pdflatex\n' >> "$FAKE_TOOL_SEQUENCE"
+printf '%%PDF-1.4\n%%fake\n' > "$job.pdf"
+if [ -e "$job.bbl" ] && [ ! -e "$job.rerun" ]; then
+	: > "$job.rerun"
+	printf 'LaTeX Warning: Label(s) may have changed. Rerun to get cross-references right.\n' > "$job.log"
+else
+	printf 'This is a fake log\n' > "$job.log"
+fi
+`
+
+const fakeManualBibtex = `printf 'bibtex %s\n' "$1" >> "$FAKE_TOOL_SEQUENCE"
+: > "$1.bbl"
+`
+
+func TestCompileWithoutLatexmkRunsManualPasses(t *testing.T) {
+	dir := installFakeTools(t, map[string]string{"pdflatex": fakeManualPdflatex, "bibtex": fakeManualBibtex})
+	t.Setenv("PATH", dir) // latexmk absent
+	sequenceFile := filepath.Join(t.TempDir(), "sequence")
+	t.Setenv("FAKE_TOOL_SEQUENCE", sequenceFile)
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: strings.Replace(citingDocument, "%s", "As shown in", 1)},
+		{Path: "refs.bib", Content: refsBib},
+	}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	data, err := os.ReadFile(sequenceFile)
+	if err != nil {
+		t.Fatalf("failed to read tool sequence: %v", err)
+	}
+	want := "pdflatex\nbibtex main\npdflatex\npdflatex"
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Fatalf("expected passes %q, got %q", want, got)
+	}
+}
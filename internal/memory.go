@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// memoryNearLimitPercent is the usage above which a TeX memory pool is
+// reported as close to overflowing
+const memoryNearLimitPercent = 90.0
+
+// texMemoryParams maps the descriptions in TeX's end-of-run memory report to
+// the texmf.cnf parameters that size them
+var texMemoryParams = map[string]string{
+	"strings":                       "max_strings",
+	"string characters":             "pool_size",
+	"words of memory":               "main_memory",
+	"multiletter control sequences": "hash_size",
+	"words of font info":            "font_mem_size",
+	"fonts":                         "font_max",
+	"hyphenation exceptions":        "hyph_size",
+	"i":                             "stack_size",
+	"n":                             "nest_size",
+	"p":                             "param_size",
+	"b":                             "buf_size",
+	"s":                             "save_size",
+}
+
+var (
+	memoryBlockPattern = regexp.MustCompile(`Here is how much of \S+ memory you used:`)
+	memoryStatPattern  = regexp.MustCompile(`^(\d+) (.+?) out of ([\d+]+)$`)
+	memoryFontPattern  = regexp.MustCompile(`^(\d+) words of font info for (\d+) fonts?, out of (\d+) for (\d+)$`)
+	memoryStackPattern = regexp.MustCompile(`^(\S+) stack positions out of (\S+)$`)
+	memoryStackEntry   = regexp.MustCompile(`^(\d+)([a-z])$`)
+)
+
+// parseMemoryUsage reads the "Here is how much of TeX's memory you used"
+// block from a log. It returns nil when the log has no such block.
+func parseMemoryUsage(logContent string) *MemoryUsage {
+	loc := memoryBlockPattern.FindStringIndex(logContent)
+	if loc == nil {
+		return nil
+	}
+
+	usage := &MemoryUsage{}
+	for _, line := range strings.Split(logContent[loc[1]:], "\n")[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		if m := memoryFontPattern.FindStringSubmatch(line); m != nil {
+			usage.add("words of font info", m[1], m[3])
+			usage.add("fonts", m[2], m[4])
+			continue
+		}
+
+		if m := memoryStackPattern.FindStringSubmatch(line); m != nil {
+			used := strings.Split(m[1], ",")
+			limits := strings.Split(m[2], ",")
+			for i := 0; i < len(used) && i < len(limits); i++ {
+				u := memoryStackEntry.FindStringSubmatch(used[i])
+				l := memoryStackEntry.FindStringSubmatch(limits[i])
+				if u == nil || l == nil || u[2] != l[2] {
+					continue
+				}
+				usage.add(u[2], u[1], l[1])
+			}
+			continue
+		}
+
+		if m := memoryStatPattern.FindStringSubmatch(line); m != nil {
+			usage.add(m[2], m[1], m[3])
+		}
+	}
+
+	if len(usage.Stats) == 0 {
+		return nil
+	}
+	return usage
+}
+
+// add records one pool; limit may be a sum such as "15000+600000"
+func (u *MemoryUsage) add(description, used, limit string) {
+	name, ok := texMemoryParams[description]
+	if !ok {
+		name = description
+	}
+
+	stat := MemoryStat{Name: name}
+	stat.Used, _ = strconv.ParseInt(used, 10, 64)
+	for _, part := range strings.Split(limit, "+") {
+		n, _ := strconv.ParseInt(part, 10, 64)
+		stat.Limit += n
+	}
+
+	if stat.Limit > 0 {
+		stat.Percent = math.Round(float64(stat.Used)*1000/float64(stat.Limit)) / 10
+		if stat.Percent >= memoryNearLimitPercent {
+			stat.NearLimit = true
+			u.Warnings = append(u.Warnings, fmt.Sprintf("%s is at %.0f%% of its limit (%d of %d)", name, stat.Percent, stat.Used, stat.Limit))
+		}
+	}
+
+	u.Stats = append(u.Stats, stat)
+}
+
+// texMemoryOverrides are NAME=value settings passed to the toolchain's
+// environment, which kpathsea reads in preference to texmf.cnf
+var texMemoryOverrides []string
+
+// overridableMemoryParams are the texmf.cnf sizes that may be overridden
+var overridableMemoryParams = map[string]bool{
+	"main_memory":      true,
+	"extra_mem_top":    true,
+	"extra_mem_bot":    true,
+	"font_mem_size":    true,
+	"font_max":         true,
+	"pool_size":        true,
+	"string_vacancies": true,
+	"max_strings":      true,
+	"pool_free":        true,
+	"strings_free":     true,
+	"hash_extra":       true,
+	"buf_size":         true,
+	"stack_size":       true,
+	"nest_size":        true,
+	"param_size":       true,
+	"save_size":        true,
+	"max_in_open":      true,
+	"expand_depth":     true,
+}
+
+// SetTeXMemoryOverrides sets texmf.cnf memory parameters (NAME=value) for
+// every compile, e.g. "extra_mem_top=10000000"
+func SetTeXMemoryOverrides(entries []string) error {
+	var overrides []string
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || !overridableMemoryParams[name] {
+			return fmt.Errorf("invalid TeX memory parameter %q", entry)
+		}
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			return fmt.Errorf("invalid value for TeX memory parameter %s: %q", name, value)
+		}
+		overrides = append(overrides, name+"="+value)
+	}
+	texMemoryOverrides = overrides
+	return nil
+}
+
+// toolchainEnv returns the environment for TeX tool processes with the memory
+// overrides and extra variables applied, or nil to inherit the server's
+// environment unchanged
+func toolchainEnv(extra ...string) []string {
+	if len(texMemoryOverrides) == 0 && len(extra) == 0 {
+		return nil
+	}
+	env := append(os.Environ(), texMemoryOverrides...)
+	return append(env, extra...)
+}
+
+// capacityExceededPattern matches TeX's fatal overflow error, e.g.
+// "! TeX capacity exceeded, sorry [main memory size=5000000]."
+var capacityExceededPattern = regexp.MustCompile(`! TeX capacity exceeded, sorry \[([^=\]]+)=(\d+)\]`)
+
+// capacityParams maps the overflow message's pool names to the parameter to
+// raise
+var capacityParams = map[string]string{
+	"main memory size":     "extra_mem_top",
+	"pool size":            "pool_size",
+	"number of strings":    "max_strings",
+	"hash size":            "hash_extra",
+	"font memory":          "font_mem_size",
+	"buffer size":          "buf_size",
+	"input stack size":     "stack_size",
+	"semantic nest size":   "nest_size",
+	"parameter stack size": "param_size",
+	"save size":            "save_size",
+	"text input levels":    "max_in_open",
+	"expansion depth":      "expand_depth",
+}
+
+// detectMemoryOverflow returns an ErrMemoryOverflow describing the exhausted
+// pool when the log ends in a capacity error, or nil
+func detectMemoryOverflow(logContent string) error {
+	m := capacityExceededPattern.FindStringSubmatch(logContent)
+	if m == nil {
+		return nil
+	}
+
+	pool, size := m[1], m[2]
+	param, ok := capacityParams[pool]
+	if !ok {
+		return fmt.Errorf("%w: %s=%s is a fixed limit, often hit by runaway recursion", ErrMemoryOverflow, pool, size)
+	}
+	return fmt.Errorf("%w: %s=%s; raise %s in TEX_MEMORY_PARAMS, or check the document for runaway recursion", ErrMemoryOverflow, pool, size, param)
+}
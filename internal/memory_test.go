@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const memoryLog = `Output written on main.pdf (1 page, 12345 bytes).
+ ) 
+Here is how much of TeX's memory you used:
+ 2685 strings out of 476025
+ 41512 string characters out of 5796467
+ 4900000 words of memory out of 5000000
+ 22860 multiletter control sequences out of 15000+600000
+ 558832 words of font info for 37 fonts, out of 8000000 for 9000
+ 1141 hyphenation exceptions out of 8191
+ 75i,5n,79p,218b,190s stack positions out of 10000i,1000n,20000p,200000b,200000s
+
+PDF statistics:
+ 20 PDF objects out of 1000 (max. 8388607)
+`
+
+func TestParseMemoryUsage(t *testing.T) {
+	usage := parseMemoryUsage(memoryLog)
+	if usage == nil {
+		t.Fatalf("expected memory usage to be parsed")
+	}
+
+	stats := map[string]MemoryStat{}
+	for _, stat := range usage.Stats {
+		stats[stat.Name] = stat
+	}
+	if len(stats) != 12 {
+		t.Fatalf("expected 12 memory stats, got %d: %+v", len(stats), usage.Stats)
+	}
+
+	if pool := stats["pool_size"]; pool.Used != 41512 || pool.Limit != 5796467 || pool.NearLimit {
+		t.Fatalf("unexpected pool_size: %+v", pool)
+	}
+	if hash := stats["hash_size"]; hash.Used != 22860 || hash.Limit != 615000 {
+		t.Fatalf("unexpected hash_size: %+v", hash)
+	}
+	if fonts := stats["font_max"]; fonts.Used != 37 || fonts.Limit != 9000 {
+		t.Fatalf("unexpected font_max: %+v", fonts)
+	}
+	if buf := stats["buf_size"]; buf.Used != 218 || buf.Limit != 200000 {
+		t.Fatalf("unexpected buf_size: %+v", buf)
+	}
+
+	main := stats["main_memory"]
+	if !main.NearLimit || main.Percent != 98 {
+		t.Fatalf("expected main_memory to be near its limit, got %+v", main)
+	}
+	if len(usage.Warnings) != 1 {
+		t.Fatalf("expected one near-limit warning, got %q", usage.Warnings)
+	}
+}
+
+func TestParseMemoryUsageWithoutBlock(t *testing.T) {
+	if usage := parseMemoryUsage("Output written on main.pdf (1 page)."); usage != nil {
+		t.Fatalf("expected nil usage, got %+v", usage)
+	}
+}
+
+func TestCompileReturnsMemoryUsageWhenRequested(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(memoryLog)})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnMemoryUsage: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if result.Memory == nil || len(result.Memory.Stats) == 0 {
+		t.Fatalf("expected memory usage in the result")
+	}
+
+	result = New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Memory != nil {
+		t.Fatalf("did not expect memory usage unless requested")
+	}
+}
+
+const overflowLog = `! TeX capacity exceeded, sorry [main memory size=5000000].
+\foo ->\foo 
+           \foo 
+l.5 \foo
+         
+If you really absolutely need more capacity,
+you can ask a wizard to enlarge me.
+`
+
+func TestDetectMemoryOverflow(t *testing.T) {
+	err := detectMemoryOverflow(overflowLog)
+	if !errors.Is(err, ErrMemoryOverflow) {
+		t.Fatalf("expected ErrMemoryOverflow, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "main memory size=5000000") || !strings.Contains(err.Error(), "extra_mem_top") {
+		t.Fatalf("expected pool and advice in %q", err.Error())
+	}
+
+	if err := detectMemoryOverflow("! Undefined control sequence."); err != nil {
+		t.Fatalf("did not expect an overflow, got %v", err)
+	}
+}
+
+func TestCompileReportsMemoryOverflow(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": `cat > main.log <<'FAKELOG'
+` + overflowLog + `FAKELOG
+exit 12
+`})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success || result.ErrorCode != "MEMORY_OVERFLOW" {
+		t.Fatalf("expected MEMORY_OVERFLOW, got success=%v code=%q message=%q", result.Success, result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestCompileReportsMemoryOverflowWithPartialPDF(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": `printf '%%PDF-1.4\n%%partial\n' > main.pdf
+cat > main.log <<'FAKELOG'
+` + overflowLog + `FAKELOG
+exit 12
+`})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success || result.ErrorCode != "MEMORY_OVERFLOW" {
+		t.Fatalf("expected MEMORY_OVERFLOW, got success=%v code=%q message=%q", result.Success, result.ErrorCode, result.ErrorMessage)
+	}
+	if len(result.PDFData) == 0 {
+		t.Fatalf("expected the partial PDF to be kept")
+	}
+}
+
+func TestSetTeXMemoryOverrides(t *testing.T) {
+	t.Cleanup(func() { _ = SetTeXMemoryOverrides(nil) })
+
+	if err := SetTeXMemoryOverrides([]string{"extra_mem_top=10000000", "pool_size=8000000"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	env := toolchainEnv()
+	if !containsString(env, "extra_mem_top=10000000") || !containsString(env, "pool_size=8000000") {
+		t.Fatalf("expected overrides in the toolchain environment")
+	}
+
+	for _, invalid := range []string{"PATH=/tmp", "main_memory=lots", "pool_size=-1", "extra_mem_top"} {
+		if err := SetTeXMemoryOverrides([]string{invalid}); err == nil {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+
+	_ = SetTeXMemoryOverrides(nil)
+	if toolchainEnv() != nil {
+		t.Fatalf("expected the inherited environment without overrides")
+	}
+}
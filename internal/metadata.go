@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	authorSeparatorPattern = regexp.MustCompile(`\\(?:and|AND)\b`)
+	abstractEnvPattern     = regexp.MustCompile(`(?s)\\begin\{abstract\}(.*?)\\end\{abstract\}`)
+)
+
+// extractMetadata parses \title, \author, \date and the abstract from the
+// project's sources, looking at the main file first. Values are best-effort
+// plain text.
+func extractMetadata(files []FileEntry) MetadataExtractResponse {
+	var meta MetadataExtractResponse
+
+	for _, file := range mainFileFirst(files) {
+		content := stripTeXComments(file.Content)
+
+		if meta.Title == "" {
+			if args := commandArguments(content, "title"); len(args) > 0 {
+				meta.Title = latexToText(args[0])
+			}
+		}
+
+		if len(meta.Authors) == 0 {
+			// Some classes take one \author per person, others join them with \and
+			for _, arg := range commandArguments(content, "author") {
+				for _, author := range authorSeparatorPattern.Split(arg, -1) {
+					if text := latexToText(author); text != "" {
+						meta.Authors = append(meta.Authors, text)
+					}
+				}
+			}
+		}
+
+		if meta.Date == "" {
+			if args := commandArguments(content, "date"); len(args) > 0 {
+				meta.Date = latexToText(args[0])
+			}
+		}
+
+		if meta.Abstract == "" {
+			if m := abstractEnvPattern.FindStringSubmatch(content); m != nil {
+				meta.Abstract = latexToText(m[1])
+			} else if args := commandArguments(content, "abstract"); len(args) > 0 {
+				meta.Abstract = latexToText(args[0])
+			}
+		}
+	}
+
+	return meta
+}
+
+// mainFileFirst orders files so that the detected main file comes first
+func mainFileFirst(files []FileEntry) []FileEntry {
+	main, _, found := findMainFile(files)
+	if !found {
+		return files
+	}
+
+	ordered := []FileEntry{main}
+	for _, file := range files {
+		if file.Path != main.Path {
+			ordered = append(ordered, file)
+		}
+	}
+	return ordered
+}
+
+// commandArguments returns the mandatory argument of every \name{...} in
+// content, skipping an optional [...] argument (\title[short]{Long})
+func commandArguments(content, name string) []string {
+	var args []string
+	prefix := `\` + name
+
+	for pos := 0; ; {
+		i := strings.Index(content[pos:], prefix)
+		if i == -1 {
+			return args
+		}
+		start := pos + i
+		cmd, end := readCommandName(content, start)
+		pos = end
+		if cmd != name {
+			continue // a longer command such as \titlepage
+		}
+
+		end = skipSpaces(content, end)
+		if end < len(content) && content[end] == '[' {
+			_, end = readDelimited(content, end, '[', ']')
+			end = skipSpaces(content, end)
+		}
+		if end < len(content) && content[end] == '{' {
+			var arg string
+			arg, pos = readDelimited(content, end, '{', '}')
+			args = append(args, arg)
+		}
+	}
+}
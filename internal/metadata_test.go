@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestExtractMetadata(t *testing.T) {
+	content := `\documentclass{article}
+% \title{Commented out}
+\title[Short]{On the \emph{Efficiency} of\\ Incremental \LaTeX{} Builds}
+\author{Ada Lovelace\thanks{Analytical Engines Ltd.} \and Alan Turing \\ University of Manchester}
+\date{March 2024}
+\begin{document}
+\maketitle
+\begin{titlepage}\end{titlepage}
+\begin{abstract}
+We show that caching auxiliary files cuts compile time by 40\%.
+\end{abstract}
+\end{document}`
+
+	meta := extractMetadata([]FileEntry{{Path: "main.tex", Content: content}})
+
+	if meta.Title != "On the Efficiency of Incremental LaTeX Builds" {
+		t.Fatalf("unexpected title: %q", meta.Title)
+	}
+	if want := []string{"Ada Lovelace", "Alan Turing University of Manchester"}; !reflect.DeepEqual(meta.Authors, want) {
+		t.Fatalf("expected authors %q, got %q", want, meta.Authors)
+	}
+	if meta.Date != "March 2024" {
+		t.Fatalf("unexpected date: %q", meta.Date)
+	}
+	if meta.Abstract != "We show that caching auxiliary files cuts compile time by 40%." {
+		t.Fatalf("unexpected abstract: %q", meta.Abstract)
+	}
+}
+
+func TestMetadataExtractHandlerPrefersMainFile(t *testing.T) {
+	recorder := performJSON(t, http.MethodPost, "/metadata/extract", MetadataExtractHandler, SourceRequest{
+		Files: []FileEntry{
+			{Path: "appendix.tex", Content: `\section{Appendix}\title{Not the paper}`},
+			{Path: "paper.tex", Content: "\\documentclass{amsart}\n\\title{The Paper}\n\\author{A. Author}\n\\author{B. Author}\n"},
+		},
+	})
+	assertStatus(t, recorder, http.StatusOK)
+
+	var meta MetadataExtractResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &meta); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if meta.Title != "The Paper" || !reflect.DeepEqual(meta.Authors, []string{"A. Author", "B. Author"}) {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+}
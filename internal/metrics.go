@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus collectors for compiles, labeled by engine. They count from
+// process start whether or not a registry exports them.
+var (
+	compilesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "latex_compiles_total",
+		Help: "Compiles finished, by engine and outcome (success or failure).",
+	}, []string{"engine", "outcome"})
+	compileCacheHitsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "latex_compile_cache_hits_total",
+		Help: "Compiles answered with the project's cached PDF, by engine.",
+	}, []string{"engine"})
+	compileQueueWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "latex_compile_queue_wait_seconds",
+		Help:    "Time compiles waited in the queue before a worker took them, by engine.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"engine"})
+	compileDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "latex_compile_duration_seconds",
+		Help:    "Time from a worker taking a compile to its result, by engine.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"engine"})
+	compilesCoalescedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "latex_compiles_coalesced_total",
+		Help: "Project compiles dropped unrun because a newer request for the same project superseded them.",
+	})
+	compilesSharedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "latex_compiles_shared_total",
+		Help: "Requests answered with an identical in-flight compile of their project instead of compiling.",
+	})
+)
+
+// RegisterMetrics adds the compile collectors to reg
+func RegisterMetrics(reg prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{
+		compilesTotal, compileCacheHitsTotal, compileQueueWaitSeconds, compileDurationSeconds, compilesCoalescedTotal,
+		compilesSharedTotal,
+	} {
+		if err := reg.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetricsHandler serves the metrics of gatherer in the Prometheus text format
+func MetricsHandler(gatherer prometheus.Gatherer) gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+}
+
+// recordMetrics counts a finished compile
+func (s *compileSession) recordMetrics(result *CompileResult) {
+	if result == nil {
+		return
+	}
+
+	engine := s.engine.command()
+	outcome := "success"
+	if !result.Success {
+		outcome = "failure"
+	}
+	compilesTotal.WithLabelValues(engine, outcome).Inc()
+	if result.CacheHit {
+		compileCacheHitsTotal.WithLabelValues(engine).Inc()
+	}
+	compileQueueWaitSeconds.WithLabelValues(engine).Observe(float64(result.QueueMs) / 1000)
+	compileDurationSeconds.WithLabelValues(engine).Observe(float64(result.DurationMs) / 1000)
+	// Cache hits and early failures take no worker time worth estimating with
+	if s.compiled {
+		compileDurations.record(result.DurationMs)
+	}
+}
+
+// defaultCompileMs is the assumed compile duration until one has finished
+const defaultCompileMs = 2000
+
+// compileDurationAlpha weights the newest compile in the moving average of
+// compile durations
+const compileDurationAlpha = 0.2
+
+// durationAverage keeps a moving average of how long a compile holds a worker
+type durationAverage struct {
+	mu    sync.Mutex
+	avgMs float64
+}
+
+var compileDurations = &durationAverage{}
+
+func (a *durationAverage) record(ms int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.avgMs == 0 {
+		a.avgMs = float64(ms)
+	} else {
+		a.avgMs += compileDurationAlpha * (float64(ms) - a.avgMs)
+	}
+}
+
+func (a *durationAverage) average() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.avgMs > 0 {
+		return a.avgMs
+	}
+	return defaultCompileMs
+}
+
+// estimatedWaitMs estimates how long a job waits behind jobsAhead queued jobs:
+// the workers take them in parallel at the average compile duration
+func estimatedWaitMs(jobsAhead int) int64 {
+	return int64(float64(jobsAhead) / float64(workerCount) * compileDurations.average())
+}
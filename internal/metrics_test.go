@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsHandlerExportsCompileMetrics(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	projectID := "metrics-test"
+	forgetProject(t, projectID)
+
+	registry := prometheus.NewRegistry()
+	if err := RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics: %v", err)
+	}
+
+	// A build, then a cache hit for the unchanged sources
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	for i := 0; i < 2; i++ {
+		if result := New().Compile(files, time.Now(), projectID, CompileOptions{}); !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/metrics", MetricsHandler(registry))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assertStatus(t, recorder, http.StatusOK)
+
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`latex_compiles_total{engine="pdflatex",outcome="success"}`,
+		`latex_compile_cache_hits_total{engine="pdflatex"}`,
+		`latex_compile_queue_wait_seconds_count{engine="pdflatex"}`,
+		`latex_compile_duration_seconds_bucket{engine="pdflatex",le="0.1"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %s in the metrics, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestCacheHitsDoNotLowerCompileDurationAverage(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": "sleep 0.3\n" + fakeLatexmkScript})
+	projectID := "duration-average-test"
+	forgetProject(t, projectID)
+
+	saved := compileDurations.avgMs
+	compileDurations.avgMs = 0
+	t.Cleanup(func() { compileDurations.avgMs = saved })
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	for i := 0; i < 3; i++ {
+		if result := New().Compile(files, time.Now(), projectID, CompileOptions{}); !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+	}
+	// Only the first compile ran the toolchain
+	if avg := compileDurations.average(); avg < 300 {
+		t.Fatalf("expected cache hits to leave the average at the build's duration, got %.0fms", avg)
+	}
+}
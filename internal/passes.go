@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+)
+
+// ruleRunPattern matches latexmk's announcement of each rule it runs, e.g.
+// "Run number 2 of rule 'pdflatex'"
+var ruleRunPattern = regexp.MustCompile(`Run number \d+ of rule '([^']+)'`)
+
+// runPass runs one toolchain invocation of the compile and records its exit
+// code. When the request asked for per-pass logs, it also keeps what the
+// invocation printed, the rules latexmk ran during it, and, for engine
+// invocations, the log it left behind (each engine run overwrites the
+// previous one's).
+func (s *compileSession) runPass(stage string, engine bool, run func() error) {
+	stdoutStart, stderrStart := s.stdout.Len(), s.stderr.Len()
+
+	err := run()
+	s.recordExitCode(err)
+
+	if !s.options.ReturnPassLogs {
+		return
+	}
+
+	output := s.stdout.String()[stdoutStart:] + s.stderr.String()[stderrStart:]
+	pass := PassLog{
+		Stage:    stage,
+		ExitCode: exitCodeOf(err),
+		Output:   tailLines(truncateText(output, MaxLogChars), LogTailLines),
+	}
+	for _, m := range ruleRunPattern.FindAllStringSubmatch(output, -1) {
+		pass.Rules = append(pass.Rules, m[1])
+	}
+	if engine {
+		if data, err := os.ReadFile(s.logPath); err == nil {
+			pass.LogTail = tailLines(string(data), LogTailLines)
+		}
+	}
+	s.passes = append(s.passes, pass)
+}
+
+// exitCodeOf returns the exit code of a finished toolchain process: 0 on
+// success, -1 when it could not be run
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitError, ok := err.(*exec.ExitError); ok {
+		return exitError.ExitCode()
+	}
+	return -1
+}
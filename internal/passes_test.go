@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLatexmkCountingRuns numbers its runs in the output and the log so that
+// each pass can be told apart.
+var fakeLatexmkCountingRuns = `run=$(( $(cat .runs 2>/dev/null || echo 0) + 1 ))
+echo "$run" > .runs
+echo "latexmk run $run"
+echo "Run number 1 of rule 'pdflatex'" >&2
+[ "$run" = 1 ] && echo "Run number 1 of rule 'bibtex main'" >&2 && echo "Run number 2 of rule 'pdflatex'" >&2
+` + fakeLatexmkWithLog("Engine log of run RUN\n") + `sed -i "s/RUN/$run/" "$job.log"
+`
+
+func TestCompileReturnsPerPassLogs(t *testing.T) {
+	installFakeTools(t, map[string]string{
+		"latexmk":   fakeLatexmkCountingRuns,
+		"pythontex": "echo 'pythontex: 1 session'\n",
+	})
+
+	document := "\\documentclass{article}\n\\usepackage{pythontex}\n\\begin{document}\n\\py{1+1} \\cite{knuth1984}\n\\bibliography{refs}\n\\end{document}"
+	files := []FileEntry{
+		{Path: "main.tex", Content: document},
+		{Path: "refs.bib", Content: refsBib},
+	}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnPassLogs: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	want := []PassLog{
+		{Stage: "initial", Rules: []string{"pdflatex", "bibtex main", "pdflatex"}, LogTail: "Engine log of run 1"},
+		{Stage: "pythontex", Output: "pythontex: 1 session"},
+		{Stage: "post-pythontex", Rules: []string{"pdflatex"}, LogTail: "Engine log of run 2"},
+	}
+	if len(result.Passes) != len(want) {
+		t.Fatalf("expected %d passes, got %+v", len(want), result.Passes)
+	}
+	for i, pass := range result.Passes {
+		if pass.Stage != "pythontex" && !strings.Contains(pass.Output, fmt.Sprintf("latexmk run %d", i/2+1)) {
+			t.Fatalf("pass %d: expected its own latexmk output, got %q", i, pass.Output)
+		}
+		pass.Output = strings.TrimSpace(pass.Output)
+		if pass.Stage != "pythontex" {
+			pass.Output = ""
+		}
+		pass.LogTail = strings.TrimSpace(pass.LogTail)
+		if !reflect.DeepEqual(pass, want[i]) {
+			t.Fatalf("pass %d: expected %+v, got %+v", i, want[i], pass)
+		}
+	}
+}
+
+func TestCompileRecordsFailingPass(t *testing.T) {
+	installFakeTools(t, map[string]string{
+		"latexmk":   fakeLatexmkScript,
+		"pythontex": "echo 'Traceback: boom' >&2\nexit 3\n",
+	})
+
+	document := "\\documentclass{article}\n\\usepackage{pythontex}\n\\begin{document}\n\\py{1/0}\n\\end{document}"
+	result := New().Compile([]FileEntry{{Path: "main.tex", Content: document}}, time.Now(), "", CompileOptions{ReturnPassLogs: true})
+	if result.Success {
+		t.Fatalf("expected the failing pythontex pass to fail the compile")
+	}
+	if len(result.Passes) != 2 || result.Passes[1].Stage != "pythontex" || result.Passes[1].ExitCode != 3 || !strings.Contains(result.Passes[1].Output, "Traceback: boom") {
+		t.Fatalf("expected the pythontex pass to be reported as failed, got %+v", result.Passes)
+	}
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Permissions for files and directories written into compile workspaces.
+// Temp directories keep os.MkdirTemp's 0700 unless DIR_MODE is set.
+var (
+	fileMode    os.FileMode = 0644
+	dirMode     os.FileMode = 0755
+	fileModeSet bool
+	dirModeSet  bool
+)
+
+// SetFileModes sets the octal modes (e.g. "0640", "0750") for workspace files
+// and directories; empty strings keep the defaults. The owner must keep read
+// and write access to files and full access to directories so the toolchain
+// can work in them.
+func SetFileModes(file, dir string) error {
+	if file != "" {
+		mode, err := parseMode(file, 0600)
+		if err != nil {
+			return fmt.Errorf("invalid FILE_MODE: %w", err)
+		}
+		fileMode, fileModeSet = mode, true
+	}
+
+	if dir != "" {
+		mode, err := parseMode(dir, 0700)
+		if err != nil {
+			return fmt.Errorf("invalid DIR_MODE: %w", err)
+		}
+		dirMode, dirModeSet = mode, true
+	}
+
+	return nil
+}
+
+// parseMode parses an octal permission mode that must grant at least required
+func parseMode(value string, required os.FileMode) (os.FileMode, error) {
+	n, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("%q is not an octal permission mode", value)
+	}
+
+	mode := os.FileMode(n)
+	if mode&required != required {
+		return 0, fmt.Errorf("%q must grant the owner at least %04o", value, required)
+	}
+	return mode, nil
+}
+
+// applyTempDirMode sets the configured mode on a new compile temp directory
+func applyTempDirMode(dir string) error {
+	if !dirModeSet {
+		return nil
+	}
+	return os.Chmod(dir, dirMode)
+}
+
+// makeWorkspaceDir creates dir and any missing parents below root. MkdirAll's
+// mode is masked by the umask, so with DIR_MODE set each directory it
+// creates is given the mode explicitly.
+func makeWorkspaceDir(root, dir string) error {
+	if !dirModeSet {
+		return os.MkdirAll(dir, dirMode)
+	}
+
+	// Collect the missing directories, innermost first
+	var missing []string
+	root = filepath.Clean(root)
+	for d := filepath.Clean(dir); d != root && d != filepath.Dir(d); d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+	}
+
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Chmod(d, dirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
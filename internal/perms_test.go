@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWrittenFilesUseConfiguredModes(t *testing.T) {
+	if err := SetFileModes("0640", "0750"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		fileMode, dirMode = 0644, 0755
+		fileModeSet, dirModeSet = false, false
+	})
+
+	tempDir := t.TempDir()
+	files := []FileEntry{
+		{Path: "main.tex", Content: simpleDocument},
+		{Path: "chapters/intro.tex", Content: "Intro"},
+		{Path: "figures/dot.png", Content: "iVBORw0KGgo=", Encoding: "base64"},
+	}
+	if err := createFileStructure(tempDir, files); err != nil {
+		t.Fatalf("failed to write files: %v", err)
+	}
+
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(tempDir, file.Path))
+		if err != nil {
+			t.Fatalf("missing %s: %v", file.Path, err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Fatalf("expected %s to have mode 0640, got %04o", file.Path, info.Mode().Perm())
+		}
+	}
+
+	if err := applyTempDirMode(tempDir); err != nil {
+		t.Fatalf("failed to set temp dir mode: %v", err)
+	}
+	if info, _ := os.Stat(tempDir); info.Mode().Perm() != 0750 {
+		t.Fatalf("expected temp dir mode 0750, got %04o", info.Mode().Perm())
+	}
+}
+
+func TestNestedDirectoriesUseConfiguredMode(t *testing.T) {
+	if err := SetFileModes("", "0770"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The group write bit would be masked off by MkdirAll
+	previous := syscall.Umask(022)
+	t.Cleanup(func() {
+		syscall.Umask(previous)
+		dirMode, dirModeSet = 0755, false
+	})
+
+	tempDir := t.TempDir()
+	if err := createFileStructure(tempDir, []FileEntry{{Path: "parts/one/intro.tex", Content: "Intro"}}); err != nil {
+		t.Fatalf("failed to write files: %v", err)
+	}
+
+	for _, dir := range []string{"parts", "parts/one"} {
+		info, err := os.Stat(filepath.Join(tempDir, dir))
+		if err != nil {
+			t.Fatalf("missing %s: %v", dir, err)
+		}
+		if info.Mode().Perm() != 0770 {
+			t.Fatalf("expected %s to have mode 0770, got %04o", dir, info.Mode().Perm())
+		}
+	}
+}
+
+func TestSetFileModesRejectsInsaneModes(t *testing.T) {
+	for _, modes := range [][2]string{{"644x", ""}, {"01644", ""}, {"0400", ""}, {"", "0600"}, {"", "999"}} {
+		if err := SetFileModes(modes[0], modes[1]); err == nil {
+			t.Fatalf("expected FILE_MODE=%q DIR_MODE=%q to be rejected", modes[0], modes[1])
+		}
+	}
+	if fileModeSet || dirModeSet {
+		t.Fatalf("rejected modes must not be applied")
+	}
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// Compile stages reported to progress listeners, in pipeline order
+const (
+	StageQueued    = "queued"
+	StageWorkspace = "workspace"
+	StageLatexmk   = "latexmk"
+	StagePythonTex = "pythontex"
+	StageFinalPass = "final-pass"
+	StageDone      = "done"
+)
+
+// defaultStageMs are typical stage durations, used as progress weights until
+// this server has measured its own
+var defaultStageMs = map[string]float64{
+	StageWorkspace: 150,
+	StageLatexmk:   1350,
+	StagePythonTex: 400,
+	StageFinalPass: 900,
+}
+
+// stageHistoryAlpha weights the newest sample in the moving average of stage
+// durations
+const stageHistoryAlpha = 0.2
+
+// stageHistory keeps a moving average of how long each stage takes
+type stageHistory struct {
+	mu    sync.Mutex
+	avgMs map[string]float64
+}
+
+var stageDurations = &stageHistory{avgMs: make(map[string]float64)}
+
+func (h *stageHistory) weight(stage string) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if avg, ok := h.avgMs[stage]; ok && avg > 0 {
+		return avg
+	}
+	return defaultStageMs[stage]
+}
+
+func (h *stageHistory) record(stage string, d time.Duration) {
+	if _, known := defaultStageMs[stage]; !known {
+		return
+	}
+	ms := float64(d) / float64(time.Millisecond)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if avg, ok := h.avgMs[stage]; ok {
+		h.avgMs[stage] = avg + stageHistoryAlpha*(ms-avg)
+	} else {
+		h.avgMs[stage] = ms
+	}
+}
+
+// progressTracker turns stage transitions into a coarse, never-decreasing
+// completion percentage
+type progressTracker struct {
+	requestID string
+	report    func(ProgressEvent)
+	planned   []string
+	stage     string
+	enteredAt time.Time
+	percent   int
+}
+
+func newProgressTracker(requestID string, report func(ProgressEvent)) *progressTracker {
+	return &progressTracker{
+		requestID: requestID,
+		report:    report,
+		planned:   []string{StageWorkspace, StageLatexmk},
+	}
+}
+
+// plan sets the stages this compile will run, which determines their share
+// of the progress bar
+func (p *progressTracker) plan(stages ...string) {
+	p.planned = stages
+}
+
+// enter records the end of the current stage and reports the start of stage
+func (p *progressTracker) enter(stage string) {
+	now := time.Now()
+	if p.stage != "" {
+		stageDurations.record(p.stage, now.Sub(p.enteredAt))
+	}
+	p.stage = stage
+	p.enteredAt = now
+
+	if percent := p.percentAt(stage); percent > p.percent {
+		p.percent = percent
+	}
+	if p.report != nil {
+		p.report(ProgressEvent{RequestID: p.requestID, Stage: stage, Percent: p.percent})
+	}
+}
+
+// percentAt is the share of the planned work finished before stage starts
+func (p *progressTracker) percentAt(stage string) int {
+	if stage == StageDone {
+		return 100
+	}
+
+	var before, total float64
+	reached := false
+	for _, planned := range p.planned {
+		if planned == stage {
+			reached = true
+		}
+		weight := stageDurations.weight(planned)
+		if !reached {
+			before += weight
+		}
+		total += weight
+	}
+	if !reached || total == 0 {
+		return p.percent
+	}
+
+	// Only "done" reports 100
+	return min(int(100*before/total), 99)
+}
+
+// ProgressRetention is how long the last progress of a finished async compile
+// stays queryable
+const ProgressRetention = 10 * time.Minute
+
+// progressRegistry holds the latest progress of async compiles by request ID
+type progressRegistry struct {
+	mu     sync.RWMutex
+	events map[string]ProgressEvent
+}
+
+var asyncProgress = &progressRegistry{events: make(map[string]ProgressEvent)}
+
+func (r *progressRegistry) update(event ProgressEvent) {
+	r.mu.Lock()
+	r.events[event.RequestID] = event
+	r.mu.Unlock()
+}
+
+// expire forgets an async compile's progress ProgressRetention after its
+// result was sent, however the job ended
+func (r *progressRegistry) expire(requestID string) {
+	time.AfterFunc(ProgressRetention, func() { r.remove(requestID) })
+}
+
+func (r *progressRegistry) remove(requestID string) {
+	r.mu.Lock()
+	delete(r.events, requestID)
+	r.mu.Unlock()
+}
+
+func (r *progressRegistry) get(requestID string) (ProgressEvent, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	event, ok := r.events[requestID]
+	return event, ok
+}
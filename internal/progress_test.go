@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// performProgress queries the async progress endpoint for requestID.
+func performProgress(t *testing.T, requestID string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/compile/:requestId/progress", CompileProgressHandler)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/compile/"+requestID+"/progress", nil))
+	return recorder
+}
+
+func TestCompileProgressIsMonotonic(t *testing.T) {
+	installFakeTools(t, map[string]string{
+		"latexmk":   fakeLatexmkScript,
+		"pythontex": "exit 0\n",
+	})
+
+	var events []ProgressEvent
+	document := "\\documentclass{article}\n\\usepackage{pythontex}\n\\begin{document}\n\\py{1+1}\n\\end{document}"
+	result := New().Compile([]FileEntry{{Path: "main.tex", Content: document}}, time.Now(), "", CompileOptions{
+		Progress: func(event ProgressEvent) { events = append(events, event) },
+	})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	wantStages := []string{StageWorkspace, StageLatexmk, StagePythonTex, StageFinalPass, StageDone}
+	if len(events) != len(wantStages) {
+		t.Fatalf("expected stages %v, got %+v", wantStages, events)
+	}
+	for i, event := range events {
+		if event.Stage != wantStages[i] {
+			t.Fatalf("expected stage %s at %d, got %+v", wantStages[i], i, events)
+		}
+		if i > 0 && event.Percent < events[i-1].Percent {
+			t.Fatalf("progress decreased: %+v", events)
+		}
+	}
+	if events[len(events)-1].Percent != 100 {
+		t.Fatalf("expected the done stage to report 100%%, got %+v", events[len(events)-1])
+	}
+}
+
+func TestProgressTrackerNeverDecreasesWhenPlanGrows(t *testing.T) {
+	var percents []int
+	tracker := newProgressTracker("req", func(event ProgressEvent) { percents = append(percents, event.Percent) })
+
+	tracker.enter(StageWorkspace)
+	tracker.enter(StageLatexmk)
+	// A longer plan discovered late shrinks the share of earlier stages
+	tracker.plan(StageWorkspace, StageLatexmk, StagePythonTex, StageFinalPass)
+	tracker.enter(StageLatexmk)
+	tracker.enter(StageDone)
+
+	for i := 1; i < len(percents); i++ {
+		if percents[i] < percents[i-1] {
+			t.Fatalf("progress decreased: %v", percents)
+		}
+	}
+}
+
+func TestDroppedJobReportsProgressDone(t *testing.T) {
+	job := &CompileJob{
+		RequestID:  "dropped-progress",
+		Files:      []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		ProjectID:  "dropped-progress",
+		EnqueuedAt: time.Now(),
+		ResultChan: make(chan *CompileResult, 1),
+	}
+	job.Options.Progress = asyncProgress.update
+	asyncProgress.update(ProgressEvent{RequestID: job.RequestID, Stage: StageQueued})
+	t.Cleanup(func() { asyncProgress.remove(job.RequestID) })
+
+	failJob(jobCompiler(job), job, ErrSuperseded)
+
+	if result := <-job.ResultChan; result.ErrorCode != "SUPERSEDED" {
+		t.Fatalf("expected SUPERSEDED, got %q", result.ErrorCode)
+	}
+	if event, ok := asyncProgress.get(job.RequestID); !ok || event.Stage != StageDone || event.Percent != 100 {
+		t.Fatalf("expected the dropped job to report done, got %+v", event)
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// provenanceAttachment is the name of the JSON record attached to the PDF
+const provenanceAttachment = "provenance.json"
+
+// embeddedFontPattern matches the font files pdfTeX lists as it embeds them
+// at the end of the log, e.g. </usr/share/texmf/fonts/type1/public/amsfonts/cm/cmr10.pfb>
+var embeddedFontPattern = regexp.MustCompile(`<([^<>\s]+\.(?:pfb|pfa|otf|ttf))>`)
+
+// provenanceRecord gathers the inputs of a build for archival
+func (s *compileSession) provenanceRecord(logContent string) ProvenanceRecord {
+	record := ProvenanceRecord{
+		Engine:          string(s.engine),
+		Packages:        parseFileList(logContent),
+		SourceSHA256:    HashFileSet(s.files),
+		CompiledAt:      time.Now().UTC(),
+		SourceDateEpoch: s.options.SourceDateEpoch,
+	}
+	if record.SourceDateEpoch > 0 {
+		// The PDF carries the fixed timestamp, so the record does too
+		record.CompiledAt = time.Unix(record.SourceDateEpoch, 0).UTC()
+	}
+
+	seen := map[string]bool{}
+	for _, m := range embeddedFontPattern.FindAllStringSubmatch(unwrapLogLines(logContent), -1) {
+		name := filepath.Base(m[1])
+		if !seen[name] {
+			seen[name] = true
+			record.Fonts = append(record.Fonts, name)
+		}
+	}
+	return record
+}
+
+// embedProvenance attaches the provenance record to the compiled PDF with
+// qpdf and returns the new PDF
+func (s *compileSession) embedProvenance(logContent string) ([]byte, error) {
+	data, err := json.MarshalIndent(s.provenanceRecord(logContent), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(s.pdfPath)
+	recordPath := filepath.Join(dir, s.jobName+"-"+provenanceAttachment)
+	outPath := filepath.Join(dir, s.jobName+"-provenance.pdf")
+	defer os.Remove(recordPath)
+	defer os.Remove(outPath)
+	if err := os.WriteFile(recordPath, data, fileMode); err != nil {
+		return nil, err
+	}
+
+	cmd := s.command("qpdf", "--add-attachment", filepath.Base(recordPath),
+		"--key="+provenanceAttachment, "--filename="+provenanceAttachment, "--mimetype=application/json", "--",
+		filepath.Base(s.pdfPath), filepath.Base(outPath))
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("qpdf: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	if err := os.Rename(outPath, s.pdfPath); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(s.pdfPath)
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeQpdfAttach appends the attached file to the input PDF:
+// qpdf --add-attachment file --key=... --filename=... --mimetype=... -- in.pdf out.pdf
+const fakeQpdfAttach = `{ cat "$7"; printf '\nattachment %s\n' "$3"; cat "$2"; } > "$8"
+`
+
+func TestCompileAttachesProvenanceRecord(t *testing.T) {
+	pdfLog := listfilesLog + "</usr/share/texmf/fonts/type1/public/amsfonts/cm/cmr10.pfb>\n"
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(pdfLog), "qpdf": fakeQpdfAttach})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{Provenance: true, SourceDateEpoch: 1700000000})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if !containsString(readArgs(), `-pretex=\listfiles`) {
+		t.Fatalf("expected \\listfiles to be injected for the package list")
+	}
+
+	pdf := string(result.PDFData)
+	marker := "\nattachment --key=" + provenanceAttachment + "\n"
+	at := strings.Index(pdf, marker)
+	if !strings.HasPrefix(pdf, "%PDF") || at == -1 {
+		t.Fatalf("expected a %s attachment in the PDF, got %q", provenanceAttachment, pdf)
+	}
+
+	var record ProvenanceRecord
+	if err := json.Unmarshal([]byte(pdf[at+len(marker):]), &record); err != nil {
+		t.Fatalf("attachment is not a provenance record: %v", err)
+	}
+	if record.Engine != "pdflatex" || record.SourceSHA256 != HashFileSet(files) {
+		t.Fatalf("unexpected engine or source hash: %+v", record)
+	}
+	if len(record.Packages) != 5 || record.Packages[2].Name != "graphicx.sty" {
+		t.Fatalf("expected the \\listfiles packages, got %+v", record.Packages)
+	}
+	if len(record.Fonts) != 1 || record.Fonts[0] != "cmr10.pfb" {
+		t.Fatalf("expected the embedded font, got %v", record.Fonts)
+	}
+	if record.SourceDateEpoch != 1700000000 || !record.CompiledAt.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("expected the fixed source date, got %+v", record)
+	}
+}
+
+func TestCompileReportsProvenanceFailure(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript, "qpdf": "echo 'qpdf: broken' >&2\nexit 2\n"})
+	startTestWorker(t)
+
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:      []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		Provenance: true,
+	})
+	assertStatus(t, recorder, http.StatusOK)
+	if body := recorder.Body.String(); !strings.HasPrefix(body, "%PDF") {
+		t.Fatalf("expected the PDF without the record, got %q", body)
+	}
+	if got := recorder.Header().Get("X-Compile-Provenance-Error"); !strings.Contains(got, "qpdf: broken") {
+		t.Fatalf("expected the qpdf failure in X-Compile-Provenance-Error, got %q", got)
+	}
+}
@@ -0,0 +1,14 @@
+package internal
+
+import "github.com/gin-gonic/gin"
+
+// ConfigureTrustedProxies makes c.ClientIP() read X-Forwarded-For and
+// X-Real-IP only on requests whose peer is one of proxies (IPs or CIDRs).
+// With none, forwarded headers are ignored and the client is the peer itself,
+// so clients cannot spoof the address per-client cache caps are keyed on.
+func ConfigureTrustedProxies(router *gin.Engine, proxies []string) error {
+	if len(proxies) == 0 {
+		proxies = nil
+	}
+	return router.SetTrustedProxies(proxies)
+}
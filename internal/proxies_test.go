@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConfigureTrustedProxies(t *testing.T) {
+	clientIP := func(proxies []string, peer string) string {
+		router := gin.New()
+		if err := ConfigureTrustedProxies(router, proxies); err != nil {
+			t.Fatalf("ConfigureTrustedProxies(%v): %v", proxies, err)
+		}
+		router.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = peer + ":40000"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Body.String()
+	}
+
+	cases := []struct {
+		proxies []string
+		peer    string
+		want    string
+	}{
+		{[]string{"10.0.0.0/8"}, "10.1.2.3", "203.0.113.7"},
+		{[]string{"10.0.0.0/8"}, "198.51.100.9", "198.51.100.9"},
+		{[]string{"192.0.2.1"}, "192.0.2.1", "203.0.113.7"},
+		{nil, "10.1.2.3", "10.1.2.3"},
+	}
+	for _, tc := range cases {
+		if got := clientIP(tc.proxies, tc.peer); got != tc.want {
+			t.Errorf("proxies %v, peer %s: expected client IP %s, got %s", tc.proxies, tc.peer, tc.want, got)
+		}
+	}
+}
+
+func TestConfigureTrustedProxiesRejectsInvalidCIDR(t *testing.T) {
+	if err := ConfigureTrustedProxies(gin.New(), []string{"10.0.0.0/33"}); err == nil {
+		t.Fatalf("expected an invalid CIDR to be rejected")
+	}
+}
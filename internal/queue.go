@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminToken guards the operator endpoints; empty disables them
+var adminToken string
+
+// workerCount is the number of workers taking jobs from requestQueue
+var workerCount = 1
+
+// SetWorkerCount sets the number of workers, which queue wait estimates
+// divide the queue among and standalone tool runs are bounded by
+func SetWorkerCount(count int) {
+	workerCount = max(count, 1)
+	standaloneSlots = make(chan struct{}, workerCount)
+}
+
+// SetAdminToken sets the bearer token required by admin endpoints such as
+// GET /queue (empty = admin endpoints disabled)
+func SetAdminToken(token string) {
+	adminToken = strings.TrimSpace(token)
+}
+
+// RequireAdmin rejects requests without "Authorization: Bearer <ADMIN_TOKEN>"
+func RequireAdmin(c *gin.Context) {
+	if adminToken == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+			Error:   "Forbidden",
+			Message: "Admin endpoints are disabled; set ADMIN_TOKEN to enable them",
+		})
+		return
+	}
+
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "A valid admin bearer token is required",
+		})
+		return
+	}
+	c.Next()
+}
+
+// QueuedJob describes a job waiting for a worker, without its files
+type QueuedJob struct {
+	RequestID      string    `json:"requestId"`
+	ProjectID      string    `json:"projectId,omitempty"`
+	CacheNamespace string    `json:"cacheNamespace,omitempty"`
+	ClientID       string    `json:"clientId,omitempty"`
+	EnqueuedAt     time.Time `json:"enqueuedAt"`
+	WaitMs         int64     `json:"waitMs"`
+	FileCount      int       `json:"fileCount"`
+	Priority       int       `json:"priority"` // Always normalPriority: requestQueue is first come, first served
+}
+
+// normalPriority is the dispatch priority of every queued job
+const normalPriority = 0
+
+// QueueResponse lists the queued jobs, oldest first
+type QueueResponse struct {
+	Length   int         `json:"length"`
+	Capacity int         `json:"capacity"`
+	Jobs     []QueuedJob `json:"jobs"`
+}
+
+// queueTracker mirrors the jobs sitting in requestQueue, which a channel
+// cannot list
+type queueTracker struct {
+	mu   sync.Mutex
+	jobs map[*CompileJob]struct{}
+}
+
+var queuedJobs = &queueTracker{jobs: make(map[*CompileJob]struct{})}
+
+func (q *queueTracker) add(job *CompileJob) {
+	q.mu.Lock()
+	q.jobs[job] = struct{}{}
+	q.mu.Unlock()
+}
+
+// remove forgets job once a worker picks it up or it could not be queued
+func (q *queueTracker) remove(job *CompileJob) {
+	q.mu.Lock()
+	delete(q.jobs, job)
+	q.mu.Unlock()
+}
+
+func (q *queueTracker) list() []QueuedJob {
+	now := time.Now()
+	jobs := []QueuedJob{}
+
+	q.mu.Lock()
+	for job := range q.jobs {
+		jobs = append(jobs, QueuedJob{
+			RequestID:      job.RequestID,
+			ProjectID:      job.ProjectID,
+			CacheNamespace: job.Options.CacheNamespace,
+			ClientID:       job.Options.ClientID,
+			EnqueuedAt:     job.EnqueuedAt,
+			WaitMs:         now.Sub(job.EnqueuedAt).Milliseconds(),
+			FileCount:      len(job.Files),
+			Priority:       normalPriority,
+		})
+	}
+	q.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].EnqueuedAt.Before(jobs[j].EnqueuedAt) })
+	return jobs
+}
+
+// QueueHandler lists the jobs waiting for a worker; mount it behind
+// RequireAdmin
+func QueueHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, QueueResponse{
+		Length:   len(requestQueue),
+		Capacity: cap(requestQueue),
+		Jobs:     queuedJobs.list(),
+	})
+}
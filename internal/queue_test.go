@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// performQueue lists the queue with the given Authorization header.
+func performQueue(t *testing.T, authorization string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/queue", RequireAdmin, QueueHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/queue", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestQueueListsJobsNotYetProcessed(t *testing.T) {
+	SetAdminToken("secret")
+	t.Cleanup(func() { SetAdminToken("") })
+
+	// No worker drains this queue
+	previous := requestQueue
+	queue := make(chan *CompileJob, 4)
+	SetRequestQueue(queue)
+	t.Cleanup(func() { SetRequestQueue(previous) })
+
+	var jobs []*CompileJob
+	for _, projectID := range []string{"queued-a", "queued-b"} {
+		job := &CompileJob{
+			Files:      []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+			ProjectID:  projectID,
+			EnqueuedAt: time.Now(),
+			ResultChan: make(chan *CompileResult, 1),
+		}
+		if enqueueJob(job) != nil {
+			t.Fatalf("failed to enqueue %s", projectID)
+		}
+		jobs = append(jobs, job)
+		time.Sleep(time.Millisecond)
+	}
+	t.Cleanup(func() {
+		for _, job := range jobs {
+			queuedJobs.remove(job)
+			projectCompiles.finish(job)
+		}
+	})
+
+	recorder := performQueue(t, "Bearer secret")
+	assertStatus(t, recorder, http.StatusOK)
+	var resp QueueResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode queue: %v", err)
+	}
+	if resp.Length != 2 || len(resp.Jobs) != 2 {
+		t.Fatalf("expected 2 queued jobs, got %+v", resp)
+	}
+	for i, job := range resp.Jobs {
+		if job.RequestID != jobs[i].RequestID || job.ProjectID != jobs[i].ProjectID || job.FileCount != 1 {
+			t.Fatalf("job %d: unexpected listing %+v", i, job)
+		}
+	}
+	var raw struct {
+		Jobs []map[string]any `json:"jobs"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("failed to decode queue: %v", err)
+	}
+	for i, job := range raw.Jobs {
+		if priority, ok := job["priority"]; !ok || priority != float64(normalPriority) {
+			t.Fatalf("job %d: expected priority %d, got %v", i, normalPriority, job["priority"])
+		}
+	}
+	if strings.Contains(recorder.Body.String(), "Hello from Octree") {
+		t.Fatalf("expected file contents to be left out of the listing")
+	}
+
+	// A job a worker has picked up is no longer queued
+	queuedJobs.remove(<-queue)
+	if listed := queuedJobs.list(); len(listed) != 1 || listed[0].ProjectID != "queued-b" {
+		t.Fatalf("expected only queued-b to remain, got %+v", listed)
+	}
+}
+
+func TestQueueRequiresAdminToken(t *testing.T) {
+	assertStatus(t, performQueue(t, "Bearer secret"), http.StatusForbidden)
+
+	SetAdminToken("secret")
+	t.Cleanup(func() { SetAdminToken("") })
+	assertStatus(t, performQueue(t, ""), http.StatusUnauthorized)
+	assertStatus(t, performQueue(t, "Bearer wrong"), http.StatusUnauthorized)
+	assertStatus(t, performQueue(t, "Bearer secret"), http.StatusOK)
+}
+
+func TestBusyCompileEstimatesWait(t *testing.T) {
+	previous := requestQueue
+	queue := make(chan *CompileJob, 2)
+	SetRequestQueue(queue)
+	t.Cleanup(func() { SetRequestQueue(previous) })
+	// No worker drains this queue
+	queue <- &CompileJob{}
+	queue <- &CompileJob{}
+
+	SetWorkerCount(4)
+	t.Cleanup(func() { SetWorkerCount(1) })
+	saved := compileDurations.avgMs
+	compileDurations.avgMs = 3000
+	t.Cleanup(func() { compileDurations.avgMs = saved })
+
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+	})
+	assertStatus(t, recorder, http.StatusServiceUnavailable)
+
+	var resp struct {
+		QueuePosition   int   `json:"queuePosition"`
+		EstimatedWaitMs int64 `json:"estimatedWaitMs"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	// Two jobs ahead shared by four workers at 3s each
+	if resp.QueuePosition != 3 || resp.EstimatedWaitMs != 1500 {
+		t.Fatalf("expected position 3 and a 1500ms wait, got %+v", resp)
+	}
+}
+
+func TestAcceptedCompileCarriesWaitEstimate(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+	})
+	assertStatus(t, recorder, http.StatusOK)
+	if got := recorder.Header().Get("X-Compile-Estimated-Wait-Ms"); got != "0" {
+		t.Fatalf("expected no wait for an empty queue, got %q", got)
+	}
+}
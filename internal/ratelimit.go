@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// compileRateLimiter is a token bucket refilled at perMinute tokens a minute,
+// holding up to burst. Each compile takes one token before it is queued,
+// across all clients.
+type compileRateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens per second
+	burst  float64
+	tokens float64 // Negative when compiles have booked tokens not yet refilled
+	last   time.Time
+	now    func() time.Time
+}
+
+// globalRateLimit is nil when GLOBAL_RATE_LIMIT_RPM is unset
+var globalRateLimit *compileRateLimiter
+
+// SetGlobalRateLimit caps compiles per minute over the whole server
+// (0 = unlimited), letting up to burst start back to back (at least 1). This
+// limits the rate at which compiles are queued, not how many run at once.
+func SetGlobalRateLimit(perMinute, burst int) {
+	if perMinute <= 0 {
+		globalRateLimit = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	globalRateLimit = &compileRateLimiter{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// reserve takes the next token and returns how long the caller must wait for
+// it to be refilled. When that wait would exceed maxWait (0 = no cap) no
+// token is taken and ok is false.
+func (l *compileRateLimiter) reserve(maxWait time.Duration) (wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	if maxWait > 0 && wait > maxWait {
+		return wait, false
+	}
+	l.tokens--
+	return wait, true
+}
+
+// awaitDispatchSlot holds job back until the global rate allows it to be
+// queued, so a throttled job never occupies a worker. It fails with
+// ErrRateLimited when the job would wait past MAX_QUEUE_WAIT, since its
+// client has given up by then, or past EnqueueTimeout when MAX_QUEUE_WAIT is
+// unset. A job superseded while it waits fails with ErrSuperseded.
+func awaitDispatchSlot(job *CompileJob) error {
+	limiter := globalRateLimit
+	if limiter == nil {
+		return nil
+	}
+
+	maxWait := EnqueueTimeout
+	if maxQueueWait > 0 {
+		maxWait = maxQueueWait - time.Since(job.EnqueuedAt)
+		if maxWait <= 0 {
+			// Out of budget, but a free token still costs nothing to take
+			maxWait = time.Nanosecond
+		}
+	}
+
+	wait, ok := limiter.reserve(maxWait)
+	if !ok {
+		log.Printf("Rejecting compile of project %q: next token in %s (GLOBAL_RATE_LIMIT_RPM)", job.ProjectID, wait)
+		return ErrRateLimited
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	log.Printf("Delaying compile of project %q by %s (GLOBAL_RATE_LIMIT_RPM)", job.ProjectID, wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var cancelled <-chan struct{}
+	if job.Options.Context != nil {
+		cancelled = job.Options.Context.Done()
+	}
+	select {
+	case <-timer.C:
+	case <-cancelled:
+	}
+	if cancelled != nil && job.Options.Context.Err() != nil || projectCompiles.outdated(job) {
+		log.Printf("Compile of project %q superseded while waiting for a token", job.ProjectID)
+		return ErrSuperseded
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSpacesDispatches(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	SetGlobalRateLimit(60, 1)
+	t.Cleanup(func() { SetGlobalRateLimit(0, 0) })
+	limiter := globalRateLimit
+	limiter.now = func() time.Time { return now }
+
+	for i, want := range []time.Duration{0, time.Second, 2 * time.Second} {
+		if wait, ok := limiter.reserve(0); !ok || wait != want {
+			t.Fatalf("reservation %d: expected to wait %s, got %s (ok=%v)", i, want, wait, ok)
+		}
+	}
+	if wait, ok := limiter.reserve(time.Second); ok {
+		t.Fatalf("expected a reservation 3s out to exceed a 1s cap, waited %s", wait)
+	}
+
+	now = now.Add(10 * time.Second)
+	if wait, ok := limiter.reserve(time.Second); !ok || wait != 0 {
+		t.Fatalf("expected an idle limiter to dispatch at once, got %s (ok=%v)", wait, ok)
+	}
+}
+
+func TestRateLimiterAllowsBurst(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	SetGlobalRateLimit(60, 3)
+	t.Cleanup(func() { SetGlobalRateLimit(0, 0) })
+	limiter := globalRateLimit
+	limiter.now = func() time.Time { return now }
+
+	for i, want := range []time.Duration{0, 0, 0, time.Second} {
+		if wait, ok := limiter.reserve(0); !ok || wait != want {
+			t.Fatalf("reservation %d: expected to wait %s, got %s (ok=%v)", i, want, wait, ok)
+		}
+	}
+
+	// Refilling never stores more than the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if wait, _ := limiter.reserve(0); wait != 0 {
+			t.Fatalf("reservation %d after idling: expected no wait, got %s", i, wait)
+		}
+	}
+	if wait, _ := limiter.reserve(0); wait != time.Second {
+		t.Fatalf("expected the burst to be used up, got wait %s", wait)
+	}
+}
+
+func TestCompileHandlerThrottledByGlobalRate(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	SetGlobalRateLimit(1, 1)
+	SetMaxQueueWait(2 * time.Second)
+	t.Cleanup(func() {
+		SetGlobalRateLimit(0, 0)
+		SetMaxQueueWait(0)
+	})
+
+	request := CompileRequest{Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}}}
+	assertStatus(t, performJSON(t, http.MethodPost, "/compile", CompileHandler, request), http.StatusOK)
+
+	// The next slot is a minute away, past the queue wait
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, request)
+	assertStatus(t, recorder, http.StatusTooManyRequests)
+	var resp ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil || resp.Code != "RATE_LIMITED" {
+		t.Fatalf("expected RATE_LIMITED, got %s", recorder.Body.String())
+	}
+}
+
+func TestCompileHandlerDefersPastGlobalRate(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	// One token every 500ms
+	SetGlobalRateLimit(120, 1)
+	t.Cleanup(func() { SetGlobalRateLimit(0, 0) })
+
+	request := CompileRequest{Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}}}
+	assertStatus(t, performJSON(t, http.MethodPost, "/compile", CompileHandler, request), http.StatusOK)
+
+	started := time.Now()
+	assertStatus(t, performJSON(t, http.MethodPost, "/compile", CompileHandler, request), http.StatusOK)
+	if elapsed := time.Since(started); elapsed < 300*time.Millisecond {
+		t.Fatalf("expected the second compile to wait for a token, took %s", elapsed)
+	}
+}
+
+func TestGlobalRateWaitCappedWithoutMaxQueueWait(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	SetGlobalRateLimit(1, 1)
+	t.Cleanup(func() { SetGlobalRateLimit(0, 0) })
+
+	request := CompileRequest{Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}}}
+	assertStatus(t, performJSON(t, http.MethodPost, "/compile", CompileHandler, request), http.StatusOK)
+
+	// The next token is a minute away, past EnqueueTimeout
+	started := time.Now()
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, request)
+	assertStatus(t, recorder, http.StatusTooManyRequests)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("expected the request to be rejected at once, took %s", elapsed)
+	}
+}
+
+func TestCompileSupersededWhileWaitingForToken(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	projectID := "rate-supersede-test"
+	forgetProject(t, projectID)
+
+	// No worker drains this queue
+	previous := requestQueue
+	SetRequestQueue(make(chan *CompileJob, 2))
+	t.Cleanup(func() { SetRequestQueue(previous) })
+
+	// One token a second, already taken
+	SetGlobalRateLimit(60, 1)
+	t.Cleanup(func() { SetGlobalRateLimit(0, 0) })
+	limiter := globalRateLimit
+	limiter.reserve(0)
+
+	newJob := func(draft string) *CompileJob {
+		return &CompileJob{
+			Files:      []FileEntry{{Path: "main.tex", Content: strings.Replace(simpleDocument, "Hello from Octree!", draft, 1)}},
+			ProjectID:  projectID,
+			EnqueuedAt: time.Now(),
+			ResultChan: make(chan *CompileResult, 1),
+		}
+	}
+	older := newJob("Older draft")
+	waited := make(chan error, 1)
+	go func() { waited <- enqueueJob(older) }()
+
+	// Once the older job is waiting, hand the newer one a token of its own
+	for {
+		limiter.mu.Lock()
+		reserved := limiter.tokens < 0
+		if reserved {
+			limiter.tokens = 1
+		}
+		limiter.mu.Unlock()
+		if reserved {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	newer := newJob("Newer draft")
+	if err := enqueueJob(newer); err != nil {
+		t.Fatalf("failed to enqueue the newer draft: %v", err)
+	}
+
+	if err := <-waited; err != ErrSuperseded {
+		t.Fatalf("expected the older draft to be superseded while waiting, got %v", err)
+	}
+	if len(requestQueue) != 1 {
+		t.Fatalf("expected only the newer draft to be queued, got %d", len(requestQueue))
+	}
+	HandleCompilation(<-requestQueue)
+	if result := <-newer.ResultChan; !result.Success {
+		t.Fatalf("expected the newer draft to compile, got: %s", result.ErrorMessage)
+	}
+}
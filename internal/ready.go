@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ReadinessCacheTTL is how long a toolchain check answers GET /ready
+	// before the tools are run again
+	ReadinessCacheTTL = 10 * time.Second
+	// toolCheckTimeout bounds each tool's --version run
+	toolCheckTimeout = 5 * time.Second
+)
+
+// ToolStatus reports whether one toolchain program runs
+type ToolStatus struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Required  bool   `json:"required"`          // Readiness depends on it
+	Version   string `json:"version,omitempty"` // First line of its --version output
+	Error     string `json:"error,omitempty"`
+}
+
+// ReadyResponse is the readiness probe's answer
+type ReadyResponse struct {
+	Ready     bool         `json:"ready"`
+	Tools     []ToolStatus `json:"tools"`
+	CheckedAt time.Time    `json:"checkedAt"`
+}
+
+// readinessCache keeps the last toolchain check so probes do not fork a
+// process per tool on every request
+type readinessCache struct {
+	mu   sync.Mutex
+	last *ReadyResponse
+}
+
+var readiness = &readinessCache{}
+
+// check returns the cached check while it is fresh and runs a new one
+// otherwise
+func (r *readinessCache) check() ReadyResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last == nil || time.Since(r.last.CheckedAt) >= ReadinessCacheTTL {
+		resp := checkToolchain()
+		r.last = &resp
+	}
+	return *r.last
+}
+
+// checkToolchain runs each program with --version. The server is ready when
+// pdflatex and the preferred Unicode engine run: without latexmk compiles are
+// sequenced manually, and the other tools only serve some documents.
+func checkToolchain() ReadyResponse {
+	tools := []struct {
+		name     string
+		required bool
+	}{
+		{"latexmk", false},
+		{enginePdfLaTeX.command(), true},
+		{engineXeLaTeX.command(), preferredUnicodeEngine == engineXeLaTeX},
+		{engineLuaLaTeX.command(), preferredUnicodeEngine == engineLuaLaTeX},
+		{"bibtex", false},
+		{"biber", false},
+	}
+
+	resp := ReadyResponse{Ready: true, CheckedAt: time.Now()}
+	for _, tool := range tools {
+		status := toolStatus(tool.name)
+		status.Required = tool.required
+		if tool.required && !status.Available {
+			resp.Ready = false
+		}
+		resp.Tools = append(resp.Tools, status)
+	}
+	return resp
+}
+
+func toolStatus(name string) ToolStatus {
+	status := ToolStatus{Name: name}
+	if _, err := exec.LookPath(name); err != nil {
+		status.Error = "not found on PATH"
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolCheckTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, name, "--version").CombinedOutput()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Available = true
+	status.Version, _, _ = strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return status
+}
+
+// ReadyHandler is the readiness probe: 200 when the toolchain can compile,
+// 503 otherwise. Unlike HealthHandler, it fails for broken container builds.
+func ReadyHandler(c *gin.Context) {
+	resp := readiness.check()
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
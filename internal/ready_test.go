@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestReadyHandlerChecksToolchain(t *testing.T) {
+	probe := func() ReadyResponse {
+		t.Helper()
+		readiness.last = nil
+		recorder := performJSON(t, http.MethodGet, "/ready", ReadyHandler, nil)
+
+		var resp ReadyResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if want := map[bool]int{true: http.StatusOK, false: http.StatusServiceUnavailable}[resp.Ready]; recorder.Code != want {
+			t.Fatalf("expected HTTP %d for ready=%v, got %d", want, resp.Ready, recorder.Code)
+		}
+		return resp
+	}
+
+	dir := installFakeTools(t, map[string]string{"pdflatex": "echo 'pdfTeX 3.141592653-2.6-1.40.25 (TeX Live 2023)'\necho 'kpathsea version 6.3.5'\n"})
+	t.Setenv("PATH", dir)
+
+	resp := probe()
+	if resp.Ready {
+		t.Fatalf("expected not ready without xelatex, got %+v", resp)
+	}
+	for _, tool := range resp.Tools {
+		switch tool.Name {
+		case "pdflatex":
+			if !tool.Available || !tool.Required || tool.Version != "pdfTeX 3.141592653-2.6-1.40.25 (TeX Live 2023)" {
+				t.Fatalf("unexpected pdflatex status %+v", tool)
+			}
+		case "xelatex":
+			if tool.Available || !tool.Required {
+				t.Fatalf("expected xelatex to be required and missing, got %+v", tool)
+			}
+		}
+	}
+
+	installFakeTools(t, map[string]string{"xelatex": "echo 'XeTeX 3.141592653-2.6-0.999995'\n"})
+	if resp := probe(); !resp.Ready {
+		t.Fatalf("expected ready with pdflatex and xelatex, got %+v", resp)
+	}
+}
+
+func TestReadinessIsCached(t *testing.T) {
+	readiness.last = nil
+	t.Cleanup(func() { readiness.last = nil })
+
+	first := readiness.check()
+	if second := readiness.check(); !second.CheckedAt.Equal(first.CheckedAt) {
+		t.Fatalf("expected the second probe to reuse the first check")
+	}
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// undefinedRefPattern matches LaTeX's and natbib's end-of-run warnings for
+// unresolved \ref and \cite targets, e.g.
+// "LaTeX Warning: Reference `fig:x' on page 1 undefined on input line 5."
+var undefinedRefPattern = regexp.MustCompile("(?:LaTeX|Package natbib) Warning: (Reference|Citation) `([^']+)'(?: on page \\S+)? undefined")
+
+// parseUndefinedReferences collects unresolved references and citations from
+// a LaTeX log. Counts are warning occurrences; names are unique, in log order.
+func parseUndefinedReferences(logContent string) UndefinedReferences {
+	var refs UndefinedReferences
+	seen := map[string]bool{}
+
+	for _, match := range undefinedRefPattern.FindAllStringSubmatch(unwrapLogLines(logContent), -1) {
+		kind, name := match[1], match[2]
+		key := kind + "\x00" + name
+
+		if kind == "Reference" {
+			refs.ReferenceCount++
+			if !seen[key] {
+				refs.References = append(refs.References, name)
+			}
+		} else {
+			refs.CitationCount++
+			if !seen[key] {
+				refs.Citations = append(refs.Citations, name)
+			}
+		}
+		seen[key] = true
+	}
+
+	return refs
+}
+
+// unwrapLogLines joins log lines that TeX wrapped at max_print_line so that
+// messages split across lines can be matched as a whole
+func unwrapLogLines(logContent string) string {
+	lines := strings.Split(logContent, "\n")
+	var b strings.Builder
+	b.Grow(len(logContent))
+
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		b.WriteString(line)
+		if len(line) != maxPrintLine && i < len(lines)-1 {
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const undefinedRefsLog = `LaTeX Warning: Reference ` + "`fig:missing'" + ` on page 1 undefined on input line 4.
+
+LaTeX Warning: Reference ` + "`fig:missing'" + ` on page 2 undefined on input line 9.
+
+LaTeX Warning: Citation ` + "`knuth84'" + ` on page 1 undefined on input line 6.
+
+Package natbib Warning: Citation ` + "`lamport94'" + ` undefined on input line 7.
+
+LaTeX Warning: There were undefined references.
+`
+
+func TestParseUndefinedReferences(t *testing.T) {
+	refs := parseUndefinedReferences(undefinedRefsLog)
+
+	if refs.ReferenceCount != 2 || !reflect.DeepEqual(refs.References, []string{"fig:missing"}) {
+		t.Fatalf("unexpected references: %+v", refs)
+	}
+	if refs.CitationCount != 2 || !reflect.DeepEqual(refs.Citations, []string{"knuth84", "lamport94"}) {
+		t.Fatalf("unexpected citations: %+v", refs)
+	}
+}
+
+func TestParseUndefinedReferencesJoinsWrappedLines(t *testing.T) {
+	// TeX wraps log lines at 79 characters
+	line := "LaTeX Warning: Reference `sec:a-rather-long-label-name-that-gets-wrapped-by-tex"
+	logContent := line + "\n' on page 3 undefined on input line 12.\n"
+	if len(line) != maxPrintLine {
+		t.Fatalf("test line must be %d characters, got %d", maxPrintLine, len(line))
+	}
+
+	refs := parseUndefinedReferences(logContent)
+	if !reflect.DeepEqual(refs.References, []string{"sec:a-rather-long-label-name-that-gets-wrapped-by-tex"}) {
+		t.Fatalf("unexpected references: %+v", refs)
+	}
+}
+
+func TestCompileReportsUndefinedReferences(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(undefinedRefsLog)})
+
+	document := "\\documentclass{article}\n\\begin{document}\nSee Figure~\\ref{fig:missing}.\n\\end{document}"
+	result := New().Compile([]FileEntry{{Path: "main.tex", Content: document}}, time.Now(), "", CompileOptions{})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if result.Undefined.ReferenceCount == 0 || result.Undefined.References[0] != "fig:missing" {
+		t.Fatalf("expected fig:missing to be reported as undefined, got %+v", result.Undefined)
+	}
+}
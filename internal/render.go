@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Output formats a compile can return
+const (
+	OutputFormatPDF = "pdf"
+	OutputFormatPNG = "png"
+	OutputFormatSVG = "svg"
+)
+
+// RenderDPI is the resolution of PNG page renders
+const RenderDPI = 150
+
+// renderFormats maps each image format to its converter and MIME type
+var renderFormats = map[string]struct {
+	tool     string
+	mimeType string
+}{
+	OutputFormatPNG: {"pdftoppm", "image/png"},
+	OutputFormatSVG: {"pdf2svg", "image/svg+xml"},
+}
+
+// normalizeOutputFormat returns the requested format in lower case, "pdf"
+// when empty, and false when it is not supported
+func normalizeOutputFormat(format string) (string, bool) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" || format == OutputFormatPDF {
+		return OutputFormatPDF, true
+	}
+	_, ok := renderFormats[format]
+	return format, ok
+}
+
+// render imposes a successful result's PDF when requested, then converts it
+// into the requested image format and sprite sheet, keeping the PDF. A
+// missing converter or failed conversion fails the result, with the PDF still
+// attached as a partial result.
+func (s *compileSession) render(result *CompileResult) *CompileResult {
+	if result == nil || !result.Success {
+		return result
+	}
+
+	if s.options.Impose != "" {
+		if err := s.impose(result); err != nil {
+			return s.failRender(result, err)
+		}
+	}
+
+	if s.options.SpriteSheet {
+		sheet, err := s.spriteSheet(result.PDFData)
+		if err != nil {
+			return s.failRender(result, err)
+		}
+		result.SpriteSheet = sheet
+	}
+
+	format := s.options.OutputFormat
+	converter, ok := renderFormats[format]
+	if !ok {
+		return result
+	}
+
+	tools := []string{converter.tool}
+	if format == OutputFormatSVG && s.options.RenderAllPages {
+		tools = append(tools, "pdfinfo")
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			return s.failRender(result, fmt.Errorf("%w: %s is not installed", ErrRenderUnavailable, tool))
+		}
+	}
+
+	pages, err := s.renderPages(result.PDFData, format)
+	if err != nil {
+		return s.failRender(result, fmt.Errorf("%w: %v", ErrRenderFailed, err))
+	}
+
+	log.Printf("[%s] Rendered %d page(s) as %s", s.compiler.RequestID, len(pages), format)
+	result.Artifacts = pages
+	result.ArtifactMimeType = converter.mimeType
+	return result
+}
+
+// renderPages writes the PDF to a scratch directory and converts the first
+// page, or every page up to MaxRenderPages when requested, returning them in
+// page order
+func (s *compileSession) renderPages(pdf []byte, format string) ([][]byte, error) {
+	dir, err := os.MkdirTemp("", "render-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "input.pdf"), pdf, 0600); err != nil {
+		return nil, err
+	}
+
+	last := 1
+	if s.options.RenderAllPages {
+		last = MaxRenderPages
+	}
+
+	var cmds []*exec.Cmd
+	switch format {
+	case OutputFormatPNG:
+		// Writes page-1.png, or page-01.png ... when there are 10+ pages
+		cmds = append(cmds, s.command("pdftoppm", "-png", "-r", strconv.Itoa(RenderDPI),
+			"-f", "1", "-l", strconv.Itoa(last), "input.pdf", "page"))
+	case OutputFormatSVG:
+		// pdf2svg converts one page or all of them, so a capped range is
+		// converted page by page
+		if s.options.RenderAllPages {
+			pageCount, err := s.pdfPageCount(dir)
+			if err != nil {
+				return nil, err
+			}
+			last = min(pageCount, MaxRenderPages)
+		}
+		for page := 1; page <= last; page++ {
+			cmds = append(cmds, s.command("pdf2svg", "input.pdf", fmt.Sprintf("page-%d.svg", page), strconv.Itoa(page)))
+		}
+	}
+	for _, cmd := range cmds {
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("%s: %v: %s", renderFormats[format].tool, err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "page-*."+format))
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no pages rendered")
+	}
+	sort.Slice(paths, func(i, j int) bool { return renderedPageNumber(paths[i]) < renderedPageNumber(paths[j]) })
+
+	pages := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, data)
+	}
+	return pages, nil
+}
+
+// renderedPageNumber parses the page number of a page-N.ext file
+func renderedPageNumber(path string) int {
+	name := strings.TrimPrefix(filepath.Base(path), "page-")
+	n, _ := strconv.Atoi(strings.TrimSuffix(name, filepath.Ext(name)))
+	return n
+}
+
+// failRender turns a successful result into a render failure that still
+// carries the PDF
+func (s *compileSession) failRender(result *CompileResult, err error) *CompileResult {
+	log.Printf("[%s] Render failed: %v", s.compiler.RequestID, err)
+	s.metadata.Status = "error"
+	s.metadata.Error = err.Error()
+	s.compiler.persistMetadata(s.metadata)
+
+	result.Success = false
+	result.ErrorMessage = err.Error()
+	result.ErrorCode = errorCode(err)
+	return result
+}
+
+const (
+	// MaxRenderDPI bounds the resolution POST /render accepts
+	MaxRenderDPI = 600
+	// MaxRenderPages bounds the pages one POST /render call may rasterize
+	MaxRenderPages = 50
+	// RenderTimeout bounds the poppler tools run by POST /render
+	RenderTimeout = 30 * time.Second
+)
+
+var pdfinfoPagesPattern = regexp.MustCompile(`(?m)^Pages:\s+(\d+)`)
+
+// pdfPageCount reads the page count of dir's input.pdf with pdfinfo
+func (s *compileSession) pdfPageCount(dir string) (int, error) {
+	info := s.command("pdfinfo", "input.pdf")
+	info.Dir = dir
+	output, err := info.CombinedOutput()
+	m := pdfinfoPagesPattern.FindSubmatch(output)
+	if err != nil || m == nil {
+		return 0, fmt.Errorf("could not read the page count: %s", strings.TrimSpace(string(output)))
+	}
+	pageCount, _ := strconv.Atoi(string(m[1]))
+	return pageCount, nil
+}
+
+// RenderHandler rasterizes a page range of an already compiled PDF to PNG
+// with pdftoppm, so clients can re-render at another resolution without
+// recompiling. It runs outside the compile queue, so its tools share the
+// standalone slots and the compile CPU-time budget.
+func RenderHandler(c *gin.Context) {
+	var req RenderRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	pdf, err := base64.StdEncoding.DecodeString(req.PdfData)
+	if err != nil || len(pdf) < 4 || string(pdf[:4]) != "%PDF" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: "pdfData must be a base64-encoded PDF",
+		})
+		return
+	}
+
+	dpi := req.DPI
+	if dpi == 0 {
+		dpi = RenderDPI
+	}
+	if dpi < 1 || dpi > MaxRenderDPI {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: fmt.Sprintf("dpi must be between 1 and %d", MaxRenderDPI),
+		})
+		return
+	}
+
+	resp, err := renderPNGPages(c.Request.Context(), pdf, req.FirstPage, req.LastPage, dpi)
+	if err != nil {
+		log.Printf("Render failed: %v", err)
+		c.JSON(errorStatus(errorCode(err)), ErrorResponse{
+			Error:   "Render failed",
+			Code:    errorCode(err),
+			Message: err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// renderPNGPages checks the page range against the PDF's page count and
+// renders those pages
+func renderPNGPages(ctx context.Context, pdf []byte, first, last, dpi int) (*RenderResponse, error) {
+	for _, tool := range []string{"pdfinfo", "pdftoppm"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, fmt.Errorf("%w: %s is not installed", ErrRenderUnavailable, tool)
+		}
+	}
+
+	release, err := acquireStandaloneSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, RenderTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "render-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRenderFailed, err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "input.pdf"), pdf, 0600); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRenderFailed, err)
+	}
+
+	info, err := standaloneCommand(ctx, "pdfinfo", filepath.Join(dir, "input.pdf")).CombinedOutput()
+	m := pdfinfoPagesPattern.FindSubmatch(info)
+	if err != nil || m == nil {
+		return nil, fmt.Errorf("%w: could not read the page count: %s", ErrRenderFailed, strings.TrimSpace(string(info)))
+	}
+	pageCount, _ := strconv.Atoi(string(m[1]))
+
+	if first == 0 {
+		first = 1
+	}
+	if last == 0 {
+		last = first
+	}
+	switch {
+	case first < 1 || last < first:
+		return nil, fmt.Errorf("%w: pages %d-%d; firstPage must be at least 1 and lastPage at least firstPage", ErrInvalidPageRange, first, last)
+	case last > pageCount:
+		return nil, fmt.Errorf("%w: pages %d-%d, but the PDF has %d page(s)", ErrInvalidPageRange, first, last, pageCount)
+	case last-first+1 > MaxRenderPages:
+		return nil, fmt.Errorf("%w: %d pages requested, at most %d per request", ErrInvalidPageRange, last-first+1, MaxRenderPages)
+	}
+
+	cmd := standaloneCommand(ctx, "pdftoppm", "-png", "-r", strconv.Itoa(dpi),
+		"-f", strconv.Itoa(first), "-l", strconv.Itoa(last), "input.pdf", "page")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%w: pdftoppm: %v: %s", ErrRenderFailed, err, strings.TrimSpace(string(output)))
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	sort.Slice(paths, func(i, j int) bool { return renderedPageNumber(paths[i]) < renderedPageNumber(paths[j]) })
+
+	resp := &RenderResponse{PageCount: pageCount, DPI: dpi, Pages: []RenderedPage{}}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRenderFailed, err)
+		}
+		config, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: page %d: %v", ErrRenderFailed, renderedPageNumber(path), err)
+		}
+		resp.Pages = append(resp.Pages, RenderedPage{
+			Page:    renderedPageNumber(path),
+			Width:   config.Width,
+			Height:  config.Height,
+			PngData: base64.StdEncoding.EncodeToString(data),
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePdftoppm writes one PNG per page, zero-padded like pdftoppm does for
+// documents of 10+ pages, or only the first page under -f 1 -l 1.
+const fakePdftoppm = `case " $* " in
+*" -l 1 "*) printf 'png page 1' > page-01.png ;;
+*) for n in 01 02 10; do printf "png page $n" > "page-$n.png"; done ;;
+esac
+`
+
+// fakePdf2svg writes the page its third argument selects to the file its
+// second names.
+const fakePdf2svg = `printf "<svg>$3</svg>" > "$2"
+`
+
+func TestCompileRendersFirstPageAsPNG(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript, "pdftoppm": fakePdftoppm})
+	startTestWorker(t)
+
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:        []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		OutputFormat: "PNG",
+	})
+	assertStatus(t, recorder, http.StatusOK)
+	if got := recorder.Header().Get("Content-Type"); got != "image/png" {
+		t.Fatalf("expected image/png, got %q", got)
+	}
+	if body := recorder.Body.String(); body != "png page 1" {
+		t.Fatalf("expected the first page, got %q", body)
+	}
+	if disposition := recorder.Header().Get("Content-Disposition"); !strings.Contains(disposition, "compiled-1.png") {
+		t.Fatalf("unexpected Content-Disposition %q", disposition)
+	}
+}
+
+func TestCompileRendersAllPagesInOrder(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript, "pdf2svg": fakePdf2svg, "pdfinfo": "echo 'Pages: 10'\n"})
+	startTestWorker(t)
+
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:          []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		OutputFormat:   "svg",
+		RenderAllPages: true,
+	})
+	assertStatus(t, recorder, http.StatusOK)
+
+	var resp CompileResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected a JSON envelope for every page: %v", err)
+	}
+	if resp.ArtifactMimeType != "image/svg+xml" || len(resp.Artifacts) != 10 {
+		t.Fatalf("expected 10 SVG pages, got %q with %d", resp.ArtifactMimeType, len(resp.Artifacts))
+	}
+	for i, artifact := range resp.Artifacts {
+		want := fmt.Sprintf("<svg>%d</svg>", i+1)
+		if page, _ := base64.StdEncoding.DecodeString(artifact); string(page) != want {
+			t.Fatalf("page %d: expected %q, got %q", i+1, want, page)
+		}
+	}
+}
+
+func TestCompileRendersAtMostMaxRenderPages(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript, "pdf2svg": fakePdf2svg, "pdfinfo": "echo 'Pages: 2000'\n"})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{OutputFormat: OutputFormatSVG, RenderAllPages: true})
+	if !result.Success || len(result.Artifacts) != MaxRenderPages {
+		t.Fatalf("expected %d rendered pages, got success=%v with %d: %s", MaxRenderPages, result.Success, len(result.Artifacts), result.ErrorMessage)
+	}
+}
+
+func TestRenderWithoutConverterKeepsPDF(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	if _, err := exec.LookPath("pdf2svg"); err == nil {
+		t.Skip("pdf2svg is installed")
+	}
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{OutputFormat: OutputFormatSVG})
+	if result.Success || result.ErrorCode != "RENDER_UNAVAILABLE" {
+		t.Fatalf("expected RENDER_UNAVAILABLE, got success=%v code=%q", result.Success, result.ErrorCode)
+	}
+	if len(result.PDFData) == 0 {
+		t.Fatalf("expected the PDF to be kept as a partial result")
+	}
+}
+
+func TestCompileRejectsUnknownOutputFormat(t *testing.T) {
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:        []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+		OutputFormat: "jpeg",
+	})
+	assertStatus(t, recorder, http.StatusBadRequest)
+}
+
+// fakePdftoppmRange copies $FAKE_PNG to page-N.png for each page from -f to
+// -l, and fakePdfinfo reports a 3-page PDF.
+const (
+	fakePdftoppmRange = `while [ $# -gt 0 ]; do
+	case "$1" in
+	-f) first=$2; shift ;;
+	-l) last=$2; shift ;;
+	esac
+	shift
+done
+n=$first
+while [ "$n" -le "$last" ]; do cp "$FAKE_PNG" "page-$n.png"; n=$((n+1)); done
+`
+	fakePdfinfo = "echo 'Producer: pdfTeX'\necho 'Pages:          3'\n"
+)
+
+func TestRenderHandlerReturnsPageRange(t *testing.T) {
+	installFakeTools(t, map[string]string{"pdftoppm": fakePdftoppmRange, "pdfinfo": fakePdfinfo})
+
+	var page bytes.Buffer
+	if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 85, 110))); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(t.TempDir(), "page.png")
+	if err := os.WriteFile(pngPath, page.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_PNG", pngPath)
+
+	pdf := base64.StdEncoding.EncodeToString([]byte("%PDF-1.5\n%fake\n"))
+	recorder := performJSON(t, http.MethodPost, "/render", RenderHandler, RenderRequest{PdfData: pdf, FirstPage: 2, LastPage: 3, DPI: 72})
+	assertStatus(t, recorder, http.StatusOK)
+
+	var resp RenderResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.PageCount != 3 || resp.DPI != 72 || len(resp.Pages) != 2 {
+		t.Fatalf("expected pages 2-3 of 3, got %+v", resp)
+	}
+	for i, rendered := range resp.Pages {
+		if rendered.Page != i+2 || rendered.Width != 85 || rendered.Height != 110 || rendered.PngData == "" {
+			t.Fatalf("unexpected page %+v", rendered)
+		}
+	}
+
+	recorder = performJSON(t, http.MethodPost, "/render", RenderHandler, RenderRequest{PdfData: pdf, FirstPage: 2, LastPage: 5})
+	assertStatus(t, recorder, http.StatusBadRequest)
+	var errResp ErrorResponse
+	json.Unmarshal(recorder.Body.Bytes(), &errResp)
+	if errResp.Code != "INVALID_PAGE_RANGE" || !strings.Contains(errResp.Message, "the PDF has 3 page(s)") {
+		t.Fatalf("expected a page range error naming the page count, got %+v", errResp)
+	}
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// sandboxesShellEscape reports whether the toolchain runs in a throwaway copy
+// of the workspace. Under SAFE_MODE this keeps the build outputs of a
+// shell-escape document (minted caches, pythontex files, ...) out of the
+// cached workspace, where they could poison later builds. It is not a
+// security boundary: the copy runs as the same user under the same temp root,
+// so commands can still reach the workspace by absolute path.
+func (s *compileSession) sandboxesShellEscape() bool {
+	return safeMode && s.requiresShellEscape && s.projectID != ""
+}
+
+// enterSandbox writes the sources into a fresh directory and points the
+// session at it. The cached workspace is only touched again by leaveSandbox,
+// which imports the PDF and SyncTeX file.
+func (s *compileSession) enterSandbox() *CompileResult {
+	dir, err := os.MkdirTemp("", "latex-sandbox-*")
+	if err != nil {
+		return s.failWrite("Failed to create sandbox directory", err)
+	}
+	if err := applyTempDirMode(dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return s.failWrite("Failed to set sandbox directory mode", err)
+	}
+	if err := createFileStructure(dir, s.files); err != nil {
+		_ = os.RemoveAll(dir)
+		return s.failWrite("Failed to write files", err)
+	}
+
+	s.sandboxedFrom = s.tempDir
+	s.moveWorkspace(dir)
+	// The sandbox has none of the workspace's auxiliary files, so every pass
+	// and the bibliography run as in a fresh build
+	s.isIncremental = false
+	s.includeOnly = nil
+
+	log.Printf("[%s] Shell escape under safe mode: compiling in sandbox %s", s.compiler.RequestID, dir)
+	return nil
+}
+
+// leaveSandbox copies the PDF (when it is one) and SyncTeX file back into the
+// cached workspace and removes the sandbox
+func (s *compileSession) leaveSandbox() {
+	if s.sandboxedFrom == "" {
+		return
+	}
+	sandbox := s.tempDir
+	pdfPath, synctexPath := s.pdfPath, s.synctexPath()
+
+	s.moveWorkspace(s.sandboxedFrom)
+	s.sandboxedFrom = ""
+
+	if pdf, err := os.ReadFile(pdfPath); err == nil && bytes.HasPrefix(pdf, []byte("%PDF")) {
+		s.importSandboxOutput(s.pdfPath, pdf)
+		if synctex, err := os.ReadFile(synctexPath); err == nil {
+			s.importSandboxOutput(s.synctexPath(), synctex)
+		}
+	}
+
+	if err := os.RemoveAll(sandbox); err != nil {
+		log.Printf("[%s] Warning: failed to remove sandbox %s: %v", s.compiler.RequestID, sandbox, err)
+	}
+}
+
+func (s *compileSession) importSandboxOutput(path string, data []byte) {
+	if err := os.WriteFile(path, data, fileMode); err != nil {
+		log.Printf("[%s] Warning: failed to import %s from the sandbox: %v", s.compiler.RequestID, filepath.Base(path), err)
+	}
+}
+
+// moveWorkspace rebases the session's workspace paths onto dir
+func (s *compileSession) moveWorkspace(dir string) {
+	rebase := func(path string) string {
+		rel, err := filepath.Rel(s.tempDir, path)
+		if err != nil {
+			return path
+		}
+		return filepath.Join(dir, rel)
+	}
+	s.texFilePath = rebase(s.texFilePath)
+	s.pdfPath = rebase(s.pdfPath)
+	s.logPath = rebase(s.logPath)
+	s.tempDir = dir
+}
+
+// workspaceDir is the directory the project's cache entry keeps: the cached
+// workspace, also while the toolchain runs in a sandbox
+func (s *compileSession) workspaceDir() string {
+	if s.sandboxedFrom != "" {
+		return s.sandboxedFrom
+	}
+	return s.tempDir
+}
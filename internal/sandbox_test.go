@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeShellEscapeLatexmk builds like fakeLatexmkScript, plus the side effects
+// a \write18 command could have: a stray file and a tampered .aux
+var fakeShellEscapeLatexmk = fakeLatexmkScript + `echo planted > escaped.txt
+echo '\relax tampered' > "$job.aux"
+`
+
+func TestSandboxedShellEscapeLeavesCachedWorkspaceUnmodified(t *testing.T) {
+	SetSafeMode(true)
+	t.Cleanup(func() { SetSafeMode(false) })
+	installFakeTools(t, map[string]string{"latexmk": fakeShellEscapeLatexmk})
+	projectID := "sandboxed-shell-escape-test"
+	forgetProject(t, projectID)
+
+	files := []FileEntry{{Path: "main.tex", Content: "\\documentclass{article}\n\\usepackage{minted}\n\\begin{document}\nx\n\\end{document}"}}
+	compile := func() *CompileResult {
+		result := New().Compile(files, time.Now(), projectID, CompileOptions{})
+		if !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+		return result
+	}
+	compile()
+
+	entry, _ := GetCache().Get(projectID)
+	if entry == nil || entry.TempDir == "" {
+		t.Fatalf("expected the project's workspace to be cached")
+	}
+	before := workspaceSnapshot(t, entry.TempDir)
+	want := map[string]string{"main.tex": files[0].Content, "main.pdf": "%PDF-1.4\n%fake\n"}
+	if !reflect.DeepEqual(before, want) {
+		t.Fatalf("expected only the sources and the imported PDF, got %v", before)
+	}
+
+	// A rebuild of the cached workspace must not see or keep side effects
+	files[0].Content += "\n"
+	result := New().Compile(files, time.Now(), projectID, CompileOptions{})
+	if !result.Success {
+		t.Fatalf("expected incremental compile to succeed, got: %s", result.ErrorMessage)
+	}
+	entry, _ = GetCache().Get(projectID)
+	after := workspaceSnapshot(t, entry.TempDir)
+	want["main.tex"] = files[0].Content
+	if !reflect.DeepEqual(after, want) {
+		t.Fatalf("shell escape modified the cached workspace: %v", after)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(os.TempDir(), "latex-sandbox-*"))
+	for _, dir := range matches {
+		if _, err := os.Stat(filepath.Join(dir, "main.tex")); err == nil {
+			t.Fatalf("expected the sandbox to be removed, found %s", dir)
+		}
+	}
+}
+
+// workspaceSnapshot maps each file under dir to its content
+func workspaceSnapshot(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	snapshot := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		snapshot[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read workspace %s: %v", dir, err)
+	}
+	return snapshot
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+var (
+	// fileLineErrorPattern matches errors printed under -file-line-error,
+	// e.g. "./main.tex:5: Undefined control sequence."
+	fileLineErrorPattern = regexp.MustCompile(`^(\S[^:]*\.\w+):(\d+): (.+)$`)
+	// logWarningPattern matches the first line of a LaTeX, package, or class
+	// warning, e.g. "Package hyperref Warning: Token not allowed in a PDF string"
+	logWarningPattern = regexp.MustCompile(`^(LaTeX(?: Font)?|Package (\S+)|Class (\S+)) Warning: (.*)$`)
+	// continuationPrefixPattern matches the "(hyperref)" indent of a warning's
+	// continuation lines
+	continuationPrefixPattern = regexp.MustCompile(`^\([^)]*\)\s*`)
+	inputLinePattern          = regexp.MustCompile(`on input line (\d+)`)
+	// boxWarningPattern matches overfull/underfull box reports, e.g.
+	// "Overfull \hbox (12.3pt too wide) in paragraph at lines 7--9"
+	boxWarningPattern = regexp.MustCompile(`^(Overfull|Underfull) \\([hv])box \([^)]*\)(?:.* at lines? (\d+))?`)
+)
+
+// sarifRuleDescriptions describes the fixed rule IDs; package/<name> and
+// class/<name> rules are described from their name
+var sarifRuleDescriptions = map[string]string{
+	"latex/error":               "LaTeX error",
+	"latex/warning":             "LaTeX warning",
+	"latex/undefined-reference": "Reference to an undefined label",
+	"latex/undefined-citation":  "Citation of an undefined key",
+	"latex/rerun":               "Cross-references need another pass",
+	"latex/font":                "Font substitution",
+	"latex/overfull-hbox":       "Overfull horizontal box",
+	"latex/overfull-vbox":       "Overfull vertical box",
+	"latex/underfull-hbox":      "Underfull horizontal box",
+	"latex/underfull-vbox":      "Underfull vertical box",
+}
+
+// logDiagnostic is one error or warning found in a LaTeX log
+type logDiagnostic struct {
+	Rule    string
+	Level   string // SARIF level: "error", "warning", or "note"
+	Message string
+	File    string // Relative to the main file's directory; "" for the main file
+	Line    int
+}
+
+// parseLogDiagnostics collects the errors and warnings of a LaTeX log.
+// Warnings do not name their file, so they are attributed to the main file.
+func parseLogDiagnostics(logContent string) []logDiagnostic {
+	var diagnostics []logDiagnostic
+	lines := strings.Split(unwrapLogLines(logContent), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+
+		if m := fileLineErrorPattern.FindStringSubmatch(line); m != nil {
+			lineNo, _ := strconv.Atoi(m[2])
+			diagnostics = append(diagnostics, logDiagnostic{
+				Rule:    "latex/error",
+				Level:   "error",
+				Message: m[3],
+				File:    strings.TrimPrefix(m[1], "./"),
+				Line:    lineNo,
+			})
+			continue
+		}
+
+		if m := logWarningPattern.FindStringSubmatch(line); m != nil {
+			message := m[4]
+			// Continuation lines are indented under "(package)" or spaces
+			for i+1 < len(lines) && isWarningContinuation(lines[i+1]) {
+				i++
+				message += " " + continuationPrefixPattern.ReplaceAllString(strings.TrimSpace(lines[i]), "")
+			}
+			diagnostics = append(diagnostics, logDiagnostic{
+				Rule:    warningRule(m[1], m[2], m[3], message),
+				Level:   "warning",
+				Message: message,
+				Line:    inputLine(message),
+			})
+			continue
+		}
+
+		if m := boxWarningPattern.FindStringSubmatch(line); m != nil {
+			level := "warning"
+			if m[1] == "Underfull" {
+				level = "note"
+			}
+			lineNo, _ := strconv.Atoi(m[3])
+			diagnostics = append(diagnostics, logDiagnostic{
+				Rule:    "latex/" + strings.ToLower(m[1]) + "-" + m[2] + "box",
+				Level:   level,
+				Message: line,
+				Line:    lineNo,
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+func isWarningContinuation(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && (strings.HasPrefix(trimmed, "(") || strings.HasPrefix(line, "    "))
+}
+
+// warningRule maps a warning to its rule ID from its origin and message
+func warningRule(origin, pkg, class, message string) string {
+	// natbib reports undefined citations in LaTeX's own words
+	switch {
+	case strings.HasPrefix(message, "Reference `") && strings.Contains(message, "undefined"):
+		return "latex/undefined-reference"
+	case strings.HasPrefix(message, "Citation `") && strings.Contains(message, "undefined"):
+		return "latex/undefined-citation"
+	case pkg != "":
+		return "package/" + pkg
+	case class != "":
+		return "class/" + class
+	case origin == "LaTeX Font":
+		return "latex/font"
+	case strings.Contains(message, "Rerun to get"):
+		return "latex/rerun"
+	default:
+		return "latex/warning"
+	}
+}
+
+func inputLine(message string) int {
+	if m := inputLinePattern.FindStringSubmatch(message); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+	return 0
+}
+
+// buildSarif serializes log diagnostics as a SARIF 2.1.0 log. mainFile is the
+// main file's slash-separated path in the project; other files are resolved
+// relative to its directory.
+func buildSarif(diagnostics []logDiagnostic, mainFile string) *SarifLog {
+	run := SarifRun{Results: []SarifResult{}}
+	run.Tool.Driver.Name = "octree-compile"
+	ruleIndex := map[string]int{}
+
+	for _, d := range diagnostics {
+		index, ok := ruleIndex[d.Rule]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			ruleIndex[d.Rule] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, SarifRule{
+				ID:               d.Rule,
+				ShortDescription: SarifMessage{Text: ruleDescription(d.Rule)},
+			})
+		}
+
+		uri := mainFile
+		if d.File != "" {
+			uri = path.Join(path.Dir(mainFile), filepath.ToSlash(d.File))
+		}
+		location := SarifLocation{}
+		location.PhysicalLocation.ArtifactLocation.URI = uri
+		if d.Line > 0 {
+			location.PhysicalLocation.Region = &SarifRegion{StartLine: d.Line}
+		}
+
+		run.Results = append(run.Results, SarifResult{
+			RuleID:    d.Rule,
+			RuleIndex: index,
+			Level:     d.Level,
+			Message:   SarifMessage{Text: d.Message},
+			Locations: []SarifLocation{location},
+		})
+	}
+
+	return &SarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []SarifRun{run}}
+}
+
+func ruleDescription(rule string) string {
+	if description, ok := sarifRuleDescriptions[rule]; ok {
+		return description
+	}
+	kind, name, _ := strings.Cut(rule, "/")
+	return "Warning from the " + name + " " + kind
+}
+
+// sarif builds the SARIF log of the compile's final log when requested
+func (s *compileSession) sarif(logContent string) *SarifLog {
+	if !s.options.ReturnSarif {
+		return nil
+	}
+	mainFile, err := filepath.Rel(s.tempDir, s.texFilePath)
+	if err != nil {
+		mainFile = filepath.Base(s.texFilePath)
+	}
+	return buildSarif(parseLogDiagnostics(logContent), filepath.ToSlash(mainFile))
+}
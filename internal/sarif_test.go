@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sarifLog = `This is pdfTeX, Version 3.141592653-2.6-1.40.25
+(./main.tex
+LaTeX2e <2023-11-01>
+Package hyperref Warning: Token not allowed in a PDF string (Unicode):
+(hyperref)                removing ` + "`" + `math shift' on input line 12.
+
+LaTeX Warning: Reference ` + "`fig:missing'" + ` on page 1 undefined on input line 20.
+
+Overfull \hbox (12.3pt too wide) in paragraph at lines 31--33
+./chapters/intro.tex:7: Undefined control sequence.
+l.7 \foo
+`
+
+func TestParseLogDiagnostics(t *testing.T) {
+	diagnostics := parseLogDiagnostics(sarifLog)
+	want := []logDiagnostic{
+		{Rule: "package/hyperref", Level: "warning", Line: 12},
+		{Rule: "latex/undefined-reference", Level: "warning", Line: 20},
+		{Rule: "latex/overfull-hbox", Level: "warning", Line: 31},
+		{Rule: "latex/error", Level: "error", File: "chapters/intro.tex", Line: 7},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %+v", len(want), diagnostics)
+	}
+	for i, w := range want {
+		d := diagnostics[i]
+		if d.Rule != w.Rule || d.Level != w.Level || d.File != w.File || d.Line != w.Line {
+			t.Fatalf("diagnostic %d: expected %+v, got %+v", i, w, d)
+		}
+	}
+	if !strings.Contains(diagnostics[0].Message, "removing `math shift'") {
+		t.Fatalf("expected the continuation line in the message, got %q", diagnostics[0].Message)
+	}
+}
+
+func TestSarifOutputShape(t *testing.T) {
+	data, err := json.Marshal(buildSarif(parseLogDiagnostics(sarifLog), "paper/main.tex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["version"] != "2.1.0" || !strings.Contains(doc["$schema"].(string), "sarif-2.1.0") {
+		t.Fatalf("expected a SARIF 2.1.0 header, got %s", data)
+	}
+
+	run := doc["runs"].([]interface{})[0].(map[string]interface{})
+	driver := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})
+	if driver["name"] != "octree-compile" {
+		t.Fatalf("expected the tool driver to be named, got %v", driver["name"])
+	}
+	rules := driver["rules"].([]interface{})
+	results := run["results"].([]interface{})
+	if len(rules) != 4 || len(results) != 4 {
+		t.Fatalf("expected 4 rules and 4 results, got %s", data)
+	}
+
+	reference := results[1].(map[string]interface{})
+	if reference["ruleId"] != "latex/undefined-reference" || reference["level"] != "warning" {
+		t.Fatalf("unexpected result %v", reference)
+	}
+	if rules[int(reference["ruleIndex"].(float64))].(map[string]interface{})["id"] != reference["ruleId"] {
+		t.Fatalf("expected ruleIndex to point at the result's rule")
+	}
+	if reference["message"].(map[string]interface{})["text"] == "" {
+		t.Fatalf("expected a message text")
+	}
+	location := reference["locations"].([]interface{})[0].(map[string]interface{})["physicalLocation"].(map[string]interface{})
+	if uri := location["artifactLocation"].(map[string]interface{})["uri"]; uri != "paper/main.tex" {
+		t.Fatalf("expected the warning on the main file, got %v", uri)
+	}
+	if line := location["region"].(map[string]interface{})["startLine"]; line != float64(20) {
+		t.Fatalf("expected startLine 20, got %v", line)
+	}
+
+	failure := results[3].(map[string]interface{})["locations"].([]interface{})[0].(map[string]interface{})
+	if uri := failure["physicalLocation"].(map[string]interface{})["artifactLocation"].(map[string]interface{})["uri"]; uri != "paper/chapters/intro.tex" {
+		t.Fatalf("expected the error resolved against the main file's directory, got %v", uri)
+	}
+}
+
+func TestCompileReturnsSarif(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithLog(sarifLog)})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnSarif: true})
+	if !result.Success {
+		t.Fatalf("expected success: %s", result.ErrorMessage)
+	}
+	if result.Sarif == nil || len(result.Sarif.Runs[0].Results) != 4 {
+		t.Fatalf("expected 4 SARIF results, got %+v", result.Sarif)
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+)
+
+// safeMode enables source checks that block known ways for a document to
+// reach outside its workspace
+var safeMode bool
+
+// SetSafeMode enables or disables safe-mode source checks
+func SetSafeMode(enabled bool) {
+	safeMode = enabled
+}
+
+// pipedInputPattern matches \input{|"cmd"}, \input|cmd, \openin1=|cmd and
+// similar piped-input forms that make TeX run a shell command, including
+// through LaTeX's internal names for the primitive, \@@input and \@input
+var pipedInputPattern = regexp.MustCompile(`\\(?:@{0,2}input|include|InputIfFileExists|openin\s*(?:\\[A-Za-z@]+|\d+)\s*=?)\s*\{?\s*"?\|`)
+
+// absolutePathPattern matches file inclusions whose argument is an absolute
+// path (/etc/passwd, ~/.ssh/id_rsa, C:\...), e.g. \input{/etc/passwd},
+// \input /etc/passwd or \includegraphics[width=1cm]{/home/x.png}
+var absolutePathPattern = regexp.MustCompile(`\\(?:input|include|InputIfFileExists|includegraphics|includepdf|includesvg|lstinputlisting|verbatiminput)\*?\s*(?:\[[^\]]*\]\s*)?(?:\{\s*"?|\s+)(?:/|~|[A-Za-z]:[\\/])`)
+
+// findPipedInput returns the file and line of the first piped-input attempt
+func findPipedInput(files []FileEntry) (string, int) {
+	return findSourcePattern(files, pipedInputPattern)
+}
+
+// findAbsolutePathInput returns the file and line of the first inclusion of
+// an absolute path; projects only ever include files from their workspace
+func findAbsolutePathInput(files []FileEntry) (string, int) {
+	return findSourcePattern(files, absolutePathPattern)
+}
+
+// findSourcePattern returns the file and line of the first match of pattern
+// in the TeX sources, ignoring comments
+func findSourcePattern(files []FileEntry, pattern *regexp.Regexp) (string, int) {
+	for _, file := range files {
+		if file.Encoding == "base64" || !shouldInspectForEngine(file.Path) {
+			continue
+		}
+		content := stripTeXComments(file.Content)
+		if loc := pattern.FindStringIndex(content); loc != nil {
+			return file.Path, lineNumberAt(content, loc[0])
+		}
+	}
+	return "", 0
+}
+
+// safeModeEnv makes kpathsea refuse to open files by absolute path, in parent
+// directories, or starting with a dot, catching reads the source scan cannot
+// see (paths built by macros)
+var safeModeEnv = []string{"openin_any=p", "openout_any=p"}
+
+// enforceSafeMode rejects sources that try to run or read outside the sandbox
+func (s *compileSession) enforceSafeMode() *CompileResult {
+	if !safeMode {
+		return nil
+	}
+
+	if path, line := findPipedInput(s.files); path != "" {
+		log.Printf("[%s] Rejecting request: piped input in %s:%d", s.compiler.RequestID, path, line)
+		return s.compiler.failWith(s.metadata, fmt.Errorf("%w at %s:%d", ErrPipedInput, path, line), s.queueMs, s.receivedAt)
+	}
+
+	if path, line := findAbsolutePathInput(s.files); path != "" {
+		log.Printf("[%s] Rejecting request: absolute input path in %s:%d", s.compiler.RequestID, path, line)
+		return s.compiler.failWith(s.metadata, fmt.Errorf("%w at %s:%d", ErrAbsolutePath, path, line), s.queueMs, s.receivedAt)
+	}
+
+	return nil
+}
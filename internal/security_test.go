@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafeModeBlocksPipedInput(t *testing.T) {
+	SetSafeMode(true)
+	t.Cleanup(func() { SetSafeMode(false) })
+
+	attempts := []string{
+		`\input{|"cat /etc/passwd"}`,
+		`\input|ls`,
+		`\makeatletter\@@input|"cat /etc/passwd"`,
+		`\makeatletter \@input{|"id"}`,
+		`\immediate\openin5=|"id"`,
+		`\openin\myfile = |"whoami"`,
+	}
+
+	for _, attempt := range attempts {
+		files := []FileEntry{{Path: "main.tex", Content: "\\documentclass{article}\n\\begin{document}\n" + attempt + "\n\\end{document}"}}
+		result := New().Compile(files, time.Now(), "", CompileOptions{})
+		if result.Success || result.ErrorCode != "PIPED_INPUT" {
+			t.Fatalf("expected %q to be blocked, got success=%v code=%q", attempt, result.Success, result.ErrorCode)
+		}
+		if !strings.Contains(result.ErrorMessage, "main.tex:3") {
+			t.Fatalf("expected location main.tex:3 in %q", result.ErrorMessage)
+		}
+	}
+}
+
+func TestPipedInputIgnoresRegularInputAndComments(t *testing.T) {
+	files := []FileEntry{{Path: "main.tex", Content: "\\input{chapter1}\n% \\input{|\"ls\"}\n\\openin1=data.txt"}}
+	if path, _ := findPipedInput(files); path != "" {
+		t.Fatalf("did not expect piped input to be detected")
+	}
+}
+
+func TestSafeModeBlocksAbsolutePathInput(t *testing.T) {
+	SetSafeMode(true)
+	t.Cleanup(func() { SetSafeMode(false) })
+
+	attempts := []string{
+		`\input{/etc/passwd}`,
+		`\input /etc/passwd`,
+		`\include{ /root/notes}`,
+		`\includegraphics[width=\linewidth]{/var/lib/secret.png}`,
+		`\lstinputlisting{~/.ssh/id_rsa}`,
+	}
+
+	for _, attempt := range attempts {
+		files := []FileEntry{{Path: "main.tex", Content: "\\documentclass{article}\n\\begin{document}\n" + attempt + "\n\\end{document}"}}
+		result := New().Compile(files, time.Now(), "", CompileOptions{})
+		if result.Success || result.ErrorCode != "ABSOLUTE_PATH" {
+			t.Fatalf("expected %q to be blocked, got success=%v code=%q", attempt, result.Success, result.ErrorCode)
+		}
+		if !strings.Contains(result.ErrorMessage, "main.tex:3") {
+			t.Fatalf("expected location main.tex:3 in %q", result.ErrorMessage)
+		}
+	}
+}
+
+func TestAbsolutePathInputAllowsRelativePaths(t *testing.T) {
+	files := []FileEntry{{Path: "main.tex", Content: "\\input{chapters/intro}\n\\includegraphics{figures/plot.pdf}\n% \\input{/etc/passwd}"}}
+	if path, _ := findAbsolutePathInput(files); path != "" {
+		t.Fatalf("did not expect an absolute path to be detected")
+	}
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// selfTestSourceDateEpoch pins the fixture's timestamps so its PDF is
+// byte-for-byte reproducible on a given toolchain
+const selfTestSourceDateEpoch = 1700000000
+
+// selfTestDocument exercises the engine, fonts, math, and cross-references.
+// \pdftrailerid{} drops the otherwise time-derived trailer /ID.
+const selfTestDocument = `\pdftrailerid{}
+\documentclass{article}
+\begin{document}
+\section{Self test}\label{sec:self}
+Section~\ref{sec:self}: $e^{i\pi} + 1 = 0$.
+\end{document}
+`
+
+// selfTestExpectedSHA256 is the fixture PDF hash expected on this deployment's
+// toolchain; empty only checks that the compile succeeds
+var selfTestExpectedSHA256 string
+
+// SetSelfTestExpectedSHA256 sets the SHA256 /selftest compares against
+func SetSelfTestExpectedSHA256(sha string) {
+	selfTestExpectedSHA256 = strings.ToLower(strings.TrimSpace(sha))
+}
+
+// SelfTestHandler compiles a built-in fixture through the queue and worker and
+// reports pass/fail with timing, for deployment smoke tests
+func SelfTestHandler(c *gin.Context) {
+	job := &CompileJob{
+		Context: c,
+		Files:   []FileEntry{{Path: "main.tex", Content: selfTestDocument}},
+		Options: CompileOptions{
+			SourceDateEpoch: selfTestSourceDateEpoch,
+		},
+		EnqueuedAt: time.Now(),
+		ResultChan: make(chan *CompileResult, 1),
+	}
+
+	result, err := submitJob(job)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, SelfTestResponse{
+			Status: "fail",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	resp := SelfTestResponse{
+		Status:         "pass",
+		RequestID:      result.RequestID,
+		QueueMs:        result.QueueMs,
+		DurationMs:     result.DurationMs,
+		SHA256:         result.SHA256,
+		ExpectedSHA256: selfTestExpectedSHA256,
+	}
+
+	switch {
+	case !result.Success:
+		resp.Status = "fail"
+		resp.Error = result.ErrorMessage
+	case selfTestExpectedSHA256 != "" && result.SHA256 != selfTestExpectedSHA256:
+		resp.Status = "fail"
+		resp.Error = fmt.Sprintf("PDF SHA256 %s does not match the expected %s", result.SHA256, selfTestExpectedSHA256)
+	}
+
+	status := http.StatusOK
+	if resp.Status != "pass" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func performSelfTest(t *testing.T) (*SelfTestResponse, int) {
+	t.Helper()
+
+	recorder := performJSON(t, http.MethodGet, "/selftest", SelfTestHandler, nil)
+	var resp SelfTestResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return &resp, recorder.Code
+}
+
+func TestSelfTestPassesOnHealthyToolchain(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	// The fake latexmk always writes the same PDF bytes
+	hash := sha256.Sum256([]byte("%PDF-1.4\n%fake\n"))
+	SetSelfTestExpectedSHA256(hex.EncodeToString(hash[:]))
+	t.Cleanup(func() { SetSelfTestExpectedSHA256("") })
+
+	resp, status := performSelfTest(t)
+	if status != http.StatusOK || resp.Status != "pass" {
+		t.Fatalf("expected self test to pass, got HTTP %d: %+v", status, resp)
+	}
+	if resp.SHA256 != resp.ExpectedSHA256 || resp.RequestID == "" {
+		t.Fatalf("unexpected self test response: %+v", resp)
+	}
+}
+
+func TestSelfTestFailsOnHashMismatch(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	SetSelfTestExpectedSHA256("0000")
+	t.Cleanup(func() { SetSelfTestExpectedSHA256("") })
+
+	resp, status := performSelfTest(t)
+	if status != http.StatusServiceUnavailable || resp.Status != "fail" || resp.Error == "" {
+		t.Fatalf("expected self test to fail on hash mismatch, got HTTP %d: %+v", status, resp)
+	}
+}
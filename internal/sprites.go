@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SpriteCellWidth is the width in pixels each page is scaled to
+	SpriteCellWidth = 160
+	// SpriteSheetColumns is the number of cells per sprite sheet row
+	SpriteSheetColumns = 5
+	// MaxSpritePages bounds the pages tiled into a sprite sheet; later pages
+	// are left out
+	MaxSpritePages = 100
+)
+
+// spriteSheet tiles thumbnails of the PDF's pages into one PNG, row by row.
+// Pages of other sizes than the first are drawn at the top left of their
+// cell, which is as large as the largest page.
+func (s *compileSession) spriteSheet(pdf []byte) (*SpriteSheet, error) {
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		return nil, fmt.Errorf("%w: pdftoppm is not installed", ErrRenderUnavailable)
+	}
+
+	dir, err := os.MkdirTemp("", "sprites-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRenderFailed, err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "input.pdf"), pdf, 0600); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRenderFailed, err)
+	}
+
+	cmd := s.command("pdftoppm", "-png", "-scale-to-x", strconv.Itoa(SpriteCellWidth), "-scale-to-y", "-1",
+		"-f", "1", "-l", strconv.Itoa(MaxSpritePages), "input.pdf", "page")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%w: pdftoppm: %v: %s", ErrRenderFailed, err, strings.TrimSpace(string(output)))
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: no pages rendered", ErrRenderFailed)
+	}
+	sort.Slice(paths, func(i, j int) bool { return renderedPageNumber(paths[i]) < renderedPageNumber(paths[j]) })
+
+	pages := make([]image.Image, 0, len(paths))
+	cellWidth, cellHeight := 0, 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRenderFailed, err)
+		}
+		page, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: page %d: %v", ErrRenderFailed, renderedPageNumber(path), err)
+		}
+		pages = append(pages, page)
+		cellWidth = max(cellWidth, page.Bounds().Dx())
+		cellHeight = max(cellHeight, page.Bounds().Dy())
+	}
+
+	columns := min(len(pages), SpriteSheetColumns)
+	rows := (len(pages) + columns - 1) / columns
+	sheet := image.NewRGBA(image.Rect(0, 0, columns*cellWidth, rows*cellHeight))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for i, page := range pages {
+		origin := image.Pt(i%columns*cellWidth, i/columns*cellHeight)
+		draw.Draw(sheet, page.Bounds().Sub(page.Bounds().Min).Add(origin), page, page.Bounds().Min, draw.Src)
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, sheet); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRenderFailed, err)
+	}
+
+	log.Printf("[%s] Tiled %d page(s) into a %dx%d sprite sheet", s.compiler.RequestID, len(pages), columns, rows)
+	return &SpriteSheet{
+		PngData:    base64.StdEncoding.EncodeToString(encoded.Bytes()),
+		Pages:      len(pages),
+		Columns:    columns,
+		Rows:       rows,
+		CellWidth:  cellWidth,
+		CellHeight: cellHeight,
+	}, nil
+}
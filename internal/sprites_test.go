@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakePdftoppmThumbnails renders a 3-page PDF by copying $FAKE_PNG.
+const fakePdftoppmThumbnails = `for n in 1 2 3; do cp "$FAKE_PNG" "page-$n.png"; done
+`
+
+func TestCompileReturnsSpriteSheet(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript, "pdftoppm": fakePdftoppmThumbnails})
+	startTestWorker(t)
+
+	var thumbnail bytes.Buffer
+	if err := png.Encode(&thumbnail, image.NewGray(image.Rect(0, 0, 160, 207))); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(t.TempDir(), "page.png")
+	if err := os.WriteFile(pngPath, thumbnail.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_PNG", pngPath)
+
+	threePages := "\\documentclass{article}\n\\begin{document}\nOne\\newpage Two\\newpage Three\n\\end{document}"
+	recorder := performJSON(t, http.MethodPost, "/compile", CompileHandler, CompileRequest{
+		Files:       []FileEntry{{Path: "main.tex", Content: threePages}},
+		SpriteSheet: true,
+	})
+	assertStatus(t, recorder, http.StatusOK)
+
+	var resp CompileResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected a JSON envelope with the sprite sheet: %v", err)
+	}
+	sheet := resp.SpriteSheet
+	if sheet == nil || resp.PdfBuffer == "" {
+		t.Fatalf("expected the PDF and a sprite sheet, got %+v", resp)
+	}
+	if sheet.Pages != 3 || sheet.Columns != 3 || sheet.Rows != 1 || sheet.CellWidth != 160 || sheet.CellHeight != 207 {
+		t.Fatalf("expected 3 cells of 160x207 in one row, got %+v", sheet)
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(sheet.PngData)
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("sprite sheet is not a PNG: %v", err)
+	}
+	if config.Width != 3*160 || config.Height != 207 {
+		t.Fatalf("expected a 480x207 sheet, got %dx%d", config.Width, config.Height)
+	}
+}
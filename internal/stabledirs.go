@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// stableTempDirs gives each project a fixed workspace path instead of a
+// random one, so its builds can be inspected across requests
+var stableTempDirs bool
+
+// SetStableTempDirs enables or disables deterministic project workspaces
+func SetStableTempDirs(enabled bool) {
+	stableTempDirs = enabled
+}
+
+var stableDirUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// maxStableDirNameChars bounds the readable part of a stable directory name
+const maxStableDirNameChars = 64
+
+// stableTempDir returns the workspace path of a (namespaced) project ID: a
+// single directory under the temp root, named after the ID's safe characters
+// and a hash of the full ID so distinct IDs never share it
+func stableTempDir(projectID string) string {
+	name := strings.Trim(stableDirUnsafeChars.ReplaceAllString(projectID, "_"), "_")
+	if len(name) > maxStableDirNameChars {
+		name = name[:maxStableDirNameChars]
+	}
+	sum := sha256.Sum256([]byte(projectID))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("latex-project-%s-%s", name, hex.EncodeToString(sum[:6])))
+}
+
+// newTempDir creates the session's workspace: a fresh random directory, or
+// the project's stable one when STABLE_TEMP_DIRS is set
+func (s *compileSession) newTempDir() (string, error) {
+	if !stableTempDirs || s.projectID == "" {
+		return os.MkdirTemp("", "latex-*")
+	}
+
+	// Only reached without a usable cached workspace, so whatever is left at
+	// the path (an old build, or a link planted in a shared temp root) goes
+	dir := stableTempDir(s.projectID)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	// Mkdir fails rather than follow anything recreated in between
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
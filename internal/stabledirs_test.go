@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStableTempDirStaysUnderTempRoot(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("TMPDIR", root)
+
+	for _, projectID := range []string{"../../etc", "team%2Fa/../b", "a b", "a_b"} {
+		dir := stableTempDir(projectID)
+		if filepath.Dir(dir) != root {
+			t.Fatalf("expected %q to map directly under %s, got %s", projectID, root, dir)
+		}
+	}
+	if stableTempDir("a b") == stableTempDir("a_b") {
+		t.Fatalf("expected IDs with the same safe characters to get distinct directories")
+	}
+}
+
+func TestStableTempDirsReuseProjectPath(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	t.Setenv("TMPDIR", t.TempDir())
+	SetStableTempDirs(true)
+	t.Cleanup(func() { SetStableTempDirs(false) })
+
+	const projectID = "stable-dirs-project"
+	forgetProject(t, CacheKey("tenant", projectID))
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	want := stableTempDir(CacheKey("tenant", projectID))
+
+	for i := 0; i < 2; i++ {
+		// ForceRebuild discards the workspace, so each build creates it anew
+		result := New().Compile(files, time.Now(), projectID, CompileOptions{CacheNamespace: "tenant", ForceRebuild: true})
+		if !result.Success {
+			t.Fatalf("build %d failed: %s", i, result.ErrorMessage)
+		}
+		entry, ok := GetCache().Get(CacheKey("tenant", projectID))
+		if !ok || entry.TempDir != want {
+			t.Fatalf("build %d: expected workspace %s, got %+v", i, want, entry)
+		}
+		if _, err := os.Stat(filepath.Join(want, "main.pdf")); err != nil {
+			t.Fatalf("build %d: expected the PDF in the stable workspace: %v", i, err)
+		}
+	}
+}
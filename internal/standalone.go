@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// standaloneSlots bounds the toolchain processes that endpoints outside the
+// compile queue (POST /render, /validate-bib, /detex) run at once; it holds
+// one slot per worker
+var standaloneSlots = make(chan struct{}, 1)
+
+// acquireStandaloneSlot waits up to EnqueueTimeout for a standalone slot,
+// failing with ErrEnqueueTimeout like a full compile queue. The returned
+// function frees the slot.
+func acquireStandaloneSlot(ctx context.Context) (func(), error) {
+	slots := standaloneSlots
+	timer := time.NewTimer(EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-timer.C:
+		return nil, ErrEnqueueTimeout
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %v", ErrEnqueueTimeout, ctx.Err())
+	}
+}
+
+// standaloneCommand builds a command for an endpoint outside the compile
+// queue, held to the same limits as a compile's toolchain: its own process
+// group, killed whole when ctx ends, under the server's CPU-time budget
+func standaloneCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if maxCpuSeconds > 0 {
+		name, args = ulimitCommand(maxCpuSeconds, name, args)
+	}
+	return groupCommand(ctx, name, args...)
+}
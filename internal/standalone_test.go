@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStandaloneCommandRunsUnderCompileLimits(t *testing.T) {
+	SetMaxCpuSeconds(7)
+	t.Cleanup(func() { SetMaxCpuSeconds(0) })
+
+	cmd := standaloneCommand(context.Background(), "pdftoppm", "-png", "input.pdf")
+	if !strings.Contains(strings.Join(cmd.Args, " "), "ulimit -t 7") {
+		t.Fatalf("expected the CPU-time budget, got %q", cmd.Args)
+	}
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.Setpgid {
+		t.Fatalf("expected the command to run in its own process group")
+	}
+}
+
+func TestStandaloneSlotsBoundConcurrentRuns(t *testing.T) {
+	previous := standaloneSlots
+	standaloneSlots = make(chan struct{}, 1)
+	t.Cleanup(func() { standaloneSlots = previous })
+
+	release, err := acquireStandaloneSlot(context.Background())
+	if err != nil {
+		t.Fatalf("expected a free slot: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := acquireStandaloneSlot(ctx); !errors.Is(err, ErrEnqueueTimeout) {
+		t.Fatalf("expected ErrEnqueueTimeout while the only slot is taken, got %v", err)
+	}
+
+	release()
+	if release, err := acquireStandaloneSlot(context.Background()); err != nil {
+		t.Fatalf("expected the released slot to be free: %v", err)
+	} else {
+		release()
+	}
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamEventBuffer holds a compile's stage transitions until the stream
+// writes them; a compile reports fewer than this
+const streamEventBuffer = 16
+
+// CompileStreamHandler compiles like CompileHandler but answers with a
+// Server-Sent Events stream: a "progress" event per stage, starting with
+// "queued", then a "result" event with the JSON envelope or an "error" event
+// with the error response
+func CompileStreamHandler(c *gin.Context) {
+	var req CompileRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	outputFormat, ok := validateCompileRequest(c, &req)
+	if !ok {
+		return
+	}
+
+	if rejectWhenBusy(c) {
+		return
+	}
+
+	job := newCompileJob(c, &req, outputFormat)
+	events := make(chan ProgressEvent, streamEventBuffer)
+	job.Options.Progress = func(event ProgressEvent) {
+		// Never stall the compile on a slow client
+		select {
+		case events <- event:
+		default:
+		}
+	}
+
+	if err := enqueueJob(job); err != nil {
+		c.JSON(errorStatus(errorCode(err)), ErrorResponse{
+			Error:   "Server busy",
+			Code:    errorCode(err),
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Compile-Request-Id", job.RequestID)
+	c.SSEvent("progress", ProgressEvent{RequestID: job.RequestID, Stage: StageQueued})
+	c.Writer.Flush()
+
+	var deadline <-chan time.Time
+	if maxQueueWait > 0 {
+		timer := time.NewTimer(maxQueueWait - time.Since(job.EnqueuedAt))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		select {
+		case event := <-events:
+			c.SSEvent("progress", event)
+		case result := <-job.ResultChan:
+			// "done" is reported before the result is sent; keep it first
+			flushProgressEvents(c, events)
+			if result.Success {
+				c.SSEvent("result", newCompileResponse(result, job.Options))
+			} else {
+				c.SSEvent("error", newCompileErrorResponse(result, req.wantsPartialPDF()))
+			}
+			c.Writer.Flush()
+			return
+		case <-deadline:
+			c.SSEvent("error", ErrorResponse{
+				Error:   "Server busy",
+				Code:    errorCode(ErrQueueWaitExceeded),
+				Message: ErrQueueWaitExceeded.Error(),
+			})
+			c.Writer.Flush()
+			return
+		case <-c.Request.Context().Done():
+			// The client left; the compile still finishes and is cached
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// flushProgressEvents writes the progress events already buffered
+func flushProgressEvents(c *gin.Context, events <-chan ProgressEvent) {
+	for {
+		select {
+		case event := <-events:
+			c.SSEvent("progress", event)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sseEvent is one parsed Server-Sent Event
+type sseEvent struct {
+	name string
+	data string
+}
+
+func parseSSE(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				event.name = name
+			} else if data, ok := strings.CutPrefix(line, "data:"); ok {
+				event.data = data
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestCompileStreamHandler(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	startTestWorker(t)
+
+	recorder := performJSON(t, http.MethodPost, "/compile/stream", CompileStreamHandler, CompileRequest{
+		Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+	})
+	assertStatus(t, recorder, http.StatusOK)
+	if got := recorder.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", got)
+	}
+
+	events := parseSSE(recorder.Body.String())
+	var stages []string
+	for _, event := range events[:len(events)-1] {
+		var progress ProgressEvent
+		if event.name != "progress" || json.Unmarshal([]byte(event.data), &progress) != nil {
+			t.Fatalf("expected progress events before the result, got %+v", event)
+		}
+		stages = append(stages, progress.Stage)
+	}
+	if strings.Join(stages, ",") != "queued,workspace,latexmk,done" {
+		t.Fatalf("unexpected stages %v", stages)
+	}
+
+	last := events[len(events)-1]
+	var resp CompileResponse
+	if last.name != "result" || json.Unmarshal([]byte(last.data), &resp) != nil || resp.PdfBuffer == "" {
+		t.Fatalf("expected a result event with the PDF, got %+v", last)
+	}
+}
+
+func TestCompileStreamHandlerReportsFailure(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": "exit 12\n"})
+	startTestWorker(t)
+
+	recorder := performJSON(t, http.MethodPost, "/compile/stream", CompileStreamHandler, CompileRequest{
+		Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}},
+	})
+	events := parseSSE(recorder.Body.String())
+	last := events[len(events)-1]
+	var resp ErrorResponse
+	if last.name != "error" || json.Unmarshal([]byte(last.data), &resp) != nil || resp.Error != "LaTeX compilation failed" {
+		t.Fatalf("expected an error event, got %+v", last)
+	}
+}
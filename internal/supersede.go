@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// supersededWaitDelay bounds how long a cancelled toolchain process may keep
+// its output pipes open after being killed
+const supersededWaitDelay = 2 * time.Second
+
+// compileRegistry remembers the newest queued or running compile of each
+// project so that a newer request can cancel the one it supersedes. It also
+// keeps each project to one place in requestQueue and one running compile,
+// with at most one parked job waiting to run after it.
+type compileRegistry struct {
+	mu      sync.Mutex
+	newest  map[string]*CompileJob
+	queued  map[string]*queueSlot
+	running map[string]*CompileJob
+	parked  map[string]*CompileJob
+}
+
+var projectCompiles = &compileRegistry{
+	newest:  make(map[string]*CompileJob),
+	queued:  make(map[string]*queueSlot),
+	running: make(map[string]*CompileJob),
+	parked:  make(map[string]*CompileJob),
+}
+
+// queueSlot is a project's place in requestQueue: the job sent into the
+// queue, and the project's newest job, which runs when a worker takes it
+type queueSlot struct {
+	sent *CompileJob
+	job  *CompileJob
+}
+
+// coalescedCompiles counts the jobs dropped unrun because a newer request
+// for their project superseded them
+var coalescedCompiles atomic.Int64
+
+// supersedeKey identifies the project a job belongs to, or "" for one-off
+// compiles, which are never superseded
+func supersedeKey(job *CompileJob) string {
+	if job.ProjectID == "" {
+		return ""
+	}
+	return CacheKey(job.Options.CacheNamespace, job.ProjectID)
+}
+
+// attach gives a project-scoped job a context that a newer request for the
+// same project cancels
+func (r *compileRegistry) attach(job *CompileJob) {
+	if supersedeKey(job) == "" {
+		return
+	}
+	job.Options.Context, job.cancel = context.WithCancel(context.Background())
+}
+
+// supersede records job as its project's newest compile and cancels the one
+// before it, which then fails with ErrSuperseded
+func (r *compileRegistry) supersede(job *CompileJob) {
+	key := supersedeKey(job)
+	if key == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if previous := r.newest[key]; previous != nil && previous != job {
+		if previous.EnqueuedAt.After(job.EnqueuedAt) {
+			// A newer request got here first
+			job.cancel()
+			return
+		}
+		log.Printf("Superseding the in-flight compile of project %q", job.ProjectID)
+		previous.cancel()
+	}
+	r.newest[key] = job
+}
+
+// finish forgets job once it is done (or could not be queued)
+func (r *compileRegistry) finish(job *CompileJob) {
+	key := supersedeKey(job)
+	if key == "" || job.cancel == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if r.newest[key] == job {
+		delete(r.newest, key)
+	}
+	r.mu.Unlock()
+
+	job.cancel()
+}
+
+// outdated reports whether a newer request for job's project was queued
+// while job waited to be
+func (r *compileRegistry) outdated(job *CompileJob) bool {
+	key := supersedeKey(job)
+	if key == "" {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newest := r.newest[key]
+	return newest != nil && newest.EnqueuedAt.After(job.EnqueuedAt)
+}
+
+// claimSlot gives a project-scoped job its project's place in requestQueue.
+// When a job of the project is already waiting there, job takes its place
+// and the job it replaces is returned for the caller to drop, with ok true.
+// Otherwise job must be sent into the queue itself.
+func (r *compileRegistry) claimSlot(job *CompileJob) (replaced *CompileJob, ok bool) {
+	key := supersedeKey(job)
+	if key == "" {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slot := r.queued[key]; slot != nil {
+		replaced, slot.job = slot.job, job
+		return replaced, true
+	}
+	r.queued[key] = &queueSlot{sent: job, job: job}
+	return nil, false
+}
+
+// takeSlot frees the place in requestQueue of sent, a job taken from the
+// queue or one that could not be sent into it, and returns the job holding
+// that place, which is sent or a newer job of its project
+func (r *compileRegistry) takeSlot(sent *CompileJob) *CompileJob {
+	key := supersedeKey(sent)
+	if key == "" {
+		return sent
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slot := r.queued[key]
+	if slot == nil || slot.sent != sent {
+		return sent
+	}
+	delete(r.queued, key)
+	return slot.job
+}
+
+// begin claims job's project for it and reports whether it may run now. A
+// job whose project is already compiling is parked instead; the job it
+// replaces as the parked one is returned for the caller to drop.
+func (r *compileRegistry) begin(job *CompileJob) (bool, *CompileJob) {
+	key := supersedeKey(job)
+	if key == "" {
+		return true, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running[key] == nil {
+		r.running[key] = job
+		return true, nil
+	}
+	replaced := r.parked[key]
+	r.parked[key] = job
+	log.Printf("Parking compile of project %q until its running compile finishes", job.ProjectID)
+	return false, replaced
+}
+
+// next releases job's project and returns the parked job to run after it,
+// which takes the project over, or nil
+func (r *compileRegistry) next(job *CompileJob) *CompileJob {
+	key := supersedeKey(job)
+	if key == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parked := r.parked[key]
+	delete(r.parked, key)
+	if parked == nil {
+		delete(r.running, key)
+		return nil
+	}
+	r.running[key] = parked
+	return parked
+}
+
+// dropSuperseded answers a job that a newer request for its project
+// superseded before it started, without compiling it
+func dropSuperseded(job *CompileJob) {
+	defer projectCompiles.finish(job)
+
+	count := coalescedCompiles.Add(1)
+	compilesCoalescedTotal.Inc()
+	log.Printf("[%s] Dropping superseded compile of project %q unrun (%d coalesced so far)", job.RequestID, job.ProjectID, count)
+	failJob(jobCompiler(job), job, ErrSuperseded)
+}
+
+// superseded reports whether a newer request for the project cancelled this
+// compile
+func (s *compileSession) superseded() bool {
+	return s.options.Context != nil && s.options.Context.Err() != nil
+}
+
+// command builds a toolchain command that is killed, with everything it
+// spawned, when the compile is superseded or times out
+func (s *compileSession) command(name string, args ...string) *exec.Cmd {
+	ctx := s.toolchainCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	name, args = s.cpuLimitedCommand(name, args)
+	return groupCommand(ctx, name, args...)
+}
+
+// groupCommand builds a command that runs in its own process group, all of
+// which is killed when ctx ends
+func groupCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	// latexmk runs the engine as a child; kill the whole process group
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = supersededWaitDelay
+	return cmd
+}
+
+// abandonSuperseded fails a cancelled compile. A toolchain killed mid-run may
+// leave half-written auxiliary files, so, as after a timeout, the workspace is
+// removed and the superseding compile starts from scratch.
+func (s *compileSession) abandonSuperseded(cache *CompilationCache) *CompileResult {
+	log.Printf("[%s] Compile superseded by a newer request for project %s", s.compiler.RequestID, s.projectID)
+
+	if s.tempDir != "" {
+		if s.projectID != "" {
+			cache.Set(s.projectID, &CacheEntry{ProjectID: s.projectID, ClientID: s.options.ClientID})
+		}
+		s.shouldCleanup = true
+	}
+
+	return s.compiler.failWith(s.metadata, ErrSuperseded, s.queueMs, s.receivedAt)
+}
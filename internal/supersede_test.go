@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewerRequestSupersedesInFlightCompile(t *testing.T) {
+	// Drafts marked SLOW take far longer than the test allows
+	installFakeTools(t, map[string]string{"latexmk": "grep -q SLOW main.tex && sleep 30\n" + fakeLatexmkScript})
+	startTestWorker(t)
+	projectID := "supersede-test"
+	forgetProject(t, projectID)
+
+	// One router for both requests; performJSON's per-call gin setup is not
+	// safe to run concurrently
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/compile", CompileHandler)
+
+	compile := func(body string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(CompileRequest{
+			Files:     []FileEntry{{Path: "main.tex", Content: strings.Replace(simpleDocument, "Hello from Octree!", body, 1)}},
+			ProjectID: projectID,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/compile", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	first := make(chan *httptest.ResponseRecorder, 1)
+	started := time.Now()
+	go func() { first <- compile("SLOW first draft") }()
+
+	time.Sleep(300 * time.Millisecond)
+	second := compile("Second draft")
+	assertStatus(t, second, http.StatusOK)
+
+	superseded := <-first
+	assertStatus(t, superseded, http.StatusConflict)
+	var resp ErrorResponse
+	if err := json.Unmarshal(superseded.Body.Bytes(), &resp); err != nil || resp.Code != "SUPERSEDED" {
+		t.Fatalf("expected SUPERSEDED, got %s", superseded.Body.String())
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected the superseded compile to be killed, took %s", elapsed)
+	}
+
+	// The cached workspace matches the newest files, not the abandoned draft
+	entry, ok := GetCache().Get(projectID)
+	if !ok || entry.ContentHash != HashFileSet([]FileEntry{{Path: "main.tex", Content: strings.Replace(simpleDocument, "Hello from Octree!", "Second draft", 1)}}) {
+		t.Fatalf("expected the cache to hold the second draft's build")
+	}
+}
+
+func TestOneOffCompilesAreNotSuperseded(t *testing.T) {
+	job := &CompileJob{Files: []FileEntry{{Path: "main.tex", Content: simpleDocument}}}
+	projectCompiles.attach(job)
+	if job.Options.Context != nil || job.cancel != nil {
+		t.Fatalf("compiles without a project ID must not be cancellable")
+	}
+}
+
+func TestProjectRunsOneCompileAtATime(t *testing.T) {
+	registry := &compileRegistry{
+		newest:  make(map[string]*CompileJob),
+		running: make(map[string]*CompileJob),
+		parked:  make(map[string]*CompileJob),
+	}
+	job := func() *CompileJob { return &CompileJob{ProjectID: "busy-project"} }
+	first, second, third := job(), job(), job()
+
+	if run, _ := registry.begin(first); !run {
+		t.Fatalf("expected the first job to run")
+	}
+	if run, replaced := registry.begin(second); run || replaced != nil {
+		t.Fatalf("expected the second job to be parked")
+	}
+	if run, replaced := registry.begin(third); run || replaced != second {
+		t.Fatalf("expected the third job to replace the parked second")
+	}
+	if run, _ := registry.begin(&CompileJob{}); !run {
+		t.Fatalf("expected a one-off compile to run regardless")
+	}
+
+	if next := registry.next(first); next != third {
+		t.Fatalf("expected the newest parked job to run next, got %+v", next)
+	}
+	if next := registry.next(third); next != nil {
+		t.Fatalf("expected nothing left to run, got %+v", next)
+	}
+	if run, _ := registry.begin(job()); !run {
+		t.Fatalf("expected the project to be free again")
+	}
+}
+
+func TestSupersededQueuedCompileIsDroppedUnrun(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	t.Setenv("FAKE_LATEXMK_RUNS", runs)
+	installFakeTools(t, map[string]string{"latexmk": "echo run >> \"$FAKE_LATEXMK_RUNS\"\n" + fakeLatexmkScript})
+	projectID := "coalesce-test"
+	forgetProject(t, projectID)
+
+	// No worker drains this queue until both jobs are in
+	previous := requestQueue
+	SetRequestQueue(make(chan *CompileJob, 2))
+	t.Cleanup(func() { SetRequestQueue(previous) })
+
+	coalesced := coalescedCompiles.Load()
+	var jobs []*CompileJob
+	for _, draft := range []string{"First draft", "Second draft"} {
+		job := &CompileJob{
+			Files:      []FileEntry{{Path: "main.tex", Content: strings.Replace(simpleDocument, "Hello from Octree!", draft, 1)}},
+			ProjectID:  projectID,
+			EnqueuedAt: time.Now(),
+			ResultChan: make(chan *CompileResult, 1),
+		}
+		if enqueueJob(job) != nil {
+			t.Fatalf("failed to enqueue %s", draft)
+		}
+		jobs = append(jobs, job)
+	}
+
+	// The second draft took over the first's place in the queue
+	if len(requestQueue) != 1 {
+		t.Fatalf("expected the project to hold one queue slot, got %d", len(requestQueue))
+	}
+	HandleCompilation(<-requestQueue)
+
+	if result := <-jobs[0].ResultChan; result.Success || result.ErrorCode != "SUPERSEDED" {
+		t.Fatalf("expected the first draft to be superseded, got success=%v code=%q", result.Success, result.ErrorCode)
+	}
+	if result := <-jobs[1].ResultChan; !result.Success {
+		t.Fatalf("expected the second draft to compile, got: %s", result.ErrorMessage)
+	}
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "run") != 1 {
+		t.Fatalf("expected only the second draft to run latexmk, got %q", data)
+	}
+	if got := coalescedCompiles.Load() - coalesced; got != 1 {
+		t.Fatalf("expected 1 coalesced compile, got %d", got)
+	}
+}
+
+func TestSupersededCompilesDoNotCrowdOutOtherProjects(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkScript})
+	flooded, other := "flooded-project", "other-project"
+	forgetProject(t, flooded)
+	forgetProject(t, other)
+
+	// No worker drains this queue, which has room for two jobs
+	previous := requestQueue
+	SetRequestQueue(make(chan *CompileJob, 2))
+	t.Cleanup(func() { SetRequestQueue(previous) })
+
+	newJob := func(projectID string, draft int) *CompileJob {
+		return &CompileJob{
+			Files:      []FileEntry{{Path: "main.tex", Content: strings.Replace(simpleDocument, "Hello from Octree!", fmt.Sprintf("Draft %d", draft), 1)}},
+			ProjectID:  projectID,
+			EnqueuedAt: time.Now(),
+			ResultChan: make(chan *CompileResult, 1),
+		}
+	}
+
+	var drafts []*CompileJob
+	for i := 0; i < 5; i++ {
+		job := newJob(flooded, i)
+		if enqueueJob(job) != nil {
+			t.Fatalf("failed to enqueue draft %d", i)
+		}
+		drafts = append(drafts, job)
+	}
+	if len(requestQueue) != 1 {
+		t.Fatalf("expected the flooded project to hold one queue slot, got %d", len(requestQueue))
+	}
+	for i, job := range drafts[:len(drafts)-1] {
+		if result := <-job.ResultChan; result.ErrorCode != "SUPERSEDED" {
+			t.Fatalf("expected draft %d to be superseded, got code=%q", i, result.ErrorCode)
+		}
+	}
+
+	if queueFull() {
+		t.Fatalf("expected room in the queue for another project")
+	}
+	otherJob := newJob(other, 0)
+	if err := enqueueJob(otherJob); err != nil {
+		t.Fatalf("expected the other project to be admitted, got %v", err)
+	}
+
+	HandleCompilation(<-requestQueue)
+	HandleCompilation(<-requestQueue)
+	if result := <-drafts[len(drafts)-1].ResultChan; !result.Success {
+		t.Fatalf("expected the newest draft to compile, got: %s", result.ErrorMessage)
+	}
+	if result := <-otherJob.ResultChan; !result.Success {
+		t.Fatalf("expected the other project to compile, got: %s", result.ErrorMessage)
+	}
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// synctexHeader starts every SyncTeX file
+const synctexHeader = "SyncTeX Version:"
+
+// synctexPath returns where the engine writes the compressed SyncTeX file
+// next to the PDF
+func (s *compileSession) synctexPath() string {
+	return strings.TrimSuffix(s.pdfPath, ".pdf") + ".synctex.gz"
+}
+
+// readSynctex returns the SyncTeX data for the compiled PDF, gunzipped when
+// the request asked for uncompressed output
+func (s *compileSession) readSynctex() ([]byte, error) {
+	data, err := os.ReadFile(s.synctexPath())
+	if err != nil {
+		return nil, err
+	}
+	if !s.options.SynctexUncompressed {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress synctex: %w", err)
+	}
+	defer reader.Close()
+
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("decompress synctex: %w", err)
+	}
+	if !bytes.HasPrefix(raw, []byte(synctexHeader)) {
+		return nil, fmt.Errorf("decompress synctex: missing %q header", synctexHeader)
+	}
+	return raw, nil
+}
+
+// forwardSync locates the request's syncForward position in the fresh PDF
+// with "synctex view". It returns nil when no position was requested, the
+// engine wrote no SyncTeX file, or synctex found nothing.
+func (s *compileSession) forwardSync() *SyncTarget {
+	position := s.options.SyncForward
+	if position == nil {
+		return nil
+	}
+	// Lines are 1-based, so 0 means the field was missing; column 0 is
+	// synctex's "anywhere on the line" and is valid
+	if position.Line < 1 || position.Column < 0 {
+		log.Printf("[%s] Warning: skipping forward sync of invalid position %d:%d", s.compiler.RequestID, position.Line, position.Column)
+		return nil
+	}
+	if _, err := os.Stat(s.synctexPath()); err != nil {
+		log.Printf("[%s] Warning: skipping forward sync, no SyncTeX file: %v", s.compiler.RequestID, err)
+		return nil
+	}
+
+	input := s.texFilePath
+	if position.File != "" {
+		if !filepath.IsLocal(filepath.FromSlash(position.File)) {
+			log.Printf("[%s] Warning: skipping forward sync of %q outside the project", s.compiler.RequestID, position.File)
+			return nil
+		}
+		input = filepath.Join(s.tempDir, filepath.FromSlash(position.File))
+	}
+
+	cmd := s.command("synctex", "view",
+		"-i", fmt.Sprintf("%d:%d:%s", position.Line, position.Column, input),
+		"-o", s.pdfPath)
+	cmd.Dir = filepath.Dir(s.pdfPath)
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("[%s] Warning: synctex forward sync failed: %v", s.compiler.RequestID, err)
+		return nil
+	}
+
+	target := parseSynctexView(string(output))
+	if target == nil {
+		log.Printf("[%s] Warning: synctex found no PDF location for %s:%d", s.compiler.RequestID, input, position.Line)
+	}
+	return target
+}
+
+// parseSynctexView reads the first record between "SyncTeX result begin" and
+// "SyncTeX result end" of synctex view's output
+func parseSynctexView(output string) *SyncTarget {
+	var target *SyncTarget
+	inResult := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "SyncTeX result begin":
+			inResult = true
+			continue
+		case line == "SyncTeX result end":
+			return target
+		case !inResult:
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Page":
+			if target != nil {
+				return target
+			}
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				return nil
+			}
+			target = &SyncTarget{Page: page}
+		case "x":
+			if target != nil {
+				target.X, _ = strconv.ParseFloat(value, 64)
+			}
+		case "y":
+			if target != nil {
+				target.Y, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+	}
+	return target
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeSynctex = "SyncTeX Version:1\nInput:1:./main.tex\nOutput:pdf\nMagnification:1000\nUnit:1\nX Offset:0\nY Offset:0\nContent:\n"
+
+// fakeLatexmkWithSynctex also writes a gzipped SyncTeX file next to the PDF.
+var fakeLatexmkWithSynctex = fakeLatexmkScript + `printf '` + strings.ReplaceAll(fakeSynctex, "\n", `\n`) + `' | gzip > "$job.synctex.gz"
+`
+
+func TestCompileReturnsGzippedSynctexByDefault(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithSynctex})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnSynctex: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(result.Synctex))
+	if err != nil {
+		t.Fatalf("expected gzipped synctex: %v", err)
+	}
+	raw, _ := io.ReadAll(reader)
+	if string(raw) != fakeSynctex {
+		t.Fatalf("unexpected synctex content: %q", raw)
+	}
+
+	found := false
+	for _, arg := range readArgs() {
+		found = found || strings.Contains(arg, "-synctex=1")
+	}
+	if !found {
+		t.Fatalf("expected the engine to run with -synctex=1")
+	}
+}
+
+func TestCompileReturnsUncompressedSynctex(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithSynctex})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnSynctex: true, SynctexUncompressed: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if !strings.HasPrefix(string(result.Synctex), "SyncTeX Version:1\nInput:1:") {
+		t.Fatalf("expected uncompressed synctex text, got %q", result.Synctex)
+	}
+}
+
+// fakeSynctexView answers "synctex view" like synctex 1.5, after recording its
+// -i argument next to itself
+const fakeSynctexView = `echo "$3" > "$(dirname "$0")/view.input"
+cat <<'OUT'
+This is SyncTeX command line utility, version 1.5
+SyncTeX result begin
+Output:main.pdf
+Page:2
+x:133.768356
+y:134.239502
+h:133.768356
+v:136.630417
+W:343.711060
+H:9.962640
+before:
+offset:0
+middle:
+after:
+Output:main.pdf
+Page:3
+x:72.000000
+y:90.000000
+SyncTeX result end
+OUT
+`
+
+func TestCompileRunsForwardSync(t *testing.T) {
+	dir := installFakeTools(t, map[string]string{
+		"latexmk": fakeLatexmkWithSynctex,
+		"synctex": fakeSynctexView,
+	})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{
+		{Path: "main.tex", Content: simpleDocument},
+		{Path: "chapters/intro.tex", Content: "Intro"},
+	}
+	options := CompileOptions{SyncForward: &SourcePosition{File: "chapters/intro.tex", Line: 1}}
+	result := New().Compile(files, time.Now(), "", options)
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	found := false
+	for _, arg := range readArgs() {
+		found = found || strings.Contains(arg, "-synctex=1")
+	}
+	if !found {
+		t.Fatalf("expected the engine to run with -synctex=1")
+	}
+
+	want := SyncTarget{Page: 2, X: 133.768356, Y: 134.239502}
+	if result.SyncTarget == nil || *result.SyncTarget != want {
+		t.Fatalf("expected the first synctex record %+v, got %+v", want, result.SyncTarget)
+	}
+	if len(result.Synctex) != 0 {
+		t.Fatalf("syncForward alone must not return the SyncTeX data")
+	}
+
+	input, _ := os.ReadFile(filepath.Join(dir, "view.input"))
+	if !strings.HasPrefix(string(input), "1:0:") || !strings.HasSuffix(strings.TrimSpace(string(input)), filepath.Join("chapters", "intro.tex")) {
+		t.Fatalf("unexpected synctex -i argument %q", input)
+	}
+}
+
+func TestForwardSyncSkippedWithoutSynctexFile(t *testing.T) {
+	installFakeTools(t, map[string]string{
+		"latexmk": fakeLatexmkScript,
+		"synctex": "exit 1\n",
+	})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{SyncForward: &SourcePosition{Line: 3}})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed without SyncTeX data, got: %s", result.ErrorMessage)
+	}
+	if result.SyncTarget != nil {
+		t.Fatalf("expected no sync target, got %+v", result.SyncTarget)
+	}
+}
+
+func TestForwardSyncValidatesPosition(t *testing.T) {
+	dir := installFakeTools(t, map[string]string{
+		"latexmk": fakeLatexmkWithSynctex,
+		"synctex": fakeSynctexView,
+	})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	cases := []struct {
+		position SourcePosition
+		input    string // Expected line:column prefix of synctex's -i, "" when skipped
+	}{
+		{SourcePosition{Line: 1, Column: 0}, "1:0:"},
+		{SourcePosition{Line: 4, Column: 7}, "4:7:"},
+		{SourcePosition{}, ""},
+		{SourcePosition{Line: 2, Column: -1}, ""},
+	}
+	for _, tc := range cases {
+		os.Remove(filepath.Join(dir, "view.input"))
+		position := tc.position
+		result := New().Compile(files, time.Now(), "", CompileOptions{SyncForward: &position})
+		if !result.Success {
+			t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+		}
+
+		input, err := os.ReadFile(filepath.Join(dir, "view.input"))
+		if tc.input == "" {
+			if err == nil || result.SyncTarget != nil {
+				t.Fatalf("expected %+v to be skipped, synctex ran with %q", tc.position, input)
+			}
+			continue
+		}
+		if !strings.HasPrefix(string(input), tc.input) || result.SyncTarget == nil {
+			t.Fatalf("expected %+v to look up %s, got %q", tc.position, tc.input, input)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// verbatimEnvironments hold literal text: \begin/\end inside them are not
+// structure
+var verbatimEnvironments = map[string]bool{
+	"verbatim":      true,
+	"verbatim*":     true,
+	"Verbatim":      true,
+	"BVerbatim":     true,
+	"LVerbatim":     true,
+	"lstlisting":    true,
+	"minted":        true,
+	"comment":       true,
+	"filecontents":  true,
+	"filecontents*": true,
+}
+
+var environmentTokenPattern = regexp.MustCompile(`\\(begin|end)\s*\{([^{}\\]+)\}|\\verb\*?`)
+
+type openEnvironment struct {
+	name string
+	line int
+}
+
+// checkEnvironments walks the document body of a root file and returns an
+// ErrUnmatchedEnvironment naming the first environment whose \begin and \end
+// do not pair up. Files without \begin{document} are fragments and skipped.
+func checkEnvironments(path, content string) error {
+	content = stripTeXComments(content)
+	start := strings.Index(content, `\begin{document}`)
+	if start == -1 {
+		return nil
+	}
+
+	var stack []openEnvironment
+	pos := start
+	for {
+		loc := environmentTokenPattern.FindStringSubmatchIndex(content[pos:])
+		if loc == nil {
+			break
+		}
+		tokenStart, tokenEnd := pos+loc[0], pos+loc[1]
+		line := lineNumberAt(content, tokenStart)
+
+		if loc[2] == -1 {
+			// \verb|...|: skip to the closing delimiter on the same line
+			pos = skipInlineVerb(content, tokenEnd)
+			continue
+		}
+
+		kind := content[pos+loc[2] : pos+loc[3]]
+		name := strings.TrimSpace(content[pos+loc[4] : pos+loc[5]])
+		pos = tokenEnd
+
+		if kind == "begin" {
+			if verbatimEnvironments[name] {
+				end := strings.Index(content[pos:], `\end{`+name+`}`)
+				if end == -1 {
+					return unmatchedEnvironmentError(path, fmt.Sprintf(`\begin{%s} on line %d is never closed`, name, line))
+				}
+				pos += end + len(`\end{`+name+`}`)
+				continue
+			}
+			stack = append(stack, openEnvironment{name: name, line: line})
+			continue
+		}
+
+		if len(stack) == 0 || !environmentOpen(stack, name) {
+			return unmatchedEnvironmentError(path, fmt.Sprintf(`\end{%s} on line %d has no matching \begin{%s}`, name, line, name))
+		}
+		top := stack[len(stack)-1]
+		if top.name != name {
+			return unmatchedEnvironmentError(path, fmt.Sprintf(`\begin{%s} on line %d is not closed before \end{%s} on line %d`, top.name, top.line, name, line))
+		}
+		stack = stack[:len(stack)-1]
+
+		if name == "document" {
+			// LaTeX ignores everything after \end{document}
+			return nil
+		}
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return unmatchedEnvironmentError(path, fmt.Sprintf(`\begin{%s} on line %d is never closed`, top.name, top.line))
+	}
+	return nil
+}
+
+func environmentOpen(stack []openEnvironment, name string) bool {
+	for _, env := range stack {
+		if env.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// skipInlineVerb returns the offset after a \verb argument whose delimiter is
+// at pos
+func skipInlineVerb(content string, pos int) int {
+	if pos >= len(content) {
+		return pos
+	}
+	delim := content[pos]
+	if delim >= 'a' && delim <= 'z' || delim >= 'A' && delim <= 'Z' {
+		// A longer command such as \verbatiminput, not \verb
+		return pos
+	}
+	for i := pos + 1; i < len(content) && content[i] != '\n'; i++ {
+		if content[i] == delim {
+			return i + 1
+		}
+	}
+	return pos + 1
+}
+
+func unmatchedEnvironmentError(path, detail string) error {
+	return fmt.Errorf("%w: %s of %s", ErrUnmatchedEnvironment, detail, path)
+}
+
+// findUnmatchedEnvironment checks every root document in the project
+func findUnmatchedEnvironment(files []FileEntry) error {
+	for _, file := range files {
+		if file.Encoding == "base64" || !isMainFileCandidate(file.Path) {
+			continue
+		}
+		if err := checkEnvironments(file.Path, file.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enforceSyntax runs the quick structural checks that catch mistakes LaTeX
+// would otherwise report late and confusingly
+func (s *compileSession) enforceSyntax() *CompileResult {
+	if err := findUnmatchedEnvironment(s.files); err != nil {
+		log.Printf("[%s] Rejecting request: %v", s.compiler.RequestID, err)
+		return s.compiler.failWith(s.metadata, err, s.queueMs, s.receivedAt)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckEnvironmentsReportsUnclosedItemize(t *testing.T) {
+	content := `\documentclass{article}
+\begin{document}
+\begin{itemize}
+  \item First
+  \begin{enumerate}
+    \item Nested
+  \end{enumerate}
+\end{document}`
+
+	err := checkEnvironments("main.tex", content)
+	if !errors.Is(err, ErrUnmatchedEnvironment) {
+		t.Fatalf("expected ErrUnmatchedEnvironment, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `\begin{itemize} on line 3`) {
+		t.Fatalf("expected itemize on line 3 to be reported, got %q", err.Error())
+	}
+}
+
+func TestCheckEnvironmentsReportsStrayEnd(t *testing.T) {
+	content := "\\begin{document}\nText\n\\end{center}\n\\end{document}"
+
+	err := checkEnvironments("main.tex", content)
+	if err == nil || !strings.Contains(err.Error(), `\end{center} on line 3 has no matching`) {
+		t.Fatalf("expected stray \\end{center} to be reported, got %v", err)
+	}
+}
+
+func TestCheckEnvironmentsTreatsVerbatimAsLiteral(t *testing.T) {
+	content := `\begin{document}
+\begin{verbatim}
+\begin{itemize}
+\end{verbatim}
+Inline \verb|\end{figure}| and % \begin{table}
+\begin{lstlisting}
+\end{center}
+\end{lstlisting}
+\end{document}
+\begin{ignored}`
+
+	if err := checkEnvironments("main.tex", content); err != nil {
+		t.Fatalf("expected balanced document, got %v", err)
+	}
+}
+
+func TestCheckEnvironmentsSkipsFragments(t *testing.T) {
+	// Chapters may open an environment that another file closes
+	if err := checkEnvironments("chapter.tex", "\\begin{figure}\n"); err != nil {
+		t.Fatalf("expected fragments to be skipped, got %v", err)
+	}
+}
+
+func TestCompileRejectsUnmatchedEnvironment(t *testing.T) {
+	files := []FileEntry{{Path: "main.tex", Content: "\\documentclass{article}\n\\begin{document}\n\\begin{itemize}\n\\item x\n\\end{document}"}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Success || result.ErrorCode != "UNMATCHED_ENVIRONMENT" {
+		t.Fatalf("expected UNMATCHED_ENVIRONMENT, got success=%v code=%q", result.Success, result.ErrorCode)
+	}
+	if !strings.Contains(result.ErrorMessage, "itemize") || !strings.Contains(result.ErrorMessage, "line 3") {
+		t.Fatalf("expected environment name and line in %q", result.ErrorMessage)
+	}
+}
@@ -0,0 +1,351 @@
+package internal
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tableEnvironments maps each supported table environment to the number of
+// mandatory arguments it takes; the last one is the column specification
+var tableEnvironments = map[string]int{
+	"tabular":   1,
+	"tabular*":  2,
+	"tabularx":  2,
+	"longtable": 1,
+}
+
+var tableBeginPattern = regexp.MustCompile(`\\begin\{(tabular\*?|tabularx|longtable)\}`)
+
+// tableRuleCommands are row-level commands that draw rules or mark longtable
+// heads/feet; they carry no cell content
+var tableRuleCommands = map[string]int{
+	"hline":        0,
+	"toprule":      0,
+	"midrule":      0,
+	"bottomrule":   0,
+	"cline":        1,
+	"cmidrule":     1,
+	"endhead":      0,
+	"endfirsthead": 0,
+	"endfoot":      0,
+	"endlastfoot":  0,
+	"noalign":      1,
+	"rowcolor":     1,
+}
+
+// textDroppedArgCommands lose their first argument when LaTeX is converted
+// to text (\textcolor{red}{x} -> x, \thanks{...} -> "")
+var textDroppedArgCommands = map[string]bool{
+	"textcolor": true,
+	"cellcolor": true,
+	"color":     true,
+	"hspace":    true,
+	"vspace":    true,
+	"rule":      true,
+	"label":     true,
+	"thanks":    true,
+	"footnote":  true,
+}
+
+// textCommandReplacements are commands that print text of their own
+var textCommandReplacements = map[string]string{
+	"LaTeX":  "LaTeX",
+	"LaTeXe": "LaTeX2e",
+	"TeX":    "TeX",
+	"ldots":  "...",
+	"dots":   "...",
+}
+
+// cellEscapedChars are characters that stand for themselves when escaped
+const cellEscapedChars = `&%$#_{}`
+
+// extractTables finds every supported table environment in content and
+// returns its cells as text rows
+func extractTables(path, content string) []ExtractedTable {
+	content = stripTeXComments(content)
+
+	var tables []ExtractedTable
+	offset := 0
+	for {
+		loc := tableBeginPattern.FindStringSubmatchIndex(content[offset:])
+		if loc == nil {
+			return tables
+		}
+
+		env := content[offset+loc[2] : offset+loc[3]]
+		start := offset + loc[0]
+		pos := offset + loc[1]
+
+		columns, pos := readTableArguments(content, pos, tableEnvironments[env])
+		body, end := tableBody(content, pos, env)
+
+		tables = append(tables, ExtractedTable{
+			File:        path,
+			Line:        lineNumberAt(content, start),
+			Environment: env,
+			Columns:     columns,
+			Rows:        parseTableRows(body),
+		})
+		offset = end
+	}
+}
+
+// readTableArguments skips the optional and mandatory arguments after
+// \begin{env} and returns the column specification
+func readTableArguments(content string, pos, mandatory int) (string, int) {
+	var columns string
+	for mandatory > 0 {
+		pos = skipSpaces(content, pos)
+		if pos >= len(content) {
+			break
+		}
+		switch content[pos] {
+		case '[':
+			_, pos = readDelimited(content, pos, '[', ']')
+		case '{':
+			columns, pos = readDelimited(content, pos, '{', '}')
+			mandatory--
+		default:
+			return columns, pos
+		}
+	}
+	return columns, pos
+}
+
+// tableBody returns the source between the arguments of env and its matching
+// \end{env}, and the offset just past that \end
+func tableBody(content string, pos int, env string) (string, int) {
+	begin := `\begin{` + env + `}`
+	end := `\end{` + env + `}`
+	depth := 1
+
+	for i := pos; i < len(content); i++ {
+		switch {
+		case strings.HasPrefix(content[i:], begin):
+			depth++
+		case strings.HasPrefix(content[i:], end):
+			depth--
+			if depth == 0 {
+				return content[pos:i], i + len(end)
+			}
+		}
+	}
+	return content[pos:], len(content)
+}
+
+// parseTableRows splits a table body on \\ and & at the top level (outside
+// braces and nested environments) and converts each cell to text
+func parseTableRows(body string) [][]string {
+	var rows [][]string
+	for _, row := range splitTableLevel(body, true) {
+		row = stripTableRules(row)
+		if strings.TrimSpace(row) == "" {
+			continue
+		}
+
+		var cells []string
+		for _, cell := range splitTableLevel(row, false) {
+			text, span := tableCellText(cell)
+			cells = append(cells, text)
+			for ; span > 1; span-- {
+				cells = append(cells, "")
+			}
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+// splitTableLevel splits s on row separators (\\, \tabularnewline) when rows
+// is true, or on & otherwise, ignoring separators inside braces or nested
+// environments
+func splitTableLevel(s string, rows bool) []string {
+	var parts []string
+	braces, envs, last := 0, 0, 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			braces++
+		case '}':
+			braces--
+		case '&':
+			if !rows && braces == 0 && envs == 0 {
+				parts = append(parts, s[last:i])
+				last = i + 1
+			}
+		case '\\':
+			rest := s[i:]
+			switch {
+			case strings.HasPrefix(rest, `\begin{`):
+				envs++
+			case strings.HasPrefix(rest, `\end{`):
+				envs--
+			case rows && braces == 0 && envs == 0 && (strings.HasPrefix(rest, `\\`) || strings.HasPrefix(rest, `\tabularnewline`)):
+				parts = append(parts, s[last:i])
+				next := i + 2
+				if strings.HasPrefix(rest, `\tabularnewline`) {
+					next = i + len(`\tabularnewline`)
+				}
+				next = skipSpaces(s, next)
+				// Optional extra row spacing: \\[2pt]
+				if next < len(s) && s[next] == '[' {
+					_, next = readDelimited(s, next, '[', ']')
+				}
+				last = next
+				i = next - 1
+				continue
+			}
+			i++ // skip the escaped character (\&, \{, \\ inside a cell, ...)
+		}
+	}
+
+	return append(parts, s[last:])
+}
+
+// stripTableRules removes leading rule and longtable head/foot commands from
+// a row
+func stripTableRules(row string) string {
+	for {
+		row = strings.TrimSpace(row)
+		name, pos := readCommandName(row, 0)
+		args, ok := tableRuleCommands[name]
+		if !ok {
+			return row
+		}
+		// \cmidrule(lr){2-3}
+		if pos < len(row) && row[pos] == '(' {
+			_, pos = readDelimited(row, pos, '(', ')')
+		}
+		for ; args > 0; args-- {
+			pos = skipSpaces(row, pos)
+			if pos >= len(row) || row[pos] != '{' {
+				break
+			}
+			_, pos = readDelimited(row, pos, '{', '}')
+		}
+		row = row[pos:]
+	}
+}
+
+// tableCellText converts a cell to plain text and returns how many columns it
+// spans (\multicolumn)
+func tableCellText(cell string) (string, int) {
+	cell = strings.TrimSpace(cell)
+	span := 1
+
+	if name, pos := readCommandName(cell, 0); name == "multicolumn" || name == "multirow" {
+		var args []string
+		for len(args) < 3 {
+			pos = skipSpaces(cell, pos)
+			if pos >= len(cell) {
+				break
+			}
+			if cell[pos] == '[' {
+				_, pos = readDelimited(cell, pos, '[', ']')
+				continue
+			}
+			if cell[pos] != '{' {
+				break
+			}
+			var arg string
+			arg, pos = readDelimited(cell, pos, '{', '}')
+			args = append(args, arg)
+		}
+		if len(args) == 3 {
+			if name == "multicolumn" {
+				if n, err := strconv.Atoi(strings.TrimSpace(args[0])); err == nil && n > 1 {
+					span = n
+				}
+			}
+			cell = args[2] + cell[pos:]
+		}
+	}
+
+	return latexToText(cell), span
+}
+
+// latexToText is a best-effort conversion of a LaTeX fragment to plain text:
+// formatting commands are dropped but their arguments kept
+func latexToText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{', '}', '$':
+			continue
+		case '~':
+			b.WriteByte(' ')
+		case '\\':
+			name, pos := readCommandName(s, i)
+			if name == "" {
+				// Control symbol: an escaped character (\&) or spacing (\,)
+				if i+1 < len(s) && strings.IndexByte(cellEscapedChars, s[i+1]) >= 0 {
+					b.WriteByte(s[i+1])
+				} else {
+					b.WriteByte(' ')
+				}
+				i++
+				continue
+			}
+			if name == "textbackslash" {
+				b.WriteByte('\\')
+			}
+			b.WriteString(textCommandReplacements[name])
+			if textDroppedArgCommands[name] {
+				pos = skipSpaces(s, pos)
+				if pos < len(s) && s[pos] == '{' {
+					_, pos = readDelimited(s, pos, '{', '}')
+				}
+			}
+			i = pos - 1
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// readCommandName returns the name of the control word starting at pos (which
+// must be a backslash) and the offset just past it
+func readCommandName(s string, pos int) (string, int) {
+	if pos >= len(s) || s[pos] != '\\' {
+		return "", pos
+	}
+	end := pos + 1
+	for end < len(s) && (s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z') {
+		end++
+	}
+	if end < len(s) && s[end] == '*' && end > pos+1 {
+		end++
+	}
+	return s[pos+1 : end], end
+}
+
+// readDelimited reads a balanced group starting at s[pos] == open and returns
+// its inner text and the offset just past the closing delimiter
+func readDelimited(s string, pos int, open, close byte) (string, int) {
+	depth := 0
+	for i := pos; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return s[pos+1 : i], i + 1
+			}
+		}
+	}
+	return s[pos+1:], len(s)
+}
+
+func skipSpaces(s string, pos int) int {
+	for pos < len(s) && (s[pos] == ' ' || s[pos] == '\t' || s[pos] == '\n' || s[pos] == '\r') {
+		pos++
+	}
+	return pos
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestExtractTablesSimpleTable(t *testing.T) {
+	content := `\begin{tabular}{|c|c|}
+\hline
+Name & Score \\
+\hline
+Alice & 42 \\
+\hline
+\end{tabular}`
+
+	tables := extractTables("main.tex", content)
+	if len(tables) != 1 {
+		t.Fatalf("expected 1 table, got %d", len(tables))
+	}
+
+	want := [][]string{{"Name", "Score"}, {"Alice", "42"}}
+	if !reflect.DeepEqual(tables[0].Rows, want) {
+		t.Fatalf("expected rows %q, got %q", want, tables[0].Rows)
+	}
+	if tables[0].Columns != "|c|c|" || tables[0].Environment != "tabular" || tables[0].Line != 1 {
+		t.Fatalf("unexpected table metadata: %+v", tables[0])
+	}
+}
+
+func TestExtractTablesMulticolumnAndFormatting(t *testing.T) {
+	content := `Intro text.
+% \begin{tabular}{c} commented & out \end{tabular}
+\begin{tabularx}{\textwidth}{lXr}
+\toprule
+\multicolumn{2}{c}{\textbf{Totals}} & 100\,\% \\ \midrule
+R\&D & \emph{cost}~center & \$5 \\[2pt]
+\cmidrule(lr){1-2}
+a & {x & y} & z
+\bottomrule
+\end{tabularx}`
+
+	tables := extractTables("report.tex", content)
+	if len(tables) != 1 {
+		t.Fatalf("expected 1 table, got %d", len(tables))
+	}
+
+	want := [][]string{
+		{"Totals", "", "100 %"},
+		{"R&D", "cost center", "$5"},
+		{"a", "x & y", "z"},
+	}
+	if !reflect.DeepEqual(tables[0].Rows, want) {
+		t.Fatalf("expected rows %q, got %q", want, tables[0].Rows)
+	}
+	if tables[0].Columns != "lXr" || tables[0].Line != 3 {
+		t.Fatalf("unexpected table metadata: %+v", tables[0])
+	}
+}
+
+func TestTableExtractHandler(t *testing.T) {
+	recorder := performJSON(t, http.MethodPost, "/table/extract", TableExtractHandler, SourceRequest{
+		Content: "\\begin{longtable}[c]{ll}\na & b \\\\\nc & d \\\\\n\\end{longtable}",
+	})
+	assertStatus(t, recorder, http.StatusOK)
+
+	var resp TableExtractResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Tables) != 1 || !reflect.DeepEqual(resp.Tables[0].Rows, [][]string{{"a", "b"}, {"c", "d"}}) {
+		t.Fatalf("unexpected tables: %+v", resp.Tables)
+	}
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extraTexInputs are server-side directories of private packages searched
+// after the project itself; the toolchain may read nothing else beyond the
+// TeX distribution
+var extraTexInputs []string
+
+// SetExtraTexInputs sets the directories added to TEXINPUTS for every compile.
+// Each must be an existing absolute directory, so that a typo fails at startup
+// rather than as a missing package in every compile.
+func SetExtraTexInputs(dirs []string) error {
+	var checked []string
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("%s is not an absolute path", dir)
+		}
+		if strings.ContainsRune(dir, os.PathListSeparator) {
+			return fmt.Errorf("%s contains %q", dir, os.PathListSeparator)
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		checked = append(checked, filepath.Clean(dir))
+	}
+	extraTexInputs = checked
+	return nil
+}
+
+// texInputsEnv returns the TEXINPUTS assignment adding the extra directories
+// (searched recursively) after the workspace and before the server's own
+// TEXINPUTS, or "" when none are configured. The trailing separator keeps the
+// distribution's default search path.
+func texInputsEnv() string {
+	if len(extraTexInputs) == 0 {
+		return ""
+	}
+
+	sep := string(os.PathListSeparator)
+	paths := []string{"."}
+	for _, dir := range extraTexInputs {
+		paths = append(paths, dir+"//")
+	}
+	value := strings.Join(paths, sep) + sep
+	if existing := os.Getenv("TEXINPUTS"); existing != "" {
+		value += strings.TrimPrefix(existing, sep)
+	}
+	return "TEXINPUTS=" + value
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeLatexmkNeedingPackage fails like a missing \usepackage unless
+// teamstyle.sty is in the workspace or a TEXINPUTS directory.
+var fakeLatexmkNeedingPackage = `found=""
+IFS=:
+for dir in $TEXINPUTS; do
+	[ -n "$dir" ] && [ -f "${dir%//}/teamstyle.sty" ] && found=1
+done
+unset IFS
+if [ -z "$found" ]; then
+	echo "! LaTeX Error: File teamstyle.sty not found."
+	exit 12
+fi
+` + fakeLatexmkScript
+
+func TestExtraTexInputsProvidePrivatePackages(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkNeedingPackage})
+
+	document := "\\documentclass{article}\n\\usepackage{teamstyle}\n\\begin{document}\nHi\n\\end{document}"
+	files := []FileEntry{{Path: "main.tex", Content: document}}
+	if result := New().Compile(files, time.Now(), "", CompileOptions{}); result.Success {
+		t.Fatalf("expected the compile to fail without the package directory")
+	}
+
+	packages := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(packages, "tex"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(packages, "tex", "teamstyle.sty"), []byte("\\ProvidesPackage{teamstyle}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetExtraTexInputs([]string{filepath.Join(packages, "tex")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetExtraTexInputs(nil) })
+
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if !result.Success {
+		t.Fatalf("expected the package from EXTRA_TEXINPUTS to be found: %s %s", result.ErrorMessage, result.Stdout)
+	}
+}
+
+func TestExtraTexInputsRejectsInvalidDirectories(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file.sty")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"relative/texmf", file, "/does/not/exist"} {
+		if err := SetExtraTexInputs([]string{dir}); err == nil {
+			t.Fatalf("expected %s to be rejected", dir)
+		}
+	}
+}
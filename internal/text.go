@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// extractText runs pdftotext on the compiled PDF when requested. Every page
+// is kept so the cached copy can answer requests with or without textPerPage.
+func (s *compileSession) extractText() *PDFText {
+	if !s.options.ReturnText {
+		return nil
+	}
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		log.Printf("[%s] Warning: text extraction unavailable, pdftotext is not installed", s.compiler.RequestID)
+		return nil
+	}
+
+	output, err := s.command("pdftotext", "-enc", "UTF-8", s.pdfPath, "-").Output()
+	if err != nil {
+		log.Printf("[%s] Warning: pdftotext failed: %v", s.compiler.RequestID, err)
+		return nil
+	}
+
+	text := parsePdftotext(string(output))
+	if !text.HasTextLayer {
+		log.Printf("[%s] PDF has no text layer (%d image-only pages)", s.compiler.RequestID, len(text.EmptyPages))
+	}
+	return text
+}
+
+// parsePdftotext splits pdftotext's output, which ends each page with a form
+// feed, into trimmed pages
+func parsePdftotext(output string) *PDFText {
+	pages := strings.Split(output, "\f")
+	if len(pages) > 1 && strings.TrimSpace(pages[len(pages)-1]) == "" {
+		pages = pages[:len(pages)-1]
+	}
+
+	text := &PDFText{Pages: make([]string, len(pages))}
+	var nonEmpty []string
+	for i, page := range pages {
+		page = strings.TrimSpace(page)
+		text.Pages[i] = page
+		if page == "" {
+			text.EmptyPages = append(text.EmptyPages, i+1)
+			continue
+		}
+		nonEmpty = append(nonEmpty, page)
+	}
+	text.Text = strings.Join(nonEmpty, "\n\n")
+	text.HasTextLayer = len(nonEmpty) > 0
+	return text
+}
+
+// textResult shapes extracted text for the request, leaving out the per-page
+// split unless it was asked for
+func (s *compileSession) textResult(text *PDFText) *PDFText {
+	if text == nil || !s.options.ReturnText {
+		return nil
+	}
+	if s.options.TextPerPage {
+		return text
+	}
+	shaped := *text
+	shaped.Pages = nil
+	return &shaped
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLatexmkWithText writes the main file's prose lines into the fake PDF,
+// and fakePdftotext prints them back as the text layer of one page.
+var (
+	fakeLatexmkWithText = fakeLatexmkScript + `grep -v '^\\' "$last" >> "$job.pdf"
+`
+	fakePdftotext = `grep -v '^%' "$3"; printf '\f'
+`
+)
+
+func TestCompileReturnsExtractedText(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithText, "pdftotext": fakePdftotext})
+	projectID := "extracted-text-test"
+	forgetProject(t, projectID)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), projectID, CompileOptions{ReturnText: true, TextPerPage: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if result.Text == nil || !strings.Contains(result.Text.Text, "Hello from Octree!") || !result.Text.HasTextLayer {
+		t.Fatalf("expected the source's phrase in the text layer, got %+v", result.Text)
+	}
+	if len(result.Text.Pages) != 1 {
+		t.Fatalf("expected one page of text, got %q", result.Text.Pages)
+	}
+
+	// The text is cached with the PDF
+	cached := New().Compile(files, time.Now(), projectID, CompileOptions{ReturnText: true})
+	if !cached.CacheHit || cached.Text == nil || cached.Text.Text != result.Text.Text || cached.Text.Pages != nil {
+		t.Fatalf("expected the cached text without pages, got hit=%v %+v", cached.CacheHit, cached.Text)
+	}
+}
+
+func TestParsePdftotextReportsImageOnlyPages(t *testing.T) {
+	got := parsePdftotext("Introduction\n\nSome text\f\f  \n\fConclusion\n\f")
+	want := &PDFText{
+		Text:         "Introduction\n\nSome text\n\nConclusion",
+		Pages:        []string{"Introduction\n\nSome text", "", "", "Conclusion"},
+		HasTextLayer: true,
+		EmptyPages:   []int{2, 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if scanned := parsePdftotext("\f\f"); scanned.HasTextLayer || scanned.Text != "" || !reflect.DeepEqual(scanned.EmptyPages, []int{1, 2}) {
+		t.Fatalf("expected an image-only PDF to have no text layer, got %+v", scanned)
+	}
+}
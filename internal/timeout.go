@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// compilationTimeout bounds the toolchain run of each compile; 0 disables it
+var compilationTimeout time.Duration
+
+// SetCompilationTimeout sets how long a compile's toolchain may run before it
+// is killed (0 = unlimited)
+func SetCompilationTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	compilationTimeout = d
+}
+
+// startTimeout gives the compile's toolchain commands a deadline of
+// compilationTimeout and returns the function releasing it
+func (s *compileSession) startTimeout() context.CancelFunc {
+	parent := s.options.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	if compilationTimeout <= 0 {
+		s.toolchainCtx = parent
+		return func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(parent, compilationTimeout)
+	s.toolchainCtx = ctx
+	return cancel
+}
+
+// timedOut reports whether the toolchain was killed at the deadline
+func (s *compileSession) timedOut() bool {
+	return s.toolchainCtx != nil && errors.Is(s.toolchainCtx.Err(), context.DeadlineExceeded)
+}
+
+// abandonTimedOut fails a compile killed at its deadline. The workspace may
+// hold half-written auxiliary files, so it is removed and a project's next
+// compile starts from scratch.
+func (s *compileSession) abandonTimedOut(cache *CompilationCache) *CompileResult {
+	log.Printf("[%s] Compilation timed out after %s", s.compiler.RequestID, compilationTimeout)
+
+	if s.projectID != "" {
+		cache.Set(s.projectID, &CacheEntry{ProjectID: s.projectID, ClientID: s.options.ClientID})
+	}
+	s.shouldCleanup = true
+
+	err := fmt.Errorf("%w after %s", ErrCompileTimeout, compilationTimeout)
+	return s.failToolchain(err)
+}
+
+// failToolchain fails the compile with err, keeping the toolchain output and
+// the tail of whatever log the engine got to write
+func (s *compileSession) failToolchain(err error) *CompileResult {
+	logContent := ""
+	if logData, readErr := os.ReadFile(s.logPath); readErr == nil {
+		logContent = string(logData)
+	}
+	s.metadata.LogTail = tailLines(logContent, LogTailLines)
+	s.metadata.PeakRssKb = s.peakRssKb
+
+	result := s.compiler.failWith(s.metadata, err, s.queueMs, s.receivedAt)
+	result.Stdout = truncateText(s.stdout.String(), MaxLogChars)
+	result.Stderr = truncateText(s.stderr.String(), MaxLogChars)
+	result.LogTail = s.metadata.LogTail
+	result.PeakRssKb = s.peakRssKb
+	result.Passes = s.passes
+	result.Sarif = s.sarif(logContent)
+	result.FullLog = s.fullLog(logContent)
+	result.Errors = s.latexErrors(logContent)
+	return result
+}
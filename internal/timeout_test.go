@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLatexmkHanging writes a log and then hangs, with a child process
+// holding its output open, as a runaway engine run does.
+const fakeLatexmkHanging = `echo "Runaway log line" > main.log
+sleep 30
+`
+
+func TestCompilationTimeoutKillsToolchain(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkHanging})
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	SetCompilationTimeout(300 * time.Millisecond)
+	t.Cleanup(func() { SetCompilationTimeout(0) })
+
+	started := time.Now()
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("expected the toolchain to be killed at the timeout, took %s", elapsed)
+	}
+
+	if result.Success || result.ErrorCode != "COMPILE_TIMEOUT" || !strings.Contains(result.ErrorMessage, "timed out after 300ms") {
+		t.Fatalf("expected COMPILE_TIMEOUT, got success=%v code=%q: %s", result.Success, result.ErrorCode, result.ErrorMessage)
+	}
+	if !strings.Contains(result.LogTail, "Runaway log line") {
+		t.Fatalf("expected the partial log tail, got %q", result.LogTail)
+	}
+
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Fatalf("expected the temp directory to be removed, found %v", entries)
+	}
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// timingLogPrefix tags the package load times typed out by packageTimingHooks
+const timingLogPrefix = "[octree-timing]"
+
+// packageTimingHooks logs \pdfelapsedtime before and after every package load.
+// Engines without \pdfelapsedtime (xelatex, lualatex) or LaTeX kernels without
+// hooks skip it, leaving only the latexmk rule timings.
+const packageTimingHooks = `\ifdefined\pdfelapsedtime\ifdefined\AddToHook` +
+	`\AddToHook{package/before}{\typeout{` + timingLogPrefix + ` begin \CurrentFile\space\the\pdfelapsedtime}}` +
+	`\AddToHook{package/after}{\typeout{` + timingLogPrefix + ` end \CurrentFile\space\the\pdfelapsedtime}}` +
+	`\fi\fi`
+
+var (
+	// latexmk -time reports each rule run, e.g. "'pdflatex': time = 0.52"
+	ruleTimingPattern = regexp.MustCompile(`'([^']+)': time = ([\d.]+)`)
+	// ... and the total, "Accumulated processing time = 1.23" in older
+	// releases or "Processing time = 1.23, of which ..." in newer ones
+	processingTimePattern = regexp.MustCompile(`(?:Accumulated processing time|Processing time) = ([\d.]+)`)
+	packageTimingPattern  = regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(timingLogPrefix) + ` (begin|end) (\S+) (\d+)$`)
+)
+
+// parseTimings builds the timing breakdown from latexmk's -time report and
+// the package load times in the final log. It returns nil when neither has
+// any data.
+func parseTimings(latexmkOutput, logContent string) *CompileTimings {
+	timings := &CompileTimings{}
+
+	ruleIndex := map[string]int{}
+	for _, m := range ruleTimingPattern.FindAllStringSubmatch(latexmkOutput, -1) {
+		i, ok := ruleIndex[m[1]]
+		if !ok {
+			i = len(timings.Rules)
+			ruleIndex[m[1]] = i
+			timings.Rules = append(timings.Rules, RuleTiming{Rule: m[1]})
+		}
+		timings.Rules[i].Runs++
+		timings.Rules[i].Ms += secondsToMs(m[2])
+	}
+	if m := processingTimePattern.FindAllStringSubmatch(latexmkOutput, -1); m != nil {
+		timings.ProcessingMs = secondsToMs(m[len(m)-1][1])
+	}
+
+	started := map[string]int64{}
+	for _, m := range packageTimingPattern.FindAllStringSubmatch(unwrapLogLines(logContent), -1) {
+		// \pdfelapsedtime counts in 1/65536 s
+		at, _ := strconv.ParseInt(m[3], 10, 64)
+		if m[1] == "begin" {
+			started[m[2]] = at
+			continue
+		}
+		if begin, ok := started[m[2]]; ok {
+			timings.Packages = append(timings.Packages, PackageTiming{
+				Name: m[2],
+				Ms:   (at - begin) * 1000 / 65536,
+			})
+			delete(started, m[2])
+		}
+	}
+	sort.SliceStable(timings.Packages, func(i, j int) bool {
+		return timings.Packages[i].Ms > timings.Packages[j].Ms
+	})
+
+	if len(timings.Rules) == 0 && len(timings.Packages) == 0 && timings.ProcessingMs == 0 {
+		return nil
+	}
+	return timings
+}
+
+func secondsToMs(seconds string) int64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(seconds), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(value * 1000))
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const timingLog = `This is pdfTeX, Version 3.141592653-2.6-1.40.25
+[octree-timing] begin amsmath.sty 65536
+[octree-timing] begin amsgen.sty 70000
+[octree-timing] end amsgen.sty 72000
+[octree-timing] end amsmath.sty 98304
+[octree-timing] begin tikz.sty 98304
+[octree-timing] end tikz.sty 229376
+Output written on main.pdf (1 page, 12345 bytes).
+`
+
+// fakeLatexmkWithTiming prints latexmk's -time report when asked for it.
+var fakeLatexmkWithTiming = fakeLatexmkWithLog(timingLog) + `for arg; do
+	[ "$arg" = "-time" ] && printf "'pdflatex': time = 0.52\n'bibtex main': time = 0.03\n'pdflatex': time = 0.40\nAccumulated processing time = 1.01\n"
+done
+`
+
+func TestCompileReturnsTimingsWhenRequested(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithTiming})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnTimings: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+
+	args := readArgs()
+	if !containsString(args, "-time") {
+		t.Fatalf("expected latexmk to run with -time, got %v", args)
+	}
+	hooked := false
+	for _, arg := range args {
+		hooked = hooked || strings.HasPrefix(arg, "-pretex=") && strings.Contains(arg, `\AddToHook{package/before}`)
+	}
+	if !hooked {
+		t.Fatalf("expected package timing hooks in -pretex, got %v", args)
+	}
+
+	timings := result.Timings
+	if timings == nil {
+		t.Fatalf("expected timings to be returned")
+	}
+	if timings.ProcessingMs != 1010 {
+		t.Fatalf("expected 1010ms processing time, got %d", timings.ProcessingMs)
+	}
+	if len(timings.Rules) != 2 || timings.Rules[0] != (RuleTiming{Rule: "pdflatex", Runs: 2, Ms: 920}) {
+		t.Fatalf("unexpected rule timings: %+v", timings.Rules)
+	}
+	if len(timings.Packages) != 3 || timings.Packages[0] != (PackageTiming{Name: "tikz.sty", Ms: 2000}) || timings.Packages[1] != (PackageTiming{Name: "amsmath.sty", Ms: 500}) {
+		t.Fatalf("unexpected package timings: %+v", timings.Packages)
+	}
+}
+
+func TestCompileOmitsTimingsByDefault(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithTiming})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{})
+	if result.Timings != nil || containsString(readArgs(), "-time") {
+		t.Fatalf("timings must only be collected when requested")
+	}
+}
@@ -1,6 +1,9 @@
 package internal
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // FileEntry represents a single file in a multi-file project
 type FileEntry struct {
@@ -11,19 +14,127 @@ type FileEntry struct {
 
 // CompileRequest represents the incoming compilation request
 type CompileRequest struct {
-	Files            []FileEntry `json:"files"`
-	ProjectID        string      `json:"projectId,omitempty"`
-	LastModifiedFile string      `json:"lastModifiedFile,omitempty"`
+	Files               []FileEntry       `json:"files"`
+	ProjectID           string            `json:"projectId,omitempty"`
+	CacheNamespace      string            `json:"cacheNamespace,omitempty"` // Isolates the cache entries of tenants sharing project IDs
+	LastModifiedFile    string            `json:"lastModifiedFile,omitempty"`
+	ReturnManifest      bool              `json:"returnManifest,omitempty"`      // Return the \listfiles package manifest
+	JobName             string            `json:"jobName,omitempty"`             // Override the output base name
+	MainFile            string            `json:"mainFile,omitempty"`            // Path of the root document; detected when empty
+	LatexRelease        string            `json:"latexRelease,omitempty"`        // Roll the LaTeX kernel back to this date (YYYY-MM-DD) via latexrelease
+	ReturnMemoryUsage   bool              `json:"returnMemoryUsage,omitempty"`   // Return TeX's memory usage statistics
+	ReturnSynctex       bool              `json:"returnSynctex,omitempty"`       // Return the SyncTeX data (gzip by default)
+	SynctexUncompressed bool              `json:"synctexUncompressed,omitempty"` // Return SyncTeX as plain text instead of gzip
+	ReturnXdv           bool              `json:"returnXdv,omitempty"`           // Return xelatex's .xdv intermediate (xelatex projects only)
+	ReturnTimings       bool              `json:"returnTimings,omitempty"`       // Return per-rule and per-package timings
+	ReturnAllAux        bool              `json:"returnAllAux,omitempty"`        // Return every .aux file, keyed by path
+	SplitByChapter      bool              `json:"splitByChapter,omitempty"`      // Also return one PDF per \chapter
+	Env                 map[string]string `json:"env,omitempty"`                 // Variables for the compile subprocesses (ALLOWED_ENV_VARS only)
+	ReturnPassLogs      bool              `json:"returnPassLogs,omitempty"`      // Return each toolchain pass's output and log separately
+	ReturnFloats        bool              `json:"returnFloats,omitempty"`        // Return the figures and tables with their captions and numbers
+	Provenance          bool              `json:"provenance,omitempty"`          // Attach a reproducibility record (provenance.json) to the PDF
+	CpuLimitSeconds     int               `json:"cpuLimitSeconds,omitempty"`     // CPU-time budget, at most the server's MAX_CPU_SECONDS
+	ReturnSarif         bool              `json:"returnSarif,omitempty"`         // Return the log's errors and warnings as SARIF 2.1.0
+	FullLog             bool              `json:"fullLog,omitempty"`             // Return the complete .log instead of only its tail
+	ReturnMacros        bool              `json:"returnMacros,omitempty"`        // Return the user-defined commands and their arity
+	ReturnBibliography  bool              `json:"returnBibliography,omitempty"`  // Return the cited .bib entries as structured records
+	ReturnBibCollisions bool              `json:"returnBibCollisions,omitempty"` // Return duplicate .bib keys and entries sharing a citation label (biber)
+	ForceRebuild        bool              `json:"forceRebuild,omitempty"`        // Ignore the project's cached PDF and workspace and build from scratch
+	OutputFormat        string            `json:"outputFormat,omitempty"`        // "pdf" (default), "png", or "svg"
+	Impose              string            `json:"impose,omitempty"`              // "2up" or "booklet": return the PDF imposed two pages per sheet
+	RenderAllPages      bool              `json:"renderAllPages,omitempty"`      // Render every page instead of only the first (png/svg)
+	SpriteSheet         bool              `json:"spriteSheet,omitempty"`         // Return page thumbnails tiled into one PNG
+	ReturnText          bool              `json:"returnText,omitempty"`          // Return the PDF's text layer, extracted with pdftotext
+	TextPerPage         bool              `json:"textPerPage,omitempty"`         // Also split the returned text by page
+	CallbackURL         string            `json:"callbackUrl,omitempty"`         // Compile asynchronously and POST the result here
+	PartialPdfOnError   *bool             `json:"partialPdfOnError,omitempty"`   // Include a partial PDF in error responses (default true)
+	ContentAddressed    bool              `json:"contentAddressed,omitempty"`    // Name the PDF <sha256>.pdf and mark it immutable
+	IncludeOnly         []string          `json:"includeOnly,omitempty"`         // Compile only these \include files, reusing the others' cached .aux
+	SyncForward         *SourcePosition   `json:"syncForward,omitempty"`         // Locate this source position in the PDF after a successful build
+}
+
+// SourcePosition is a source location for SyncTeX forward search. File is
+// project-relative (the main file when empty); Line is 1-based, and a Column
+// of 0 matches anywhere on the line.
+type SourcePosition struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+}
+
+// wantsPartialPDF reports whether a failed compile's partial PDF should be
+// returned; it defaults to true
+func (r *CompileRequest) wantsPartialPDF() bool {
+	return r.PartialPdfOnError == nil || *r.PartialPdfOnError
+}
+
+// CompileOptions carries optional per-request compile behaviour
+type CompileOptions struct {
+	ReturnManifest      bool                // Inject \listfiles and return the parsed package manifest
+	JobName             string              // Sanitized output base name; derived from the main file when empty
+	MainFile            string              // Requested root document path; findMainFile's guess when empty
+	LatexRelease        string              // Kernel release date loaded with latexrelease before the document
+	ReturnMemoryUsage   bool                // Return the engine's memory usage statistics from the log
+	ReturnSynctex       bool                // Run with -synctex=1 and return the SyncTeX data
+	SynctexUncompressed bool                // Gunzip the SyncTeX data before returning it
+	ReturnXdv           bool                // Keep and return the .xdv when the engine is xelatex
+	ReturnTimings       bool                // Run latexmk -time, log package load times, and return both
+	ReturnAllAux        bool                // Return the workspace's .aux files keyed by relative path
+	SplitByChapter      bool                // Log chapter start pages and split the PDF with qpdf
+	Env                 map[string]string   // Request variables for the toolchain, checked against the allowlist
+	ReturnPassLogs      bool                // Keep each pass's output and log tail
+	ReturnFloats        bool                // List figure/table environments, numbered from the .aux
+	Provenance          bool                // Inject \listfiles and attach a ProvenanceRecord to the PDF with qpdf
+	CpuLimitSeconds     int                 // Requested CPU-time budget; the server's maxCpuSeconds still applies
+	ReturnSarif         bool                // Serialize the final log's diagnostics as SARIF
+	FullLog             bool                // Return the untruncated .log alongside its tail
+	ReturnMacros        bool                // List \newcommand/\def-style definitions in the sources
+	ReturnBibliography  bool                // Parse the .bib entries the build cited
+	ReturnBibCollisions bool                // Report biber's duplicate keys and disambiguated labels
+	ForceRebuild        bool                // Skip the cached PDF and replace the project's workspace with a fresh one
+	OutputFormat        string              // Normalized format; png and svg render the PDF after the build
+	Impose              string              // Normalized imposition ("2up", "booklet"); applied after the build, the cache keeps the original
+	RenderAllPages      bool                // Render every page rather than the first
+	SpriteSheet         bool                // Tile page thumbnails into one PNG after the build
+	ReturnText          bool                // Extract the PDF's text with pdftotext; cached with the PDF
+	TextPerPage         bool                // Keep the per-page split of the extracted text
+	Context             context.Context     // Cancelled when a newer request for the project supersedes this one; nil never cancels
+	ClientID            string              // Requesting client (IP), used for per-client cache caps
+	CacheNamespace      string              // Prefixed onto the project ID for cache keys and locks
+	SourceDateEpoch     int64               // Fixed SOURCE_DATE_EPOCH for reproducible output (0 = current time)
+	Progress            func(ProgressEvent) // Called on each stage transition, if set
+	IncludeOnly         []string            // Sanitized \include names to inject as \includeonly on cached workspaces
+	SyncForward         *SourcePosition     // Run with -synctex=1 and locate this source position in the PDF
+}
+
+// wantsBuildOutputs reports whether the request asked for build data besides
+// the PDF (manifest, memory, SyncTeX, XDV, timings, .aux files, chapters,
+// pass logs, floats, SARIF diagnostics, the full log, macros, the
+// bibliography or its collisions, or a forward sync target)
+func (o CompileOptions) wantsBuildOutputs() bool {
+	return o.ReturnManifest || o.ReturnMemoryUsage || o.ReturnSynctex || o.ReturnXdv ||
+		o.ReturnTimings || o.ReturnAllAux || o.SplitByChapter || o.ReturnPassLogs || o.ReturnFloats ||
+		o.ReturnSarif || o.FullLog || o.ReturnMacros || o.ReturnBibliography || o.ReturnBibCollisions ||
+		o.SyncForward != nil
+}
+
+// writesSynctex reports whether the engine must write a .synctex.gz
+func (o CompileOptions) writesSynctex() bool {
+	return o.ReturnSynctex || o.SyncForward != nil
 }
 
 // CompileJob represents a queued compilation job
 type CompileJob struct {
+	RequestID        string      // Pre-assigned request ID (async jobs); generated by the worker when empty
 	Context          interface{} // Will be *gin.Context
 	Files            []FileEntry // Multi-file content
 	ProjectID        string      // Project identifier for caching
 	LastModifiedFile string      // Hint for which file changed
+	Options          CompileOptions
 	EnqueuedAt       time.Time
 	ResultChan       chan *CompileResult // Channel to send result back to handler
+	cancel           context.CancelFunc  // Cancels Options.Context, see compileRegistry
+	inflight         *inflightCompile    // Set while identical requests may wait on this job, see joinInFlight
 }
 
 // CompileMetadata tracks compilation metadata for logging
@@ -43,22 +154,472 @@ type compileMetadata struct {
 	LogTail     string    `json:"logTail,omitempty"`
 	Error       string    `json:"error,omitempty"`
 	Engine      string    `json:"engine,omitempty"`
+	PeakRssKb   int64     `json:"peakRssKb,omitempty"`
 }
 
 // CompileResult holds the result of a compilation
 type CompileResult struct {
-	RequestID    string
-	Success      bool
-	PDFData      []byte
-	SHA256       string
-	ErrorMessage string
-	Stdout       string
-	Stderr       string
-	LogTail      string
-	QueueMs      int64
-	DurationMs   int64
-	PDFSize      int
-	CacheHit     bool // Whether result was served from cache
+	RequestID        string
+	Success          bool
+	PDFData          []byte
+	SHA256           string
+	VisualHash       string // SHA256 with volatile metadata normalized out, see visualHash
+	ErrorMessage     string
+	ErrorCode        string // Structured error code, see errors.go
+	Stdout           string
+	Stderr           string
+	LogTail          string
+	FullLog          string          // Complete .log, when requested
+	Errors           []LatexError    // Errors parsed from the log of a failed compile
+	Warnings         []LatexWarning  // Reference, citation, and box warnings of a successful compile
+	WarningSummary   *WarningSummary // Warning categories present in a successful compile's log
+	QueueMs          int64
+	DurationMs       int64
+	PDFSize          int
+	PeakRssKb        int64               // Peak resident memory of the toolchain processes
+	CacheHit         bool                // Whether result was served from cache
+	Manifest         []PackageInfo       // Packages and versions reported by \listfiles
+	Undefined        UndefinedReferences // Unresolved \ref/\cite targets from the final log
+	Memory           *MemoryUsage        // TeX memory statistics, when requested
+	Synctex          []byte              // SyncTeX data (gzip unless uncompressed was requested)
+	Xdv              []byte              // xelatex's .xdv intermediate, when requested
+	Timings          *CompileTimings     // Per-rule and per-package timings, when requested
+	AuxFiles         map[string]string   // Workspace-relative path -> .aux content, when requested
+	Chapters         []ChapterPDF        // Per-chapter PDFs, when requested
+	Passes           []PassLog           // Per-pass output, when requested
+	Floats           *FloatInventory     // Figures and tables, when requested
+	Macros           []MacroDefinition   // User-defined commands, when requested
+	Bibliography     []BibEntry          // Cited bibliography entries, when requested
+	BibCollisions    []BibCollision      // Duplicate keys and label collisions, when requested
+	Artifacts        [][]byte            // Rendered pages in order, for png/svg output
+	ArtifactMimeType string              // MIME type of Artifacts
+	SpriteSheet      *SpriteSheet        // Page thumbnails in one PNG, when requested
+	Text             *PDFText            // The PDF's text layer, when requested
+	SyncTarget       *SyncTarget         // PDF location of the syncForward position, when found
+	Sarif            *SarifLog           // Log diagnostics as SARIF, when requested
+	ProvenanceError  string              // Why the requested provenance record is missing from the PDF
+}
+
+// LatexError is one error from the log, located by -file-line-error
+type LatexError struct {
+	File    string `json:"file"` // Relative to the main file's directory
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	Context string `json:"context,omitempty"` // TeX's explanation and "l.<line>" source excerpt
+	Source  string `json:"source,omitempty"`  // The full source line, from the request's files
+	Column  int    `json:"column,omitempty"`  // 1-based column where TeX stopped reading Source, when known
+	Hint    string `json:"hint,omitempty"`    // Plain-language explanation of cryptic errors, e.g. runaway arguments
+}
+
+// LatexWarning is a warning from the log that leaves a visible flaw in the
+// PDF: an undefined reference or citation (?? in the text) or a bad box
+type LatexWarning struct {
+	Kind    string `json:"kind"`          // undefined-reference, undefined-citation, overfull-box, underfull-box
+	Key     string `json:"key,omitempty"` // Label or citation key, for undefined ones
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"` // Input line, or the first line of the box's paragraph
+}
+
+// WarningSummary flags each warning category the final log contains; false
+// means the build is clean in that respect
+type WarningSummary struct {
+	UndefinedRefs      bool `json:"undefinedRefs"`
+	UndefinedCitations bool `json:"undefinedCitations"`
+	Overfull           bool `json:"overfull"`
+	Underfull          bool `json:"underfull"`
+	FontWarnings       bool `json:"fontWarnings"`
+}
+
+// UndefinedReferences lists \ref and \cite targets LaTeX could not resolve
+// (rendered as ?? in the PDF)
+type UndefinedReferences struct {
+	ReferenceCount int      `json:"referenceCount"`
+	References     []string `json:"references,omitempty"`
+	CitationCount  int      `json:"citationCount"`
+	Citations      []string `json:"citations,omitempty"`
+}
+
+// SourceRequest is the payload of the parsing endpoints (/table/extract,
+// /metadata/extract, /citations/check): either raw content or a set of
+// project files
+type SourceRequest struct {
+	Content string      `json:"content,omitempty"`
+	Files   []FileEntry `json:"files,omitempty"`
+}
+
+// DetexRequest is the payload of POST /detex
+type DetexRequest struct {
+	SourceRequest
+	KeepMath bool `json:"keepMath,omitempty"` // Keep math as LaTeX source instead of dropping it
+}
+
+// DetexResponse is the prose of a document with its markup stripped
+type DetexResponse struct {
+	MainFile string `json:"mainFile"`
+	Text     string `json:"text"`
+}
+
+// RenderRequest is the payload of POST /render: a compiled PDF and the pages
+// to rasterize
+type RenderRequest struct {
+	PdfData   string `json:"pdfData"`             // Base64-encoded PDF
+	FirstPage int    `json:"firstPage,omitempty"` // 1-based; defaults to 1
+	LastPage  int    `json:"lastPage,omitempty"`  // Inclusive; defaults to FirstPage
+	DPI       int    `json:"dpi,omitempty"`       // Defaults to RenderDPI
+}
+
+// RenderResponse holds the rendered pages in order
+type RenderResponse struct {
+	PageCount int            `json:"pageCount"` // Pages in the whole PDF
+	DPI       int            `json:"dpi"`
+	Pages     []RenderedPage `json:"pages"`
+}
+
+// RenderedPage is one page rasterized to PNG
+type RenderedPage struct {
+	Page    int    `json:"page"`
+	Width   int    `json:"width"`  // Pixels
+	Height  int    `json:"height"` // Pixels
+	PngData string `json:"pngData"`
+}
+
+// SpriteSheet is a PNG of page thumbnails in a grid of equal cells, filled
+// row by row: page n (from 1) is in column (n-1) % columns, row (n-1) / columns
+type SpriteSheet struct {
+	PngData    string `json:"pngData"`
+	Pages      int    `json:"pages"` // Cells in use, at most MaxSpritePages
+	Columns    int    `json:"columns"`
+	Rows       int    `json:"rows"`
+	CellWidth  int    `json:"cellWidth"`  // Pixels
+	CellHeight int    `json:"cellHeight"` // Pixels
+}
+
+// PDFText is a PDF's text layer as pdftotext reads it. Pages without text,
+// such as scanned images, are listed in EmptyPages (from 1).
+type PDFText struct {
+	Text         string   `json:"text"` // Every page's text, separated by blank lines
+	Pages        []string `json:"pages,omitempty"`
+	HasTextLayer bool     `json:"hasTextLayer"`
+	EmptyPages   []int    `json:"emptyPages,omitempty"`
+}
+
+// SyncTarget is where a source position was typeset: synctex's x and y, in
+// big points from the top-left corner of the page
+type SyncTarget struct {
+	Page int     `json:"page"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+}
+
+// ExtractedTable is one tabular/tabularx/longtable environment with its cells
+// converted to plain text. \multicolumn cells are followed by empty cells so
+// that columns stay aligned.
+type ExtractedTable struct {
+	File        string     `json:"file,omitempty"`
+	Line        int        `json:"line"`
+	Environment string     `json:"environment"`
+	Columns     string     `json:"columns"`
+	Rows        [][]string `json:"rows"`
+}
+
+// MetadataExtractResponse holds the front matter parsed from a document
+type MetadataExtractResponse struct {
+	Title    string   `json:"title,omitempty"`
+	Authors  []string `json:"authors,omitempty"`
+	Date     string   `json:"date,omitempty"`
+	Abstract string   `json:"abstract,omitempty"`
+}
+
+// CitationCheckResponse reports \cite keys with no matching .bib entry or
+// \bibitem
+type CitationCheckResponse struct {
+	CitedCount int               `json:"citedCount"` // Unique keys cited
+	EntryCount int               `json:"entryCount"` // Unique keys defined
+	Missing    []MissingCitation `json:"missing"`
+}
+
+// MissingCitation is one citation of an undefined key
+type MissingCitation struct {
+	Key  string `json:"key"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// BibValidationResponse reports the problems biber finds in .bib files
+type BibValidationResponse struct {
+	Valid     bool       `json:"valid"`     // No issue of severity "error"
+	FileCount int        `json:"fileCount"` // .bib files checked
+	Issues    []BibIssue `json:"issues"`
+}
+
+// BibIssue is one syntax error or data-model violation in a .bib file
+type BibIssue struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Key      string `json:"key,omitempty"`   // Entry the issue is in
+	Field    string `json:"field,omitempty"` // Field the issue is about, when named
+	Severity string `json:"severity"`        // "error" or "warning"
+	Message  string `json:"message"`
+}
+
+// TableExtractResponse lists the tables found in the request sources
+type TableExtractResponse struct {
+	Tables []ExtractedTable `json:"tables"`
+}
+
+// PassLog is the output of one toolchain invocation: a latexmk run (which
+// performs all engine and bibliography passes it needs) or the pythontex helper
+type PassLog struct {
+	Stage    string   `json:"stage"` // "initial", "pythontex", or "post-pythontex"
+	ExitCode int      `json:"exitCode"`
+	Rules    []string `json:"rules,omitempty"`   // Rules latexmk ran, in order, one entry per run
+	Output   string   `json:"output,omitempty"`  // Tail of stdout and stderr
+	LogTail  string   `json:"logTail,omitempty"` // Tail of the .log after an engine pass
+}
+
+// ChapterPDF is one chapter cut out of the compiled PDF
+type ChapterPDF struct {
+	Title     string // Numbered plain-text title, e.g. "1 Introduction"
+	FirstPage int    // Physical pages in the full PDF, 1-based and inclusive
+	LastPage  int
+	PDFData   []byte
+}
+
+// ChapterResponse is the JSON form of a ChapterPDF
+type ChapterResponse struct {
+	Title     string `json:"title"`
+	FirstPage int    `json:"firstPage"`
+	LastPage  int    `json:"lastPage"`
+	PdfBuffer string `json:"pdfBuffer"` // Base64-encoded PDF
+}
+
+// FloatInventory counts a document's figure and table environments and lists
+// them in source order
+type FloatInventory struct {
+	FigureCount int         `json:"figureCount"`
+	TableCount  int         `json:"tableCount"`
+	Floats      []FloatInfo `json:"floats"`
+}
+
+// FloatInfo is one figure or table environment
+type FloatInfo struct {
+	Environment  string `json:"environment"`            // figure, figure*, table, or table*
+	Number       string `json:"number,omitempty"`       // As typeset ("3", "2.1"), from the .aux
+	Caption      string `json:"caption,omitempty"`      // Plain text of the \caption
+	ShortCaption string `json:"shortCaption,omitempty"` // The \caption[short] list-of form, if given
+	Label        string `json:"label,omitempty"`
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+}
+
+// CompileTimings breaks a compile's time down for performance debugging
+type CompileTimings struct {
+	ProcessingMs int64           `json:"processingMs,omitempty"` // latexmk's total processing time
+	Rules        []RuleTiming    `json:"rules,omitempty"`
+	Packages     []PackageTiming `json:"packages,omitempty"` // Slowest first
+}
+
+// RuleTiming is the time latexmk spent in one rule (an engine pass, bibtex,
+// makeindex, ...) over all its runs
+type RuleTiming struct {
+	Rule string `json:"rule"`
+	Runs int    `json:"runs"`
+	Ms   int64  `json:"ms"`
+}
+
+// PackageTiming is the load time of one package in the final engine pass,
+// including the packages it loads itself
+type PackageTiming struct {
+	Name string `json:"name"`
+	Ms   int64  `json:"ms"`
+}
+
+// MemoryUsage is the engine's end-of-run memory report
+type MemoryUsage struct {
+	Stats    []MemoryStat `json:"stats"`
+	Warnings []string     `json:"warnings,omitempty"` // Pools at or above 90% of their limit
+}
+
+// MemoryStat is the usage of one TeX memory pool, named after its texmf.cnf
+// parameter (main_memory, pool_size, ...)
+type MemoryStat struct {
+	Name      string  `json:"name"`
+	Used      int64   `json:"used"`
+	Limit     int64   `json:"limit"`
+	Percent   float64 `json:"percent"`
+	NearLimit bool    `json:"nearLimit,omitempty"`
+}
+
+// BibCollision is a clash in the bibliography: a key defined more than once
+// (biber keeps the first definition), or entries sharing a citation label
+// that biber told apart with a letter, as in "Smith 2020a/b"
+type BibCollision struct {
+	Kind  string   `json:"kind"`           // duplicate-key or label
+	Label string   `json:"label"`          // The duplicate key, or the shared label, e.g. "Smith 2020" or "Smi20"
+	Keys  []string `json:"keys"`           // Entries sharing the label, in .bbl order
+	File  string   `json:"file,omitempty"` // .bib file holding a duplicate key
+}
+
+// BibEntry is one parsed .bib entry, with TeX grouping and escapes removed.
+// Names are "First Last"; Fields holds every field by lowercased name.
+type BibEntry struct {
+	Key       string            `json:"key"`
+	Type      string            `json:"type,omitempty"` // Lowercased, e.g. article, inproceedings
+	Authors   []string          `json:"authors,omitempty"`
+	Editors   []string          `json:"editors,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Year      string            `json:"year,omitempty"`    // From year, else biblatex's date
+	Journal   string            `json:"journal,omitempty"` // journal or biblatex's journaltitle
+	Booktitle string            `json:"booktitle,omitempty"`
+	Publisher string            `json:"publisher,omitempty"` // publisher, institution, or school
+	Volume    string            `json:"volume,omitempty"`
+	Number    string            `json:"number,omitempty"`
+	Pages     string            `json:"pages,omitempty"`
+	DOI       string            `json:"doi,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// MacroDefinition is one user-defined command, for editor autocompletion
+type MacroDefinition struct {
+	Name          string `json:"name"`                    // With its backslash, e.g. \vect
+	Definer       string `json:"definer"`                 // newcommand, renewcommand*, def, DeclareMathOperator, ...
+	Arity         int    `json:"arity"`                   // Number of arguments, including an optional first one
+	OptionalFirst bool   `json:"optionalFirst,omitempty"` // The first argument is optional, with a default
+	File          string `json:"file"`
+	Line          int    `json:"line"`
+}
+
+// SarifLog is a SARIF 2.1.0 log of a compile's errors and warnings, for
+// code-scanning tools
+type SarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SarifRun `json:"runs"`
+}
+
+// SarifRun is the single run of a SarifLog
+type SarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name  string      `json:"name"`
+			Rules []SarifRule `json:"rules,omitempty"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []SarifResult `json:"results"`
+}
+
+// SarifRule describes a rule ID, e.g. "latex/undefined-reference" or
+// "package/hyperref"
+type SarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription SarifMessage `json:"shortDescription"`
+}
+
+// SarifResult is one error or warning
+type SarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"` // "error", "warning", or "note"
+	Message   SarifMessage    `json:"message"`
+	Locations []SarifLocation `json:"locations"`
+}
+
+// SarifMessage is a SARIF plain-text message
+type SarifMessage struct {
+	Text string `json:"text"`
+}
+
+// SarifLocation points a result at a project file and, when known, a line
+type SarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *SarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+// SarifRegion is the 1-based source line of a result
+type SarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// ProvenanceRecord is the reproducibility manifest attached to the PDF as
+// provenance.json
+type ProvenanceRecord struct {
+	Engine          string        `json:"engine"`
+	Packages        []PackageInfo `json:"packages"`        // The \listfiles manifest
+	Fonts           []string      `json:"fonts,omitempty"` // Font files embedded by the engine, when logged
+	SourceSHA256    string        `json:"sourceSha256"`    // Hash of the source file set
+	CompiledAt      time.Time     `json:"compiledAt"`
+	SourceDateEpoch int64         `json:"sourceDateEpoch,omitempty"` // Fixed timestamp the PDF was built with
+}
+
+// PackageInfo is a single entry of the \listfiles manifest
+type PackageInfo struct {
+	Name    string `json:"name"`
+	Date    string `json:"date,omitempty"`
+	Version string `json:"version,omitempty"`
+	Info    string `json:"info,omitempty"`
+}
+
+// CompileResponse is the JSON form of a successful compilation, returned when
+// the client asks for structured data alongside the PDF
+type CompileResponse struct {
+	RequestID        string              `json:"requestId"`
+	SHA256           string              `json:"sha256"`
+	VisualHash       string              `json:"visualHash"` // Unchanged when only timestamps/producer/ID differ
+	QueueMs          int64               `json:"queueMs"`
+	DurationMs       int64               `json:"durationMs"`
+	PDFSize          int                 `json:"pdfSize"`
+	CacheHit         bool                `json:"cacheHit"`
+	PdfBuffer        string              `json:"pdfBuffer"` // Base64-encoded PDF
+	Manifest         []PackageInfo       `json:"manifest,omitempty"`
+	Undefined        UndefinedReferences `json:"undefined"`
+	Memory           *MemoryUsage        `json:"memory,omitempty"`
+	Synctex          string              `json:"synctex,omitempty"` // Base64-encoded SyncTeX data
+	SynctexGzip      bool                `json:"synctexGzip,omitempty"`
+	Xdv              string              `json:"xdv,omitempty"` // Base64-encoded .xdv (xelatex only)
+	Timings          *CompileTimings     `json:"timings,omitempty"`
+	AuxFiles         map[string]string   `json:"auxFiles,omitempty"` // Path -> .aux content
+	Chapters         []ChapterResponse   `json:"chapters,omitempty"`
+	Passes           []PassLog           `json:"passes,omitempty"`
+	Floats           *FloatInventory     `json:"floats,omitempty"`
+	Macros           []MacroDefinition   `json:"macros,omitempty"`
+	Bibliography     []BibEntry          `json:"bibliography,omitempty"`
+	BibCollisions    []BibCollision      `json:"bibCollisions,omitempty"`
+	Artifacts        []string            `json:"artifacts,omitempty"` // Base64-encoded rendered pages, for png/svg output
+	ArtifactMimeType string              `json:"artifactMimeType,omitempty"`
+	SpriteSheet      *SpriteSheet        `json:"spriteSheet,omitempty"`
+	Text             *PDFText            `json:"text,omitempty"`
+	SyncTarget       *SyncTarget         `json:"syncTarget,omitempty"` // PDF location of the requested syncForward position
+	Sarif            *SarifLog           `json:"sarif,omitempty"`
+	FullLog          string              `json:"fullLog,omitempty"` // Complete .log, when requested
+	Warnings         []LatexWarning      `json:"warnings,omitempty"`
+	WarningSummary   *WarningSummary     `json:"warningSummary,omitempty"`
+	ProvenanceError  string              `json:"provenanceError,omitempty"` // The PDF lacks the requested provenance record
+}
+
+// AsyncCompileResponse acknowledges a compile queued with a callback URL
+type AsyncCompileResponse struct {
+	RequestID string `json:"requestId"`
+	Status    string `json:"status"`
+}
+
+// CallbackPayload is POSTed to the callback URL when an async compile finishes
+type CallbackPayload struct {
+	RequestID  string       `json:"requestId"`
+	Status     string       `json:"status"` // "success" or "error"
+	SHA256     string       `json:"sha256,omitempty"`
+	PDFSize    int          `json:"pdfSize,omitempty"`
+	PdfBuffer  string       `json:"pdfBuffer,omitempty"` // Base64-encoded PDF (partial PDF on error, if any)
+	Error      string       `json:"error,omitempty"`
+	Code       string       `json:"code,omitempty"`
+	Log        string       `json:"log,omitempty"`
+	Memory     *MemoryUsage `json:"memory,omitempty"`
+	QueueMs    int64        `json:"queueMs"`
+	DurationMs int64        `json:"durationMs"`
 }
 
 // HealthResponse represents the health check response
@@ -69,15 +630,39 @@ type HealthResponse struct {
 	Timestamp     string `json:"timestamp"`
 }
 
+// ProgressEvent is an estimate of how far a compile has got
+type ProgressEvent struct {
+	RequestID string `json:"requestId"`
+	Stage     string `json:"stage"`
+	Percent   int    `json:"percent"`
+}
+
+// SelfTestResponse reports the outcome of compiling the built-in fixture
+type SelfTestResponse struct {
+	Status         string `json:"status"` // "pass" or "fail"
+	RequestID      string `json:"requestId,omitempty"`
+	QueueMs        int64  `json:"queueMs"`
+	DurationMs     int64  `json:"durationMs"`
+	SHA256         string `json:"sha256,omitempty"`
+	ExpectedSHA256 string `json:"expectedSha256,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error      string `json:"error"`
-	Message    string `json:"message,omitempty"`
-	RequestID  string `json:"requestId,omitempty"`
-	QueueMs    int64  `json:"queueMs,omitempty"`
-	DurationMs int64  `json:"durationMs,omitempty"`
-	Stdout     string `json:"stdout,omitempty"`
-	Stderr     string `json:"stderr,omitempty"`
-	Log        string `json:"log,omitempty"`
-	PdfBuffer  string `json:"pdfBuffer,omitempty"` // Base64-encoded partial PDF if available
+	Error      string       `json:"error"`
+	Code       string       `json:"code,omitempty"`
+	Message    string       `json:"message,omitempty"`
+	RequestID  string       `json:"requestId,omitempty"`
+	QueueMs    int64        `json:"queueMs,omitempty"`
+	DurationMs int64        `json:"durationMs,omitempty"`
+	Stdout     string       `json:"stdout,omitempty"`
+	Stderr     string       `json:"stderr,omitempty"`
+	Log        string       `json:"log,omitempty"`
+	Memory     *MemoryUsage `json:"memory,omitempty"`
+	Passes     []PassLog    `json:"passes,omitempty"`
+	Sarif      *SarifLog    `json:"sarif,omitempty"`
+	FullLog    string       `json:"fullLog,omitempty"`   // Complete .log, when requested
+	Errors     []LatexError `json:"errors,omitempty"`    // Parsed file:line errors, see ParseLatexErrors
+	PdfBuffer  string       `json:"pdfBuffer,omitempty"` // Base64-encoded partial PDF if available
 }
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+var (
+	pdfObjectPattern = regexp.MustCompile(`\d+\s+\d+\s+obj\b`)
+	// streamKeywordPattern matches the end of a stream object's dictionary
+	streamKeywordPattern = regexp.MustCompile(`>>\s*stream\b`)
+	// volatileEntryPattern matches the dictionary entries that change between
+	// builds of the same document: timestamps, the producer string, and /ID
+	volatileEntryPattern = regexp.MustCompile(`/(?:CreationDate|ModDate|Producer)\s*\((?:[^()\\]|\\.)*\)|/ID\s*\[[^\]]*\]`)
+	// skippedObjectPattern matches objects left out of the visual hash:
+	// cross-reference streams (byte offsets) and XMP metadata (timestamps, UUIDs)
+	skippedObjectPattern = regexp.MustCompile(`/Type\s*/(?:XRef|Metadata)\b`)
+	objStmPattern        = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	objStmFirstPattern   = regexp.MustCompile(`/First\s+(\d+)`)
+)
+
+// visualHash hashes a PDF's objects with volatile metadata normalized out, so
+// that two builds differing only in their timestamps hash the same. The
+// cross-reference tables and trailer (offsets and /ID) are not hashed, and
+// Flate-compressed object streams are inflated so the Info dictionary inside
+// them is normalized too. A real change to the content changes the hash.
+func visualHash(pdf []byte) string {
+	hasher := sha256.New()
+
+	for pos := 0; ; {
+		loc := pdfObjectPattern.FindIndex(pdf[pos:])
+		if loc == nil {
+			break
+		}
+		body, end := pdfObjectBody(pdf, pos+loc[1])
+		pos = end
+
+		dict, stream := body, []byte(nil)
+		if i := streamStart(body); i >= 0 {
+			dict, stream = body[:i], body[i:]
+		}
+		if skippedObjectPattern.Match(dict) {
+			continue
+		}
+
+		if objStmPattern.Match(dict) {
+			if objects, ok := inflateObjectStream(dict, stream); ok {
+				hasher.Write(volatileEntryPattern.ReplaceAll(objects, nil))
+				continue
+			}
+		}
+		hasher.Write(volatileEntryPattern.ReplaceAll(dict, nil))
+		hasher.Write(stream)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// pdfObjectBody returns the text from pos (just past "obj") to the matching
+// "endobj", skipping over stream data, and the offset after it
+func pdfObjectBody(pdf []byte, pos int) ([]byte, int) {
+	search := pos
+	endobj := bytes.Index(pdf[pos:], []byte("endobj"))
+	limit := len(pdf)
+	if endobj >= 0 {
+		limit = pos + endobj
+	}
+	if stream := streamStart(pdf[pos:limit]); stream >= 0 {
+		if endstream := bytes.Index(pdf[pos+stream:], []byte("endstream")); endstream >= 0 {
+			search = pos + stream + endstream
+			endobj = bytes.Index(pdf[search:], []byte("endobj"))
+		}
+	}
+	if endobj == -1 {
+		return pdf[pos:], len(pdf)
+	}
+	return pdf[pos : search+endobj], search + endobj + len("endobj")
+}
+
+// streamStart returns the offset of the "stream" keyword after an object's
+// dictionary, or -1 when the object has no stream
+func streamStart(body []byte) int {
+	loc := streamKeywordPattern.FindIndex(body)
+	if loc == nil {
+		return -1
+	}
+	return loc[1] - len("stream")
+}
+
+// inflateObjectStream returns the objects of a Flate-compressed object
+// stream without its header of object numbers and offsets, which shift when
+// an earlier object's length changes
+func inflateObjectStream(dict, stream []byte) ([]byte, bool) {
+	m := objStmFirstPattern.FindSubmatch(dict)
+	if m == nil || !bytes.Contains(dict, []byte("/FlateDecode")) {
+		return nil, false
+	}
+	first, _ := strconv.Atoi(string(m[1]))
+
+	data := bytes.TrimLeft(bytes.TrimPrefix(stream, []byte("stream")), "\r\n")
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	defer reader.Close()
+
+	objects, err := io.ReadAll(reader)
+	if err != nil && len(objects) == 0 || first > len(objects) {
+		return nil, false
+	}
+	return objects[first:], true
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeLatexmkWithTimestamp writes a PDF whose Info dictionary, /ID, and xref
+// offsets change with the build time, as pdflatex's do.
+const fakeLatexmkWithTimestamp = `job=""
+for arg; do
+	case "$arg" in
+	-jobname=*) job="${arg#-jobname=}" ;;
+	esac
+	last="$arg"
+done
+[ -n "$job" ] || job="${last%.*}"
+now=$(date +%s%N)
+cat > "$job.pdf" <<FAKEPDF
+%PDF-1.5
+1 0 obj
+<< /Type /Catalog /Pages 2 0 R >>
+endobj
+2 0 obj
+<< /Type /Pages /Kids [] /Count 0 >>
+endobj
+3 0 obj
+<< /Producer (pdfTeX-1.40.25) /CreationDate (D:$now) /ModDate (D:$now) >>
+endobj
+xref
+0 4
+0000000000 65535 f
+trailer
+<< /Size 4 /Root 1 0 R /Info 3 0 R /ID [<$now> <$now>] >>
+startxref
+$now
+%%EOF
+FAKEPDF
+echo "fake log" > "$job.log"
+`
+
+func TestVisualHashIgnoresBuildTimestamps(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithTimestamp})
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	first := New().Compile(files, time.Now(), "", CompileOptions{})
+	time.Sleep(10 * time.Millisecond)
+	second := New().Compile(files, time.Now(), "", CompileOptions{})
+	if !first.Success || !second.Success {
+		t.Fatalf("expected both compiles to succeed: %s %s", first.ErrorMessage, second.ErrorMessage)
+	}
+
+	if first.SHA256 == second.SHA256 {
+		t.Fatalf("expected the raw PDFs to differ by their timestamps")
+	}
+	if first.VisualHash == "" || first.VisualHash != second.VisualHash {
+		t.Fatalf("expected equal visual hashes, got %q and %q", first.VisualHash, second.VisualHash)
+	}
+}
+
+// objectStreamPDF stores the Info dictionary in a Flate-compressed object
+// stream, as pdfTeX does at \pdfobjcompresslevel=2.
+func objectStreamPDF(t *testing.T, date, text string) []byte {
+	t.Helper()
+
+	info := fmt.Sprintf("<< /Producer (pdfTeX) /CreationDate (D:%s) >>", date)
+	header := fmt.Sprintf("4 0 5 %d ", len(info)+1)
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	fmt.Fprintf(w, "%s%s\n<< /Type /Page >>", header, info)
+	w.Close()
+
+	var pdf bytes.Buffer
+	fmt.Fprintf(&pdf, "%%PDF-1.5\n1 0 obj\n<< /Length 20 >>\nstream\nBT (%s) Tj ET\nendstream\nendobj\n", text)
+	fmt.Fprintf(&pdf, "2 0 obj\n<< /Type /ObjStm /N 2 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", len(header), compressed.Len())
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n")
+	fmt.Fprintf(&pdf, "3 0 obj\n<< /Type /XRef /ID [<%s> <%s>] >>\nstream\n%s\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", date, date, date, pdf.Len())
+	return pdf.Bytes()
+}
+
+func TestVisualHashNormalizesObjectStreams(t *testing.T) {
+	a := visualHash(objectStreamPDF(t, "20240101120000", "Hello"))
+	b := visualHash(objectStreamPDF(t, "20250606183000", "Hello"))
+	if a != b {
+		t.Fatalf("expected compressed Info timestamps to be ignored")
+	}
+
+	if c := visualHash(objectStreamPDF(t, "20240101120000", "Hullo")); c == a {
+		t.Fatalf("expected a content change to change the visual hash")
+	}
+}
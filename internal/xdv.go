@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// xdvPath returns where xelatex -no-pdf writes its intermediate next to the PDF
+func (s *compileSession) xdvPath() string {
+	return strings.TrimSuffix(s.pdfPath, ".pdf") + ".xdv"
+}
+
+// keepsXdv reports whether this run must leave the .xdv behind; other
+// engines have no XDV stage, so the option is ignored for them
+func (s *compileSession) keepsXdv() bool {
+	if !s.options.ReturnXdv {
+		return false
+	}
+	if s.engine != engineXeLaTeX {
+		log.Printf("[%s] returnXdv ignored: engine is %s, not xelatex", s.compiler.RequestID, s.engine.command())
+		return false
+	}
+	return true
+}
+
+// readXdv returns the .xdv of an xelatex compile
+func (s *compileSession) readXdv() ([]byte, error) {
+	if s.engine != engineXeLaTeX {
+		return nil, fmt.Errorf("engine %s produces no .xdv", s.engine.command())
+	}
+	return os.ReadFile(s.xdvPath())
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const xelatexDocument = `\documentclass{article}
+\usepackage{fontspec}
+\begin{document}
+Hello from Octree!
+\end{document}`
+
+// fakeLatexmkWithXdv also writes an .xdv when latexmk runs in -pdfxe mode.
+var fakeLatexmkWithXdv = fakeLatexmkScript + `for arg; do
+	[ "$arg" = "-pdfxe" ] && printf 'xdv-data' > "$job.xdv"
+done
+`
+
+func TestCompileReturnsXdvForXelatex(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithXdv})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: xelatexDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnXdv: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if string(result.Xdv) != "xdv-data" {
+		t.Fatalf("expected the .xdv to be returned, got %q", result.Xdv)
+	}
+
+	args := readArgs()
+	found := false
+	for _, arg := range args {
+		found = found || strings.HasPrefix(arg, "-xelatex=xelatex -no-pdf ")
+	}
+	if !containsString(args, "-pdfxe") || !found {
+		t.Fatalf("expected latexmk to keep the .xdv via -pdfxe and xelatex -no-pdf, got %v", args)
+	}
+}
+
+func TestCompileIgnoresXdvForPdflatex(t *testing.T) {
+	installFakeTools(t, map[string]string{"latexmk": fakeLatexmkWithXdv})
+	readArgs := recordLatexmkArgs(t)
+
+	files := []FileEntry{{Path: "main.tex", Content: simpleDocument}}
+	result := New().Compile(files, time.Now(), "", CompileOptions{ReturnXdv: true})
+	if !result.Success {
+		t.Fatalf("expected compile to succeed, got: %s", result.ErrorMessage)
+	}
+	if result.Xdv != nil || containsString(readArgs(), "-pdfxe") {
+		t.Fatalf("pdflatex compiles have no .xdv to return")
+	}
+}
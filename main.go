@@ -3,21 +3,29 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/octree/latex-compile/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"google.golang.org/grpc"
 )
 
 const (
-	DefaultPort           = "3001"
-	MaxConcurrentRequests = 2
-	CompilationTimeout    = 60 * time.Second
-	ShutdownTimeout       = 60 * time.Second
+	DefaultPort        = "3001"
+	DefaultWorkerCount = 2
+	MaxWorkerCount     = 64   // Upper clamp for WORKER_COUNT
+	MaxQueueCapacity   = 1024 // Upper clamp for QUEUE_CAPACITY
+	CompilationTimeout = 60 * time.Second
+	ShutdownTimeout    = 60 * time.Second
 )
 
 var requestQueue chan *internal.CompileJob
@@ -42,17 +50,97 @@ func main() {
 	// Set history dir for compiler
 	internal.SetHistoryDir(historyDir)
 
+	// Fixed workspace path per project instead of a random one, for debugging
+	internal.SetStableTempDirs(os.Getenv("STABLE_TEMP_DIRS") == "true")
+
+	// Permissions for workspace files and directories (e.g. 0640 / 0750)
+	if err := internal.SetFileModes(os.Getenv("FILE_MODE"), os.Getenv("DIR_MODE")); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Engine for documents that load fontspec & co. but nothing XeTeX- or
+	// LuaTeX-specific (xelatex or lualatex)
+	if err := internal.SetPreferredUnicodeEngine(os.Getenv("PREFERRED_UNICODE_ENGINE")); err != nil {
+		log.Fatalf("Invalid PREFERRED_UNICODE_ENGINE: %v", err)
+	}
+
+	// Extra root document extensions besides .tex, .ltx and .latex
+	internal.SetExtraMainFileExtensions(envList("MAIN_FILE_EXTENSIONS"))
+
+	// Directories of private packages added to TEXINPUTS
+	if err := internal.SetExtraTexInputs(envList("EXTRA_TEXINPUTS")); err != nil {
+		log.Fatalf("Invalid EXTRA_TEXINPUTS: %v", err)
+	}
+
+	// Pre-compile limits (0 = unlimited)
+	internal.SetMaxGraphicsInclusions(envInt("MAX_GRAPHICS_INCLUSIONS", 0))
+	internal.SetDeniedPackages(envList("DENIED_PACKAGES"))
+	internal.SetSafeMode(os.Getenv("SAFE_MODE") == "true")
+
+	// File types requests may carry (empty = any); others are rejected, or
+	// dropped when SKIP_DISALLOWED_FILES=true
+	internal.SetAllowedFileExtensions(envList("ALLOWED_FILE_EXTENSIONS"), os.Getenv("SKIP_DISALLOWED_FILES") == "true")
+
+	// texmf.cnf memory overrides for the toolchain, e.g. extra_mem_top=10000000
+	if err := internal.SetTeXMemoryOverrides(envList("TEX_MEMORY_PARAMS")); err != nil {
+		log.Fatalf("Invalid TEX_MEMORY_PARAMS: %v", err)
+	}
+
+	// Longest a compile's toolchain may run before it is killed (0 = unlimited)
+	internal.SetCompilationTimeout(envDuration("COMPILE_TIMEOUT", CompilationTimeout))
+
+	// CPU-time budget of each compile, in seconds (0 = unlimited)
+	internal.SetMaxCpuSeconds(envInt("MAX_CPU_SECONDS", 0))
+
+	// Per-client share of the project cache (0 = no cap)
+	internal.SetMaxCachedProjectsPerClient(envInt("MAX_CACHED_PROJECTS_PER_CLIENT", 0))
+
+	// Variables requests may set for their compile subprocesses via "env"
+	internal.SetAllowedEnvVars(envList("ALLOWED_ENV_VARS"))
+
+	// Hosts allowed to receive async compile callbacks (empty = callbacks disabled)
+	internal.SetCallbackAllowedHosts(envList("CALLBACK_ALLOWED_HOSTS"))
+
+	// Expected fixture PDF hash for /selftest (empty = only check success)
+	internal.SetSelfTestExpectedSHA256(os.Getenv("SELFTEST_SHA256"))
+
+	// Bearer token for admin endpoints such as GET /queue (empty = disabled)
+	internal.SetAdminToken(os.Getenv("ADMIN_TOKEN"))
+
+	// Overall wait for a compile result before answering 503 (0 = unlimited)
+	internal.SetMaxQueueWait(envDuration("MAX_QUEUE_WAIT", 0))
+
+	// Compiles queued per minute across all clients (0 = unlimited), and how
+	// many may be queued back to back
+	internal.SetGlobalRateLimit(envInt("GLOBAL_RATE_LIMIT_RPM", 0), envInt("GLOBAL_RATE_LIMIT_BURST", 1))
+
+	// Worker pool and queue size; the queue defaults to two slots per worker
+	workerCount := envPositiveInt("WORKER_COUNT", DefaultWorkerCount, MaxWorkerCount)
+	queueCapacity := envPositiveInt("QUEUE_CAPACITY", workerCount*2, MaxQueueCapacity)
+	internal.SetWorkerCount(workerCount)
+
 	// Initialize request queue
-	requestQueue = make(chan *internal.CompileJob, MaxConcurrentRequests*2)
+	requestQueue = make(chan *internal.CompileJob, queueCapacity)
 	internal.SetRequestQueue(requestQueue)
 
 	// Start workers
-	for i := 0; i < MaxConcurrentRequests; i++ {
+	for i := 0; i < workerCount; i++ {
 		go worker(i)
 	}
 
+	// Prometheus registry for GET /metrics: compile metrics plus the Go
+	// runtime and process collectors
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if err := internal.RegisterMetrics(registry); err != nil {
+		log.Fatalf("Failed to register metrics: %v", err)
+	}
+
 	// Setup router
-	router := setupRouter()
+	router := setupRouter(registry)
 
 	// Create server
 	srv := &http.Server{
@@ -66,13 +154,30 @@ func main() {
 	// Start server in goroutine
 	go func() {
 		log.Printf("LaTeX compilation server starting on port %s", port)
-		log.Printf("Max concurrent requests: %d", MaxConcurrentRequests)
+		log.Printf("Workers: %d, queue capacity: %d", workerCount, queueCapacity)
 		log.Printf("Health check: http://localhost:%s/health", port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
 
+	// Start gRPC server alongside HTTP when configured
+	var grpcServer *grpc.Server
+	if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+		listener, err := net.Listen("tcp", ":"+grpcPort)
+		if err != nil {
+			log.Fatalf("gRPC server failed to listen: %v", err)
+		}
+
+		grpcServer = internal.NewGRPCServer()
+		go func() {
+			log.Printf("gRPC compilation server starting on port %s", grpcPort)
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatalf("gRPC server failed: %v", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -84,6 +189,10 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
 	defer cancel()
 
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
@@ -91,7 +200,70 @@ func main() {
 	log.Println("Server exited")
 }
 
-func setupRouter() *gin.Engine {
+// envInt reads a non-negative integer from the environment, falling back to
+// def when the variable is unset or invalid
+func envInt(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		log.Printf("Warning: invalid %s=%q, using default %d", key, raw, def)
+		return def
+	}
+	return value
+}
+
+// envPositiveInt reads a positive integer from the environment, falling back
+// to def when the variable is unset or invalid and clamping it to limit
+func envPositiveInt(key string, def, limit int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Printf("Warning: invalid %s=%q, using default %d", key, raw, def)
+		return def
+	}
+	if value > limit {
+		log.Printf("Warning: %s=%d exceeds the maximum, using %d", key, value, limit)
+		return limit
+	}
+	return value
+}
+
+// envDuration reads a non-negative duration such as "45s" or "2m" from the
+// environment, falling back to def when unset or invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil || value < 0 {
+		log.Printf("Warning: invalid %s=%q, using default %s", key, raw, def)
+		return def
+	}
+	return value
+}
+
+// envList reads a comma-separated list from the environment
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func setupRouter(registry *prometheus.Registry) *gin.Engine {
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "" {
 		gin.SetMode(gin.ReleaseMode)
@@ -99,12 +271,35 @@ func setupRouter() *gin.Engine {
 
 	router := gin.Default()
 
+	// Proxies whose X-Forwarded-For is trusted for the client IP (empty = none)
+	if err := internal.ConfigureTrustedProxies(router, envList("TRUSTED_PROXIES")); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS middleware
 	router.Use(corsMiddleware())
 
 	// Routes
 	router.GET("/health", internal.HealthHandler)
+	router.GET("/ready", internal.ReadyHandler)
+	router.GET("/selftest", internal.SelfTestHandler)
+	router.GET("/metrics", internal.MetricsHandler(registry))
 	router.POST("/compile", internal.CompileHandler)
+	router.POST("/compile/stream", internal.CompileStreamHandler)
+	router.GET("/compile/:requestId/progress", internal.CompileProgressHandler)
+	router.POST("/render", internal.RenderHandler)
+	router.POST("/table/extract", internal.TableExtractHandler)
+	router.POST("/metadata/extract", internal.MetadataExtractHandler)
+	router.POST("/citations/check", internal.CitationCheckHandler)
+	router.POST("/validate-bib", internal.BibValidationHandler)
+	router.POST("/detex", internal.DetexHandler)
+
+	// Operator endpoints; they expose or change any tenant's projects
+	admin := router.Group("/", internal.RequireAdmin)
+	admin.GET("/cache/stats", internal.CacheStatsHandler)
+	admin.GET("/queue", internal.QueueHandler)
+	admin.GET("/history/project/:projectId", internal.ProjectHistoryHandler)
+	admin.POST("/clean/:projectId", internal.CleanHandler)
 
 	return router
 }